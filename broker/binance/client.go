@@ -3,6 +3,7 @@ package binance
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
@@ -14,12 +15,25 @@ import (
 
 const FLAG_USE_TESTNET = true
 
+const (
+	restMainURL    = "https://fapi.binance.com"
+	restTestnetURL = "https://testnet.binancefuture.com"
+)
+
+// maxBatchOrders is the most orders the batch endpoint accepts in one request
+const maxBatchOrders = 5
+
 // Client represents a Binance futures broker client
 type Client struct {
 	name        string
 	client      *futures.Client
+	market      *futures.Client // Public market data of clients without credentials
 	credentials *broker.Credentials
 	connected   bool
+
+	// User data stream
+	wsURL     string
+	keepalive time.Duration
 }
 
 // NewClient creates a new Binance futures client
@@ -27,9 +41,26 @@ func NewClient() broker.Broker {
 	return &Client{
 		name:      "binance",
 		connected: false,
+		market:    newMarketClient("binance"),
 	}
 }
 
+// restURL returns the base endpoint of the futures REST API
+func restURL(testnet bool) string {
+	if testnet {
+		return restTestnetURL
+	}
+	return restMainURL
+}
+
+// newMarketClient creates a client for public market data, which needs no credentials
+func newMarketClient(name string) *futures.Client {
+	client := futures.NewClient("", "")
+	client.BaseURL = restURL(FLAG_USE_TESTNET)
+	client.HTTPClient = &http.Client{Transport: newRateLimitedTransport(name, "")}
+	return client
+}
+
 // Name returns the broker name
 func (c *Client) Name() string {
 	return c.name
@@ -48,6 +79,8 @@ func (c *Client) Initialize(ctx context.Context, credentials *broker.Credentials
 	c.credentials = credentials
 	binance.UseTestnet = FLAG_USE_TESTNET
 	c.client = binance.NewFuturesClient(credentials.APIKey, credentials.SecretKey)
+	c.client.HTTPClient = &http.Client{Transport: newRateLimitedTransport(c.name, credentials.APIKey)}
+	c.wsURL = userStreamURL(FLAG_USE_TESTNET)
 
 	// Test connection
 	if err := c.TestConnection(ctx); err != nil {
@@ -254,6 +287,78 @@ func (c *Client) PlaceOrder(ctx context.Context, req *broker.OrderRequest) (*bro
 		return nil, err
 	}
 
+	order, err := c.newOrderService(req).Do(ctx)
+	if err != nil {
+		return nil, broker.NewBrokerError(c.name, "ORDER_FAILED", "Failed to place order", err)
+	}
+
+	return convertBinanceOrder(order), nil
+}
+
+// PlaceOrders places orders through the batch endpoint, up to maxBatchOrders per request. Invalid
+// requests are rejected without being sent, and every order of a request that fails as a whole
+// gets its error.
+func (c *Client) PlaceOrders(ctx context.Context, reqs []*broker.OrderRequest) ([]broker.BatchOrderResult, error) {
+	if !c.connected {
+		return nil, broker.ErrNotConnected
+	}
+
+	results := make([]broker.BatchOrderResult, len(reqs))
+	var batch []int
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		defer func() { batch = batch[:0] }()
+
+		services := make([]*futures.CreateOrderService, len(batch))
+		for i, index := range batch {
+			services[i] = c.newOrderService(reqs[index])
+		}
+		res, err := c.client.NewCreateBatchOrdersService().OrderList(services).Do(ctx)
+		if err != nil {
+			for _, index := range batch {
+				results[index].Err = broker.NewBrokerError(c.name, "ORDER_FAILED", "Failed to place batch orders", err)
+			}
+			return
+		}
+
+		// Placed orders are listed without the rejected ones
+		placed := 0
+		for i, index := range batch {
+			if i < len(res.Errors) && res.Errors[i] != nil {
+				results[index].Err = broker.NewBrokerError(c.name, "ORDER_FAILED", "Failed to place order", res.Errors[i])
+				continue
+			}
+			if placed >= len(res.Orders) {
+				results[index].Err = broker.NewBrokerError(c.name, "ORDER_FAILED", "No response for batch order", nil)
+				continue
+			}
+			order := convertBinanceOrderFromGet(res.Orders[placed])
+			if res.Orders[placed].Time == 0 {
+				order.CreatedAt = order.UpdatedAt
+			}
+			results[index].Order = order
+			placed++
+		}
+	}
+
+	for i, req := range reqs {
+		if err := broker.ValidateOrderRequest(req); err != nil {
+			results[i].Err = err
+			continue
+		}
+		batch = append(batch, i)
+		if len(batch) == maxBatchOrders {
+			flush()
+		}
+	}
+	flush()
+	return results, nil
+}
+
+// newOrderService builds the order service of a request
+func (c *Client) newOrderService(req *broker.OrderRequest) *futures.CreateOrderService {
 	service := c.client.NewCreateOrderService().
 		Symbol(req.Symbol).
 		Side(convertToBinanceSide(req.Side)).
@@ -281,13 +386,7 @@ func (c *Client) PlaceOrder(ctx context.Context, req *broker.OrderRequest) (*bro
 	if req.ReduceOnly {
 		service = service.ReduceOnly(req.ReduceOnly)
 	}
-
-	order, err := service.Do(ctx)
-	if err != nil {
-		return nil, broker.NewBrokerError(c.name, "ORDER_FAILED", "Failed to place order", err)
-	}
-
-	return convertBinanceOrder(order), nil
+	return service
 }
 
 // GetOrder retrieves an order by ID
@@ -384,13 +483,68 @@ func (c *Client) GetOrderHistory(ctx context.Context, symbol string, limit int)
 	return result, nil
 }
 
-// GetSymbolInfo retrieves symbol information
-func (c *Client) GetSymbolInfo(ctx context.Context, symbol string) (*broker.SymbolInfo, error) {
+// GetOrderFills retrieves the trades that filled an order
+func (c *Client) GetOrderFills(ctx context.Context, symbol string, orderID string) ([]broker.Fill, error) {
 	if !c.connected {
 		return nil, broker.ErrNotConnected
 	}
 
-	exchangeInfo, err := c.client.NewExchangeInfoService().Do(ctx)
+	id, err := strconv.ParseInt(orderID, 10, 64)
+	if err != nil {
+		return nil, broker.NewBrokerError(c.name, "INVALID_ORDER_ID", "Invalid order ID", err)
+	}
+
+	trades, err := c.client.NewListAccountTradeService().
+		Symbol(symbol).
+		OrderID(id).
+		Do(ctx)
+	if err != nil {
+		return nil, broker.NewBrokerError(c.name, "ORDER_FILLS_FAILED", "Failed to get order fills", err)
+	}
+
+	var result []broker.Fill
+	for _, trade := range trades {
+		result = append(result, convertBinanceTrade(trade))
+	}
+
+	return result, nil
+}
+
+// GetIncome retrieves the income records of a type since a point in time, at most 1000 per call
+func (c *Client) GetIncome(ctx context.Context, incomeType broker.IncomeType, since time.Time) ([]broker.Income, error) {
+	if !c.connected {
+		return nil, broker.ErrNotConnected
+	}
+
+	service := c.client.NewGetIncomeHistoryService().Limit(1000)
+	if incomeType != "" {
+		service = service.IncomeType(string(incomeType))
+	}
+	if !since.IsZero() {
+		service = service.StartTime(since.UnixMilli())
+	}
+
+	history, err := service.Do(ctx)
+	if err != nil {
+		return nil, broker.NewBrokerError(c.name, "INCOME_HISTORY_FAILED", "Failed to get income history", err)
+	}
+
+	result := make([]broker.Income, 0, len(history))
+	for _, income := range history {
+		result = append(result, convertBinanceIncome(income))
+	}
+	return result, nil
+}
+
+// GetSymbolInfo retrieves symbol information. Like GetExchangeInfo it is public and also works
+// before the client is initialized.
+func (c *Client) GetSymbolInfo(ctx context.Context, symbol string) (*broker.SymbolInfo, error) {
+	client := c.marketClient()
+	if client == nil {
+		return nil, broker.ErrNotConnected
+	}
+
+	exchangeInfo, err := client.NewExchangeInfoService().Do(ctx)
 	if err != nil {
 		return nil, broker.NewBrokerError(c.name, "EXCHANGE_INFO_FAILED", "Failed to get exchange info", err)
 	}
@@ -406,11 +560,12 @@ func (c *Client) GetSymbolInfo(ctx context.Context, symbol string) (*broker.Symb
 
 // GetExchangeInfo retrieves exchange information
 func (c *Client) GetExchangeInfo(ctx context.Context) ([]broker.SymbolInfo, error) {
-	if !c.connected {
+	client := c.marketClient()
+	if client == nil {
 		return nil, broker.ErrNotConnected
 	}
 
-	exchangeInfo, err := c.client.NewExchangeInfoService().Do(ctx)
+	exchangeInfo, err := client.NewExchangeInfoService().Do(ctx)
 	if err != nil {
 		return nil, broker.NewBrokerError(c.name, "EXCHANGE_INFO_FAILED", "Failed to get exchange info", err)
 	}
@@ -423,6 +578,15 @@ func (c *Client) GetExchangeInfo(ctx context.Context) ([]broker.SymbolInfo, erro
 	return result, nil
 }
 
+// marketClient returns the client for public market data: the initialized client, or the client
+// without credentials before initialization
+func (c *Client) marketClient() *futures.Client {
+	if c.client != nil {
+		return c.client
+	}
+	return c.market
+}
+
 // IsConnected returns connection status
 func (c *Client) IsConnected() bool {
 	return c.connected
@@ -508,10 +672,11 @@ func convertBinanceOrder(order *futures.CreateOrderResponse) *broker.Order {
 		Symbol:           order.Symbol,
 		Side:             convertFromBinanceSide(order.Side),
 		Type:             convertFromBinanceOrderType(order.Type),
-		Quantity:         "0", // Will be filled from actual API response
+		Quantity:         order.OrigQuantity,
 		Price:            order.Price,
-		ExecutedQuantity: "0", // Will be filled from actual API response
-		CumulativeQuote:  "0", // Will be filled from actual API response
+		ExecutedQuantity: order.ExecutedQuantity,
+		CumulativeQuote:  order.CumQuote,
+		AvgPrice:         order.AvgPrice,
 		Status:           convertBinanceOrderStatus(order.Status),
 		TimeInForce:      string(order.TimeInForce),
 		PositionSide:     convertPositionSideFromString(string(order.PositionSide)),
@@ -528,10 +693,11 @@ func convertBinanceOrderFromGet(order *futures.Order) *broker.Order {
 		Symbol:           order.Symbol,
 		Side:             convertFromBinanceSide(order.Side),
 		Type:             convertFromBinanceOrderType(order.Type),
-		Quantity:         "0", // Will be filled from actual API response
+		Quantity:         order.OrigQuantity,
 		Price:            order.Price,
-		ExecutedQuantity: "0", // Will be filled from actual API response
-		CumulativeQuote:  "0", // Will be filled from actual API response
+		ExecutedQuantity: order.ExecutedQuantity,
+		CumulativeQuote:  order.CumQuote,
+		AvgPrice:         order.AvgPrice,
 		Status:           convertBinanceOrderStatus(order.Status),
 		TimeInForce:      string(order.TimeInForce),
 		PositionSide:     convertPositionSideFromString(string(order.PositionSide)),
@@ -541,6 +707,36 @@ func convertBinanceOrderFromGet(order *futures.Order) *broker.Order {
 	}
 }
 
+func convertBinanceTrade(trade *futures.AccountTrade) broker.Fill {
+	return broker.Fill{
+		ID:              strconv.FormatInt(trade.ID, 10),
+		OrderID:         strconv.FormatInt(trade.OrderID, 10),
+		Symbol:          trade.Symbol,
+		Side:            convertFromBinanceSide(trade.Side),
+		PositionSide:    convertPositionSideFromString(string(trade.PositionSide)),
+		Price:           trade.Price,
+		Quantity:        trade.Quantity,
+		QuoteQuantity:   trade.QuoteQuantity,
+		Commission:      trade.Commission,
+		CommissionAsset: trade.CommissionAsset,
+		RealizedPnL:     trade.RealizedPnl,
+		Maker:           trade.Maker,
+		Time:            time.UnixMilli(trade.Time),
+	}
+}
+
+func convertBinanceIncome(income *futures.IncomeHistory) broker.Income {
+	return broker.Income{
+		ID:      strconv.FormatInt(income.TranID, 10),
+		Symbol:  income.Symbol,
+		Type:    broker.IncomeType(income.IncomeType),
+		Amount:  income.Income,
+		Asset:   income.Asset,
+		TradeID: income.TradeID,
+		Time:    time.UnixMilli(income.Time),
+	}
+}
+
 func convertFromBinanceSide(side futures.SideType) broker.OrderSide {
 	switch side {
 	case futures.SideTypeBuy:
@@ -636,4 +832,5 @@ func convertBinanceSymbolInfo(s *futures.Symbol) *broker.SymbolInfo {
 // Register the Binance broker
 func init() {
 	broker.Register("binance", NewClient)
+	broker.RegisterRateLimits("binance", rateLimits...)
 }
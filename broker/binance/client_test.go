@@ -2,6 +2,11 @@ package binance
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,6 +22,9 @@ func TestNewClient(t *testing.T) {
 	assert.NotNil(t, client)
 	assert.Equal(t, "binance", client.Name())
 	assert.False(t, client.IsConnected())
+
+	// Public market data goes to the endpoint of the configured network without a global switch
+	assert.Equal(t, restURL(FLAG_USE_TESTNET), client.(*Client).market.BaseURL)
 }
 
 func TestClientInitialize(t *testing.T) {
@@ -203,3 +211,144 @@ func TestBinanceIntegration(t *testing.T) {
 	assert.NoError(t, err)
 	assert.False(t, client.IsConnected())
 }
+
+func TestOrderConversionKeepsFillDetails(t *testing.T) {
+	order := convertBinanceOrderFromGet(&futures.Order{
+		OrderID:          42,
+		Symbol:           "BTCUSDT",
+		Side:             futures.SideTypeBuy,
+		Type:             futures.OrderTypeMarket,
+		OrigQuantity:     "0.010",
+		ExecutedQuantity: "0.010",
+		CumQuote:         "420.5",
+		AvgPrice:         "42050",
+		Status:           futures.OrderStatusTypeFilled,
+	})
+	assert.Equal(t, "42", order.ID)
+	assert.Equal(t, "0.010", order.Quantity)
+	assert.Equal(t, "0.010", order.ExecutedQuantity)
+	assert.Equal(t, "420.5", order.CumulativeQuote)
+	assert.Equal(t, "42050", order.AvgPrice)
+	assert.Equal(t, broker.OrderStatusFilled, order.Status)
+
+	fill := convertBinanceTrade(&futures.AccountTrade{
+		ID:              7,
+		OrderID:         42,
+		Symbol:          "BTCUSDT",
+		Side:            futures.SideTypeSell,
+		Price:           "42050",
+		Quantity:        "0.010",
+		Commission:      "0.168",
+		CommissionAsset: "USDT",
+		RealizedPnl:     "12.5",
+		Time:            1700000000000,
+	})
+	assert.Equal(t, "42", fill.OrderID)
+	assert.Equal(t, broker.OrderSideSell, fill.Side)
+	assert.Equal(t, "0.168", fill.Commission)
+	assert.Equal(t, "12.5", fill.RealizedPnL)
+	assert.Equal(t, int64(1700000000), fill.Time.Unix())
+}
+
+func TestIncomeConversion(t *testing.T) {
+	_, ok := NewClient().(broker.IncomeReporter)
+	assert.True(t, ok)
+
+	income := convertBinanceIncome(&futures.IncomeHistory{
+		Asset:      "USDT",
+		Income:     "-0.0421",
+		IncomeType: "FUNDING_FEE",
+		Symbol:     "BTCUSDT",
+		Time:       1700000000000,
+		TranID:     9689322392,
+	})
+	assert.Equal(t, "9689322392", income.ID)
+	assert.Equal(t, broker.IncomeTypeFundingFee, income.Type)
+	assert.Equal(t, "-0.0421", income.Amount)
+	assert.Equal(t, "BTCUSDT", income.Symbol)
+	assert.Equal(t, int64(1700000000), income.Time.Unix())
+}
+
+func TestPlaceOrdersInBatches(t *testing.T) {
+	_, ok := NewClient().(broker.BatchOrderPlacer)
+	assert.True(t, ok)
+
+	var batches [][]map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/fapi/v1/batchOrders", r.URL.Path)
+		require.NoError(t, r.ParseForm())
+		var orders []map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(r.Form.Get("batchOrders")), &orders))
+		batches = append(batches, orders)
+
+		// The third order of the first batch is rejected
+		var response []string
+		for i, order := range orders {
+			if len(batches) == 1 && i == 2 {
+				response = append(response, `{"code":-2019,"msg":"Margin is insufficient."}`)
+				continue
+			}
+			response = append(response, fmt.Sprintf(`{"orderId":%d,"symbol":"%s","side":"%s","type":"%s","origQty":"%s","price":"%v","status":"NEW","updateTime":1700000000000}`,
+				len(batches)*10+i, order["symbol"], order["side"], order["type"], order["quantity"], order["price"]))
+		}
+		w.Write([]byte("[" + strings.Join(response, ",") + "]"))
+	}))
+	t.Cleanup(server.Close)
+
+	futuresClient := futures.NewClient("key", "secret")
+	futuresClient.BaseURL = server.URL
+	client := &Client{name: "binance", client: futuresClient, connected: true}
+
+	var reqs []*broker.OrderRequest
+	for i := 0; i < 6; i++ {
+		reqs = append(reqs, &broker.OrderRequest{Symbol: "BTCUSDT", Side: broker.OrderSideSell, Type: broker.OrderTypeLimit, Quantity: "0.1", Price: fmt.Sprint(50000 + i*100), ReduceOnly: true})
+	}
+	reqs = append(reqs, &broker.OrderRequest{Symbol: "BTCUSDT", Side: broker.OrderSideBuy, Type: broker.OrderTypeLimit, Quantity: "0.1"})
+
+	results, err := client.PlaceOrders(context.Background(), reqs)
+	require.NoError(t, err)
+	require.Len(t, results, 7)
+
+	// Five orders fit in one request
+	require.Len(t, batches, 2)
+	assert.Len(t, batches[0], 5)
+	assert.Len(t, batches[1], 1)
+	assert.Equal(t, "true", batches[0][0]["reduceOnly"])
+	assert.Equal(t, "GTC", batches[0][0]["timeInForce"])
+
+	// Results line up with the requests around the rejected orders
+	assert.Equal(t, "10", results[0].Order.ID)
+	assert.Equal(t, "50100", results[1].Order.Price)
+	assert.Nil(t, results[2].Order)
+	assert.ErrorContains(t, results[2].Err, "Margin is insufficient")
+	assert.Equal(t, "13", results[3].Order.ID)
+	assert.Equal(t, "50300", results[3].Order.Price)
+	assert.Equal(t, "20", results[5].Order.ID)
+	assert.Equal(t, broker.OrderStatusNew, results[5].Order.Status)
+	assert.ErrorIs(t, results[6].Err, broker.ErrInvalidPrice)
+}
+
+func TestSymbolInfoWithoutCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/fapi/v1/exchangeInfo", r.URL.Path)
+		assert.Empty(t, r.Header.Get("X-MBX-APIKEY"))
+		w.Write([]byte(`{"symbols":[{"symbol":"BTCUSDT","status":"TRADING","baseAsset":"BTC","quoteAsset":"USDT","orderType":["LIMIT","MARKET"],"filters":[
+			{"filterType":"PRICE_FILTER","minPrice":"0.10","maxPrice":"1000000","tickSize":"0.10"},
+			{"filterType":"LOT_SIZE","minQty":"0.001","maxQty":"1000","stepSize":"0.001"}]}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	// The exchange info is public, so an uninitialized client serves it
+	market := futures.NewClient("", "")
+	market.BaseURL = server.URL
+	client := &Client{name: "binance", market: market}
+
+	info, err := client.GetSymbolInfo(context.Background(), "BTCUSDT")
+	require.NoError(t, err)
+	assert.Equal(t, "0.001", info.StepSize)
+	assert.Equal(t, "0.10", info.TickSize)
+	assert.False(t, client.IsConnected())
+
+	_, err = client.GetSymbolInfo(context.Background(), "ETHUSDT")
+	assert.ErrorIs(t, err, broker.ErrInvalidSymbol)
+}
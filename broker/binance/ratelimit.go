@@ -0,0 +1,123 @@
+package binance
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+)
+
+// Limits of Binance futures, as reported in the rateLimits of exchangeInfo
+const (
+	limitRequestWeight = "REQUEST_WEIGHT_1M"
+	limitOrders10s     = "ORDERS_10S"
+	limitOrders1m      = "ORDERS_1M"
+)
+
+// defaultBanBackoff is how long to back off after a 429 or 418 without a Retry-After header
+const defaultBanBackoff = time.Minute
+
+// rateLimits are the request budgets of a Binance futures API key
+var rateLimits = []broker.RateLimit{
+	{Name: limitRequestWeight, Limit: 2400, Window: time.Minute},
+	{Name: limitOrders10s, Limit: 300, Window: 10 * time.Second},
+	{Name: limitOrders1m, Limit: 1200, Window: time.Minute},
+}
+
+// endpointWeights are the request weights of the endpoints that weigh more than 1
+var endpointWeights = map[string]int{
+	"GET /fapi/v2/account":           5,
+	"GET /fapi/v2/balance":           5,
+	"GET /fapi/v2/positionRisk":      5,
+	"GET /fapi/v1/allOrders":         5,
+	"GET /fapi/v1/userTrades":        5,
+	"GET /fapi/v1/income":            30,
+	"GET /fapi/v1/positionSide/dual": 30,
+}
+
+// usageHeaders map the usage Binance reports on every response to the limits they count
+var usageHeaders = map[string]string{
+	"X-MBX-USED-WEIGHT-1M":  limitRequestWeight,
+	"X-MBX-ORDER-COUNT-10S": limitOrders10s,
+	"X-MBX-ORDER-COUNT-1M":  limitOrders1m,
+}
+
+// rateLimitedTransport applies the weight of every request to the limiter of its API key,
+// keeps the limiter in sync with the usage reported by Binance and backs off after bans
+type rateLimitedTransport struct {
+	name    string
+	base    http.RoundTripper
+	limiter *broker.RateLimiter
+}
+
+// newRateLimitedTransport returns a transport using the shared limiter of an API key
+func newRateLimitedTransport(name, apiKey string) *rateLimitedTransport {
+	return &rateLimitedTransport{
+		name:    name,
+		base:    http.DefaultTransport,
+		limiter: broker.RateLimiterFor(name, apiKey),
+	}
+}
+
+// RoundTrip waits for capacity, sends the request and records the reported usage
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Acquire(req.Context(), requestCosts(req)...); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for header, limit := range usageHeaders {
+		if used, err := strconv.Atoi(resp.Header.Get(header)); err == nil {
+			t.limiter.Observe(limit, used)
+		}
+	}
+
+	// 429 warns that a limit was exceeded, 418 is an IP ban after ignoring it
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusTeapot {
+		resp.Body.Close()
+
+		until := time.Now().Add(retryAfter(resp))
+		broker.Ban(t.name, until)
+		return nil, fmt.Errorf("%w: HTTP %d from %s, backing off until %s",
+			broker.ErrRateLimited, resp.StatusCode, t.name, until.Format(time.RFC3339))
+	}
+
+	return resp, nil
+}
+
+// requestCosts returns what a request consumes of each limit
+func requestCosts(req *http.Request) []broker.RateCost {
+	weight, exists := endpointWeights[req.Method+" "+req.URL.Path]
+	if !exists {
+		weight = 1
+	}
+	// Open orders of all symbols weigh 40
+	if req.URL.Path == "/fapi/v1/openOrders" && req.URL.Query().Get("symbol") == "" {
+		weight = 40
+	}
+
+	costs := []broker.RateCost{{Limit: limitRequestWeight, Amount: weight}}
+
+	// New orders also count against the order limits
+	if req.Method == http.MethodPost && (req.URL.Path == "/fapi/v1/order" || req.URL.Path == "/fapi/v1/batchOrders") {
+		costs = append(costs,
+			broker.RateCost{Limit: limitOrders10s, Amount: 1},
+			broker.RateCost{Limit: limitOrders1m, Amount: 1},
+		)
+	}
+	return costs
+}
+
+// retryAfter returns how long Binance asked to back off
+func retryAfter(resp *http.Response) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultBanBackoff
+}
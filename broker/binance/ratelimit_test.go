@@ -0,0 +1,137 @@
+package binance
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTransport creates a transport with its own limiter so bans do not leak between tests
+func newTestTransport(t *testing.T) *rateLimitedTransport {
+	t.Helper()
+
+	name := "binance-" + t.Name()
+	return &rateLimitedTransport{
+		name:    name,
+		base:    http.DefaultTransport,
+		limiter: broker.NewRateLimiter(name, rateLimits...),
+	}
+}
+
+func TestRequestCosts(t *testing.T) {
+	tests := []struct {
+		method string
+		url    string
+		want   []broker.RateCost
+	}{
+		{http.MethodGet, "/fapi/v1/ping", []broker.RateCost{{Limit: limitRequestWeight, Amount: 1}}},
+		{http.MethodGet, "/fapi/v2/account", []broker.RateCost{{Limit: limitRequestWeight, Amount: 5}}},
+		{http.MethodGet, "/fapi/v1/openOrders?symbol=BTCUSDT", []broker.RateCost{{Limit: limitRequestWeight, Amount: 1}}},
+		{http.MethodGet, "/fapi/v1/openOrders", []broker.RateCost{{Limit: limitRequestWeight, Amount: 40}}},
+		{http.MethodPost, "/fapi/v1/order", []broker.RateCost{
+			{Limit: limitRequestWeight, Amount: 1},
+			{Limit: limitOrders10s, Amount: 1},
+			{Limit: limitOrders1m, Amount: 1},
+		}},
+		{http.MethodDelete, "/fapi/v1/order", []broker.RateCost{{Limit: limitRequestWeight, Amount: 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.url, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			assert.Equal(t, tt.want, requestCosts(req))
+		})
+	}
+}
+
+func TestRateLimitedTransportTracksUsedWeight(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Another process using the same key has almost exhausted the weight
+		w.Header().Set("X-MBX-USED-WEIGHT-1M", "2398")
+		w.Header().Set("X-MBX-ORDER-COUNT-10S", "3")
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	transport := newTestTransport(t)
+	transport.limiter.SetMaxWait(0)
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Get(server.URL + "/fapi/v1/ping")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	usage := transport.limiter.Usage()
+	assert.Equal(t, 2398, usage[limitRequestWeight])
+	assert.Equal(t, 3, usage[limitOrders10s])
+
+	// A cheap request still fits, an expensive one has to wait for the next window
+	resp, err = client.Get(server.URL + "/fapi/v1/ping")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	_, err = client.Get(server.URL + "/fapi/v2/account")
+	assert.True(t, errors.Is(err, broker.ErrRateLimited))
+}
+
+func TestRateLimitedTransportBacksOffAfterBan(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer server.Close()
+
+	transport := newTestTransport(t)
+	client := &http.Client{Transport: transport}
+
+	_, err := client.Get(server.URL + "/fapi/v1/ping")
+	assert.True(t, errors.Is(err, broker.ErrRateLimited))
+	assert.WithinDuration(t, time.Now().Add(2*time.Minute), broker.BannedUntil(transport.name), 5*time.Second)
+
+	// Every key of the broker backs off without contacting the exchange
+	other := &http.Client{Transport: &rateLimitedTransport{
+		name:    transport.name,
+		base:    http.DefaultTransport,
+		limiter: broker.NewRateLimiter(transport.name, rateLimits...),
+	}}
+	_, err = other.Get(server.URL + "/fapi/v1/ping")
+	assert.True(t, errors.Is(err, broker.ErrRateLimited))
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestRateLimiterQueuesRequests(t *testing.T) {
+	limiter := broker.NewRateLimiter("queue-test", broker.RateLimit{Name: "ORDERS", Limit: 2, Window: 200 * time.Millisecond})
+	cost := broker.RateCost{Limit: "ORDERS", Amount: 1}
+
+	// Start right after a window boundary so the first two requests share a window
+	time.Sleep(time.Until(time.Now().Truncate(200 * time.Millisecond).Add(200 * time.Millisecond)))
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, limiter.Acquire(context.Background(), cost))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+
+	// The minimum interval spaces consecutive requests
+	limiter.SetMinInterval(50 * time.Millisecond)
+	start = time.Now()
+	require.NoError(t, limiter.Acquire(context.Background()))
+	require.NoError(t, limiter.Acquire(context.Background()))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// Cancelled callers stop waiting
+	limiter.SetMinInterval(time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, limiter.Acquire(ctx), context.Canceled)
+}
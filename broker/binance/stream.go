@@ -0,0 +1,203 @@
+package binance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsMainURL    = "wss://fstream.binance.com/ws"
+	wsTestnetURL = "wss://stream.binancefuture.com/ws"
+
+	// Listen keys expire 60 minutes after their last keepalive
+	defaultListenKeyKeepalive = 30 * time.Minute
+)
+
+// userStreamURL returns the base endpoint of the user data stream
+func userStreamURL(testnet bool) string {
+	if testnet {
+		return wsTestnetURL
+	}
+	return wsMainURL
+}
+
+// StreamUserData opens a user data stream and passes order and account updates to the handler.
+// The listen key is kept alive while the stream is open and closed when it ends.
+func (c *Client) StreamUserData(ctx context.Context, handler func(event broker.UserDataEvent)) error {
+	if !c.connected {
+		return broker.ErrNotConnected
+	}
+
+	listenKey, err := c.client.NewStartUserStreamService().Do(ctx)
+	if err != nil {
+		return broker.NewBrokerError(c.name, "USER_STREAM_FAILED", "Failed to start user data stream", err)
+	}
+	defer c.closeListenKey(listenKey)
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, fmt.Sprintf("%s/%s", c.wsURL, listenKey), nil)
+	if err != nil {
+		return broker.NewBrokerError(c.name, "USER_STREAM_FAILED", "Failed to connect to user data stream", err)
+	}
+	defer conn.Close()
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Closing the connection unblocks the reader below when the context ends or the keepalive fails
+	keepaliveErr := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(c.listenKeyKeepalive())
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-streamCtx.Done():
+				conn.Close()
+				return
+			case <-ticker.C:
+				if err := c.client.NewKeepaliveUserStreamService().ListenKey(listenKey).Do(streamCtx); err != nil {
+					keepaliveErr <- err
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			select {
+			case err := <-keepaliveErr:
+				return broker.NewBrokerError(c.name, "LISTEN_KEY_KEEPALIVE_FAILED", "Failed to keep the listen key alive", err)
+			default:
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return broker.NewBrokerError(c.name, "USER_STREAM_CLOSED", "User data stream disconnected", err)
+		}
+
+		var event futures.WsUserDataEvent
+		if err := json.Unmarshal(message, &event); err != nil {
+			// Events this client does not know are skipped
+			continue
+		}
+
+		switch event.Event {
+		case futures.UserDataEventTypeOrderTradeUpdate:
+			handler(convertOrderTradeUpdate(&event))
+		case futures.UserDataEventTypeAccountUpdate:
+			handler(convertAccountUpdate(&event))
+		case futures.UserDataEventTypeListenKeyExpired:
+			return broker.NewBrokerError(c.name, "LISTEN_KEY_EXPIRED", "Listen key of the user data stream expired", nil)
+		}
+	}
+}
+
+// closeListenKey invalidates a listen key; failures are ignored since unused keys expire on their own
+func (c *Client) closeListenKey(listenKey string) {
+	if c.client == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.client.NewCloseUserStreamService().ListenKey(listenKey).Do(ctx)
+}
+
+// listenKeyKeepalive returns how often the listen key is extended
+func (c *Client) listenKeyKeepalive() time.Duration {
+	if c.keepalive > 0 {
+		return c.keepalive
+	}
+	return defaultListenKeyKeepalive
+}
+
+func convertOrderTradeUpdate(event *futures.WsUserDataEvent) broker.UserDataEvent {
+	update := event.OrderTradeUpdate
+	orderID := strconv.FormatInt(update.ID, 10)
+	updatedAt := time.UnixMilli(update.TradeTime)
+
+	result := broker.UserDataEvent{
+		Type: broker.UserDataEventOrderUpdate,
+		Time: time.UnixMilli(event.Time),
+		Order: &broker.Order{
+			ID:               orderID,
+			ClientOrderID:    update.ClientOrderID,
+			Symbol:           update.Symbol,
+			Side:             convertFromBinanceSide(update.Side),
+			Type:             convertFromBinanceOrderType(update.Type),
+			Quantity:         update.OriginalQty,
+			Price:            update.OriginalPrice,
+			ExecutedQuantity: update.AccumulatedFilledQty,
+			AvgPrice:         update.AveragePrice,
+			Status:           convertBinanceOrderStatus(update.Status),
+			TimeInForce:      string(update.TimeInForce),
+			PositionSide:     convertPositionSideFromString(string(update.PositionSide)),
+			ReduceOnly:       update.IsReduceOnly,
+			UpdatedAt:        updatedAt,
+		},
+	}
+
+	if parseFloatOrZero(update.LastFilledQty) > 0 {
+		result.Fill = &broker.Fill{
+			ID:              strconv.FormatInt(update.TradeID, 10),
+			OrderID:         orderID,
+			Symbol:          update.Symbol,
+			Side:            convertFromBinanceSide(update.Side),
+			PositionSide:    convertPositionSideFromString(string(update.PositionSide)),
+			Price:           update.LastFilledPrice,
+			Quantity:        update.LastFilledQty,
+			Commission:      update.Commission,
+			CommissionAsset: update.CommissionAsset,
+			RealizedPnL:     update.RealizedPnL,
+			Maker:           update.IsMaker,
+			Time:            updatedAt,
+		}
+	}
+
+	return result
+}
+
+func convertAccountUpdate(event *futures.WsUserDataEvent) broker.UserDataEvent {
+	update := event.AccountUpdate
+	updatedAt := time.UnixMilli(event.TransactionTime)
+
+	result := broker.UserDataEvent{
+		Type:   broker.UserDataEventAccountUpdate,
+		Time:   time.UnixMilli(event.Time),
+		Reason: string(update.Reason),
+	}
+
+	for _, balance := range update.Balances {
+		result.Balances = append(result.Balances, broker.Balance{
+			Asset:              balance.Asset,
+			WalletBalance:      balance.Balance,
+			CrossWalletBalance: balance.CrossWalletBalance,
+		})
+	}
+
+	for _, position := range update.Positions {
+		result.Positions = append(result.Positions, broker.Position{
+			Symbol:         position.Symbol,
+			PositionSide:   convertPositionSideFromString(string(position.Side)),
+			Size:           position.Amount,
+			EntryPrice:     position.EntryPrice,
+			MarkPrice:      position.MarkPrice,
+			UnrealizedPnL:  position.UnrealizedPnL,
+			MarginType:     convertMarginTypeFromString(string(position.MarginType)),
+			IsolatedMargin: position.IsolatedWallet,
+			UpdatedAt:      updatedAt,
+		})
+	}
+
+	return result
+}
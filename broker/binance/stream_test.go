@@ -0,0 +1,158 @@
+package binance
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testOrderTradeUpdate = `{"e":"ORDER_TRADE_UPDATE","E":1700000000100,"T":1700000000099,"o":{"s":"BTCUSDT","c":"tv-1","S":"BUY","o":"LIMIT","f":"GTC","q":"0.02","p":"42000","ap":"42000","X":"PARTIALLY_FILLED","x":"TRADE","i":42,"l":"0.01","z":"0.01","L":"42000","N":"USDT","n":"0.168","T":1700000000099,"t":7,"m":true,"ps":"BOTH","rp":"0"}}`
+	testAccountUpdate    = `{"e":"ACCOUNT_UPDATE","E":1700000000200,"T":1700000000199,"a":{"m":"ORDER","B":[{"a":"USDT","wb":"1000.5","cw":"1000.5","bc":"0"}],"P":[{"s":"BTCUSDT","pa":"-0.01","ep":"42000","up":"-1.2","mt":"cross","iw":"0","ps":"BOTH"}]}}`
+	testListenKeyExpired = `{"e":"listenKeyExpired","E":1700000000300}`
+)
+
+// userStreamStandIn emulates the listen key endpoints and the user data stream of Binance futures
+type userStreamStandIn struct {
+	server     *httptest.Server
+	keepalives atomic.Int32
+	closed     atomic.Bool
+	messages   []string
+	expire     bool
+}
+
+func newUserStreamStandIn(t *testing.T, expire bool, messages ...string) *userStreamStandIn {
+	t.Helper()
+
+	standIn := &userStreamStandIn{messages: messages, expire: expire}
+	upgrader := websocket.Upgrader{}
+
+	standIn.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/fapi/v1/listenKey":
+			switch r.Method {
+			case http.MethodPost:
+				w.Write([]byte(`{"listenKey":"test-key"}`))
+			case http.MethodPut:
+				standIn.keepalives.Add(1)
+				w.Write([]byte(`{}`))
+			case http.MethodDelete:
+				standIn.closed.Store(true)
+				w.Write([]byte(`{}`))
+			}
+		case r.URL.Path == "/ws/test-key":
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			for _, message := range standIn.messages {
+				conn.WriteMessage(websocket.TextMessage, []byte(message))
+			}
+
+			// Keep the stream open until the listen key has been extended once
+			for standIn.keepalives.Load() == 0 {
+				time.Sleep(5 * time.Millisecond)
+			}
+			if standIn.expire {
+				conn.WriteMessage(websocket.TextMessage, []byte(testListenKeyExpired))
+			}
+			conn.ReadMessage()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(standIn.server.Close)
+	return standIn
+}
+
+// client returns a connected client that talks to the stand-in
+func (s *userStreamStandIn) client() *Client {
+	client := futures.NewClient("key", "secret")
+	client.BaseURL = s.server.URL
+
+	return &Client{
+		name:      "binance",
+		client:    client,
+		connected: true,
+		wsURL:     "ws" + strings.TrimPrefix(s.server.URL, "http") + "/ws",
+		keepalive: 10 * time.Millisecond,
+	}
+}
+
+func TestStreamUserData(t *testing.T) {
+	standIn := newUserStreamStandIn(t, true, testOrderTradeUpdate, testAccountUpdate)
+
+	var events []broker.UserDataEvent
+	err := standIn.client().StreamUserData(context.Background(), func(event broker.UserDataEvent) {
+		events = append(events, event)
+	})
+
+	var brokerErr *broker.BrokerError
+	require.True(t, errors.As(err, &brokerErr))
+	assert.Equal(t, "LISTEN_KEY_EXPIRED", brokerErr.Code)
+	assert.GreaterOrEqual(t, standIn.keepalives.Load(), int32(1))
+	assert.True(t, standIn.closed.Load())
+
+	require.Len(t, events, 2)
+
+	order := events[0]
+	assert.Equal(t, broker.UserDataEventOrderUpdate, order.Type)
+	require.NotNil(t, order.Order)
+	assert.Equal(t, "42", order.Order.ID)
+	assert.Equal(t, "tv-1", order.Order.ClientOrderID)
+	assert.Equal(t, broker.OrderTypeLimit, order.Order.Type)
+	assert.Equal(t, broker.OrderStatusPartiallyFilled, order.Order.Status)
+	assert.Equal(t, "0.01", order.Order.ExecutedQuantity)
+	require.NotNil(t, order.Fill)
+	assert.Equal(t, "7", order.Fill.ID)
+	assert.Equal(t, "0.168", order.Fill.Commission)
+	assert.True(t, order.Fill.Maker)
+
+	account := events[1]
+	assert.Equal(t, broker.UserDataEventAccountUpdate, account.Type)
+	assert.Equal(t, "ORDER", account.Reason)
+	require.Len(t, account.Balances, 1)
+	assert.Equal(t, "1000.5", account.Balances[0].WalletBalance)
+	require.Len(t, account.Positions, 1)
+	assert.Equal(t, "-0.01", account.Positions[0].Size)
+	assert.Equal(t, broker.MarginTypeCross, account.Positions[0].MarginType)
+}
+
+func TestStreamUserDataStopsWithContext(t *testing.T) {
+	standIn := newUserStreamStandIn(t, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- standIn.client().StreamUserData(ctx, func(broker.UserDataEvent) {})
+	}()
+
+	require.Eventually(t, func() bool { return standIn.keepalives.Load() > 0 }, time.Second, 5*time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("stream did not stop after the context was cancelled")
+	}
+	assert.True(t, standIn.closed.Load())
+}
+
+func TestStreamUserDataRequiresConnection(t *testing.T) {
+	err := (&Client{name: "binance"}).StreamUserData(context.Background(), func(broker.UserDataEvent) {})
+	assert.Equal(t, broker.ErrNotConnected, err)
+}
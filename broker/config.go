@@ -106,6 +106,11 @@ func (cm *ConfigManager) initializeBroker(ctx context.Context, name string, conf
 		return fmt.Errorf("invalid credentials: %w", err)
 	}
 
+	// Space the requests of this API key, including the ones made during initialization
+	if config.Settings.RateLimitDelay > 0 {
+		RateLimiterFor(name, config.Credentials.APIKey).SetMinInterval(config.Settings.RateLimitDelay)
+	}
+
 	// Initialize broker with timeout context
 	timeoutCtx, cancel := context.WithTimeout(ctx, cm.getRequestTimeout(config))
 	defer cancel()
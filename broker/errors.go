@@ -20,6 +20,7 @@ var (
 	ErrPositionNotFound    = errors.New("position not found")
 	ErrMarketClosed        = errors.New("market is closed")
 	ErrRateLimitExceeded   = errors.New("rate limit exceeded")
+	ErrRateLimited         = errors.New("rate limited") // Refused by the client-side limiter or while backing off from a ban
 	ErrAPIError            = errors.New("API error")
 	ErrNetworkError        = errors.New("network error")
 	ErrTimeout             = errors.New("request timeout")
@@ -64,6 +65,7 @@ func IsTemporaryError(err error) bool {
 
 	// Check for known temporary errors
 	if errors.Is(err, ErrRateLimitExceeded) ||
+		errors.Is(err, ErrRateLimited) ||
 		errors.Is(err, ErrNetworkError) ||
 		errors.Is(err, ErrTimeout) {
 		return true
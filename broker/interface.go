@@ -2,6 +2,7 @@ package broker
 
 import (
 	"context"
+	"time"
 )
 
 // Broker represents a cryptocurrency exchange broker interface
@@ -60,6 +61,32 @@ type FuturesBroker interface {
 	GetPositionMode(ctx context.Context) (bool, error)
 }
 
+// FillReporter is implemented by brokers that report the fills of an order,
+// including commissions and realized PnL
+type FillReporter interface {
+	GetOrderFills(ctx context.Context, symbol string, orderID string) ([]Fill, error)
+}
+
+// IncomeReporter is implemented by brokers that report the income history of the account.
+// GetIncome returns the records of a type since a point in time, oldest first; an empty type returns every type.
+type IncomeReporter interface {
+	GetIncome(ctx context.Context, incomeType IncomeType, since time.Time) ([]Income, error)
+}
+
+// UserDataStreamer is implemented by brokers that push order and account updates in real time.
+// StreamUserData blocks, passing every update to the handler, until the context is cancelled
+// or the stream is lost; callers reconnect by calling it again.
+type UserDataStreamer interface {
+	StreamUserData(ctx context.Context, handler func(event UserDataEvent)) error
+}
+
+// BatchOrderPlacer is implemented by brokers that place several orders in one request. PlaceOrders
+// returns a result for every request in the order of the requests; the error is only set when the
+// batch could not be sent at all. Orders of a batch are accepted or rejected one by one.
+type BatchOrderPlacer interface {
+	PlaceOrders(ctx context.Context, reqs []*OrderRequest) ([]BatchOrderResult, error)
+}
+
 // BrokerFactory is a factory function type for creating brokers
 type BrokerFactory func() Broker
 
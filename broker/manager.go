@@ -2,6 +2,7 @@ package broker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
@@ -226,6 +227,24 @@ func (m *Manager) CloseAllPositions(ctx context.Context) map[string]error {
 	})
 }
 
+// CancelAllOrders cancels the open orders of every symbol on all brokers
+func (m *Manager) CancelAllOrders(ctx context.Context) map[string]error {
+	return m.ExecuteOnAllBrokers(ctx, func(name string, broker Broker) error {
+		orders, err := broker.GetOpenOrders(ctx, "")
+		if err != nil {
+			return err
+		}
+
+		var errs []error
+		for _, order := range orders {
+			if err := broker.CancelOrder(ctx, order.Symbol, order.ID); err != nil {
+				errs = append(errs, fmt.Errorf("order %s: %w", order.ID, err))
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
+
 // SetLeverageOnBroker sets leverage on a specific broker
 func (m *Manager) SetLeverageOnBroker(ctx context.Context, brokerName string, req *LeverageRequest) error {
 	return m.ExecuteOnBroker(ctx, brokerName, func(broker Broker) error {
@@ -0,0 +1,478 @@
+package paper
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+)
+
+// Default settings of a paper account
+const (
+	DefaultBalance = 10000.0 // Starting wallet balance in USDT
+	DefaultFeeRate = 0.0004  // Commission charged on the notional of every fill
+)
+
+// quoteAsset is the asset balances, commissions and PnL are held in
+const quoteAsset = "USDT"
+
+// position is a one-way position of a symbol
+type position struct {
+	size       float64 // Negative for shorts
+	entryPrice float64
+	leverage   int
+	marginType broker.MarginType
+	updatedAt  time.Time
+}
+
+// Client is a simulated futures account. Market orders fill at the last price set for their symbol,
+// limit orders at their price, both in full and at once. Positions are held in one-way mode.
+type Client struct {
+	name      string
+	connected bool
+	now       func() time.Time
+
+	mutex     sync.Mutex
+	balance   float64
+	feeRate   float64
+	prices    map[string]float64
+	positions map[string]*position
+	settings  map[string]*position // Leverage and margin type of symbols without a position
+	orders    []*broker.Order
+	fills     map[string][]broker.Fill
+}
+
+// NewClient creates a paper account with the default balance and commission
+func NewClient() broker.Broker {
+	return New(DefaultBalance, DefaultFeeRate)
+}
+
+// New creates a paper account with a starting balance and a commission rate
+func New(balance, feeRate float64) *Client {
+	return &Client{
+		name:      "paper",
+		now:       time.Now,
+		balance:   balance,
+		feeRate:   feeRate,
+		prices:    make(map[string]float64),
+		positions: make(map[string]*position),
+		settings:  make(map[string]*position),
+		fills:     make(map[string][]broker.Fill),
+	}
+}
+
+// SetClock sets the clock orders and fills are timestamped with
+func (c *Client) SetClock(now func() time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = now
+}
+
+// SetPrice sets the last price of a symbol, used to fill market orders and to value positions
+func (c *Client) SetPrice(symbol string, price float64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.prices[strings.ToUpper(symbol)] = price
+}
+
+// Orders returns every order placed, oldest first
+func (c *Client) Orders() []broker.Order {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	orders := make([]broker.Order, len(c.orders))
+	for i, order := range c.orders {
+		orders[i] = *order
+	}
+	return orders
+}
+
+// Name returns the broker name
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Initialize opens the account; credentials are not needed
+func (c *Client) Initialize(ctx context.Context, credentials *broker.Credentials) error {
+	c.connected = true
+	return nil
+}
+
+// TestConnection always succeeds once the account is open
+func (c *Client) TestConnection(ctx context.Context) error {
+	if !c.connected {
+		return broker.ErrNotConnected
+	}
+	return nil
+}
+
+// GetAccountInfo returns the balance and the open positions valued at the last prices
+func (c *Client) GetAccountInfo(ctx context.Context) (*broker.AccountInfo, error) {
+	if !c.connected {
+		return nil, broker.ErrNotConnected
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	positions := c.openPositions()
+	unrealized := 0.0
+	for _, p := range positions {
+		unrealized += parseFloat(p.UnrealizedPnL)
+	}
+	wallet := format(c.balance)
+	margin := format(c.balance + unrealized)
+
+	return &broker.AccountInfo{
+		TotalWalletBalance:      wallet,
+		TotalUnrealizedPnL:      format(unrealized),
+		TotalMarginBalance:      margin,
+		TotalCrossWalletBalance: wallet,
+		TotalCrossUnPnl:         format(unrealized),
+		AvailableBalance:        margin,
+		MaxWithdrawAmount:       margin,
+		Assets: []broker.Balance{{
+			Asset:              quoteAsset,
+			WalletBalance:      wallet,
+			UnrealizedPnL:      format(unrealized),
+			MarginBalance:      margin,
+			CrossWalletBalance: wallet,
+			CrossUnPnl:         format(unrealized),
+			AvailableBalance:   margin,
+			MaxWithdrawAmount:  margin,
+		}},
+		Positions: positions,
+		CanTrade:  true,
+		UpdatedAt: c.now(),
+	}, nil
+}
+
+// GetBalance returns the balance of the quote asset
+func (c *Client) GetBalance(ctx context.Context, asset string) (*broker.Balance, error) {
+	account, err := c.GetAccountInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, balance := range account.Assets {
+		if balance.Asset == asset {
+			return &balance, nil
+		}
+	}
+	return nil, broker.NewBrokerError(c.name, "ASSET_NOT_FOUND", fmt.Sprintf("Asset %s not found", asset), nil)
+}
+
+// GetPositions returns the open positions
+func (c *Client) GetPositions(ctx context.Context) ([]broker.Position, error) {
+	if !c.connected {
+		return nil, broker.ErrNotConnected
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.openPositions(), nil
+}
+
+// GetPosition returns the open position of a symbol
+func (c *Client) GetPosition(ctx context.Context, symbol string) (*broker.Position, error) {
+	positions, err := c.GetPositions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range positions {
+		if p.Symbol == strings.ToUpper(symbol) {
+			return &p, nil
+		}
+	}
+	return nil, broker.NewBrokerError(c.name, "POSITION_NOT_FOUND", fmt.Sprintf("Position for %s not found", symbol), broker.ErrPositionNotFound)
+}
+
+// SetLeverage records the leverage of a symbol
+func (c *Client) SetLeverage(ctx context.Context, req *broker.LeverageRequest) error {
+	if !broker.IsValidLeverage(req.Leverage) {
+		return broker.ErrInvalidLeverage
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.setting(req.Symbol).leverage = req.Leverage
+	return nil
+}
+
+// SetMarginType records the margin type of a symbol
+func (c *Client) SetMarginType(ctx context.Context, req *broker.MarginTypeRequest) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.setting(req.Symbol).marginType = req.MarginType
+	return nil
+}
+
+// PlaceOrder fills an order in full: market orders at the last price of the symbol, limit orders at
+// their price. Reduce-only orders are rejected on a flat position or in the direction of the position.
+func (c *Client) PlaceOrder(ctx context.Context, req *broker.OrderRequest) (*broker.Order, error) {
+	if !c.connected {
+		return nil, broker.ErrNotConnected
+	}
+	if err := broker.ValidateOrderRequest(req); err != nil {
+		return nil, broker.NewBrokerError(c.name, "INVALID_ORDER", "Invalid order request", err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	symbol := strings.ToUpper(req.Symbol)
+	quantity, _ := broker.ParseQuantity(req.Quantity)
+	price := c.prices[symbol]
+	if req.Type == broker.OrderTypeLimit {
+		price, _ = broker.ParsePrice(req.Price)
+	}
+	if price <= 0 {
+		return nil, broker.NewBrokerError(c.name, "NO_PRICE", fmt.Sprintf("No price known for %s", symbol), broker.ErrInvalidPrice)
+	}
+
+	delta := quantity
+	if req.Side == broker.OrderSideSell {
+		delta = -quantity
+	}
+	if req.ReduceOnly && c.setting(symbol).size*delta >= 0 {
+		return nil, broker.NewBrokerError(c.name, "REDUCE_ONLY_REJECTED", "Reduce-only order would increase the position", broker.ErrInvalidQuantity)
+	}
+
+	now := c.now()
+	realized := c.fill(symbol, delta, price, now)
+	commission := quantity * price * c.feeRate
+	c.balance += realized - commission
+
+	order := &broker.Order{
+		ID:               strconv.Itoa(len(c.orders) + 1),
+		ClientOrderID:    fmt.Sprintf("paper-%d", len(c.orders)+1),
+		Symbol:           symbol,
+		Side:             req.Side,
+		Type:             req.Type,
+		Quantity:         req.Quantity,
+		Price:            req.Price,
+		ExecutedQuantity: format(quantity),
+		CumulativeQuote:  format(quantity * price),
+		AvgPrice:         format(price),
+		Status:           broker.OrderStatusFilled,
+		TimeInForce:      req.TimeInForce,
+		PositionSide:     req.PositionSide,
+		ReduceOnly:       req.ReduceOnly,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	c.orders = append(c.orders, order)
+	c.fills[order.ID] = []broker.Fill{{
+		ID:              order.ID,
+		OrderID:         order.ID,
+		Symbol:          symbol,
+		Side:            req.Side,
+		PositionSide:    req.PositionSide,
+		Price:           format(price),
+		Quantity:        format(quantity),
+		QuoteQuantity:   format(quantity * price),
+		Commission:      format(commission),
+		CommissionAsset: quoteAsset,
+		RealizedPnL:     format(realized),
+		Time:            now,
+	}}
+
+	result := *order
+	return &result, nil
+}
+
+// GetOrder returns a placed order
+func (c *Client) GetOrder(ctx context.Context, symbol string, orderID string) (*broker.Order, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, order := range c.orders {
+		if order.ID == orderID {
+			result := *order
+			return &result, nil
+		}
+	}
+	return nil, broker.NewBrokerError(c.name, "ORDER_NOT_FOUND", fmt.Sprintf("Order %s not found", orderID), broker.ErrOrderNotFound)
+}
+
+// CancelOrder fails since every order fills when it is placed
+func (c *Client) CancelOrder(ctx context.Context, symbol string, orderID string) error {
+	if _, err := c.GetOrder(ctx, symbol, orderID); err != nil {
+		return err
+	}
+	return broker.NewBrokerError(c.name, "ORDER_FILLED", fmt.Sprintf("Order %s is already filled", orderID), nil)
+}
+
+// GetOpenOrders returns no orders since every order fills when it is placed
+func (c *Client) GetOpenOrders(ctx context.Context, symbol string) ([]broker.Order, error) {
+	return []broker.Order{}, nil
+}
+
+// GetOrderHistory returns the latest orders of a symbol, oldest first
+func (c *Client) GetOrderHistory(ctx context.Context, symbol string, limit int) ([]broker.Order, error) {
+	var orders []broker.Order
+	for _, order := range c.Orders() {
+		if order.Symbol == strings.ToUpper(symbol) {
+			orders = append(orders, order)
+		}
+	}
+	if limit > 0 && len(orders) > limit {
+		orders = orders[len(orders)-limit:]
+	}
+	return orders, nil
+}
+
+// GetOrderFills returns the fill of an order with its commission and realized PnL
+func (c *Client) GetOrderFills(ctx context.Context, symbol string, orderID string) ([]broker.Fill, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	fills, ok := c.fills[orderID]
+	if !ok {
+		return nil, broker.NewBrokerError(c.name, "ORDER_NOT_FOUND", fmt.Sprintf("Order %s not found", orderID), broker.ErrOrderNotFound)
+	}
+	return append([]broker.Fill(nil), fills...), nil
+}
+
+// GetSymbolInfo returns a symbol quoted in USDT that accepts market and limit orders
+func (c *Client) GetSymbolInfo(ctx context.Context, symbol string) (*broker.SymbolInfo, error) {
+	symbol = strings.ToUpper(symbol)
+	return &broker.SymbolInfo{
+		Symbol:     symbol,
+		BaseAsset:  strings.TrimSuffix(symbol, quoteAsset),
+		QuoteAsset: quoteAsset,
+		Status:     "TRADING",
+		OrderTypes: []broker.OrderType{broker.OrderTypeMarket, broker.OrderTypeLimit},
+	}, nil
+}
+
+// GetExchangeInfo returns the symbols a price was set for
+func (c *Client) GetExchangeInfo(ctx context.Context) ([]broker.SymbolInfo, error) {
+	c.mutex.Lock()
+	symbols := make([]string, 0, len(c.prices))
+	for symbol := range c.prices {
+		symbols = append(symbols, symbol)
+	}
+	c.mutex.Unlock()
+	sort.Strings(symbols)
+
+	infos := make([]broker.SymbolInfo, 0, len(symbols))
+	for _, symbol := range symbols {
+		info, _ := c.GetSymbolInfo(ctx, symbol)
+		infos = append(infos, *info)
+	}
+	return infos, nil
+}
+
+// IsConnected returns whether the account is open
+func (c *Client) IsConnected() bool {
+	return c.connected
+}
+
+// Close closes the account; its state is kept
+func (c *Client) Close() error {
+	c.connected = false
+	return nil
+}
+
+// fill moves the position of a symbol by a signed quantity at a price and returns the PnL realized
+// by the part that reduces it
+func (c *Client) fill(symbol string, delta, price float64, now time.Time) float64 {
+	p, ok := c.positions[symbol]
+	if !ok {
+		p = c.setting(symbol)
+		c.positions[symbol] = p
+		delete(c.settings, symbol)
+	}
+	p.updatedAt = now
+
+	realized := 0.0
+	if p.size*delta < 0 {
+		closing := math.Min(math.Abs(delta), math.Abs(p.size))
+		if p.size > 0 {
+			realized = (price - p.entryPrice) * closing
+		} else {
+			realized = (p.entryPrice - price) * closing
+		}
+	}
+
+	size := p.size + delta
+	switch {
+	case math.Abs(size) < 1e-12:
+		// Keep the settings of the symbol once the position is closed
+		c.settings[symbol] = &position{leverage: p.leverage, marginType: p.marginType}
+		delete(c.positions, symbol)
+		return realized
+	case p.size*size < 0 || p.size == 0:
+		// A new position or the rest of a reversal opens at the fill price
+		p.entryPrice = price
+	case math.Abs(size) > math.Abs(p.size):
+		p.entryPrice = (p.entryPrice*math.Abs(p.size) + price*math.Abs(delta)) / math.Abs(size)
+	}
+	p.size = size
+	return realized
+}
+
+// setting returns the settings of a symbol without a position
+func (c *Client) setting(symbol string) *position {
+	symbol = strings.ToUpper(symbol)
+	if p, ok := c.positions[symbol]; ok {
+		return p
+	}
+	s, ok := c.settings[symbol]
+	if !ok {
+		s = &position{leverage: 1, marginType: broker.MarginTypeCross}
+		c.settings[symbol] = s
+	}
+	return s
+}
+
+// openPositions returns the open positions valued at the last prices, ordered by symbol
+func (c *Client) openPositions() []broker.Position {
+	symbols := make([]string, 0, len(c.positions))
+	for symbol := range c.positions {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	positions := make([]broker.Position, 0, len(symbols))
+	for _, symbol := range symbols {
+		p := c.positions[symbol]
+		mark, ok := c.prices[symbol]
+		if !ok {
+			mark = p.entryPrice
+		}
+		side := broker.PositionSideLong
+		if p.size < 0 {
+			side = broker.PositionSideShort
+		}
+		positions = append(positions, broker.Position{
+			Symbol:        symbol,
+			PositionSide:  side,
+			Size:          format(p.size),
+			EntryPrice:    format(p.entryPrice),
+			MarkPrice:     format(mark),
+			UnrealizedPnL: format((mark - p.entryPrice) * p.size),
+			Leverage:      p.leverage,
+			MarginType:    p.marginType,
+			UpdatedAt:     p.updatedAt,
+		})
+	}
+	return positions
+}
+
+// format formats a number rounded to 8 decimals without trailing zeros
+func format(value float64) string {
+	return strconv.FormatFloat(math.Round(value*1e8)/1e8, 'f', -1, 64)
+}
+
+// parseFloat parses a number, treating invalid values as zero
+func parseFloat(value string) float64 {
+	f, _ := strconv.ParseFloat(value, 64)
+	return f
+}
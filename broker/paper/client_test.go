@@ -0,0 +1,67 @@
+package paper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaperFills(t *testing.T) {
+	ctx := context.Background()
+	client := New(1000, 0.001)
+	var _ broker.FillReporter = client
+	require.NoError(t, client.Initialize(ctx, nil))
+
+	at := time.Date(2025, 9, 7, 9, 0, 0, 0, time.UTC)
+	client.SetClock(func() time.Time { return at })
+
+	// Market orders need a price
+	_, err := client.PlaceOrder(ctx, &broker.OrderRequest{Symbol: "ETHUSDT", Side: broker.OrderSideBuy, Type: broker.OrderTypeMarket, Quantity: "1"})
+	assert.ErrorContains(t, err, "NO_PRICE")
+
+	client.SetPrice("ethusdt", 100)
+	order, err := client.PlaceOrder(ctx, &broker.OrderRequest{Symbol: "ETHUSDT", Side: broker.OrderSideBuy, Type: broker.OrderTypeMarket, Quantity: "2"})
+	require.NoError(t, err)
+	assert.Equal(t, broker.OrderStatusFilled, order.Status)
+	assert.Equal(t, "100", order.AvgPrice)
+	assert.Equal(t, at, order.UpdatedAt)
+
+	// Limit orders fill at their price and average the entry
+	_, err = client.PlaceOrder(ctx, &broker.OrderRequest{Symbol: "ETHUSDT", Side: broker.OrderSideBuy, Type: broker.OrderTypeLimit, Quantity: "2", Price: "110"})
+	require.NoError(t, err)
+	position, err := client.GetPosition(ctx, "ETHUSDT")
+	require.NoError(t, err)
+	assert.Equal(t, "4", position.Size)
+	assert.Equal(t, "105", position.EntryPrice)
+	assert.Equal(t, "-20", position.UnrealizedPnL)
+
+	// A reversal realizes the PnL of the closed part and opens the rest at the fill price
+	client.SetPrice("ETHUSDT", 120)
+	reversal, err := client.PlaceOrder(ctx, &broker.OrderRequest{Symbol: "ETHUSDT", Side: broker.OrderSideSell, Type: broker.OrderTypeMarket, Quantity: "5", ReduceOnly: true})
+	require.NoError(t, err)
+	fills, err := client.GetOrderFills(ctx, "ETHUSDT", reversal.ID)
+	require.NoError(t, err)
+	require.Len(t, fills, 1)
+	assert.Equal(t, "60", fills[0].RealizedPnL)
+	assert.Equal(t, "0.6", fills[0].Commission)
+
+	position, err = client.GetPosition(ctx, "ETHUSDT")
+	require.NoError(t, err)
+	assert.Equal(t, "-1", position.Size)
+	assert.Equal(t, "120", position.EntryPrice)
+	assert.Equal(t, broker.PositionSideShort, position.PositionSide)
+
+	// Reduce-only orders cannot increase the position
+	_, err = client.PlaceOrder(ctx, &broker.OrderRequest{Symbol: "ETHUSDT", Side: broker.OrderSideSell, Type: broker.OrderTypeMarket, Quantity: "1", ReduceOnly: true})
+	assert.ErrorContains(t, err, "REDUCE_ONLY_REJECTED")
+
+	// The wallet holds the realized PnL less commissions: 0.2 + 0.22 + 0.6
+	account, err := client.GetAccountInfo(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "1058.98", account.TotalWalletBalance)
+	assert.Len(t, client.Orders(), 3)
+}
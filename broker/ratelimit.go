@@ -0,0 +1,232 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultRateLimitMaxWait is how long a request is queued for capacity before it fails with ErrRateLimited
+const DefaultRateLimitMaxWait = 10 * time.Second
+
+// RateLimit declares a request budget of an exchange over a fixed time window
+type RateLimit struct {
+	Name   string        `json:"name"` // e.g. REQUEST_WEIGHT_1M, ORDERS_10S
+	Limit  int           `json:"limit"`
+	Window time.Duration `json:"window"`
+}
+
+// RateCost is the amount a request consumes of a rate limit
+type RateCost struct {
+	Limit  string
+	Amount int
+}
+
+// Declared limits, limiters per API key and bans per broker
+var (
+	rateLimitRegistry = make(map[string][]RateLimit)
+	rateLimiters      = make(map[string]*RateLimiter)
+	rateLimitBans     = make(map[string]time.Time)
+	rateLimitMutex    sync.Mutex
+)
+
+// RegisterRateLimits declares the request limits that apply to every API key of a broker
+func RegisterRateLimits(broker string, limits ...RateLimit) {
+	rateLimitMutex.Lock()
+	defer rateLimitMutex.Unlock()
+	rateLimitRegistry[broker] = limits
+}
+
+// RateLimiterFor returns the limiter shared by all clients of a broker using the same API key
+func RateLimiterFor(broker, apiKey string) *RateLimiter {
+	rateLimitMutex.Lock()
+	defer rateLimitMutex.Unlock()
+
+	key := broker + "\x00" + apiKey
+	limiter, exists := rateLimiters[key]
+	if !exists {
+		limiter = NewRateLimiter(broker, rateLimitRegistry[broker]...)
+		rateLimiters[key] = limiter
+	}
+	return limiter
+}
+
+// RateLimiter tracks the request weight of one API key against the limits of its broker.
+// Requests wait for capacity instead of exceeding a limit, and all keys of a broker back off
+// while the exchange has banned the client.
+type RateLimiter struct {
+	broker string
+	limits []RateLimit
+
+	mu          sync.Mutex
+	windows     map[string]*rateWindow
+	minInterval time.Duration
+	maxWait     time.Duration
+	last        time.Time
+}
+
+// rateWindow is the usage of a limit in its current window
+type rateWindow struct {
+	start time.Time
+	used  int
+}
+
+// NewRateLimiter creates a limiter for the given limits
+func NewRateLimiter(broker string, limits ...RateLimit) *RateLimiter {
+	return &RateLimiter{
+		broker:  broker,
+		limits:  limits,
+		windows: make(map[string]*rateWindow),
+		maxWait: DefaultRateLimitMaxWait,
+	}
+}
+
+// SetMinInterval spaces consecutive requests by at least the given delay
+func (l *RateLimiter) SetMinInterval(interval time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.minInterval = interval
+}
+
+// SetMaxWait sets how long a request may be queued before it fails with ErrRateLimited
+func (l *RateLimiter) SetMaxWait(maxWait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxWait = maxWait
+}
+
+// Acquire reserves the cost of a request, waiting while a limit is exhausted.
+// It fails with ErrRateLimited when the wait would exceed the maximum or the broker is banned.
+func (l *RateLimiter) Acquire(ctx context.Context, costs ...RateCost) error {
+	deadline := time.Now().Add(l.getMaxWait())
+
+	for {
+		wait, err := l.reserve(time.Now(), costs)
+		if err != nil {
+			return err
+		}
+		if wait == 0 {
+			return nil
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return fmt.Errorf("%w: %s needs to wait %s for capacity", ErrRateLimited, l.broker, wait.Round(time.Millisecond))
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve consumes the costs when every limit has capacity, or returns how long to wait
+func (l *RateLimiter) reserve(now time.Time, costs []RateCost) (time.Duration, error) {
+	if until := BannedUntil(l.broker); now.Before(until) {
+		wait := until.Sub(now)
+		if wait > l.getMaxWait() {
+			return 0, fmt.Errorf("%w: %s is backing off until %s", ErrRateLimited, l.broker, until.Format(time.RFC3339))
+		}
+		return wait, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if next := l.last.Add(l.minInterval); now.Before(next) {
+		return next.Sub(now), nil
+	}
+
+	var wait time.Duration
+	for _, cost := range costs {
+		limit, window := l.window(cost.Limit, now)
+		if window == nil {
+			continue
+		}
+		if window.used+cost.Amount > limit.Limit {
+			if reset := window.start.Add(limit.Window).Sub(now); reset > wait {
+				wait = reset
+			}
+		}
+	}
+	if wait > 0 {
+		return wait, nil
+	}
+
+	for _, cost := range costs {
+		if _, window := l.window(cost.Limit, now); window != nil {
+			window.used += cost.Amount
+		}
+	}
+	l.last = now
+	return 0, nil
+}
+
+// Observe records the usage of a limit reported by the exchange, which also counts
+// requests made by other processes with the same key
+func (l *RateLimiter) Observe(limitName string, used int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, window := l.window(limitName, time.Now()); window != nil && used > window.used {
+		window.used = used
+	}
+}
+
+// Usage returns the consumption of each limit in its current window
+func (l *RateLimiter) Usage() map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	usage := make(map[string]int, len(l.limits))
+	for _, limit := range l.limits {
+		_, window := l.window(limit.Name, time.Now())
+		usage[limit.Name] = window.used
+	}
+	return usage
+}
+
+// window returns a declared limit and its current window, starting a new window when the last one ended
+func (l *RateLimiter) window(name string, now time.Time) (RateLimit, *rateWindow) {
+	for _, limit := range l.limits {
+		if limit.Name != name {
+			continue
+		}
+
+		start := now.Truncate(limit.Window)
+		window, exists := l.windows[name]
+		if !exists || !window.start.Equal(start) {
+			window = &rateWindow{start: start}
+			l.windows[name] = window
+		}
+		return limit, window
+	}
+	return RateLimit{}, nil
+}
+
+// getMaxWait returns the maximum queueing time
+func (l *RateLimiter) getMaxWait() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.maxWait
+}
+
+// Ban makes every client of a broker back off until the given time
+func Ban(broker string, until time.Time) {
+	rateLimitMutex.Lock()
+	defer rateLimitMutex.Unlock()
+
+	if until.After(rateLimitBans[broker]) {
+		rateLimitBans[broker] = until
+	}
+}
+
+// BannedUntil returns until when a broker is backing off, zero when it is not
+func BannedUntil(broker string) time.Time {
+	rateLimitMutex.Lock()
+	defer rateLimitMutex.Unlock()
+	return rateLimitBans[broker]
+}
@@ -69,6 +69,12 @@ type OrderRequest struct {
 	ReduceOnly   bool         `json:"reduce_only,omitempty"`   // For futures trading
 }
 
+// BatchOrderResult is the outcome of one order of a batch: the placed order or why it was rejected
+type BatchOrderResult struct {
+	Order *Order
+	Err   error
+}
+
 // Order represents an order response
 type Order struct {
 	ID               string       `json:"id"`
@@ -80,6 +86,7 @@ type Order struct {
 	Price            string       `json:"price"`
 	ExecutedQuantity string       `json:"executed_quantity"`
 	CumulativeQuote  string       `json:"cumulative_quote"`
+	AvgPrice         string       `json:"avg_price,omitempty"`
 	Status           OrderStatus  `json:"status"`
 	TimeInForce      string       `json:"time_in_force"`
 	PositionSide     PositionSide `json:"position_side"`
@@ -88,6 +95,23 @@ type Order struct {
 	UpdatedAt        time.Time    `json:"updated_at"`
 }
 
+// Fill represents a single execution of an order
+type Fill struct {
+	ID              string       `json:"id"`
+	OrderID         string       `json:"order_id"`
+	Symbol          string       `json:"symbol"`
+	Side            OrderSide    `json:"side"`
+	PositionSide    PositionSide `json:"position_side"`
+	Price           string       `json:"price"`
+	Quantity        string       `json:"quantity"`
+	QuoteQuantity   string       `json:"quote_quantity"`
+	Commission      string       `json:"commission"`
+	CommissionAsset string       `json:"commission_asset"`
+	RealizedPnL     string       `json:"realized_pnl"`
+	Maker           bool         `json:"maker"`
+	Time            time.Time    `json:"time"`
+}
+
 // Position represents a futures position
 type Position struct {
 	Symbol            string       `json:"symbol"`
@@ -140,6 +164,51 @@ type AccountInfo struct {
 	UpdatedAt                   time.Time  `json:"updated_at"`
 }
 
+// IncomeType represents the kind of an account income record
+type IncomeType string
+
+const (
+	IncomeTypeRealizedPnL    IncomeType = "REALIZED_PNL"
+	IncomeTypeCommission     IncomeType = "COMMISSION"
+	IncomeTypeFundingFee     IncomeType = "FUNDING_FEE"
+	IncomeTypeInsuranceClear IncomeType = "INSURANCE_CLEAR"
+)
+
+// Income represents a change of the account balance such as a commission or funding fee.
+// Costs have a negative amount.
+type Income struct {
+	ID      string     `json:"id"` // Transaction ID, unique per exchange
+	Symbol  string     `json:"symbol"`
+	Type    IncomeType `json:"type"`
+	Amount  string     `json:"amount"`
+	Asset   string     `json:"asset"`
+	TradeID string     `json:"trade_id,omitempty"`
+	Time    time.Time  `json:"time"`
+}
+
+// UserDataEventType represents the kind of update pushed on a user data stream
+type UserDataEventType string
+
+const (
+	UserDataEventOrderUpdate   UserDataEventType = "ORDER_UPDATE"
+	UserDataEventAccountUpdate UserDataEventType = "ACCOUNT_UPDATE"
+)
+
+// UserDataEvent represents a real-time order or account update of a user data stream
+type UserDataEvent struct {
+	Type UserDataEventType `json:"type"`
+	Time time.Time         `json:"time"`
+
+	// Order updates
+	Order *Order `json:"order,omitempty"`
+	Fill  *Fill  `json:"fill,omitempty"` // Last fill of the order, nil when the update did not fill anything
+
+	// Account updates
+	Reason    string     `json:"reason,omitempty"`
+	Balances  []Balance  `json:"balances,omitempty"`
+	Positions []Position `json:"positions,omitempty"` // Size is signed, negative for short positions in one-way mode
+}
+
 // SymbolInfo represents trading symbol information
 type SymbolInfo struct {
 	Symbol                     string      `json:"symbol"`
@@ -3,6 +3,7 @@ package broker
 import (
 	"context"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -82,6 +83,50 @@ func FormatPrice(price float64, precision int) string {
 	return fmt.Sprintf(format, price)
 }
 
+// RoundToFilters rounds the quantity of an order down to the step size of its symbol and the
+// price to the nearest tick size. Filters the symbol does not report leave the value unchanged.
+func RoundToFilters(req *OrderRequest, info *SymbolInfo) error {
+	if step := parseIncrement(info.StepSize); step > 0 {
+		quantity, err := ParseQuantity(req.Quantity)
+		if err != nil {
+			return err
+		}
+		// The epsilon keeps quantities that are a multiple of the step from losing one to float error
+		rounded := math.Floor(quantity/step+1e-9) * step
+		if rounded <= 0 {
+			return fmt.Errorf("%w: %s is below the step size %s", ErrInvalidQuantity, req.Quantity, info.StepSize)
+		}
+		req.Quantity = FormatQuantity(rounded, incrementPrecision(info.StepSize))
+	}
+
+	if tick := parseIncrement(info.TickSize); tick > 0 && req.Price != "" {
+		price, err := ParsePrice(req.Price)
+		if err != nil {
+			return err
+		}
+		req.Price = FormatPrice(math.Round(price/tick)*tick, incrementPrecision(info.TickSize))
+	}
+	return nil
+}
+
+// parseIncrement parses a step or tick size, returning 0 when it is missing or invalid
+func parseIncrement(increment string) float64 {
+	value, err := strconv.ParseFloat(increment, 64)
+	if err != nil || value <= 0 {
+		return 0
+	}
+	return value
+}
+
+// incrementPrecision returns the number of decimals of a step or tick size such as "0.00100000"
+func incrementPrecision(increment string) int {
+	dot := strings.IndexByte(increment, '.')
+	if dot < 0 {
+		return 0
+	}
+	return len(strings.TrimRight(increment[dot+1:], "0"))
+}
+
 // ValidateOrderRequest validates an order request
 func ValidateOrderRequest(req *OrderRequest) error {
 	if req == nil {
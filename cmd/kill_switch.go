@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/services"
+)
+
+// runKillSwitch engages, releases or lists kill switches through the admin API of a running instance
+func runKillSwitch(args []string) error {
+	flags := flag.NewFlagSet("kill-switch", flag.ExitOnError)
+	configFile := flags.String("config", "config.yaml", "Path to configuration file")
+	server := flags.String("server", "", "Base URL of the running instance, defaults to the server address of the configuration")
+	user := flags.String("user", "", "User name or api_sec, all users when empty")
+	exchange := flags.String("exchange", "", "Exchange, all exchanges when empty")
+	pause := flags.String("pause", "", "Pause new signals: reject or queue")
+	cancelOrders := flags.Bool("cancel-orders", false, "Cancel all open orders")
+	flatten := flags.Bool("flatten", false, "Close all positions")
+	reason := flags.String("reason", "", "Reason recorded with the kill switch")
+	release := flags.Bool("release", false, "Release the kill switch and execute queued signals")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s kill-switch [flags]\n\nWithout -pause, -cancel-orders, -flatten or -release the engaged kill switches are listed.\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	cfg, err := config.LoadConfig(*configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config from %s: %w", *configFile, err)
+	}
+	if cfg.Admin.Token == "" {
+		return fmt.Errorf("admin API is disabled: set admin.token in %s", *configFile)
+	}
+
+	baseURL := *server
+	if baseURL == "" {
+		host := cfg.Server.Host
+		if host == "" || host == "0.0.0.0" {
+			host = "127.0.0.1"
+		}
+		baseURL = fmt.Sprintf("http://%s:%s", host, cfg.Server.Port)
+	}
+	endpoint := baseURL + "/api/v1/admin/kill-switch"
+
+	var req *http.Request
+	switch {
+	case *release:
+		query := url.Values{}
+		query.Set("user", *user)
+		query.Set("exchange", *exchange)
+		req, err = http.NewRequest(http.MethodDelete, endpoint+"?"+query.Encode(), nil)
+	case *pause != "" || *cancelOrders || *flatten:
+		body, _ := json.Marshal(&services.KillSwitchRequest{
+			User:         *user,
+			Exchange:     *exchange,
+			Pause:        *pause,
+			CancelOrders: *cancelOrders,
+			Flatten:      *flatten,
+			Reason:       *reason,
+		})
+		req, err = http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	default:
+		req, err = http.NewRequest(http.MethodGet, endpoint, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+cfg.Admin.Token)
+
+	// Flattening waits for every exchange to answer
+	client := &http.Client{Timeout: 2 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	var pretty bytes.Buffer
+	if json.Indent(&pretty, body, "", "  ") == nil {
+		body = pretty.Bytes()
+	}
+	fmt.Println(string(body))
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("request failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"os"
 
+	_ "github.com/Cyvadra/tv-forward/broker/binance" // Registers the Binance broker
 	"github.com/Cyvadra/tv-forward/internal/config"
 	"github.com/Cyvadra/tv-forward/internal/database"
 	"github.com/Cyvadra/tv-forward/internal/handlers"
@@ -13,6 +16,20 @@ import (
 )
 
 func main() {
+	// Subcommands run instead of the server
+	if len(os.Args) > 1 && os.Args[1] == "kill-switch" {
+		if err := runKillSwitch(os.Args[2:]); err != nil {
+			log.Fatalf("Kill switch failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := runReplay(os.Args[2:]); err != nil {
+			log.Fatalf("Replay failed: %v", err)
+		}
+		return
+	}
+
 	// Parse command line flags
 	configFile := flag.String("config", "config.yaml", "Path to configuration file")
 	flag.Parse()
@@ -71,4 +88,7 @@ func setupServices(cfg *config.Config, userConfig *config.UserConfig) {
 
 	// Store the configured handler globally so routes can access it
 	handlers.SetGlobalHandler(alertHandler)
+
+	// Start background jobs such as retention archival
+	alertHandler.StartBackgroundJobs(context.Background())
 }
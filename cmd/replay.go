@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/Cyvadra/tv-forward/broker/paper"
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/database"
+	"github.com/Cyvadra/tv-forward/internal/services"
+	"gorm.io/gorm/logger"
+)
+
+// runReplay feeds a file of recorded webhooks through the execution pipeline against paper accounts
+// and prints a report of the orders, positions and PnL
+func runReplay(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	configFile := flags.String("config", "config.yaml", "Path to configuration file")
+	userConfigFile := flags.String("users", "users.yaml", "Path to user configuration file")
+	strategiesFile := flags.String("strategies", "", "JSON file with a list of strategies to configure before the replay")
+	dsn := flags.String("db", "file:replay?mode=memory&cache=shared", "Database of the replay, never the live database")
+	speed := flags.Float64("speed", 0, "Factor the gaps between webhooks are shortened by, 0 replays without waiting")
+	balance := flags.Float64("balance", paper.DefaultBalance, "Starting balance of every paper account")
+	feeRate := flags.Float64("fee-rate", paper.DefaultFeeRate, "Commission rate of every paper account")
+	output := flags.String("output", "", "File the report is written to, standard output when empty")
+	verbose := flags.Bool("verbose", false, "Log every pipeline step")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s replay [flags] webhooks.jsonl\n\nEach line is a webhook body timestamped by its timenow or time field, or an object with the body and its received_at.\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected one webhook file")
+	}
+
+	cfg, err := config.LoadConfig(*configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config from %s: %w", *configFile, err)
+	}
+	userConfig, err := config.LoadUserConfig(*userConfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to load user config from %s: %w", *userConfigFile, err)
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to open webhook file: %w", err)
+	}
+	entries, err := services.ReadReplayEntries(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+	if err := database.InitDatabase(*dsn); err != nil {
+		return err
+	}
+	if !*verbose {
+		database.GetDB().Logger = logger.Discard
+	}
+
+	replay := services.NewReplayService(services.ReplayOptions{Speed: *speed, Balance: *balance, FeeRate: *feeRate})
+	replay.SetConfig(cfg)
+	replay.SetUserConfig(userConfig)
+
+	if *strategiesFile != "" {
+		data, err := os.ReadFile(*strategiesFile)
+		if err != nil {
+			return fmt.Errorf("failed to read strategies: %w", err)
+		}
+		var strategies []services.StrategyRequest
+		if err := json.Unmarshal(data, &strategies); err != nil {
+			return fmt.Errorf("failed to parse strategies: %w", err)
+		}
+		for _, strategy := range strategies {
+			if _, err := replay.Strategies().Create(&strategy); err != nil {
+				return fmt.Errorf("failed to configure strategy %s: %w", strategy.Key, err)
+			}
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, err := replay.Run(ctx, entries)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	if *output == "" {
+		fmt.Println(string(body))
+		return nil
+	}
+	return os.WriteFile(*output, append(body, '\n'), 0o644)
+}
@@ -3,16 +3,23 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the application configuration
 type Config struct {
-	Server    ServerConfig     `yaml:"server"`
-	Database  DatabaseConfig   `yaml:"database"`
-	Endpoints []EndpointConfig `yaml:"endpoints"`
-	Trading   TradingConfig    `yaml:"trading"`
+	Server      ServerConfig      `yaml:"server"`
+	Database    DatabaseConfig    `yaml:"database"`
+	Endpoints   []EndpointConfig  `yaml:"endpoints"`
+	Trading     TradingConfig     `yaml:"trading"`
+	Admin       AdminConfig       `yaml:"admin"`
+	Retention   RetentionConfig   `yaml:"retention"`
+	Forwarding  ForwardingConfig  `yaml:"forwarding"`
+	Routing     RoutingConfig     `yaml:"routing"`
+	TelegramBot TelegramBotConfig `yaml:"telegram_bot"`
+	Parsers     []ParserConfig    `yaml:"parsers"`
 }
 
 // ServerConfig represents server configuration
@@ -30,11 +37,52 @@ type DatabaseConfig struct {
 // EndpointConfig represents a downstream endpoint configuration
 type EndpointConfig struct {
 	Name     string `yaml:"name"`
-	Type     string `yaml:"type"` // telegram, wechat, dingtalk, webhook
+	Type     string `yaml:"type"` // telegram, wechat, dingtalk, webhook, relay, slack, discord, feishu, lark, email
 	URL      string `yaml:"url"`
 	Token    string `yaml:"token,omitempty"`
 	ChatID   string `yaml:"chat_id,omitempty"`
+	Secret   string `yaml:"secret,omitempty"` // Signing secret for DingTalk and Feishu/Lark bots and webhooks
 	IsActive bool   `yaml:"is_active" default:"true"`
+	// Exclusive endpoints are left out of the default broadcast and only receive what is routed to them,
+	// such as the executions of the users that list them under notify
+	Exclusive bool `yaml:"exclusive,omitempty"`
+
+	// Message format for DingTalk (text, markdown, actionCard) and WeChat Work (text, markdown, template_card)
+	MessageType string        `yaml:"msg_type,omitempty"`
+	ActionURL   string        `yaml:"action_url,omitempty"` // Go text/template for the link of card messages
+	Mentions    MentionConfig `yaml:"mentions,omitempty"`
+
+	// Generic webhooks and relays
+	Headers       map[string]string `yaml:"headers,omitempty"`
+	BearerToken   string            `yaml:"bearer_token,omitempty"`
+	PayloadFormat string            `yaml:"payload_format,omitempty"` // alert (default), raw, signal, execution
+	Relay         RelayConfig       `yaml:"relay,omitempty"`
+
+	// Go text/template used to render messages; the channel default is used when empty
+	Template     string `yaml:"template,omitempty"`
+	TemplateFile string `yaml:"template_file,omitempty"`
+
+	// Email endpoints send through the SMTP server in URL (smtp://host:587 or smtps://host:465)
+	From     string   `yaml:"from,omitempty"`
+	To       []string `yaml:"to,omitempty"`
+	Username string   `yaml:"username,omitempty"`
+	Password string   `yaml:"password,omitempty"`
+	Subject  string   `yaml:"subject,omitempty"` // Go text/template for the subject line
+}
+
+// MentionConfig represents who a DingTalk or WeChat Work message mentions
+type MentionConfig struct {
+	Mobiles  []string `yaml:"mobiles,omitempty"`
+	UserIDs  []string `yaml:"user_ids,omitempty"`
+	All      bool     `yaml:"all,omitempty"`
+	Statuses []string `yaml:"statuses,omitempty"` // Execution statuses that trigger mentions, defaults to failed
+}
+
+// RelayConfig represents the optional rewrites of a payload relayed to another instance
+type RelayConfig struct {
+	APISec         string  `yaml:"api_sec,omitempty"`         // Replaces the api_sec of trading signals
+	Exchange       string  `yaml:"exchange,omitempty"`        // Overrides the exchange field
+	SizeMultiplier float64 `yaml:"size_multiplier,omitempty"` // Scales position sizes and quantities
 }
 
 // TradingConfig represents trading platform configuration
@@ -43,6 +91,93 @@ type TradingConfig struct {
 	Binance BinanceConfig `yaml:"binance"`
 	OKX     OKXConfig     `yaml:"okx"`
 	Derbit  DerbitConfig  `yaml:"derbit"`
+
+	OrderTracking OrderTrackingConfig `yaml:"order_tracking"`
+	UserStream    UserStreamConfig    `yaml:"user_stream"`
+	BrokerPool    BrokerPoolConfig    `yaml:"broker_pool"`
+	Risk          RiskConfig          `yaml:"risk"`
+	Drawdown      DrawdownConfig      `yaml:"drawdown"`
+	Income        IncomeConfig        `yaml:"income"`
+}
+
+// OrderTrackingConfig represents how submitted orders are followed until they reach a final state
+type OrderTrackingConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval" default:"5s"`
+	LimitTimeout time.Duration `yaml:"limit_timeout"` // Unfilled limit orders are cancelled after this time, 0 keeps them open
+}
+
+// UserStreamConfig represents the real-time user data streams kept open for exchange credentials
+type UserStreamConfig struct {
+	Enabled           bool          `yaml:"enabled" default:"false"`
+	ReconnectDelay    time.Duration `yaml:"reconnect_delay" default:"1s"` // Doubled after every failed attempt
+	MaxReconnectDelay time.Duration `yaml:"max_reconnect_delay" default:"1m"`
+}
+
+// BrokerPoolConfig represents how initialized broker clients are kept for reuse across signals
+type BrokerPoolConfig struct {
+	IdleTimeout         time.Duration `yaml:"idle_timeout" default:"30m"`         // Clients unused for this long are closed
+	HealthCheckInterval time.Duration `yaml:"health_check_interval" default:"1m"` // Unhealthy clients are closed and reconnected on next use
+}
+
+// RiskConfig represents the pre-trade limits every order is checked against. Zero values disable a limit.
+// The global limits apply to every user; limits set for a user in users.yaml replace them, and limits
+// set on a strategy replace both.
+type RiskConfig struct {
+	MaxPositionNotional float64  `yaml:"max_position_notional,omitempty" json:"max_position_notional,omitempty"` // Target position value per symbol, in quote currency
+	MaxAccountNotional  float64  `yaml:"max_account_notional,omitempty" json:"max_account_notional,omitempty"`   // Value of all open positions of a user
+	MaxLeverage         int      `yaml:"max_leverage,omitempty" json:"max_leverage,omitempty"`
+	MaxOrdersPerMinute  int      `yaml:"max_orders_per_minute,omitempty" json:"max_orders_per_minute,omitempty"`
+	MaxDailyLoss        float64  `yaml:"max_daily_loss,omitempty" json:"max_daily_loss,omitempty"`       // Realized loss since midnight UTC
+	AllowedSymbols      []string `yaml:"allowed_symbols,omitempty" json:"allowed_symbols,omitempty"`     // Empty allows all symbols
+	AllowedExchanges    []string `yaml:"allowed_exchanges,omitempty" json:"allowed_exchanges,omitempty"` // Empty allows all exchanges
+}
+
+// Merge returns the limits with the ones set in override replacing them
+func (r RiskConfig) Merge(override *RiskConfig) RiskConfig {
+	if override == nil {
+		return r
+	}
+	if override.MaxPositionNotional > 0 {
+		r.MaxPositionNotional = override.MaxPositionNotional
+	}
+	if override.MaxAccountNotional > 0 {
+		r.MaxAccountNotional = override.MaxAccountNotional
+	}
+	if override.MaxLeverage > 0 {
+		r.MaxLeverage = override.MaxLeverage
+	}
+	if override.MaxOrdersPerMinute > 0 {
+		r.MaxOrdersPerMinute = override.MaxOrdersPerMinute
+	}
+	if override.MaxDailyLoss > 0 {
+		r.MaxDailyLoss = override.MaxDailyLoss
+	}
+	if len(override.AllowedSymbols) > 0 {
+		r.AllowedSymbols = override.AllowedSymbols
+	}
+	if len(override.AllowedExchanges) > 0 {
+		r.AllowedExchanges = override.AllowedExchanges
+	}
+	return r
+}
+
+// DrawdownConfig represents the circuit breaker that pauses users whose account equity falls too far below its peak.
+// Sessions start at midnight UTC.
+type DrawdownConfig struct {
+	Enabled          bool          `yaml:"enabled" default:"false"`
+	SnapshotInterval time.Duration `yaml:"snapshot_interval" default:"5m"`
+	MaxIntraday      float64       `yaml:"max_intraday"`                  // Percent below the peak equity of the session, 0 disables
+	MaxRolling       float64       `yaml:"max_rolling"`                   // Percent below the peak equity of the rolling window, 0 disables
+	RollingWindow    time.Duration `yaml:"rolling_window" default:"168h"` // Period the rolling peak is taken over
+	Flatten          bool          `yaml:"flatten"`                       // Also close the positions of a paused user
+	AutoResume       bool          `yaml:"auto_resume"`                   // Resume at the next session instead of waiting for manual approval
+}
+
+// IncomeConfig represents the job pulling the commissions, funding fees and other income records of every credential
+type IncomeConfig struct {
+	Enabled  bool          `yaml:"enabled" default:"false"`
+	Interval time.Duration `yaml:"interval" default:"1h"`
+	Lookback time.Duration `yaml:"lookback" default:"168h"` // How far back the first pull of a credential reaches
 }
 
 // BitgetConfig represents Bitget trading platform configuration
@@ -75,6 +210,75 @@ type DerbitConfig struct {
 	IsActive  bool   `yaml:"is_active" default:"false"`
 }
 
+// AdminConfig represents configuration for the administrative API
+type AdminConfig struct {
+	Token string `yaml:"token"` // Bearer token required by /api/v1/admin endpoints
+}
+
+// RetentionConfig represents data retention and archival configuration
+type RetentionConfig struct {
+	Enabled    bool              `yaml:"enabled" default:"false"`
+	Interval   time.Duration     `yaml:"interval" default:"24h"`
+	ArchiveDir string            `yaml:"archive_dir" default:"archive"`
+	BatchSize  int               `yaml:"batch_size" default:"500"`
+	Vacuum     bool              `yaml:"vacuum" default:"true"`
+	Policies   []RetentionPolicy `yaml:"policies"`
+}
+
+// RetentionPolicy represents how long rows of a table are kept before archival
+type RetentionPolicy struct {
+	Table string `yaml:"table"` // alerts, non_trading_alerts, trading_signals, deliveries
+	Days  int    `yaml:"days"`
+}
+
+// ForwardingConfig represents retry behaviour for deliveries to downstream endpoints
+type ForwardingConfig struct {
+	MaxAttempts  int           `yaml:"max_attempts" default:"5"`
+	BaseDelay    time.Duration `yaml:"base_delay" default:"30s"`
+	MaxDelay     time.Duration `yaml:"max_delay" default:"30m"`
+	PollInterval time.Duration `yaml:"poll_interval" default:"10s"`
+}
+
+// ParserConfig maps the fields of a JSON webhook format to the TradingView signal. It is used for
+// webhooks posted to /api/v1/webhook/<name>, and for any webhook matching all of Match.
+type ParserConfig struct {
+	Name   string            `yaml:"name"`
+	Match  map[string]string `yaml:"match,omitempty"` // JSONPath expressions and the values they must have
+	Fields map[string]string `yaml:"fields"`          // Signal fields by JSON name, set from a JSONPath expression or to a constant
+}
+
+// RoutingConfig represents the rules deciding which endpoints receive an alert
+type RoutingConfig struct {
+	Rules            []RoutingRule `yaml:"rules"`
+	DefaultEndpoints []string      `yaml:"default_endpoints"` // Used when rules are configured but none matches
+}
+
+// RoutingRule routes alerts matching all of its conditions to a set of endpoints.
+// Each list matches if it is empty or contains the value (case-insensitive).
+type RoutingRule struct {
+	Name         string   `yaml:"name"`
+	Strategies   []string `yaml:"strategies,omitempty"`
+	Symbols      []string `yaml:"symbols,omitempty"`
+	Actions      []string `yaml:"actions,omitempty"`
+	Exchanges    []string `yaml:"exchanges,omitempty"`
+	Users        []string `yaml:"users,omitempty"`
+	APISecs      []string `yaml:"api_secs,omitempty"`
+	Statuses     []string `yaml:"statuses,omitempty"` // Execution status, e.g. filled or failed
+	MessageRegex string   `yaml:"message_regex,omitempty"`
+	Endpoints    []string `yaml:"endpoints"`
+	Stop         bool     `yaml:"stop,omitempty"` // Skip the remaining rules once this rule matched
+}
+
+// TelegramBotConfig represents the Telegram bot command interface
+type TelegramBotConfig struct {
+	Enabled           bool          `yaml:"enabled" default:"false"`
+	Endpoint          string        `yaml:"endpoint,omitempty"` // Telegram endpoint whose token and URL are used, the first one if empty
+	Token             string        `yaml:"token,omitempty"`    // Overrides the endpoint token
+	APIURL            string        `yaml:"api_url,omitempty"`  // Overrides the endpoint URL, e.g. a self-hosted Bot API server
+	AuthorizedChatIDs []int64       `yaml:"authorized_chat_ids"`
+	PollTimeout       time.Duration `yaml:"poll_timeout" default:"30s"`
+}
+
 // LoadConfig loads configuration from a YAML file
 func LoadConfig(filename string) (*Config, error) {
 	data, err := os.ReadFile(filename)
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -18,6 +19,9 @@ type UserConfigEntry struct {
 	Name        string                 `yaml:"name"`
 	IsActive    bool                   `yaml:"is_active" default:"true"`
 	Credentials []UserCredentialConfig `yaml:"credentials"`
+	Notify      []string               `yaml:"notify,omitempty"` // Endpoints receiving this user's execution results
+	Risk        *RiskConfig            `yaml:"risk,omitempty"`   // Replaces the global risk limits that are set here
+	Shadow      bool                   `yaml:"shadow,omitempty"` // Orders on every exchange are stored instead of placed
 }
 
 // UserCredentialConfig represents exchange credentials for a user
@@ -27,6 +31,7 @@ type UserCredentialConfig struct {
 	SecretKey  string `yaml:"secret_key"`
 	Passphrase string `yaml:"passphrase,omitempty"` // For Bitget
 	IsActive   bool   `yaml:"is_active" default:"true"`
+	Shadow     bool   `yaml:"shadow,omitempty"` // Orders on this exchange are stored instead of placed
 }
 
 // LoadUserConfig loads user configuration from a YAML file
@@ -77,3 +82,16 @@ func (uce *UserConfigEntry) GetCredentialsForExchange(exchange string) *UserCred
 	}
 	return nil
 }
+
+// ShadowMode reports whether orders of the user on an exchange are stored instead of placed
+func (uce *UserConfigEntry) ShadowMode(exchange string) bool {
+	if uce.Shadow {
+		return true
+	}
+	for i := range uce.Credentials {
+		if strings.EqualFold(uce.Credentials[i].Exchange, exchange) && uce.Credentials[i].Shadow {
+			return true
+		}
+	}
+	return false
+}
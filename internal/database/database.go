@@ -24,18 +24,35 @@ func InitDatabase(dsn string) error {
 	}
 
 	// Auto migrate the schema
-	if err := DB.AutoMigrate(
+	if err := Migrate(DB); err != nil {
+		return err
+	}
+
+	log.Println("Database initialized successfully")
+	return nil
+}
+
+// Migrate creates or updates the schema of all models
+func Migrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(
 		&models.Alert{},
 		&models.TradingSignal{},
 		&models.DownstreamEndpoint{},
 		&models.User{},
 		&models.UserCredential{},
 		&models.Position{},
+		&models.Delivery{},
+		&models.Order{},
+		&models.Balance{},
+		&models.KillSwitch{},
+		&models.EquitySnapshot{},
+		&models.Trade{},
+		&models.Income{},
+		&models.Strategy{},
+		&models.ShadowOrder{},
 	); err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
-
-	log.Println("Database initialized successfully")
 	return nil
 }
 
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/Cyvadra/tv-forward/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth returns a middleware that requires the configured admin bearer token
+func (h *AlertHandler) AdminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.config == nil || h.config.Admin.Token == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin API is disabled"})
+			return
+		}
+
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.config.Admin.Token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid admin token"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RunArchival archives and purges expired alerts and signals on demand
+func (h *AlertHandler) RunArchival(c *gin.Context) {
+	results, err := h.retentionService.RunOnce(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to run archival",
+			"details": err.Error(),
+			"results": results,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Archival completed",
+		"results": results,
+	})
+}
+
+// GetKillSwitches lists the engaged kill switches
+func (h *AlertHandler) GetKillSwitches(c *gin.Context) {
+	switches, err := h.killSwitch.Active()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve kill switches"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"kill_switches": switches})
+}
+
+// EngageKillSwitch pauses new signals, cancels open orders and flattens positions globally, per user or per exchange
+func (h *AlertHandler) EngageKillSwitch(c *gin.Context) {
+	var req services.KillSwitchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	result, err := h.killSwitch.Engage(context.WithoutCancel(c.Request.Context()), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to engage kill switch", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Kill switch engaged",
+		"result":  result,
+	})
+}
+
+// ReleaseKillSwitch resumes trading for the scope given by the user and exchange query parameters
+func (h *AlertHandler) ReleaseKillSwitch(c *gin.Context) {
+	result, err := h.killSwitch.Release(context.WithoutCancel(c.Request.Context()), c.Query("user"), c.Query("exchange"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to release kill switch", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Kill switch released",
+		"result":  result,
+	})
+}
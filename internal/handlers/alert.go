@@ -1,8 +1,7 @@
 package handlers
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"io"
 	"log"
 	"net/http"
@@ -18,38 +17,89 @@ import (
 // Global handler instance
 var globalHandler *AlertHandler
 
-// TradingViewAlert represents the structure of a TradingView webhook alert
-type TradingViewAlert struct {
-	Strategy string  `json:"strategy"`
-	Symbol   string  `json:"symbol"`
-	Action   string  `json:"action"`
-	Price    float64 `json:"price"`
-	Quantity float64 `json:"quantity"`
-	Message  string  `json:"message"`
-	// Additional fields that might be present
-	Exchange string `json:"exchange,omitempty"`
-	Time     string `json:"time,omitempty"`
-}
+// TradingViewAlert represents the structure of a legacy TradingView webhook alert
+type TradingViewAlert = services.TradingViewAlert
 
 // AlertHandler handles TradingView alert webhooks
 type AlertHandler struct {
-	alertService   *services.AlertService
-	forwardService *services.ForwardService
-	tradingService *services.TradingService
-	userService    *services.UserService
+	config           *config.Config
+	alertService     *services.AlertService
+	forwardService   *services.ForwardService
+	tradingService   *services.TradingService
+	userService      *services.UserService
+	retentionService *services.RetentionService
+	enhancedTrading  *services.EnhancedTradingService
+	telegramBot      *services.TelegramBotService
+	orderTracker     *services.OrderTracker
+	userStream       *services.UserStreamService
+	brokerPool       *services.BrokerPool
+	riskEngine       *services.RiskEngine
+	killSwitch       *services.KillSwitchService
+	equityService    *services.EquityService
+	ledger           *services.LedgerService
+	incomeService    *services.IncomeService
+	strategies       *services.StrategyService
+	shadow           *services.ShadowService
 }
 
 // NewAlertHandler creates a new alert handler
 func NewAlertHandler() *AlertHandler {
 	userService := services.NewUserService()
+	brokerPool := services.NewBrokerPool()
 	tradingService := services.NewTradingService()
 	tradingService.SetUserService(userService)
+	tradingService.SetBrokerPool(brokerPool)
+	enhancedTrading := services.NewEnhancedTradingService()
+	enhancedTrading.SetUserService(userService)
+	enhancedTrading.SetBrokerPool(brokerPool)
+	forwardService := services.NewForwardService()
+	ledger := services.NewLedgerService()
+	tradingService.SetLedger(ledger)
+	strategies := services.NewStrategyService()
+	tradingService.SetStrategyService(strategies)
+	forwardService.SetStrategyService(strategies)
+
+	// Orders that are not filled on submission are booked and notified once they are final
+	orderTracker := services.NewOrderTracker(userService, brokerPool)
+	orderTracker.OnFinal(func(signal *models.TradingSignal) {
+		if err := ledger.Record(signal); err != nil {
+			log.Printf("Failed to book trading signal %d in the ledger: %v", signal.ID, err)
+		}
+		if err := forwardService.NotifyExecution(signal); err != nil {
+			log.Printf("Failed to notify execution of trading signal %d: %v", signal.ID, err)
+		}
+	})
+	tradingService.SetOrderTracker(orderTracker)
+	tradingService.SetForwardService(forwardService)
+	riskEngine := services.NewRiskEngine(userService)
+	tradingService.SetRiskEngine(riskEngine)
+	killSwitch := services.NewKillSwitchService(enhancedTrading, userService)
+	killSwitch.SetForwardService(forwardService)
+	killSwitch.SetTradingService(tradingService)
+	tradingService.SetKillSwitch(killSwitch)
+	equityService := services.NewEquityService(enhancedTrading, userService, killSwitch)
+	userStream := services.NewUserStreamService(userService, orderTracker)
+	shadow := services.NewShadowService()
+	shadow.SetBrokerPool(brokerPool)
 
 	return &AlertHandler{
-		alertService:   services.NewAlertService(),
-		forwardService: services.NewForwardService(),
-		tradingService: tradingService,
-		userService:    userService,
+		alertService:     services.NewAlertService(),
+		forwardService:   forwardService,
+		tradingService:   tradingService,
+		userService:      userService,
+		retentionService: services.NewRetentionService(),
+		enhancedTrading:  enhancedTrading,
+		telegramBot:      services.NewTelegramBotService(enhancedTrading, userService),
+		orderTracker:     orderTracker,
+		userStream:       userStream,
+		brokerPool:       brokerPool,
+		riskEngine:       riskEngine,
+		killSwitch:       killSwitch,
+		equityService:    equityService,
+		ledger:           ledger,
+		incomeService:    services.NewIncomeService(brokerPool, ledger),
+		strategies:       strategies,
+		shadow:           shadow,
 	}
 }
 
@@ -65,17 +115,42 @@ func GetGlobalHandler() *AlertHandler {
 
 // SetConfig sets the configuration for all services
 func (h *AlertHandler) SetConfig(cfg *config.Config) {
+	h.config = cfg
 	h.forwardService.SetConfig(cfg)
 	h.tradingService.SetConfig(cfg)
+	h.retentionService.SetConfig(cfg)
+	h.enhancedTrading.SetConfig(cfg)
+	h.telegramBot.SetConfig(cfg)
+	h.orderTracker.SetConfig(cfg)
+	h.userStream.SetConfig(cfg)
+	h.brokerPool.SetConfig(cfg)
+	h.riskEngine.SetConfig(cfg)
+	h.equityService.SetConfig(cfg)
+	h.incomeService.SetConfig(cfg)
 }
 
 // SetUserConfig sets the user configuration for all services
 func (h *AlertHandler) SetUserConfig(userConfig *config.UserConfig) {
 	h.userService.SetUserConfig(userConfig)
+	h.forwardService.SetUserConfig(userConfig)
 }
 
-// HandleTradingViewAlert handles incoming TradingView alerts
+// StartBackgroundJobs starts the periodic background jobs of all services
+func (h *AlertHandler) StartBackgroundJobs(ctx context.Context) {
+	go h.retentionService.Start(ctx)
+	go h.forwardService.Start(ctx)
+	go h.telegramBot.Start(ctx)
+	go h.orderTracker.Start(ctx)
+	go h.userStream.Start(ctx)
+	go h.brokerPool.Start(ctx)
+	go h.equityService.Start(ctx)
+	go h.incomeService.Start(ctx)
+}
+
+// HandleTradingViewAlert handles incoming TradingView alerts by running them through the execution pipeline
 func (h *AlertHandler) HandleTradingViewAlert(c *gin.Context) {
+	receivedAt := time.Now()
+
 	// Read the request body
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
@@ -84,123 +159,90 @@ func (h *AlertHandler) HandleTradingViewAlert(c *gin.Context) {
 		return
 	}
 
-	// Try to parse as TradingView signal first
-	var tvSignal models.TradingViewSignal
-	if err := json.Unmarshal(body, &tvSignal); err == nil && tvSignal.APISec != "" {
-		// This is a TradingView trading signal
-		h.handleTradingViewSignal(c, &tvSignal, body)
-		return
+	execution := &services.Execution{
+		Body:       body,
+		RequestURL: c.Request.URL.String(),
+		ReceivedAt: receivedAt,
+		Parser:     c.Param("parser"),
 	}
 
-	// Try to parse as legacy alert format
-	var alert TradingViewAlert
-	flagIsTradingAlert := true
-
-	if err := json.Unmarshal(body, &alert); err != nil {
-		flagIsTradingAlert = false
-		// Log the raw request body for debugging
-		log.Printf("Raw request body: %s", string(body))
-		alert = TradingViewAlert{
-			Strategy: "alert",
-			Symbol:   "",
-			Action:   "",
-			Price:    0.0,
-			Quantity: 0.0,
-			Message:  string(body),
-			Exchange: "",
-			Time:     time.Now().Format(time.RFC3339),
+	// Orders are placed even if the sender disconnects before they are acknowledged
+	ctx := context.WithoutCancel(c.Request.Context())
+	resume, err := h.tradingService.Accept(ctx, execution)
+	if err != nil {
+		log.Printf("Failed to process alert: %v", err)
+		if execution.Alert == nil || execution.Alert.ID == 0 {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save alert"})
+			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":    "Failed to process trading signal",
+			"details":  err.Error(),
+			"alert_id": execution.Alert.ID,
+		})
+		return
 	}
 
-	// Get raw payload for logging
-	rawPayload, _ := json.Marshal(alert)
-
-	// Create alert record
-	alertRecord := &models.Alert{
-		Strategy:   alert.Strategy,
-		Symbol:     alert.Symbol,
-		Action:     alert.Action,
-		Price:      alert.Price,
-		Quantity:   alert.Quantity,
-		Message:    alert.Message,
-		RawPayload: string(rawPayload),
-		Status:     "received",
-		CreatedAt:  time.Now(),
+	// Legacy alerts and plain-text messages are traded and forwarded once their sender is answered
+	if resume != nil {
+		alertID := execution.Alert.ID
+		go resume()
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "Alert received and processed",
+			"alert_id": alertID,
+		})
+		return
 	}
 
-	// Save alert to database
-	if err := h.alertService.SaveAlert(alertRecord); err != nil {
-		log.Printf("Failed to save alert: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save alert"})
+	if execution.Alert.Status == "queued" {
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":  "Trading signal queued by kill switch",
+			"alert_id": execution.Alert.ID,
+		})
 		return
 	}
 
-	go func() {
-		if flagIsTradingAlert {
-			// Process trading signal if applicable
-			if err := h.tradingService.ProcessTradingSignal(alertRecord); err != nil {
-				log.Printf("Failed to process trading signal: %v", err)
-			}
-		} else {
-			// Otherwise, forward alert to downstream endpoints with request URL
-			requestURL := c.Request.URL.String()
-			if err := h.forwardService.ForwardAlertWithURL(alertRecord, requestURL); err != nil {
-				log.Printf("Failed to forward alert: %v", err)
+	if batch := execution.Batch; batch != nil {
+		orders := make([]gin.H, len(batch.Items))
+		for i, item := range batch.Items {
+			orders[i] = gin.H{
+				"trading_signal_id": item.Record.ID,
+				"symbol":            item.Record.Symbol,
+				"action":            item.Record.Action,
+				"status":            item.Record.Status,
+				"error":             item.Record.ErrorMessage,
 			}
 		}
-	}()
-
-	c.JSON(http.StatusOK, gin.H{
-		"message":  "Alert received and processed",
-		"alert_id": alertRecord.ID,
-	})
-}
-
-// handleTradingViewSignal handles TradingView trading signals
-func (h *AlertHandler) handleTradingViewSignal(c *gin.Context, signal *models.TradingViewSignal, body []byte) {
-	// Process the trading signal
-	if err := h.tradingService.ProcessTradingViewSignal(signal); err != nil {
-		log.Printf("Failed to process trading signal: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to process trading signal",
-			"details": err.Error(),
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "Batch received and processed",
+			"mode":     batch.Mode,
+			"orders":   orders,
+			"alert_id": execution.Alert.ID,
 		})
 		return
 	}
 
-	// Also create an alert record for tracking
-	alertRecord := &models.Alert{
-		Strategy:   "trading_signal",
-		Symbol:     signal.Symbol,
-		Action:     signal.Action,
-		Price:      0, // Will be parsed from string if needed
-		Quantity:   0, // Will be parsed from string if needed
-		Message:    fmt.Sprintf("Trading signal: %s %s %s", signal.Action, signal.Symbol, signal.PositionSize),
-		RawPayload: string(body),
-		Status:     "processed",
-		CreatedAt:  time.Now(),
-	}
-
-	// Save alert to database
-	if err := h.alertService.SaveAlert(alertRecord); err != nil {
-		log.Printf("Failed to save alert: %v", err)
+	if execution.Failed() {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":             "Failed to process trading signal",
+			"details":           execution.Record.ErrorMessage,
+			"error_code":        execution.Record.ErrorCode,
+			"status":            execution.Record.Status,
+			"trading_signal_id": execution.Record.ID,
+			"alert_id":          execution.Alert.ID,
+		})
+		return
 	}
-
-	// Forward alert to downstream endpoints
-	go func() {
-		requestURL := c.Request.URL.String()
-		if err := h.forwardService.ForwardAlertWithURL(alertRecord, requestURL); err != nil {
-			log.Printf("Failed to forward alert: %v", err)
-		}
-	}()
-
+	signal := execution.Signal
 	c.JSON(http.StatusOK, gin.H{
-		"message":   "Trading signal received and processed",
-		"signal_id": signal.ID,
-		"api_sec":   signal.APISec,
-		"symbol":    signal.Symbol,
-		"action":    signal.Action,
-		"alert_id":  alertRecord.ID,
+		"message":           "Trading signal received and processed",
+		"signal_id":         signal.ID,
+		"api_sec":           signal.APISec,
+		"symbol":            signal.Symbol,
+		"action":            signal.Action,
+		"status":            execution.Record.Status,
+		"trading_signal_id": execution.Record.ID,
+		"alert_id":          execution.Alert.ID,
 	})
 }
 
@@ -314,3 +356,170 @@ func (h *AlertHandler) GetUserPositions(c *gin.Context) {
 		"positions": positions,
 	})
 }
+
+// GetUserEquity returns the equity curve of a user and the drawdowns the circuit breaker measures.
+// The from and to query parameters are RFC 3339 times and default to the last 7 days.
+func (h *AlertHandler) GetUserEquity(c *gin.Context) {
+	apiSec := c.Param("api_sec")
+	if apiSec == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "api_sec parameter is required"})
+		return
+	}
+
+	from, to, ok := timeRange(c, time.Now().Add(-7*24*time.Hour))
+	if !ok {
+		return
+	}
+
+	user, err := h.userService.FindUser(apiSec)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	snapshots, err := h.equityService.EquityCurve(user.ID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve equity snapshots"})
+		return
+	}
+	intraday, rolling, err := h.equityService.Drawdowns(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate drawdowns"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":           user.ID,
+		"snapshots":         snapshots,
+		"intraday_drawdown": intraday,
+		"rolling_drawdown":  rolling,
+	})
+}
+
+// GetUserTrades returns the trades of a user's ledger that were open within a period.
+// The period is given by the RFC 3339 query parameters from and to and defaults to the last 30 days.
+func (h *AlertHandler) GetUserTrades(c *gin.Context) {
+	user, from, to, ok := h.ledgerQuery(c)
+	if !ok {
+		return
+	}
+
+	trades, err := h.ledger.Trades(user.ID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve trades"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": user.ID,
+		"trades":  trades,
+	})
+}
+
+// GetUserPerformance returns the performance statistics of a user in total and per strategy.
+// The period is given by the RFC 3339 query parameters from and to and defaults to the last 30 days.
+func (h *AlertHandler) GetUserPerformance(c *gin.Context) {
+	user, from, to, ok := h.ledgerQuery(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.ledger.UserPerformance(user.ID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate performance"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":     user.ID,
+		"performance": report,
+	})
+}
+
+// GetUserIncome returns the income records of a user, such as commissions and funding fees, optionally
+// of the income type in the type query parameter. The period is given by the RFC 3339 query parameters
+// from and to and defaults to the last 30 days.
+func (h *AlertHandler) GetUserIncome(c *gin.Context) {
+	user, from, to, ok := h.ledgerQuery(c)
+	if !ok {
+		return
+	}
+
+	incomes, err := h.incomeService.Incomes(user.ID, c.Query("type"), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve income"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": user.ID,
+		"income":  incomes,
+	})
+}
+
+// GetStrategyPerformance returns the performance statistics of every strategy over all users.
+// The period is given by the RFC 3339 query parameters from and to and defaults to the last 30 days.
+func (h *AlertHandler) GetStrategyPerformance(c *gin.Context) {
+	from, to, ok := timeRange(c, time.Now().Add(-30*24*time.Hour))
+	if !ok {
+		return
+	}
+
+	report, err := h.ledger.StrategyPerformance(from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate performance"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"performance": report,
+	})
+}
+
+// ledgerQuery resolves the user and period of a ledger request. Without the periodic income pull the
+// income of the user is synchronized first so the trades include the latest funding fees.
+func (h *AlertHandler) ledgerQuery(c *gin.Context) (*models.User, time.Time, time.Time, bool) {
+	apiSec := c.Param("api_sec")
+	if apiSec == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "api_sec parameter is required"})
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	from, to, ok := timeRange(c, time.Now().Add(-30*24*time.Hour))
+	if !ok {
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	user, err := h.userService.FindUser(apiSec)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	if !h.incomeService.Scheduled() {
+		if err := h.incomeService.SyncUser(c.Request.Context(), user.ID); err != nil {
+			log.Printf("Failed to synchronize income of user %d: %v", user.ID, err)
+		}
+	}
+	return user, from, to, true
+}
+
+// timeRange parses the RFC 3339 query parameters from and to. An omitted to is open-ended.
+// It responds with an error and returns false for invalid times.
+func timeRange(c *gin.Context, defaultFrom time.Time) (from, to time.Time, ok bool) {
+	from = defaultFrom
+	var err error
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from time"})
+			return from, to, false
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to time"})
+			return from, to, false
+		}
+	}
+	return from, to, true
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDeliveries retrieves downstream deliveries with pagination
+func (h *AlertHandler) GetDeliveries(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	status := c.Query("status")
+	endpoint := c.Query("endpoint")
+
+	deliveries, total, err := h.forwardService.GetDeliveries(page, limit, status, endpoint)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+	})
+}
+
+// GetAlertDeliveries retrieves the deliveries of an alert, including downstream responses
+func (h *AlertHandler) GetAlertDeliveries(c *gin.Context) {
+	alertID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid alert ID"})
+		return
+	}
+
+	deliveries, err := h.forwardService.GetAlertDeliveries(uint(alertID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// ReplayDelivery sends a single delivery again
+func (h *AlertHandler) ReplayDelivery(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return
+	}
+
+	delivery, err := h.forwardService.ReplayDelivery(uint(id))
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Failed to replay delivery",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// ReplayDeadDeliveries schedules all dead-lettered deliveries for another round of attempts
+func (h *AlertHandler) ReplayDeadDeliveries(c *gin.Context) {
+	count, err := h.forwardService.ReplayDeadDeliveries()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Dead deliveries scheduled for retry",
+		"scheduled": count,
+	})
+}
@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMetrics returns the latencies of signal execution and the state of the broker pool
+func (h *AlertHandler) GetMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"latency":     h.tradingService.Metrics().Snapshot(),
+		"broker_pool": h.brokerPool.Stats(),
+	})
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/Cyvadra/tv-forward/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// DryRunRouting shows which endpoints an example webhook payload would be forwarded to.
+// The execution outcome and user can be simulated with the status and user query parameters.
+func (h *AlertHandler) DryRunRouting(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	notification := &services.Notification{RequestURL: c.Request.URL.String()}
+
+	var tvSignal models.TradingViewSignal
+	var alert TradingViewAlert
+	if err := json.Unmarshal(body, &tvSignal); err == nil && tvSignal.APISec != "" {
+		notification.Signal = &tvSignal
+		notification.UserName = h.userService.GetUserName(tvSignal.APISec)
+		strategy := tvSignal.StrategyKey()
+		if strategy == "" {
+			strategy = "trading_signal"
+		}
+		notification.Alert = &models.Alert{
+			Strategy:   strategy,
+			Symbol:     tvSignal.Symbol,
+			Action:     tvSignal.Action,
+			Message:    fmt.Sprintf("Trading signal: %s %s %s", tvSignal.Action, tvSignal.Symbol, tvSignal.PositionSize),
+			RawPayload: string(body),
+		}
+	} else if err := json.Unmarshal(body, &alert); err == nil {
+		notification.Alert = &models.Alert{
+			Strategy:   alert.Strategy,
+			Symbol:     alert.Symbol,
+			Action:     alert.Action,
+			Price:      alert.Price,
+			Quantity:   alert.Quantity,
+			Message:    alert.Message,
+			RawPayload: string(body),
+		}
+	} else {
+		notification.Alert = &models.Alert{Strategy: "alert", Message: string(body), RawPayload: string(body)}
+	}
+	notification.Alert.CreatedAt = time.Now()
+
+	if user := c.Query("user"); user != "" {
+		notification.UserName = user
+	}
+	if status := c.Query("status"); status != "" {
+		notification.Execution = &models.TradingSignal{Status: status}
+	}
+
+	c.JSON(http.StatusOK, h.forwardService.Route(notification))
+}
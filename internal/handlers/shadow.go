@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserShadowOrders returns the orders stored for a user in shadow mode, optionally of the exchange
+// query parameter. The period is given by the RFC 3339 query parameters from and to and defaults to
+// the last 30 days.
+func (h *AlertHandler) GetUserShadowOrders(c *gin.Context) {
+	user, from, to, ok := h.ledgerQuery(c)
+	if !ok {
+		return
+	}
+
+	orders, err := h.shadow.Orders(user.ID, c.Query("exchange"), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve shadow orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": user.ID,
+		"orders":  orders,
+	})
+}
+
+// CompareShadowOrders pairs the shadow orders of a user with the orders of the live user in the live
+// query parameter and lists their divergences. The exchange and live_exchange query parameters narrow
+// down either side, window sets how far apart paired orders may be. The period is given by the
+// RFC 3339 query parameters from and to and defaults to the last 30 days.
+func (h *AlertHandler) CompareShadowOrders(c *gin.Context) {
+	user, from, to, ok := h.ledgerQuery(c)
+	if !ok {
+		return
+	}
+
+	liveName := c.Query("live")
+	if liveName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "live parameter is required"})
+		return
+	}
+	live, err := h.userService.FindUser(liveName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Live user not found"})
+		return
+	}
+
+	window := services.DefaultShadowWindow
+	if value := c.Query("window"); value != "" {
+		if window, err = time.ParseDuration(value); err != nil || window <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid window"})
+			return
+		}
+	}
+
+	comparison, err := h.shadow.Compare(c.Request.Context(), &services.ShadowCompareRequest{
+		ShadowUserID:   user.ID,
+		ShadowExchange: c.Query("exchange"),
+		LiveUserID:     live.ID,
+		LiveExchange:   c.Query("live_exchange"),
+		From:           from,
+		To:             to,
+		Window:         window,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compare shadow orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":      user.ID,
+		"live_user_id": live.ID,
+		"comparison":   comparison,
+	})
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// GetStrategies lists the strategies
+func (h *AlertHandler) GetStrategies(c *gin.Context) {
+	strategies, err := h.strategies.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve strategies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"strategies": strategies})
+}
+
+// GetStrategy returns the strategy of the key path parameter
+func (h *AlertHandler) GetStrategy(c *gin.Context) {
+	strategy, err := h.strategies.Get(c.Param("key"))
+	if err != nil {
+		strategyError(c, err, "Failed to retrieve strategy")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"strategy": strategy})
+}
+
+// CreateStrategy stores a new strategy, so it can be configured before its first signal
+func (h *AlertHandler) CreateStrategy(c *gin.Context) {
+	var req services.StrategyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	strategy, err := h.strategies.Create(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create strategy", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"strategy": strategy})
+}
+
+// UpdateStrategy changes the fields of a strategy that are set in the request body
+func (h *AlertHandler) UpdateStrategy(c *gin.Context) {
+	var req services.StrategyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	strategy, err := h.strategies.Update(c.Param("key"), &req)
+	if err != nil {
+		strategyError(c, err, "Failed to update strategy")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"strategy": strategy})
+}
+
+// DeleteStrategy removes a strategy. Its signals, orders and trades are kept.
+func (h *AlertHandler) DeleteStrategy(c *gin.Context) {
+	if err := h.strategies.Delete(c.Param("key")); err != nil {
+		strategyError(c, err, "Failed to delete strategy")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Strategy deleted"})
+}
+
+// GetStrategyDashboard returns the performance of a strategy in total, per symbol and per user,
+// together with its open trades. The period is given by the RFC 3339 query parameters from and to
+// and defaults to the last 30 days.
+func (h *AlertHandler) GetStrategyDashboard(c *gin.Context) {
+	from, to, ok := timeRange(c, time.Now().Add(-30*24*time.Hour))
+	if !ok {
+		return
+	}
+
+	strategy, err := h.strategies.Get(c.Param("key"))
+	if err != nil {
+		strategyError(c, err, "Failed to retrieve strategy")
+		return
+	}
+
+	report, err := h.ledger.StrategyDashboard(strategy, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate performance"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"performance": report})
+}
+
+// strategyError responds with 404 for unknown strategies and with 400 otherwise
+func strategyError(c *gin.Context, err error, message string) {
+	if errors.Is(err, services.ErrStrategyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Strategy not found"})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": message, "details": err.Error()})
+}
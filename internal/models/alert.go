@@ -8,18 +8,19 @@ import (
 
 // Alert represents a TradingView alert
 type Alert struct {
-	ID         uint           `json:"id" gorm:"primaryKey"`
-	Strategy   string         `json:"strategy"`
-	Symbol     string         `json:"symbol"`
-	Action     string         `json:"action"` // buy, sell, close
-	Price      float64        `json:"price"`
-	Quantity   float64        `json:"quantity"`
-	Message    string         `json:"message"`
-	RawPayload string         `json:"raw_payload" gorm:"type:text"`
-	Status     string         `json:"status" gorm:"default:'received'"` // received, processed, failed
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	Strategy      string         `json:"strategy"`
+	Symbol        string         `json:"symbol"`
+	Action        string         `json:"action"` // buy, sell, close
+	Price         float64        `json:"price"`
+	Quantity      float64        `json:"quantity"`
+	Message       string         `json:"message"`
+	RawPayload    string         `json:"raw_payload" gorm:"type:text"`
+	SignalPayload string         `json:"signal_payload,omitempty" gorm:"type:text"` // canonical signal of parsed webhooks, replayed instead of the raw payload
+	Status        string         `json:"status" gorm:"default:'received'"`          // received, queued, processed, failed
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
 }
 
 // DownstreamEndpoint represents a webhook endpoint configuration
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Balance represents the latest wallet balance of an asset on a user's exchange account
+type Balance struct {
+	ID                 uint           `json:"id" gorm:"primaryKey"`
+	UserID             uint           `json:"user_id" gorm:"uniqueIndex:idx_balance_account"`
+	Exchange           string         `json:"exchange" gorm:"uniqueIndex:idx_balance_account"`
+	Asset              string         `json:"asset" gorm:"uniqueIndex:idx_balance_account"`
+	WalletBalance      string         `json:"wallet_balance"`
+	CrossWalletBalance string         `json:"cross_wallet_balance"`
+	UpdateReason       string         `json:"update_reason,omitempty"` // ORDER, FUNDING_FEE, DEPOSIT, ...
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Delivery statuses
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusSending   = "sending"
+	DeliveryStatusRetrying  = "retrying"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusDead      = "dead"
+)
+
+// Delivery represents the forwarding of an alert to a single downstream endpoint
+type Delivery struct {
+	ID           uint           `json:"id" gorm:"primaryKey"`
+	AlertID      uint           `json:"alert_id" gorm:"index"`
+	SignalID     uint           `json:"signal_id,omitempty"` // Executed trading signal rendered into the message
+	EndpointName string         `json:"endpoint_name" gorm:"index"`
+	EndpointType string         `json:"endpoint_type"`
+	RequestURL   string         `json:"request_url"`
+	Status       string         `json:"status" gorm:"index;default:'pending'"` // pending, sending, retrying, delivered, dead
+	Attempts     int            `json:"attempts"`
+	LastError    string         `json:"last_error,omitempty" gorm:"type:text"`
+	NextRetryAt  *time.Time     `json:"next_retry_at,omitempty" gorm:"index"`
+	DeliveredAt  *time.Time     `json:"delivered_at,omitempty"`
+	ResponseCode int            `json:"response_code,omitempty"`                  // Downstream HTTP status of the last attempt
+	ResponseBody string         `json:"response_body,omitempty" gorm:"type:text"` // Downstream response of the last attempt, truncated
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+}
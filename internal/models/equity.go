@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EquitySnapshot records the account equity of a user summed over the exchanges of their active credentials
+type EquitySnapshot struct {
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	UserID        uint           `json:"user_id" gorm:"index:idx_equity_user_time"`
+	Equity        string         `json:"equity"` // Total margin balance: wallet balance plus unrealized PnL
+	WalletBalance string         `json:"wallet_balance"`
+	UnrealizedPnL string         `json:"unrealized_pnl"`
+	Exchanges     int            `json:"exchanges"` // Number of exchange accounts summed
+	CreatedAt     time.Time      `json:"created_at" gorm:"index:idx_equity_user_time"`
+	DeletedAt     gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Kill switch sources
+const (
+	KillSwitchSourceAdmin    = "admin"    // Engaged through the admin API or the command line
+	KillSwitchSourceDrawdown = "drawdown" // Engaged by the drawdown circuit breaker
+)
+
+// Kill switch modes deciding what happens to new signals while a switch is engaged
+const (
+	KillSwitchModeReject = "reject" // Signals are recorded as failed
+	KillSwitchModeQueue  = "queue"  // Signals are kept and executed once the switch is released
+)
+
+// KillSwitch pauses trading globally, for a user or for an exchange until it is released
+type KillSwitch struct {
+	ID         uint           `json:"id" gorm:"primaryKey"`
+	UserID     uint           `json:"user_id" gorm:"index"`  // 0 applies to every user
+	Exchange   string         `json:"exchange" gorm:"index"` // Empty applies to every exchange
+	Mode       string         `json:"mode"`                  // reject, queue
+	Reason     string         `json:"reason,omitempty"`
+	Source     string         `json:"source"` // admin, drawdown
+	Active     bool           `json:"active" gorm:"index"`
+	ReleasedAt *time.Time     `json:"released_at,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+}
+
+// Applies reports whether the switch covers signals of a user on an exchange
+func (k *KillSwitch) Applies(userID uint, exchange string) bool {
+	return (k.UserID == 0 || k.UserID == userID) && (k.Exchange == "" || k.Exchange == exchange)
+}
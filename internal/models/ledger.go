@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+)
+
+// Trade statuses
+const (
+	TradeStatusOpen   = "open"
+	TradeStatusClosed = "closed"
+)
+
+// Trade is a round trip of the trade ledger: a position of a user on a symbol from the fill that
+// opened it to the fill that closed it. Trades are booked from the trading signals as they fill.
+type Trade struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	UserID        uint       `json:"user_id" gorm:"index:idx_trade_user_symbol"`
+	Exchange      string     `json:"exchange" gorm:"index:idx_trade_user_symbol"`
+	Symbol        string     `json:"symbol" gorm:"index:idx_trade_user_symbol"`
+	StrategyID    uint       `json:"strategy_id,omitempty" gorm:"index"`
+	Strategy      string     `json:"strategy" gorm:"index"` // Key of the strategy that opened the position
+	Side          string     `json:"side"`                  // long, short
+	Quantity      string     `json:"quantity"`              // Total quantity of the fills that opened or increased the position
+	Size          string     `json:"size"`                  // Open size, 0 once closed
+	EntryPrice    string     `json:"entry_price"`           // Average entry price of the position
+	ExitPrice     string     `json:"exit_price,omitempty"`  // Average price of the fills that reduced or closed the position
+	RealizedPnL   string     `json:"realized_pnl"`          // Before fees and funding
+	Fees          string     `json:"fees"`                  // Commissions paid, positive
+	Funding       string     `json:"funding"`               // Funding fees received, negative when paid
+	NetPnL        string     `json:"net_pnl"`               // Realized PnL less fees plus funding
+	EntrySignalID uint       `json:"entry_signal_id"`
+	ExitSignalID  uint       `json:"exit_signal_id,omitempty"`
+	Status        string     `json:"status" gorm:"index"` // open, closed
+	OpenedAt      time.Time  `json:"opened_at"`
+	ClosedAt      *time.Time `json:"closed_at,omitempty" gorm:"index"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// Income is an income record of an exchange account, such as a commission or a funding fee.
+// Records are attributed to the trading signal and position of their symbol.
+type Income struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	UserID          uint      `json:"user_id" gorm:"index:idx_income_user_time"`
+	Exchange        string    `json:"exchange" gorm:"uniqueIndex:idx_income_tran"`
+	TranID          string    `json:"tran_id" gorm:"uniqueIndex:idx_income_tran"` // Transaction ID of the exchange
+	Symbol          string    `json:"symbol"`
+	Type            string    `json:"type" gorm:"index"` // REALIZED_PNL, COMMISSION, FUNDING_FEE, INSURANCE_CLEAR
+	Amount          string    `json:"amount"`            // Negative for costs
+	Asset           string    `json:"asset"`
+	TradeID         string    `json:"trade_id,omitempty"`
+	TradingSignalID uint      `json:"trading_signal_id,omitempty" gorm:"index"` // Latest filled signal of the symbol before the record
+	PositionID      uint      `json:"position_id,omitempty" gorm:"index"`
+	Time            time.Time `json:"time" gorm:"index:idx_income_user_time"`
+	CreatedAt       time.Time `json:"created_at"`
+}
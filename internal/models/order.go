@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Order statuses as reported by the exchanges
+const (
+	OrderStatusNew             = "NEW"
+	OrderStatusPartiallyFilled = "PARTIALLY_FILLED"
+	OrderStatusFilled          = "FILLED"
+	OrderStatusCanceled        = "CANCELED"
+	OrderStatusRejected        = "REJECTED"
+	OrderStatusExpired         = "EXPIRED"
+)
+
+// Order represents an exchange order placed for a trading signal, tracked until it is final
+type Order struct {
+	ID               uint           `json:"id" gorm:"primaryKey"`
+	TradingSignalID  uint           `json:"trading_signal_id" gorm:"index"`
+	UserID           uint           `json:"user_id" gorm:"index"`
+	StrategyID       uint           `json:"strategy_id,omitempty" gorm:"index"`
+	Exchange         string         `json:"exchange"`
+	Symbol           string         `json:"symbol"`
+	ExchangeOrderID  string         `json:"exchange_order_id" gorm:"index"`
+	ClientOrderID    string         `json:"client_order_id,omitempty"`
+	Side             string         `json:"side"`
+	Type             string         `json:"type"`
+	PositionSide     string         `json:"position_side,omitempty"`
+	Quantity         string         `json:"quantity"`
+	Price            string         `json:"price,omitempty"`
+	ExecutedQuantity string         `json:"executed_quantity"`
+	AvgPrice         string         `json:"avg_price,omitempty"`
+	Fee              string         `json:"fee,omitempty"`
+	FeeAsset         string         `json:"fee_asset,omitempty"`
+	RealizedPnL      string         `json:"realized_pnl,omitempty"`
+	Status           string         `json:"status" gorm:"index"`  // NEW, PARTIALLY_FILLED, FILLED, CANCELED, REJECTED, EXPIRED
+	ExpiresAt        *time.Time     `json:"expires_at,omitempty"` // Unfilled limit orders are cancelled after this time
+	LastCheckedAt    *time.Time     `json:"last_checked_at,omitempty"`
+	LastError        string         `json:"last_error,omitempty" gorm:"type:text"`
+	CompletedAt      *time.Time     `json:"completed_at,omitempty"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+}
+
+// IsFinal reports whether the order can no longer change
+func (o *Order) IsFinal() bool {
+	switch o.Status {
+	case OrderStatusFilled, OrderStatusCanceled, OrderStatusRejected, OrderStatusExpired:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// ShadowOrder is the order a trading signal would have placed on an account in shadow mode. Shadow
+// signals run through the whole pipeline, but their orders are stored instead of being sent to the
+// exchange.
+type ShadowOrder struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	TradingSignalID uint      `json:"trading_signal_id" gorm:"index"`
+	UserID          uint      `json:"user_id" gorm:"index"`
+	StrategyID      uint      `json:"strategy_id,omitempty" gorm:"index"`
+	Exchange        string    `json:"exchange"`
+	Symbol          string    `json:"symbol"` // As formatted for the exchange
+	Side            string    `json:"side"`
+	Type            string    `json:"type"`
+	Quantity        string    `json:"quantity"`
+	Price           string    `json:"price,omitempty"`
+	PositionSide    string    `json:"position_side,omitempty"`
+	TimeInForce     string    `json:"time_in_force,omitempty"`
+	ReduceOnly      bool      `json:"reduce_only"`
+	CreatedAt       time.Time `json:"created_at" gorm:"index"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+)
+
+// Strategy groups the signals sent by one TradingView strategy. It is identified by the key sent in
+// the strategy field of a signal, or by its aid, and created on its first signal.
+type Strategy struct {
+	ID             uint               `json:"id" gorm:"primaryKey"`
+	Key            string             `json:"key" gorm:"uniqueIndex;not null"`
+	Name           string             `json:"name"`
+	Description    string             `json:"description,omitempty"`
+	Enabled        bool               `json:"enabled"`                                 // Signals of a disabled strategy are recorded as failed
+	SizeMultiplier float64            `json:"size_multiplier"`                         // Scales the position sizes of the signals, 1 keeps them
+	Risk           *config.RiskConfig `json:"risk,omitempty" gorm:"serializer:json"`   // Replaces the global and user risk limits that are set here
+	Notify         []string           `json:"notify,omitempty" gorm:"serializer:json"` // Endpoints receiving the notifications of this strategy
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+}
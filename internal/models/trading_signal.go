@@ -39,6 +39,17 @@ type TradingViewSignal struct {
 	SLTPType               string `json:"sltp_type"`
 	AID                    string `json:"aid"`
 	APISec                 string `json:"api_sec"`
+	Strategy               string `json:"strategy"` // Key of the strategy, the aid identifies it when empty
+
+	ReceivedAt time.Time `json:"-"` // When the webhook arrived, set by the server
+}
+
+// StrategyKey returns the key of the strategy that sent the signal, empty when the signal names none
+func (s *TradingViewSignal) StrategyKey() string {
+	if s.Strategy != "" {
+		return s.Strategy
+	}
+	return s.AID
 }
 
 // User represents a user account identified by api_sec
@@ -102,6 +113,7 @@ type TradingSignal struct {
 	ID                     uint           `json:"id" gorm:"primaryKey"`
 	UserID                 uint           `json:"user_id" gorm:"not null"`
 	AlertID                uint           `json:"alert_id,omitempty"`
+	StrategyID             uint           `json:"strategy_id,omitempty" gorm:"index"`
 	Alert                  Alert          `json:"alert,omitempty" gorm:"foreignKey:AlertID"`
 	SignalID               string         `json:"signal_id"` // From TradingView signal
 	Symbol                 string         `json:"symbol"`
@@ -117,7 +129,14 @@ type TradingSignal struct {
 	TradingMode            string         `json:"trading_mode"`
 	OrderType              string         `json:"order_type"`
 	OrderID                string         `json:"order_id"`
-	Status                 string         `json:"status"` // pending, filled, cancelled, failed
+	FilledQuantity         string         `json:"filled_quantity,omitempty"`
+	AvgPrice               string         `json:"avg_price,omitempty"`
+	Fee                    string         `json:"fee,omitempty"`
+	FeeAsset               string         `json:"fee_asset,omitempty"`
+	RealizedPnL            string         `json:"realized_pnl,omitempty"` // Set when the order reduced or closed a position
+	Status                 string         `json:"status"`                 // pending, filled, cancelled, failed, shadow
+	ErrorCode              string         `json:"error_code,omitempty"`   // broker.BrokerError code of failed executions, RISK_REJECTED for risk rejections
+	RiskRule               string         `json:"risk_rule,omitempty"`    // Risk rule that rejected the signal
 	ErrorMessage           string         `json:"error_message,omitempty"`
 	ExecutedAt             *time.Time     `json:"executed_at"`
 	RawPayload             string         `json:"raw_payload" gorm:"type:text"`
@@ -19,6 +19,8 @@ func SetupRoutes(r *gin.Engine) {
 	{
 		// TradingView webhook endpoint
 		api.POST("/webhook/tradingview", alertHandler.HandleTradingViewAlert)
+		// Webhooks of other formats, decoded by the signal parser of that name
+		api.POST("/webhook/:parser", alertHandler.HandleTradingViewAlert)
 
 		// Alert management endpoints
 		alerts := api.Group("/alerts")
@@ -26,6 +28,7 @@ func SetupRoutes(r *gin.Engine) {
 			alerts.GET("", alertHandler.GetAlerts)
 			alerts.GET("/:id", alertHandler.GetAlert)
 			alerts.GET("/:id/signals", alertHandler.GetTradingSignals)
+			alerts.GET("/:id/deliveries", alertHandler.GetAlertDeliveries)
 		}
 
 		// User management endpoints
@@ -33,6 +36,55 @@ func SetupRoutes(r *gin.Engine) {
 		{
 			users.GET("/:api_sec/signals", alertHandler.GetUserSignals)
 			users.GET("/:api_sec/positions", alertHandler.GetUserPositions)
+			users.GET("/:api_sec/equity", alertHandler.GetUserEquity)
+			users.GET("/:api_sec/trades", alertHandler.GetUserTrades)
+			users.GET("/:api_sec/performance", alertHandler.GetUserPerformance)
+			users.GET("/:api_sec/income", alertHandler.GetUserIncome)
+			users.GET("/:api_sec/shadow-orders", alertHandler.GetUserShadowOrders)
+			users.GET("/:api_sec/shadow-compare", alertHandler.CompareShadowOrders)
+		}
+
+		// Performance analytics endpoints
+		analytics := api.Group("/analytics")
+		{
+			analytics.GET("/strategies", alertHandler.GetStrategyPerformance)
+			analytics.GET("/strategies/:key", alertHandler.GetStrategyDashboard)
+		}
+
+		// Strategy management endpoints
+		strategies := api.Group("/strategies")
+		{
+			strategies.GET("", alertHandler.GetStrategies)
+			strategies.GET("/:key", alertHandler.GetStrategy)
+			strategies.POST("", alertHandler.AdminAuth(), alertHandler.CreateStrategy)
+			strategies.PUT("/:key", alertHandler.AdminAuth(), alertHandler.UpdateStrategy)
+			strategies.DELETE("/:key", alertHandler.AdminAuth(), alertHandler.DeleteStrategy)
+		}
+
+		// Delivery management endpoints
+		deliveries := api.Group("/deliveries")
+		{
+			deliveries.GET("", alertHandler.GetDeliveries)
+			deliveries.POST("/replay", alertHandler.AdminAuth(), alertHandler.ReplayDeadDeliveries)
+			deliveries.POST("/:id/replay", alertHandler.AdminAuth(), alertHandler.ReplayDelivery)
+		}
+
+		// Routing endpoints
+		routing := api.Group("/routing")
+		{
+			routing.POST("/dry-run", alertHandler.DryRunRouting)
+		}
+
+		// Execution latency and broker pool metrics
+		api.GET("/metrics", alertHandler.GetMetrics)
+
+		// Administrative endpoints
+		admin := api.Group("/admin", alertHandler.AdminAuth())
+		{
+			admin.POST("/archive", alertHandler.RunArchival)
+			admin.GET("/kill-switch", alertHandler.GetKillSwitches)
+			admin.POST("/kill-switch", alertHandler.EngageKillSwitch)
+			admin.DELETE("/kill-switch", alertHandler.ReleaseKillSwitch)
 		}
 	}
 
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/models"
+)
+
+// PerformanceStats summarizes the trades of the ledger over a period. Trades count once they are
+// closed within the period; open trades only add to the exposure time.
+type PerformanceStats struct {
+	Trades            int      `json:"trades"`
+	Wins              int      `json:"wins"`
+	Losses            int      `json:"losses"`
+	WinRate           float64  `json:"win_rate"` // Percent of trades with a positive net PnL
+	GrossProfit       float64  `json:"gross_profit"`
+	GrossLoss         float64  `json:"gross_loss"`    // Sum of the losing trades, positive
+	ProfitFactor      *float64 `json:"profit_factor"` // Gross profit over gross loss, null without losses
+	NetPnL            float64  `json:"net_pnl"`
+	Fees              float64  `json:"fees"`
+	Funding           float64  `json:"funding"`
+	SharpeRatio       float64  `json:"sharpe_ratio"`        // Annualized from the daily net PnL, days without trades included
+	MaxDrawdown       float64  `json:"max_drawdown"`        // Largest fall of the cumulative net PnL below its peak
+	ExposureTime      float64  `json:"exposure_time"`       // Percent of the period with an open position
+	AvgHoldingSeconds float64  `json:"avg_holding_seconds"` // Average time from opening to closing a trade
+}
+
+// PerformanceReport holds the performance over a period in total and per strategy
+type PerformanceReport struct {
+	From       time.Time                    `json:"from"`
+	To         time.Time                    `json:"to"`
+	Total      *PerformanceStats            `json:"total"`
+	ByStrategy map[string]*PerformanceStats `json:"by_strategy"`
+}
+
+// StrategyReport holds the performance of a single strategy over a period in total, per symbol and per user
+type StrategyReport struct {
+	Strategy   *models.Strategy             `json:"strategy"`
+	From       time.Time                    `json:"from"`
+	To         time.Time                    `json:"to"`
+	Total      *PerformanceStats            `json:"total"`
+	BySymbol   map[string]*PerformanceStats `json:"by_symbol"`
+	ByUser     map[uint]*PerformanceStats   `json:"by_user"` // Keyed by user ID
+	OpenTrades []models.Trade               `json:"open_trades"`
+}
+
+// UserPerformance reports the performance of a user's trades within a period
+func (s *LedgerService) UserPerformance(userID uint, from, to time.Time) (*PerformanceReport, error) {
+	trades, err := s.Trades(userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return newPerformanceReport(trades, from, to), nil
+}
+
+// StrategyPerformance reports the performance of the trades of every user within a period
+func (s *LedgerService) StrategyPerformance(from, to time.Time) (*PerformanceReport, error) {
+	trades, err := s.strategyTrades("", from, to)
+	if err != nil {
+		return nil, err
+	}
+	return newPerformanceReport(trades, from, to), nil
+}
+
+// StrategyDashboard reports the performance of the trades of a strategy within a period
+func (s *LedgerService) StrategyDashboard(strategy *models.Strategy, from, to time.Time) (*StrategyReport, error) {
+	trades, err := s.strategyTrades(strategy.Key, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	performance := newPerformanceReport(trades, from, to)
+	report := &StrategyReport{
+		Strategy:   strategy,
+		From:       performance.From,
+		To:         performance.To,
+		Total:      performance.Total,
+		BySymbol:   statsBy(trades, performance.From, performance.To, func(trade models.Trade) string { return trade.Symbol }),
+		ByUser:     statsBy(trades, performance.From, performance.To, func(trade models.Trade) uint { return trade.UserID }),
+		OpenTrades: []models.Trade{},
+	}
+	for _, trade := range trades {
+		if trade.Status == models.TradeStatusOpen {
+			report.OpenTrades = append(report.OpenTrades, trade)
+		}
+	}
+	return report, nil
+}
+
+// strategyTrades returns the trades of every user that were open within a period, all strategies
+// for an empty key
+func (s *LedgerService) strategyTrades(key string, from, to time.Time) ([]models.Trade, error) {
+	query := s.db.Model(&models.Trade{})
+	if key != "" {
+		query = query.Where("strategy = ?", key)
+	}
+	if !from.IsZero() {
+		query = query.Where("closed_at IS NULL OR closed_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("opened_at <= ?", to)
+	}
+
+	var trades []models.Trade
+	if err := query.Order("opened_at, id").Find(&trades).Error; err != nil {
+		return nil, fmt.Errorf("failed to get trades: %w", err)
+	}
+	return trades, nil
+}
+
+// newPerformanceReport calculates the statistics of a set of trades. An open period starts with
+// the first trade and ends now.
+func newPerformanceReport(trades []models.Trade, from, to time.Time) *PerformanceReport {
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to
+		for _, trade := range trades {
+			if trade.OpenedAt.Before(from) {
+				from = trade.OpenedAt
+			}
+		}
+	}
+
+	return &PerformanceReport{
+		From:       from,
+		To:         to,
+		Total:      performanceStats(trades, from, to),
+		ByStrategy: statsBy(trades, from, to, func(trade models.Trade) string { return trade.Strategy }),
+	}
+}
+
+// statsBy calculates the statistics of the trades within a period per group
+func statsBy[K comparable](trades []models.Trade, from, to time.Time, group func(models.Trade) K) map[K]*PerformanceStats {
+	groups := make(map[K][]models.Trade)
+	for _, trade := range trades {
+		key := group(trade)
+		groups[key] = append(groups[key], trade)
+	}
+
+	stats := make(map[K]*PerformanceStats, len(groups))
+	for key, groupTrades := range groups {
+		stats[key] = performanceStats(groupTrades, from, to)
+	}
+	return stats
+}
+
+// performanceStats calculates the statistics of the trades within a period
+func performanceStats(trades []models.Trade, from, to time.Time) *PerformanceStats {
+	stats := &PerformanceStats{}
+
+	var closed []models.Trade
+	for _, trade := range trades {
+		if trade.ClosedAt != nil && !trade.ClosedAt.Before(from) && !trade.ClosedAt.After(to) {
+			closed = append(closed, trade)
+		}
+	}
+	sort.SliceStable(closed, func(i, j int) bool { return closed[i].ClosedAt.Before(*closed[j].ClosedAt) })
+
+	var holding time.Duration
+	cumulative, peak := 0.0, 0.0
+	for _, trade := range closed {
+		pnl := parseAmount(trade.NetPnL)
+		stats.Trades++
+		stats.NetPnL += pnl
+		stats.Fees += parseAmount(trade.Fees)
+		stats.Funding += parseAmount(trade.Funding)
+		if pnl > 0 {
+			stats.Wins++
+			stats.GrossProfit += pnl
+		} else if pnl < 0 {
+			stats.Losses++
+			stats.GrossLoss -= pnl
+		}
+		holding += trade.ClosedAt.Sub(trade.OpenedAt)
+
+		cumulative += pnl
+		peak = math.Max(peak, cumulative)
+		stats.MaxDrawdown = math.Max(stats.MaxDrawdown, peak-cumulative)
+	}
+
+	if stats.Trades > 0 {
+		stats.WinRate = float64(stats.Wins) / float64(stats.Trades) * 100
+		stats.AvgHoldingSeconds = holding.Seconds() / float64(stats.Trades)
+	}
+	if stats.GrossLoss > 0 {
+		factor := stats.GrossProfit / stats.GrossLoss
+		stats.ProfitFactor = &factor
+	}
+	stats.SharpeRatio = sharpeRatio(closed, from, to)
+	stats.ExposureTime = exposureTime(trades, from, to)
+	return stats
+}
+
+// sharpeRatio annualizes the mean over the standard deviation of the daily net PnL.
+// It is 0 for periods shorter than two days or without variation.
+func sharpeRatio(closed []models.Trade, from, to time.Time) float64 {
+	first := from.UTC().Truncate(24 * time.Hour)
+	days := int(to.UTC().Truncate(24*time.Hour).Sub(first)/(24*time.Hour)) + 1
+	if days < 2 {
+		return 0
+	}
+
+	daily := make([]float64, days)
+	for _, trade := range closed {
+		day := int(trade.ClosedAt.UTC().Truncate(24*time.Hour).Sub(first) / (24 * time.Hour))
+		if day >= 0 && day < days {
+			daily[day] += parseAmount(trade.NetPnL)
+		}
+	}
+
+	mean := 0.0
+	for _, pnl := range daily {
+		mean += pnl
+	}
+	mean /= float64(days)
+
+	variance := 0.0
+	for _, pnl := range daily {
+		variance += (pnl - mean) * (pnl - mean)
+	}
+	stddev := math.Sqrt(variance / float64(days-1))
+	if stddev == 0 {
+		return 0
+	}
+	return mean / stddev * math.Sqrt(365)
+}
+
+// exposureTime returns the percent of a period in which at least one of the trades was open
+func exposureTime(trades []models.Trade, from, to time.Time) float64 {
+	period := to.Sub(from)
+	if period <= 0 {
+		return 0
+	}
+
+	type interval struct{ start, end time.Time }
+	var intervals []interval
+	for _, trade := range trades {
+		end := to
+		if trade.ClosedAt != nil && trade.ClosedAt.Before(to) {
+			end = *trade.ClosedAt
+		}
+		start := latest(trade.OpenedAt, from)
+		if end.After(start) {
+			intervals = append(intervals, interval{start, end})
+		}
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].start.Before(intervals[j].start) })
+
+	// Overlapping trades count once
+	var exposed time.Duration
+	var current *interval
+	for i := range intervals {
+		if current != nil && !intervals[i].start.After(current.end) {
+			current.end = latest(current.end, intervals[i].end)
+			continue
+		}
+		if current != nil {
+			exposed += current.end.Sub(current.start)
+		}
+		current = &intervals[i]
+	}
+	if current != nil {
+		exposed += current.end.Sub(current.start)
+	}
+	return float64(exposed) / float64(period) * 100
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/models"
+)
+
+// isBatchBody reports whether a webhook body carries several orders: a JSON array, or an object
+// with an "orders" list
+func isBatchBody(body []byte) bool {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return false
+	}
+	if body[0] == '[' {
+		return json.Valid(body)
+	}
+	var envelope struct {
+		Orders json.RawMessage `json:"orders"`
+	}
+	return body[0] == '{' && json.Unmarshal(body, &envelope) == nil &&
+		bytes.HasPrefix(bytes.TrimSpace(envelope.Orders), []byte("["))
+}
+
+// decodeBatch decodes the signals of a batch webhook and its mode. The fields of an "orders"
+// envelope other than the orders and the mode apply to every order that does not set them itself.
+func decodeBatch(body []byte) (string, []models.TradingViewSignal, error) {
+	var (
+		mode     = BatchModeBestEffort
+		defaults map[string]json.RawMessage
+		orders   []map[string]json.RawMessage
+	)
+	if body = bytes.TrimSpace(body); body[0] == '[' {
+		if err := json.Unmarshal(body, &orders); err != nil {
+			return "", nil, fmt.Errorf("invalid batch: %w", err)
+		}
+	} else {
+		if err := json.Unmarshal(body, &defaults); err != nil {
+			return "", nil, fmt.Errorf("invalid batch: %w", err)
+		}
+		if err := json.Unmarshal(defaults["orders"], &orders); err != nil {
+			return "", nil, fmt.Errorf("invalid batch orders: %w", err)
+		}
+		if raw, ok := defaults["mode"]; ok {
+			if err := json.Unmarshal(raw, &mode); err != nil {
+				return "", nil, fmt.Errorf("invalid batch mode: %w", err)
+			}
+		}
+		delete(defaults, "orders")
+		delete(defaults, "mode")
+	}
+
+	if mode != BatchModeBestEffort && mode != BatchModeAllOrNothing {
+		return "", nil, fmt.Errorf("invalid batch mode: %q", mode)
+	}
+	if len(orders) == 0 {
+		return "", nil, fmt.Errorf("batch has no orders")
+	}
+
+	signals := make([]models.TradingViewSignal, len(orders))
+	for i, order := range orders {
+		for name, value := range defaults {
+			if _, ok := order[name]; !ok {
+				order[name] = value
+			}
+		}
+		data, _ := json.Marshal(order)
+		if err := json.Unmarshal(data, &signals[i]); err != nil {
+			return "", nil, fmt.Errorf("invalid order %d: %w", i+1, err)
+		}
+		if signals[i].APISec == "" {
+			return "", nil, fmt.Errorf("order %d has no api_sec", i+1)
+		}
+	}
+	return mode, signals, nil
+}
+
+// parseBatch stores a batch webhook as one alert and creates an execution with its record for
+// each order. A batch with an invalid order is rejected as a whole.
+func (s *TradingService) parseBatch(exec *Execution) error {
+	stored := exec.Alert
+	mode, signals, decodeErr := decodeBatch(exec.Body)
+
+	// The alert names the strategy when all orders share one
+	strategy := ""
+	summaries := make([]string, len(signals))
+	symbols := []string{}
+	for i, signal := range signals {
+		summaries[i] = strings.TrimSpace(signal.Action + " " + signal.Symbol)
+		if !slices.Contains(symbols, signal.Symbol) {
+			symbols = append(symbols, signal.Symbol)
+		}
+		if i == 0 {
+			strategy = signal.StrategyKey()
+		} else if signal.StrategyKey() != strategy {
+			strategy = ""
+		}
+	}
+	if strategy == "" {
+		strategy = "batch"
+	}
+	exec.Alert = &models.Alert{
+		Strategy:   strategy,
+		Symbol:     strings.Join(symbols, ","),
+		Action:     "batch",
+		Message:    fmt.Sprintf("Batch of %d orders: %s", len(signals), strings.Join(summaries, ", ")),
+		RawPayload: string(exec.Body),
+		Status:     "received",
+		CreatedAt:  s.now(),
+	}
+	if decodeErr != nil {
+		exec.Alert.Message = "Invalid batch: " + decodeErr.Error()
+	}
+	if stored != nil && stored.ID != 0 {
+		exec.Alert.ID = stored.ID
+		exec.Alert.CreatedAt = stored.CreatedAt
+	}
+	if err := s.db.Save(exec.Alert).Error; err != nil {
+		return fmt.Errorf("failed to save alert: %w", err)
+	}
+	if decodeErr != nil {
+		return decodeErr
+	}
+
+	exec.Batch = &Batch{Mode: mode}
+	for i := range signals {
+		signal := &signals[i]
+		signal.ReceivedAt = exec.ReceivedAt
+		body, _ := json.Marshal(signal)
+		exec.Batch.Items = append(exec.Batch.Items, &Execution{
+			Body:       body,
+			RequestURL: exec.RequestURL,
+			ReceivedAt: exec.ReceivedAt,
+			Alert:      exec.Alert,
+			Signal:     signal,
+			Record:     s.newSignalRecord(exec.Alert, signal),
+			Batch:      exec.Batch,
+		})
+	}
+	log.Printf("Batch of %d orders received in %s mode: alert=%d", len(signals), mode, exec.Alert.ID)
+	return nil
+}
+
+// previousBatchTarget returns the target position of the last earlier order of the same batch on
+// the same symbol and account, empty when there is none. Orders of a batch are validated before
+// any of them is placed, so later orders build on the targets of earlier ones.
+func (e *Execution) previousBatchTarget() string {
+	if e.Batch == nil {
+		return ""
+	}
+	target := ""
+	for _, item := range e.Batch.Items {
+		if item == e {
+			break
+		}
+		if item.Record != nil && item.Record.UserID == e.Record.UserID && item.Record.Symbol == e.Record.Symbol &&
+			strings.EqualFold(item.Record.Exchange, e.Record.Exchange) && item.Record.MarketPositionSize != "" {
+			target = item.Record.MarketPositionSize
+		}
+	}
+	return target
+}
+
+// executeBatchStage places the orders of a batch in the order they are listed. Consecutive orders
+// on the same client of a broker with a batch endpoint are placed in one request; other orders are
+// executed one by one. In all-or-nothing mode no order is placed unless every order passed the
+// previous stages, and the batch is aborted at the first order that fails to be placed.
+func (s *TradingService) executeBatchStage(ctx context.Context, batch *Batch) error {
+	allOrNothing := batch.Mode == BatchModeAllOrNothing
+	if allOrNothing {
+		for i, item := range batch.Items {
+			if item.Failed() {
+				s.abortBatch(ctx, batch.Items, i)
+				return nil
+			}
+		}
+	}
+
+	for i := 0; i < len(batch.Items); {
+		group := batchGroup(batch.Items[i:])
+		if len(group) > 1 {
+			s.placeBatch(ctx, group)
+		} else if err := s.executeStage(ctx, group[0]); err != nil {
+			return err
+		}
+
+		for j := range group {
+			if allOrNothing && group[j].Failed() {
+				s.abortBatch(ctx, batch.Items, i+j)
+				return nil
+			}
+		}
+		i += len(group)
+	}
+	return nil
+}
+
+// batchGroup returns the leading orders that can be placed in one batch request: orders routed to
+// the same client of a broker with a batch endpoint. It returns at least the first order.
+func batchGroup(items []*Execution) []*Execution {
+	client := batchClient(items[0])
+	if client == nil {
+		return items[:1]
+	}
+	n := 1
+	for n < len(items) && batchClient(items[n]) == client {
+		n++
+	}
+	return items[:n]
+}
+
+// batchClient returns the client an order is placed on if it can be placed in a batch, nil otherwise
+func batchClient(exec *Execution) broker.Broker {
+	if !exec.Trades() || exec.Failed() || exec.Order == nil || exec.Shadow || len(exec.Routes) != 1 {
+		return nil
+	}
+	if _, ok := exec.Routes[0].Client.(broker.BatchOrderPlacer); !ok {
+		return nil
+	}
+	return exec.Routes[0].Client
+}
+
+// placeBatch places orders routed to the same client in one batch request and records the outcome
+// of each order. Unlike single orders, batches are not retried.
+func (s *TradingService) placeBatch(ctx context.Context, items []*Execution) {
+	route := items[0].Routes[0]
+	reqs := make([]*broker.OrderRequest, len(items))
+	for i, item := range items {
+		req := *item.Order
+		req.Symbol = broker.FormatSymbol(req.Symbol, route.Exchange)
+		reqs[i] = &req
+	}
+	log.Printf("Executing batch of %d orders on %s: alert=%d", len(reqs), route.Exchange, items[0].Alert.ID)
+
+	placeCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	placeStart := time.Now()
+	results, err := route.Client.(broker.BatchOrderPlacer).PlaceOrders(placeCtx, reqs)
+	if err == nil && len(results) != len(reqs) {
+		err = fmt.Errorf("received %d results for %d orders", len(results), len(reqs))
+	}
+	if err != nil {
+		log.Printf("%s batch failed for alert %d: %v", route.Exchange, items[0].Alert.ID, err)
+		for _, item := range items {
+			item.Fail(fmt.Errorf("%s: failed to place %s batch: %w", route.Exchange, route.Exchange, err))
+		}
+		return
+	}
+
+	s.metrics.Observe(LatencyPlaceOrder, time.Since(placeStart))
+	if !items[0].ReceivedAt.IsZero() {
+		s.metrics.Observe(LatencyWebhookToOrder, time.Since(items[0].ReceivedAt))
+	}
+
+	for i, item := range items {
+		order := results[i].Order
+		switch {
+		case results[i].Err != nil:
+			log.Printf("%s order %d of batch failed for alert %d: %v", route.Exchange, i+1, item.Alert.ID, results[i].Err)
+			item.Fail(fmt.Errorf("%s: failed to place %s order: %w", route.Exchange, route.Exchange, results[i].Err))
+		case order == nil:
+			item.Fail(fmt.Errorf("received nil order response from %s", route.Exchange))
+		default:
+			log.Printf("%s order placed successfully for alert %d: ID=%s, Status=%s, Symbol=%s",
+				route.Exchange, item.Alert.ID, order.ID, order.Status, order.Symbol)
+			item.Record.OrderID = order.ID
+			item.Record.Exchange = route.Exchange
+			item.Result = recordExecution(placeCtx, route.Client, item.Record, order)
+		}
+	}
+}
+
+// abortBatch stops an all-or-nothing batch because of the failed order at the given index. Orders
+// that were not placed are failed, and placed orders that are still open are cancelled; filled
+// orders cannot be undone and are kept.
+func (s *TradingService) abortBatch(ctx context.Context, items []*Execution, failed int) {
+	reason := fmt.Errorf("batch aborted: order %d failed", failed+1)
+	log.Printf("Batch of alert %d aborted: order %d failed: %s", items[failed].Alert.ID, failed+1, items[failed].Record.ErrorMessage)
+
+	for _, item := range items {
+		if !item.Trades() || item.Failed() {
+			continue
+		}
+		if item.Result == nil {
+			item.ShadowOrder = nil
+			item.Fail(reason)
+			continue
+		}
+
+		order := item.Result
+		if order.Status != broker.OrderStatusNew && order.Status != broker.OrderStatusPartiallyFilled {
+			continue
+		}
+		for _, route := range item.Routes {
+			if route.Exchange != item.Record.Exchange {
+				continue
+			}
+			cancelCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			err := route.Client.CancelOrder(cancelCtx, order.Symbol, order.ID)
+			cancel()
+			if err != nil {
+				log.Printf("Failed to cancel order %s of aborted batch: %v", order.ID, err)
+				break
+			}
+			order.Status = broker.OrderStatusCanceled
+			item.Record.ErrorMessage = reason.Error()
+			break
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// batchMockBroker is a mock broker with a batch endpoint
+type batchMockBroker struct {
+	*MockBroker
+}
+
+func (m *batchMockBroker) PlaceOrders(ctx context.Context, reqs []*broker.OrderRequest) ([]broker.BatchOrderResult, error) {
+	args := m.Called(ctx, reqs)
+	results, _ := args.Get(0).([]broker.BatchOrderResult)
+	return results, args.Error(1)
+}
+
+func TestDecodeBatch(t *testing.T) {
+	assert.True(t, isBatchBody([]byte(` [{"api_sec":"a"}]`)))
+	assert.True(t, isBatchBody([]byte(`{"orders":[]}`)))
+	assert.False(t, isBatchBody([]byte(`{"api_sec":"a","orders":"none"}`)))
+	assert.False(t, isBatchBody([]byte(`{"strategy":"grid","action":"buy"}`)))
+	assert.False(t, isBatchBody([]byte(`[not json`)))
+
+	mode, signals, err := decodeBatch([]byte(`[{"api_sec":"a","symbol":"BTCUSDT"},{"api_sec":"b","symbol":"ETHUSDT"}]`))
+	require.NoError(t, err)
+	assert.Equal(t, BatchModeBestEffort, mode)
+	require.Len(t, signals, 2)
+	assert.Equal(t, "b", signals[1].APISec)
+
+	// Envelope fields apply to the orders that do not set them
+	mode, signals, err = decodeBatch([]byte(`{"api_sec":"a","exchange":"binance","mode":"all_or_nothing","orders":[{"symbol":"BTCUSDT"},{"symbol":"ETHUSDT","exchange":"okx"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, BatchModeAllOrNothing, mode)
+	assert.Equal(t, "a", signals[0].APISec)
+	assert.Equal(t, "binance", signals[0].ExchangeName)
+	assert.Equal(t, "okx", signals[1].ExchangeName)
+
+	_, _, err = decodeBatch([]byte(`{"api_sec":"a","mode":"atomic","orders":[{"symbol":"BTCUSDT"}]}`))
+	assert.ErrorContains(t, err, "invalid batch mode")
+	_, _, err = decodeBatch([]byte(`[{"api_sec":"a"},{"symbol":"ETHUSDT"}]`))
+	assert.ErrorContains(t, err, "order 2 has no api_sec")
+	_, _, err = decodeBatch([]byte(`{"api_sec":"a","orders":[]}`))
+	assert.ErrorContains(t, err, "batch has no orders")
+}
+
+func TestPipelineBatchBestEffort(t *testing.T) {
+	db := newTestDB(t)
+	pool, created := newTestPool(t, db)
+	create := pool.create
+	pool.create = func(exchange string) (broker.Broker, error) {
+		client, err := create(exchange)
+		return &batchMockBroker{client.(*MockBroker)}, err
+	}
+	newTestCredential(t, db, 1, "secret")
+	service := newTestTradingService(t, db, pool)
+
+	// Warm the pool so the mock can expect the orders
+	_, release, err := pool.Get(context.Background(), 1, "binance")
+	require.NoError(t, err)
+	release()
+	client := (*created)[0]
+
+	// Close BTC, open ETH and place a take profit on the new position; the ETH entry is rejected
+	client.On("PlaceOrders", mock.Anything, mock.MatchedBy(func(reqs []*broker.OrderRequest) bool {
+		return len(reqs) == 3 &&
+			reqs[0].Symbol == "BTCUSDT" && reqs[0].Side == broker.OrderSideSell && reqs[0].ReduceOnly &&
+			reqs[1].Symbol == "ETHUSDT" && reqs[1].Quantity == "2.00000000" &&
+			reqs[2].Type == broker.OrderTypeLimit && reqs[2].Quantity == "1.00000000" && reqs[2].ReduceOnly
+	})).Return([]broker.BatchOrderResult{
+		{Order: &broker.Order{ID: "1", Symbol: "BTCUSDT", Status: broker.OrderStatusFilled, ExecutedQuantity: "1", AvgPrice: "50000"}},
+		{Err: errors.New("margin is insufficient")},
+		{Order: &broker.Order{ID: "3", Symbol: "ETHUSDT", Type: broker.OrderTypeLimit, Status: broker.OrderStatusNew, ExecutedQuantity: "0"}},
+	}, nil).Once()
+	client.On("GetOrder", mock.Anything, "ETHUSDT", "3").Return(&broker.Order{ID: "3", Symbol: "ETHUSDT", Status: broker.OrderStatusNew, ExecutedQuantity: "0"}, nil).Once()
+
+	execution := &Execution{Body: []byte(`{
+		"api_sec": "secret",
+		"exchange": "binance",
+		"strategy": "rotation",
+		"orders": [
+			{"symbol": "BTCUSDT", "action": "sell", "prev_market_position_size": "1", "market_position_size": "0"},
+			{"symbol": "ETHUSDT", "action": "buy", "prev_market_position_size": "0", "market_position_size": "2"},
+			{"symbol": "ETHUSDT", "action": "sell", "ord_type": "limit", "price": "3500", "market_position_size": "1"}
+		]
+	}`)}
+	require.NoError(t, service.Execute(context.Background(), execution))
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "PlaceOrder", mock.Anything, mock.Anything)
+
+	// One alert with a trading signal per order
+	require.NotNil(t, execution.Batch)
+	assert.Nil(t, execution.Record)
+	assert.Equal(t, "batch", execution.Alert.Action)
+	assert.Equal(t, "rotation", execution.Alert.Strategy)
+	assert.Equal(t, "BTCUSDT,ETHUSDT", execution.Alert.Symbol)
+	assert.Equal(t, "processed", execution.Alert.Status)
+
+	signals, err := service.GetTradingSignals(execution.Alert.ID)
+	require.NoError(t, err)
+	require.Len(t, signals, 3)
+	assert.Equal(t, "filled", signals[0].Status)
+	assert.Equal(t, "1", signals[0].OrderID)
+	assert.Equal(t, "failed", signals[1].Status)
+	assert.Contains(t, signals[1].ErrorMessage, "margin is insufficient")
+	assert.Equal(t, "pending", signals[2].Status)
+
+	// The take profit builds on the position the entry targets
+	assert.Equal(t, "2", signals[2].PrevMarketPositionSize)
+}
+
+func TestPipelineBatchAllOrNothing(t *testing.T) {
+	db := newTestDB(t)
+	pool, created := newTestPool(t, db)
+	newTestCredential(t, db, 1, "secret")
+	service := newTestTradingService(t, db, pool)
+
+	// An order that cannot be routed keeps every order of the batch from being placed
+	execution := &Execution{Body: []byte(`{"api_sec":"secret","mode":"all_or_nothing","orders":[
+		{"symbol":"BTCUSDT","exchange":"binance","action":"buy","prev_market_position_size":"0","market_position_size":"1"},
+		{"symbol":"ETHUSDT","exchange":"bitget","action":"buy","prev_market_position_size":"0","market_position_size":"1"}
+	]}`)}
+	require.NoError(t, service.Execute(context.Background(), execution))
+	items := execution.Batch.Items
+	assert.Equal(t, "failed", items[0].Record.Status)
+	assert.Equal(t, "batch aborted: order 2 failed", items[0].Record.ErrorMessage)
+	assert.Contains(t, items[1].Record.ErrorMessage, "unsupported exchange")
+	for _, client := range *created {
+		client.AssertNotCalled(t, "PlaceOrder", mock.Anything, mock.Anything)
+	}
+
+	// A failed placement stops the batch and cancels the open orders placed before it
+	_, release, err := pool.Get(context.Background(), 1, "binance")
+	require.NoError(t, err)
+	release()
+	client := (*created)[0]
+	open := &broker.Order{ID: "11", Symbol: "BTCUSDT", Type: broker.OrderTypeLimit, Status: broker.OrderStatusNew, ExecutedQuantity: "0"}
+	client.On("PlaceOrder", mock.Anything, mock.MatchedBy(func(req *broker.OrderRequest) bool { return req.Symbol == "BTCUSDT" })).Return(open, nil).Once()
+	client.On("GetOrder", mock.Anything, "BTCUSDT", "11").Return(open, nil).Once()
+	client.On("PlaceOrder", mock.Anything, mock.MatchedBy(func(req *broker.OrderRequest) bool { return req.Symbol == "ETHUSDT" })).
+		Return((*broker.Order)(nil), errors.New("invalid quantity")).Once()
+	client.On("CancelOrder", mock.Anything, "BTCUSDT", "11").Return(nil).Once()
+
+	execution = &Execution{Body: []byte(`{"api_sec":"secret","exchange":"binance","mode":"all_or_nothing","orders":[
+		{"symbol":"BTCUSDT","action":"buy","ord_type":"limit","price":"50000","prev_market_position_size":"0","market_position_size":"1"},
+		{"symbol":"ETHUSDT","action":"buy","prev_market_position_size":"0","market_position_size":"1"},
+		{"symbol":"SOLUSDT","action":"buy","prev_market_position_size":"0","market_position_size":"1"}
+	]}`)}
+	require.NoError(t, service.Execute(context.Background(), execution))
+	client.AssertExpectations(t)
+
+	items = execution.Batch.Items
+	assert.Equal(t, "cancelled", items[0].Record.Status)
+	assert.Equal(t, "batch aborted: order 2 failed", items[0].Record.ErrorMessage)
+	assert.Equal(t, "failed", items[1].Record.Status)
+	assert.Equal(t, "failed", items[2].Record.Status)
+	assert.Equal(t, "batch aborted: order 2 failed", items[2].Record.ErrorMessage)
+
+	positions, err := service.userService.GetUserPositions(items[0].User.ID)
+	require.NoError(t, err)
+	assert.Empty(t, positions)
+}
+
+func TestPipelineRejectsInvalidBatch(t *testing.T) {
+	db := newTestDB(t)
+	pool, _ := newTestPool(t, db)
+	service := newTestTradingService(t, db, pool)
+
+	execution := &Execution{Body: []byte(`[{"api_sec":"secret","symbol":"BTCUSDT"},{"symbol":"ETHUSDT"}]`)}
+	assert.ErrorContains(t, service.Execute(context.Background(), execution), "order 2 has no api_sec")
+
+	var alert models.Alert
+	require.NoError(t, db.First(&alert, execution.Alert.ID).Error)
+	assert.Equal(t, "failed", alert.Status)
+	var signals int64
+	require.NoError(t, db.Model(&models.TradingSignal{}).Count(&signals).Error)
+	assert.Zero(t, signals)
+}
@@ -2,12 +2,15 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/Cyvadra/tv-forward/broker"
 	"github.com/Cyvadra/tv-forward/internal/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockBroker is a mock implementation of the broker interface
@@ -280,7 +283,8 @@ func TestConvertAlertToOrderRequest(t *testing.T) {
 
 // TestTrackBinanceOrderStatus tests order status tracking
 func TestTrackBinanceOrderStatus(t *testing.T) {
-	service := &TradingService{}
+	db := newTestDB(t)
+	service := &TradingService{db: db}
 	mockBroker := new(MockBroker)
 
 	signal := &models.TradingSignal{
@@ -337,11 +341,12 @@ func TestTrackBinanceOrderStatus(t *testing.T) {
 			mockBroker.On("GetOrder", mock.Anything, "BTCUSDT", "12345").Return(mockOrder, nil).Once()
 
 			ctx := context.Background()
-			_ = service.trackBinanceOrderStatus(ctx, mockBroker, signal)
+			require.NoError(t, service.trackBinanceOrderStatus(ctx, mockBroker, signal))
 
-			// Note: This will fail in actual test because we don't have a real DB
-			// But the logic can be verified
 			assert.Equal(t, tt.expectedStatus, signal.Status)
+			var stored models.TradingSignal
+			require.NoError(t, db.First(&stored, signal.ID).Error)
+			assert.Equal(t, tt.expectedStatus, stored.Status)
 
 			if tt.expectExecuted {
 				assert.NotNil(t, signal.ExecutedAt)
@@ -354,6 +359,53 @@ func TestTrackBinanceOrderStatus(t *testing.T) {
 	mockBroker.AssertExpectations(t)
 }
 
+// MockFillBroker is a mock broker that also reports order fills
+type MockFillBroker struct {
+	MockBroker
+}
+
+func (m *MockFillBroker) GetOrderFills(ctx context.Context, symbol string, orderID string) ([]broker.Fill, error) {
+	args := m.Called(ctx, symbol, orderID)
+	return args.Get(0).([]broker.Fill), args.Error(1)
+}
+
+// TestRecordExecution tests that fill details are stored on the trading signal
+func TestRecordExecution(t *testing.T) {
+	mockBroker := new(MockFillBroker)
+	signal := &models.TradingSignal{Symbol: "BTCUSDT"}
+
+	// The market order is acknowledged as NEW and filled when queried again
+	placed := &broker.Order{ID: "42", Symbol: "BTCUSDT", Status: broker.OrderStatusNew, ExecutedQuantity: "0"}
+	filled := &broker.Order{ID: "42", Symbol: "BTCUSDT", Status: broker.OrderStatusFilled, ExecutedQuantity: "0.02", AvgPrice: "42050"}
+	mockBroker.On("GetOrder", mock.Anything, "BTCUSDT", "42").Return(filled, nil).Once()
+	mockBroker.On("GetOrderFills", mock.Anything, "BTCUSDT", "42").Return([]broker.Fill{
+		{OrderID: "42", Quantity: "0.01", Commission: "0.1", CommissionAsset: "USDT", RealizedPnL: "5.25"},
+		{OrderID: "42", Quantity: "0.01", Commission: "0.2", CommissionAsset: "USDT", RealizedPnL: "7.25"},
+	}, nil).Once()
+
+	recordExecution(context.Background(), mockBroker, signal, placed)
+
+	assert.Equal(t, "0.02", signal.FilledQuantity)
+	assert.Equal(t, "42050", signal.AvgPrice)
+	assert.Equal(t, "0.3", signal.Fee)
+	assert.Equal(t, "USDT", signal.FeeAsset)
+	assert.Equal(t, "12.5", signal.RealizedPnL)
+	mockBroker.AssertExpectations(t)
+}
+
+// TestBrokerErrorCode tests that broker error codes survive wrapping
+func TestBrokerErrorCode(t *testing.T) {
+	err := fmt.Errorf("failed to place binance order: %w",
+		broker.NewBrokerError("binance", "ORDER_FAILED", "Failed to place order", errors.New("margin is insufficient")))
+	assert.Equal(t, "ORDER_FAILED", brokerErrorCode(err))
+	assert.Empty(t, brokerErrorCode(errors.New("unsupported exchange: ftx")))
+
+	// Rate limited requests report a uniform code whatever call they failed in
+	limited := broker.NewBrokerError("binance", "ORDER_FAILED", "Failed to place order",
+		fmt.Errorf("%w: binance is backing off", broker.ErrRateLimited))
+	assert.Equal(t, "RATE_LIMIT", brokerErrorCode(limited))
+}
+
 // TestBinanceIntegrationFlow tests the overall integration flow
 func TestBinanceIntegrationFlow(t *testing.T) {
 	// This test demonstrates the integration flow without actually calling Binance APIs
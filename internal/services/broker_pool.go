@@ -0,0 +1,411 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/database"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"gorm.io/gorm"
+)
+
+// BrokerPoolStats summarizes the state of a broker pool
+type BrokerPoolStats struct {
+	Clients   int   `json:"clients"`
+	InUse     int   `json:"in_use"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+// symbolInfoTTL is how long the trading rules of a symbol are cached
+const symbolInfoTTL = time.Hour
+
+// BrokerPool keeps initialized broker clients per user credential so signals are executed
+// on a ready connection instead of initializing a new client every time
+type BrokerPool struct {
+	db     *gorm.DB
+	config *config.Config
+	create func(exchange string) (broker.Broker, error)
+	market func(exchange string) (broker.Broker, error) // Creates the clients of public market data
+
+	mu      sync.Mutex
+	entries map[poolKey]*poolEntry
+	stats   BrokerPoolStats
+
+	infoMu  sync.Mutex // Guards the market clients and the cached symbol info
+	markets map[string]broker.Broker
+	symbols map[string]cachedSymbolInfo
+}
+
+// cachedSymbolInfo holds the trading rules of a symbol and when they were requested
+type cachedSymbolInfo struct {
+	info      *broker.SymbolInfo
+	fetchedAt time.Time
+}
+
+// poolKey identifies the credential of a user on an exchange. Credentials of the configuration
+// file belong to user 0.
+type poolKey struct {
+	userID   uint
+	exchange string
+}
+
+// poolEntry holds the current client of a credential
+type poolEntry struct {
+	init   sync.Mutex // Serializes lazy initialization
+	client *pooledClient
+}
+
+// pooledClient is an initialized broker shared by concurrent users
+type pooledClient struct {
+	client      broker.Broker
+	fingerprint string // Changes when the credential is rotated
+	refs        int
+	retired     bool // Closed once the last user releases it
+	lastUsed    time.Time
+	lastChecked time.Time
+}
+
+// NewBrokerPool creates a new broker pool
+func NewBrokerPool() *BrokerPool {
+	return &BrokerPool{
+		db:      database.GetDB(),
+		config:  nil, // Will be set later
+		create:  broker.Create,
+		market:  broker.Create,
+		entries: make(map[poolKey]*poolEntry),
+		markets: make(map[string]broker.Broker),
+		symbols: make(map[string]cachedSymbolInfo),
+	}
+}
+
+// SetConfig sets the configuration for the broker pool
+func (p *BrokerPool) SetConfig(cfg *config.Config) {
+	p.config = cfg
+}
+
+// Get returns a ready broker for the active credential of a user on an exchange, initializing it
+// on first use. The broker is shared: callers must not close it and must call release when done.
+func (p *BrokerPool) Get(ctx context.Context, userID uint, exchange string) (client broker.Broker, release func(), err error) {
+	if p.db == nil {
+		return nil, nil, fmt.Errorf("database not initialized")
+	}
+
+	var credential models.UserCredential
+	if err := p.db.Where("user_id = ? AND exchange = ? AND is_active = ?", userID, exchange, true).
+		First(&credential).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to get %s credentials: %w", exchange, err)
+	}
+	return p.get(ctx, poolKey{userID, exchange}, &broker.Credentials{
+		APIKey:     credential.APIKey,
+		SecretKey:  credential.SecretKey,
+		Passphrase: credential.Passphrase,
+	})
+}
+
+// GetConfigured returns a ready broker for credentials of the configuration file, which legacy
+// alerts trade with. Like Get, callers must not close it and must call release when done.
+func (p *BrokerPool) GetConfigured(ctx context.Context, exchange string, credentials *broker.Credentials) (client broker.Broker, release func(), err error) {
+	if credentials.APIKey == "" || credentials.SecretKey == "" {
+		return nil, nil, fmt.Errorf("credentials are not configured")
+	}
+	return p.get(ctx, poolKey{0, exchange}, credentials)
+}
+
+// get returns the pooled client of a key, connecting with the credentials when there is none or
+// the credentials changed
+func (p *BrokerPool) get(ctx context.Context, key poolKey, credentials *broker.Credentials) (broker.Broker, func(), error) {
+	fingerprint := credentialFingerprint(credentials)
+	if pc := p.acquire(key, fingerprint); pc != nil {
+		return pc.client, p.releaser(pc), nil
+	}
+
+	entry := p.entry(key)
+	entry.init.Lock()
+	defer entry.init.Unlock()
+
+	// Another caller may have connected while this one was waiting
+	if pc := p.acquire(key, fingerprint); pc != nil {
+		return pc.client, p.releaser(pc), nil
+	}
+
+	// A client with a different fingerprint belongs to a rotated credential
+	p.mu.Lock()
+	stale := entry.client
+	entry.client = nil
+	p.mu.Unlock()
+	if stale != nil {
+		log.Printf("Credential of user %d on %s changed, reconnecting", key.userID, key.exchange)
+		p.retire(stale)
+	}
+
+	client, err := p.connect(ctx, key.exchange, credentials)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	pc := &pooledClient{client: client, fingerprint: fingerprint, refs: 1, lastUsed: now, lastChecked: now}
+	p.mu.Lock()
+	entry.client = pc
+	p.stats.Misses++
+	p.mu.Unlock()
+
+	return client, p.releaser(pc), nil
+}
+
+// SymbolInfo returns the trading rules of a symbol on an exchange, such as its step and tick size.
+// They are public, so they are requested without credentials and shared by all users for an hour.
+func (p *BrokerPool) SymbolInfo(ctx context.Context, exchange, symbol string) (*broker.SymbolInfo, error) {
+	key := exchange + ":" + symbol
+	p.infoMu.Lock()
+	if cached, ok := p.symbols[key]; ok && time.Since(cached.fetchedAt) < symbolInfoTTL {
+		p.infoMu.Unlock()
+		return cached.info, nil
+	}
+	client, ok := p.markets[exchange]
+	if !ok {
+		var err error
+		if client, err = p.market(exchange); err != nil {
+			p.infoMu.Unlock()
+			return nil, fmt.Errorf("%s: %w", exchange, err)
+		}
+		p.markets[exchange] = client
+	}
+	p.infoMu.Unlock()
+
+	// The request is made outside the lock so a slow exchange does not hold up the others
+	info, err := client.GetSymbolInfo(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	p.infoMu.Lock()
+	p.symbols[key] = cachedSymbolInfo{info: info, fetchedAt: time.Now()}
+	p.infoMu.Unlock()
+	return info, nil
+}
+
+// Invalidate closes the pooled client of a user on an exchange so the next use reconnects
+func (p *BrokerPool) Invalidate(userID uint, exchange string) {
+	p.mu.Lock()
+	entry, exists := p.entries[poolKey{userID, exchange}]
+	var pc *pooledClient
+	if exists {
+		pc = entry.client
+		entry.client = nil
+	}
+	p.mu.Unlock()
+
+	if pc != nil {
+		p.retire(pc)
+	}
+}
+
+// Start checks the health of pooled clients and evicts idle ones until the context is cancelled
+func (p *BrokerPool) Start(ctx context.Context) {
+	ticker := time.NewTicker(p.healthCheckInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.Close()
+			return
+		case <-ticker.C:
+			p.Maintain(ctx)
+		}
+	}
+}
+
+// Maintain closes idle clients and clients that fail a connectivity check
+func (p *BrokerPool) Maintain(ctx context.Context) {
+	now := time.Now()
+	idle := make(map[poolKey]*pooledClient)
+	check := make(map[poolKey]*pooledClient)
+
+	p.mu.Lock()
+	for key, entry := range p.entries {
+		pc := entry.client
+		switch {
+		case pc == nil:
+		case pc.refs == 0 && now.Sub(pc.lastUsed) >= p.idleTimeout():
+			idle[key] = pc
+		case now.Sub(pc.lastChecked) >= p.healthCheckInterval():
+			check[key] = pc
+		}
+	}
+	p.mu.Unlock()
+
+	for key, pc := range idle {
+		log.Printf("Closing idle %s client of user %d", key.exchange, key.userID)
+		p.remove(key, pc)
+	}
+
+	for key, pc := range check {
+		if err := pc.client.TestConnection(ctx); err != nil {
+			log.Printf("Closing unhealthy %s client of user %d: %v", key.exchange, key.userID, err)
+			p.remove(key, pc)
+			continue
+		}
+
+		p.mu.Lock()
+		pc.lastChecked = time.Now()
+		p.mu.Unlock()
+	}
+}
+
+// Stats returns the current state of the pool
+func (p *BrokerPool) Stats() BrokerPoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	for _, entry := range p.entries {
+		if entry.client == nil {
+			continue
+		}
+		stats.Clients++
+		if entry.client.refs > 0 {
+			stats.InUse++
+		}
+	}
+	return stats
+}
+
+// Close closes all pooled clients; clients in use are closed once released
+func (p *BrokerPool) Close() {
+	p.mu.Lock()
+	var clients []*pooledClient
+	for _, entry := range p.entries {
+		if entry.client != nil {
+			clients = append(clients, entry.client)
+			entry.client = nil
+		}
+	}
+	p.mu.Unlock()
+
+	for _, pc := range clients {
+		p.retire(pc)
+	}
+}
+
+// acquire returns the current client of a key when it matches the credential fingerprint
+func (p *BrokerPool) acquire(key poolKey, fingerprint string) *pooledClient {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, exists := p.entries[key]
+	if !exists || entry.client == nil || entry.client.fingerprint != fingerprint {
+		return nil
+	}
+
+	entry.client.refs++
+	entry.client.lastUsed = time.Now()
+	p.stats.Hits++
+	return entry.client
+}
+
+// entry returns the entry of a key, creating it when missing
+func (p *BrokerPool) entry(key poolKey) *poolEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, exists := p.entries[key]
+	if !exists {
+		entry = &poolEntry{}
+		p.entries[key] = entry
+	}
+	return entry
+}
+
+// releaser returns the function that hands a client back to the pool
+func (p *BrokerPool) releaser(pc *pooledClient) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.mu.Lock()
+			pc.refs--
+			pc.lastUsed = time.Now()
+			closeNow := pc.retired && pc.refs == 0
+			p.mu.Unlock()
+
+			if closeNow {
+				pc.client.Close()
+			}
+		})
+	}
+}
+
+// remove takes a client out of the pool unless it was replaced in the meantime
+func (p *BrokerPool) remove(key poolKey, pc *pooledClient) {
+	p.mu.Lock()
+	if entry, exists := p.entries[key]; exists && entry.client == pc {
+		entry.client = nil
+	}
+	p.mu.Unlock()
+
+	p.retire(pc)
+}
+
+// retire closes a client that is no longer pooled as soon as nobody uses it
+func (p *BrokerPool) retire(pc *pooledClient) {
+	p.mu.Lock()
+	if pc.retired {
+		p.mu.Unlock()
+		return
+	}
+	pc.retired = true
+	p.stats.Evictions++
+	closeNow := pc.refs == 0
+	p.mu.Unlock()
+
+	if closeNow {
+		pc.client.Close()
+	}
+}
+
+// connect creates and initializes a broker with a credential
+func (p *BrokerPool) connect(ctx context.Context, exchange string, credentials *broker.Credentials) (broker.Broker, error) {
+	client, err := p.create(exchange)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", exchange, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := client.Initialize(ctx, credentials); err != nil {
+		return nil, fmt.Errorf("failed to initialize %s client: %w", exchange, err)
+	}
+	return client, nil
+}
+
+// idleTimeout returns how long unused clients are kept
+func (p *BrokerPool) idleTimeout() time.Duration {
+	if p.config != nil && p.config.Trading.BrokerPool.IdleTimeout > 0 {
+		return p.config.Trading.BrokerPool.IdleTimeout
+	}
+	return 30 * time.Minute
+}
+
+// healthCheckInterval returns how often pooled clients are checked
+func (p *BrokerPool) healthCheckInterval() time.Duration {
+	if p.config != nil && p.config.Trading.BrokerPool.HealthCheckInterval > 0 {
+		return p.config.Trading.BrokerPool.HealthCheckInterval
+	}
+	return time.Minute
+}
+
+// credentialFingerprint identifies the secrets of a credential without keeping them
+func credentialFingerprint(credentials *broker.Credentials) string {
+	sum := sha256.Sum256([]byte(credentials.APIKey + "\x00" + credentials.SecretKey + "\x00" + credentials.Passphrase))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newTestPool creates a broker pool whose brokers are new mocks, returned in creation order
+func newTestPool(t *testing.T, db *gorm.DB) (*BrokerPool, *[]*MockBroker) {
+	t.Helper()
+
+	var created []*MockBroker
+	pool := &BrokerPool{
+		db:      db,
+		entries: make(map[poolKey]*poolEntry),
+		create: func(exchange string) (broker.Broker, error) {
+			client := new(MockBroker)
+			client.On("Initialize", mock.Anything, mock.Anything).Return(nil)
+			created = append(created, client)
+			return client, nil
+		},
+		// Symbols have no filters unless a test sets them
+		market: func(exchange string) (broker.Broker, error) {
+			client := new(MockBroker)
+			client.On("GetSymbolInfo", mock.Anything, mock.Anything).Return(&broker.SymbolInfo{}, nil)
+			return client, nil
+		},
+		markets: make(map[string]broker.Broker),
+		symbols: make(map[string]cachedSymbolInfo),
+	}
+	return pool, &created
+}
+
+// newTestCredential stores an active credential
+func newTestCredential(t *testing.T, db *gorm.DB, userID uint, secret string) *models.UserCredential {
+	t.Helper()
+
+	credential := &models.UserCredential{UserID: userID, Exchange: "binance", APIKey: "key", SecretKey: secret}
+	require.NoError(t, db.Create(credential).Error)
+	return credential
+}
+
+func TestBrokerPoolReusesClients(t *testing.T) {
+	db := newTestDB(t)
+	pool, created := newTestPool(t, db)
+	newTestCredential(t, db, 1, "secret")
+	newTestCredential(t, db, 2, "other")
+
+	first, release1, err := pool.Get(context.Background(), 1, "binance")
+	require.NoError(t, err)
+	second, release2, err := pool.Get(context.Background(), 1, "binance")
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+
+	// Other users get their own client
+	other, release3, err := pool.Get(context.Background(), 2, "binance")
+	require.NoError(t, err)
+	assert.NotSame(t, first, other)
+
+	stats := pool.Stats()
+	assert.Equal(t, 2, stats.Clients)
+	assert.Equal(t, 2, stats.InUse)
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(2), stats.Misses)
+
+	release1()
+	release1() // Releasing twice has no effect
+	release2()
+	release3()
+	assert.Equal(t, 0, pool.Stats().InUse)
+	assert.Len(t, *created, 2)
+
+	_, _, err = pool.Get(context.Background(), 3, "binance")
+	assert.Error(t, err)
+}
+
+func TestBrokerPoolReusesConfiguredClients(t *testing.T) {
+	db := newTestDB(t)
+	pool, created := newTestPool(t, db)
+	credentials := &broker.Credentials{APIKey: "key", SecretKey: "secret"}
+
+	first, release1, err := pool.GetConfigured(context.Background(), "binance", credentials)
+	require.NoError(t, err)
+	release1()
+	second, release2, err := pool.GetConfigured(context.Background(), "binance", credentials)
+	require.NoError(t, err)
+	release2()
+	assert.Same(t, first, second)
+	assert.Len(t, *created, 1)
+
+	// Changed credentials in the configuration get a new client
+	(*created)[0].On("Close").Return(nil).Once()
+	third, release3, err := pool.GetConfigured(context.Background(), "binance", &broker.Credentials{APIKey: "key", SecretKey: "rotated"})
+	require.NoError(t, err)
+	release3()
+	assert.NotSame(t, first, third)
+	(*created)[0].AssertExpectations(t)
+
+	_, _, err = pool.GetConfigured(context.Background(), "binance", &broker.Credentials{APIKey: "key"})
+	assert.ErrorContains(t, err, "credentials are not configured")
+}
+
+func TestBrokerPoolReconnectsRotatedCredentials(t *testing.T) {
+	db := newTestDB(t)
+	pool, created := newTestPool(t, db)
+	credential := newTestCredential(t, db, 1, "secret")
+
+	old, releaseOld, err := pool.Get(context.Background(), 1, "binance")
+	require.NoError(t, err)
+
+	// The rotated credential gets a new client; the old one is closed once released
+	require.NoError(t, db.Model(credential).Update("secret_key", "rotated").Error)
+	current, releaseCurrent, err := pool.Get(context.Background(), 1, "binance")
+	require.NoError(t, err)
+	defer releaseCurrent()
+	assert.NotSame(t, old, current)
+	require.Len(t, *created, 2)
+
+	(*created)[0].On("Close").Return(nil).Once()
+	releaseOld()
+	(*created)[0].AssertExpectations(t)
+	assert.Equal(t, int64(1), pool.Stats().Evictions)
+
+	// Invalidation forces a new connection on next use
+	(*created)[1].On("Close").Return(nil).Once()
+	releaseCurrent()
+	pool.Invalidate(1, "binance")
+	(*created)[1].AssertExpectations(t)
+
+	_, release, err := pool.Get(context.Background(), 1, "binance")
+	require.NoError(t, err)
+	release()
+	assert.Len(t, *created, 3)
+}
+
+func TestBrokerPoolMaintain(t *testing.T) {
+	db := newTestDB(t)
+	pool, created := newTestPool(t, db)
+	pool.config = &config.Config{
+		Trading: config.TradingConfig{
+			BrokerPool: config.BrokerPoolConfig{IdleTimeout: time.Hour, HealthCheckInterval: time.Minute},
+		},
+	}
+	newTestCredential(t, db, 1, "secret")
+	newTestCredential(t, db, 2, "secret")
+
+	for _, userID := range []uint{1, 2} {
+		_, release, err := pool.Get(context.Background(), userID, "binance")
+		require.NoError(t, err)
+		release()
+	}
+	healthy, unhealthy := (*created)[0], (*created)[1]
+
+	// Clients that were checked recently are left alone
+	pool.Maintain(context.Background())
+
+	// Due clients are checked and closed when the check fails
+	pool.mu.Lock()
+	for _, entry := range pool.entries {
+		entry.client.lastChecked = time.Now().Add(-2 * time.Minute)
+	}
+	pool.mu.Unlock()
+	healthy.On("TestConnection", mock.Anything).Return(nil).Once()
+	unhealthy.On("TestConnection", mock.Anything).Return(errors.New("timeout")).Once()
+	unhealthy.On("Close").Return(nil).Once()
+	pool.Maintain(context.Background())
+	assert.Equal(t, 1, pool.Stats().Clients)
+
+	// Idle clients are closed
+	pool.mu.Lock()
+	for _, entry := range pool.entries {
+		if entry.client != nil {
+			entry.client.lastUsed = time.Now().Add(-2 * time.Hour)
+		}
+	}
+	pool.mu.Unlock()
+	healthy.On("Close").Return(nil).Once()
+	pool.Maintain(context.Background())
+	assert.Equal(t, 0, pool.Stats().Clients)
+
+	healthy.AssertExpectations(t)
+	unhealthy.AssertExpectations(t)
+}
+
+func TestPipelineRecordsLatency(t *testing.T) {
+	db := newTestDB(t)
+	pool, created := newTestPool(t, db)
+	newTestCredential(t, db, 1, "secret")
+	service := newTestTradingService(t, db, pool)
+
+	// Warm the pool so the mock can expect the order
+	_, release, err := pool.Get(context.Background(), 1, "binance")
+	require.NoError(t, err)
+	release()
+	(*created)[0].On("PlaceOrder", mock.Anything, mock.Anything).Return(&broker.Order{
+		ID: "42", Symbol: "BTCUSDT", ExecutedQuantity: "0.001", Status: broker.OrderStatusFilled,
+	}, nil).Twice()
+
+	body := []byte(`{"api_sec":"secret","id":"s1","symbol":"BTCUSDT","exchange":"binance","action":"buy","price":"50000","ord_type":"market","prev_market_position_size":"0","market_position_size":"0.001"}`)
+	receivedAt := time.Now().Add(-50 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		execution := &Execution{Body: body, ReceivedAt: receivedAt}
+		require.NoError(t, service.Execute(context.Background(), execution))
+		assert.Equal(t, "42", execution.Record.OrderID)
+	}
+
+	// Both signals reuse the warm client
+	assert.Len(t, *created, 1)
+	assert.Equal(t, int64(2), pool.Stats().Hits)
+	assert.Equal(t, int64(1), pool.Stats().Misses)
+
+	snapshot := service.Metrics().Snapshot()
+	require.Contains(t, snapshot, LatencyWebhookToOrder)
+	assert.Equal(t, int64(2), snapshot[LatencyWebhookToOrder].Count)
+	assert.GreaterOrEqual(t, snapshot[LatencyWebhookToOrder].Max, 50.0)
+	assert.Equal(t, int64(2), snapshot[LatencyBrokerConnect].Count)
+	assert.Equal(t, int64(2), snapshot[LatencyPlaceOrder].Count)
+}
+
+func TestLatencyMetricsSnapshot(t *testing.T) {
+	metrics := NewLatencyMetrics()
+	for i := 1; i <= 100; i++ {
+		metrics.Observe(LatencyPlaceOrder, time.Duration(i)*time.Millisecond)
+	}
+
+	stats := metrics.Snapshot()[LatencyPlaceOrder]
+	assert.Equal(t, int64(100), stats.Count)
+	assert.Equal(t, 100.0, stats.Last)
+	assert.Equal(t, 50.5, stats.Avg)
+	assert.Equal(t, 50.0, stats.P50)
+	assert.Equal(t, 95.0, stats.P95)
+	assert.Equal(t, 99.0, stats.P99)
+	assert.Equal(t, 100.0, stats.Max)
+
+	// Only the recent window is kept for percentiles
+	for i := 0; i < latencyWindow; i++ {
+		metrics.Observe(LatencyPlaceOrder, time.Millisecond)
+	}
+	stats = metrics.Snapshot()[LatencyPlaceOrder]
+	assert.Equal(t, int64(100+latencyWindow), stats.Count)
+	assert.Equal(t, 1.0, stats.Max)
+}
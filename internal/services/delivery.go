@@ -0,0 +1,348 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/models"
+)
+
+// retryAfterError reports that an endpoint asked for a specific delay before the next attempt
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+// Start runs the delivery retry worker until the context is cancelled
+func (s *ForwardService) Start(ctx context.Context) {
+	if s.db == nil {
+		return
+	}
+
+	// Deliveries interrupted by a restart are picked up again by the worker
+	now := time.Now()
+	if err := s.db.Model(&models.Delivery{}).
+		Where("status IN ?", []string{models.DeliveryStatusPending, models.DeliveryStatusSending}).
+		Updates(map[string]interface{}{"status": models.DeliveryStatusRetrying, "next_retry_at": now}).Error; err != nil {
+		log.Printf("Failed to recover interrupted deliveries: %v", err)
+	}
+
+	ticker := time.NewTicker(s.pollInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.processDueDeliveries(ctx)
+		}
+	}
+}
+
+// processDueDeliveries retries all deliveries whose next retry time has passed
+func (s *ForwardService) processDueDeliveries(ctx context.Context) {
+	if s.config == nil {
+		return
+	}
+
+	var deliveries []models.Delivery
+	if err := s.db.Where("status = ? AND next_retry_at <= ?", models.DeliveryStatusRetrying, time.Now()).
+		Order("next_retry_at").
+		Limit(100).
+		Find(&deliveries).Error; err != nil {
+		log.Printf("Failed to query due deliveries: %v", err)
+		return
+	}
+
+	for i := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+
+		delivery := &deliveries[i]
+		if !s.claimDelivery(delivery, models.DeliveryStatusRetrying) {
+			continue
+		}
+
+		if err := s.retryDelivery(delivery); err != nil {
+			log.Printf("Retry of delivery %d to %s failed (attempt %d): %v",
+				delivery.ID, delivery.EndpointName, delivery.Attempts, err)
+		}
+	}
+}
+
+// retryDelivery reloads the notification and endpoint of a delivery and sends it again
+func (s *ForwardService) retryDelivery(delivery *models.Delivery) error {
+	endpoint := s.findEndpoint(delivery.EndpointName)
+	if endpoint == nil {
+		return s.deadLetter(delivery, "endpoint is no longer configured or active")
+	}
+
+	notification, err := s.loadNotification(delivery)
+	if err != nil {
+		return s.deadLetter(delivery, err.Error())
+	}
+
+	return s.attemptDelivery(delivery, notification, *endpoint)
+}
+
+// loadNotification rebuilds the notification of a delivery from the database
+func (s *ForwardService) loadNotification(delivery *models.Delivery) (*Notification, error) {
+	notification, err := s.alertNotification(delivery.AlertID)
+	if err != nil {
+		return nil, err
+	}
+	notification.RequestURL = delivery.RequestURL
+
+	if delivery.SignalID != 0 {
+		var execution models.TradingSignal
+		if err := s.db.Unscoped().Preload("User").First(&execution, delivery.SignalID).Error; err != nil {
+			log.Printf("Trading signal %d of delivery %d not found: %v", delivery.SignalID, delivery.ID, err)
+		} else {
+			notification.Execution = &execution
+			notification.UserName = execution.User.Name
+		}
+	}
+
+	return notification, nil
+}
+
+// alertNotification builds the notification of a stored alert
+func (s *ForwardService) alertNotification(alertID uint) (*Notification, error) {
+	var alert models.Alert
+	if err := s.db.Unscoped().First(&alert, alertID).Error; err != nil {
+		return nil, fmt.Errorf("alert %d not found: %v", alertID, err)
+	}
+	notification := &Notification{Alert: &alert}
+
+	// Trading signals keep their original payload on the alert, or the canonical signal it was parsed into
+	payload := alert.RawPayload
+	if alert.SignalPayload != "" {
+		payload = alert.SignalPayload
+	}
+	var signal models.TradingViewSignal
+	if err := json.Unmarshal([]byte(payload), &signal); err == nil && signal.APISec != "" {
+		notification.Signal = &signal
+	}
+
+	return notification, nil
+}
+
+// attemptDelivery sends a notification to an endpoint and records the outcome on the delivery
+func (s *ForwardService) attemptDelivery(delivery *models.Delivery, notification *Notification, endpoint config.EndpointConfig) error {
+	response, err := s.sendToEndpoint(notification, endpoint)
+	if response != nil {
+		delivery.ResponseCode = response.StatusCode
+		delivery.ResponseBody = response.Body
+	}
+
+	delivery.Attempts++
+	now := time.Now()
+	if err == nil {
+		delivery.Status = models.DeliveryStatusDelivered
+		delivery.LastError = ""
+		delivery.NextRetryAt = nil
+		delivery.DeliveredAt = &now
+	} else if delivery.Attempts >= s.maxAttempts() {
+		delivery.Status = models.DeliveryStatusDead
+		delivery.LastError = err.Error()
+		delivery.NextRetryAt = nil
+		log.Printf("Delivery %d to %s moved to dead-letter after %d attempts",
+			delivery.ID, delivery.EndpointName, delivery.Attempts)
+	} else {
+		next := now.Add(s.retryDelay(delivery.Attempts, err))
+		delivery.Status = models.DeliveryStatusRetrying
+		delivery.LastError = err.Error()
+		delivery.NextRetryAt = &next
+	}
+
+	s.saveDelivery(delivery)
+	return err
+}
+
+// deadLetter moves a delivery straight to the dead-letter state
+func (s *ForwardService) deadLetter(delivery *models.Delivery, reason string) error {
+	delivery.Status = models.DeliveryStatusDead
+	delivery.LastError = reason
+	delivery.NextRetryAt = nil
+	s.saveDelivery(delivery)
+	return errors.New(reason)
+}
+
+// claimDelivery atomically marks a delivery as being sent so it is not picked up twice
+func (s *ForwardService) claimDelivery(delivery *models.Delivery, fromStatus string) bool {
+	result := s.db.Model(&models.Delivery{}).
+		Where("id = ? AND status = ?", delivery.ID, fromStatus).
+		Update("status", models.DeliveryStatusSending)
+	if result.Error != nil {
+		log.Printf("Failed to claim delivery %d: %v", delivery.ID, result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+
+	delivery.Status = models.DeliveryStatusSending
+	return true
+}
+
+// saveDelivery persists a delivery if it has been stored before
+func (s *ForwardService) saveDelivery(delivery *models.Delivery) {
+	if s.db == nil || delivery.ID == 0 {
+		return
+	}
+
+	if err := s.db.Save(delivery).Error; err != nil {
+		log.Printf("Failed to update delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// findEndpoint returns the active endpoint configuration with the given name
+func (s *ForwardService) findEndpoint(name string) *config.EndpointConfig {
+	if s.config == nil {
+		return nil
+	}
+
+	for i := range s.config.Endpoints {
+		if s.config.Endpoints[i].Name == name && s.config.Endpoints[i].IsActive {
+			return &s.config.Endpoints[i]
+		}
+	}
+	return nil
+}
+
+// retryDelay returns how long to wait before the next attempt, honoring endpoint hints
+func (s *ForwardService) retryDelay(attempts int, err error) time.Duration {
+	var retryAfter *retryAfterError
+	if errors.As(err, &retryAfter) {
+		return retryAfter.delay
+	}
+
+	baseDelay := 30 * time.Second
+	maxDelay := 30 * time.Minute
+	if s.config != nil && s.config.Forwarding.BaseDelay > 0 {
+		baseDelay = s.config.Forwarding.BaseDelay
+	}
+	if s.config != nil && s.config.Forwarding.MaxDelay > 0 {
+		maxDelay = s.config.Forwarding.MaxDelay
+	}
+
+	delay := baseDelay * time.Duration(1<<uint(min(attempts-1, 20))) // Exponential backoff
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// maxAttempts returns the number of attempts before a delivery is dead-lettered
+func (s *ForwardService) maxAttempts() int {
+	if s.config != nil && s.config.Forwarding.MaxAttempts > 0 {
+		return s.config.Forwarding.MaxAttempts
+	}
+	return 5
+}
+
+// pollInterval returns how often the retry worker looks for due deliveries
+func (s *ForwardService) pollInterval() time.Duration {
+	if s.config != nil && s.config.Forwarding.PollInterval > 0 {
+		return s.config.Forwarding.PollInterval
+	}
+	return 10 * time.Second
+}
+
+// GetDeliveries retrieves deliveries with pagination and optional status and endpoint filters
+func (s *ForwardService) GetDeliveries(page, limit int, status, endpoint string) ([]models.Delivery, int64, error) {
+	if s.db == nil {
+		return nil, 0, fmt.Errorf("database not initialized")
+	}
+
+	var deliveries []models.Delivery
+	var total int64
+
+	query := s.db.Model(&models.Delivery{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if endpoint != "" {
+		query = query.Where("endpoint_name = ?", endpoint)
+	}
+
+	// Get total count
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Get paginated results
+	offset := (page - 1) * limit
+	if err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&deliveries).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return deliveries, total, nil
+}
+
+// GetAlertDeliveries retrieves every delivery of an alert
+func (s *ForwardService) GetAlertDeliveries(alertID uint) ([]models.Delivery, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	var deliveries []models.Delivery
+	if err := s.db.Where("alert_id = ?", alertID).Order("id").Find(&deliveries).Error; err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ReplayDelivery resets a delivery's attempts and sends it again immediately
+func (s *ForwardService) ReplayDelivery(id uint) (*models.Delivery, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	var delivery models.Delivery
+	if err := s.db.First(&delivery, id).Error; err != nil {
+		return nil, err
+	}
+
+	if delivery.Status == models.DeliveryStatusSending || !s.claimDelivery(&delivery, delivery.Status) {
+		return nil, fmt.Errorf("delivery %d is currently being sent", id)
+	}
+
+	delivery.Attempts = 0
+	if err := s.retryDelivery(&delivery); err != nil {
+		log.Printf("Replay of delivery %d to %s failed: %v", delivery.ID, delivery.EndpointName, err)
+	}
+
+	return &delivery, nil
+}
+
+// ReplayDeadDeliveries schedules every dead-lettered delivery for another round of attempts
+func (s *ForwardService) ReplayDeadDeliveries() (int64, error) {
+	if s.db == nil {
+		return 0, fmt.Errorf("database not initialized")
+	}
+
+	result := s.db.Model(&models.Delivery{}).
+		Where("status = ?", models.DeliveryStatusDead).
+		Updates(map[string]interface{}{
+			"status":        models.DeliveryStatusRetrying,
+			"attempts":      0,
+			"next_retry_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
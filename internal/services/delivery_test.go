@@ -0,0 +1,156 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeliveryRetryAndDeadLetter(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"ok":false,"error_code":429,"parameters":{"retry_after":7}}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	db := newTestDB(t)
+	endpoint := config.EndpointConfig{Name: "tg", Type: "telegram", URL: server.URL, Token: "t", IsActive: true}
+	service := &ForwardService{
+		client: resty.New(),
+		db:     db,
+		config: &config.Config{
+			Endpoints: []config.EndpointConfig{endpoint},
+			Forwarding: config.ForwardingConfig{
+				MaxAttempts: 3,
+				BaseDelay:   time.Minute,
+				MaxDelay:    time.Hour,
+			},
+		},
+	}
+
+	alert := &models.Alert{Strategy: "alert", Message: "hello"}
+	require.NoError(t, db.Create(alert).Error)
+	delivery := &models.Delivery{AlertID: alert.ID, EndpointName: "tg", EndpointType: "telegram", Status: models.DeliveryStatusPending}
+	require.NoError(t, db.Create(delivery).Error)
+
+	// Telegram's retry_after hint overrides the backoff
+	before := time.Now()
+	assert.Error(t, service.attemptDelivery(delivery, &Notification{Alert: alert}, endpoint))
+	assert.Equal(t, models.DeliveryStatusRetrying, delivery.Status)
+	require.NotNil(t, delivery.NextRetryAt)
+	assert.WithinDuration(t, before.Add(7*time.Second), *delivery.NextRetryAt, time.Second)
+
+	// Subsequent failures use exponential backoff
+	before = time.Now()
+	assert.Error(t, service.retryDelivery(delivery))
+	assert.Equal(t, 2, delivery.Attempts)
+	assert.WithinDuration(t, before.Add(2*time.Minute), *delivery.NextRetryAt, time.Second)
+
+	// The last attempt moves the delivery to the dead-letter state
+	assert.Error(t, service.retryDelivery(delivery))
+	var stored models.Delivery
+	require.NoError(t, db.First(&stored, delivery.ID).Error)
+	assert.Equal(t, models.DeliveryStatusDead, stored.Status)
+	assert.Equal(t, 3, stored.Attempts)
+	assert.Nil(t, stored.NextRetryAt)
+	assert.Contains(t, stored.LastError, "status 502")
+
+	// Dead deliveries can be scheduled again
+	count, err := service.ReplayDeadDeliveries()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	require.NoError(t, db.First(&stored, delivery.ID).Error)
+	assert.Equal(t, models.DeliveryStatusRetrying, stored.Status)
+	assert.Equal(t, 0, stored.Attempts)
+}
+
+func TestDeliveryToRemovedEndpointIsDeadLettered(t *testing.T) {
+	db := newTestDB(t)
+	service := &ForwardService{client: resty.New(), db: db, config: &config.Config{}}
+
+	delivery := &models.Delivery{AlertID: 1, EndpointName: "gone", Status: models.DeliveryStatusSending}
+	require.NoError(t, db.Create(delivery).Error)
+
+	assert.Error(t, service.retryDelivery(delivery))
+	assert.Equal(t, models.DeliveryStatusDead, delivery.Status)
+}
+
+func TestRelayDeliveryStoresResponse(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, string(body))
+		if len(received) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"Invalid api_sec"}`))
+			return
+		}
+		w.Write([]byte(`{"message":"Trading signal processed successfully"}`))
+	}))
+	defer server.Close()
+
+	db := newTestDB(t)
+	endpoint := config.EndpointConfig{Name: "downstream", Type: "relay", URL: server.URL, IsActive: true}
+	service := &ForwardService{
+		client: resty.New(),
+		db:     db,
+		config: &config.Config{Endpoints: []config.EndpointConfig{endpoint}},
+	}
+
+	raw := `{"api_sec":"secret","symbol":"BTCUSDT",  "action":"buy"}`
+	alert := &models.Alert{Strategy: "trading_signal", RawPayload: raw}
+	require.NoError(t, db.Create(alert).Error)
+	delivery := &models.Delivery{AlertID: alert.ID, EndpointName: "downstream", EndpointType: "relay", Status: models.DeliveryStatusPending}
+	require.NoError(t, db.Create(delivery).Error)
+
+	// Failed attempts keep the downstream answer for inspection
+	assert.ErrorContains(t, service.attemptDelivery(delivery, &Notification{Alert: alert}, endpoint), "status 400")
+	assert.Equal(t, http.StatusBadRequest, delivery.ResponseCode)
+	assert.Equal(t, `{"error":"Invalid api_sec"}`, delivery.ResponseBody)
+
+	require.NoError(t, service.retryDelivery(delivery))
+	deliveries, err := service.GetAlertDeliveries(alert.ID)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, models.DeliveryStatusDelivered, deliveries[0].Status)
+	assert.Equal(t, http.StatusOK, deliveries[0].ResponseCode)
+	assert.Contains(t, deliveries[0].ResponseBody, "processed successfully")
+
+	// The original body is relayed byte for byte
+	assert.Equal(t, []string{raw, raw}, received)
+}
+
+func TestRewriteRelayPayload(t *testing.T) {
+	signal := []byte(`{"api_sec":"upstream","exchange":"bitget","position_size":"0.1","market_position_size":"0.3","comment":"<tp>"}`)
+	rewritten, err := rewriteRelayPayload(signal, config.RelayConfig{APISec: "downstream", Exchange: "binance", SizeMultiplier: 3})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"api_sec":"downstream","exchange":"binance","position_size":"0.3","market_position_size":"0.9","comment":"<tp>"}`, string(rewritten))
+	assert.Contains(t, string(rewritten), `"<tp>"`)
+
+	// Legacy alerts keep their numeric quantity and do not gain an api_sec
+	legacy := []byte(`{"strategy":"RSI","symbol":"BTCUSDT","quantity":2}`)
+	rewritten, err = rewriteRelayPayload(legacy, config.RelayConfig{APISec: "downstream", SizeMultiplier: 0.5})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"strategy":"RSI","symbol":"BTCUSDT","quantity":1}`, string(rewritten))
+
+	// Plain-text alerts are relayed unchanged
+	text := []byte("BTCUSDT crossed 42000")
+	rewritten, err = rewriteRelayPayload(text, config.RelayConfig{Exchange: "binance"})
+	require.NoError(t, err)
+	assert.Equal(t, text, rewritten)
+}
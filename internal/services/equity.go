@@ -0,0 +1,333 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/database"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"gorm.io/gorm"
+)
+
+// AccountSource provides the account information of a user's exchanges
+type AccountSource interface {
+	GetAccountInfo(ctx context.Context, userID uint) (map[string]*broker.AccountInfo, error)
+}
+
+// Drawdown is the fall of a user's equity below its peak within a period
+type Drawdown struct {
+	Since   time.Time `json:"since"`
+	Peak    float64   `json:"peak"`
+	Equity  float64   `json:"equity"`
+	Percent float64   `json:"percent"`
+}
+
+// EquityService records equity snapshots of every user and pauses users whose drawdown exceeds the
+// configured limits. A paused user trades again after the kill switch is released, either manually or
+// at the next session when auto_resume is set; drawdowns are measured anew from the release.
+type EquityService struct {
+	db          *gorm.DB
+	config      *config.Config
+	source      AccountSource
+	userService *UserService
+	killSwitch  *KillSwitchService
+}
+
+// NewEquityService creates a new equity service
+func NewEquityService(source AccountSource, userService *UserService, killSwitch *KillSwitchService) *EquityService {
+	return &EquityService{
+		db:          database.GetDB(),
+		config:      nil, // Will be set later
+		source:      source,
+		userService: userService,
+		killSwitch:  killSwitch,
+	}
+}
+
+// SetConfig sets the configuration holding the drawdown limits
+func (s *EquityService) SetConfig(cfg *config.Config) {
+	s.config = cfg
+}
+
+// Start records snapshots and checks drawdowns periodically until the context is cancelled
+func (s *EquityService) Start(ctx context.Context) {
+	if s.config == nil || !s.config.Trading.Drawdown.Enabled {
+		return
+	}
+
+	ticker := time.NewTicker(s.snapshotInterval())
+	defer ticker.Stop()
+
+	for {
+		s.RunOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce resumes users whose pause ended with the last session, then records the equity of every
+// active user and pauses the ones whose drawdown exceeds the limits
+func (s *EquityService) RunOnce(ctx context.Context) {
+	if s.config == nil {
+		return
+	}
+	if s.config.Trading.Drawdown.AutoResume {
+		s.resume(ctx)
+	}
+
+	users, err := s.userService.GetUsers()
+	if err != nil {
+		log.Printf("Failed to load users for equity snapshots: %v", err)
+		return
+	}
+
+	for i := range users {
+		if !users[i].IsActive {
+			continue
+		}
+
+		snapshot, err := s.Snapshot(ctx, &users[i])
+		if err != nil {
+			log.Printf("Failed to record equity of user %d: %v", users[i].ID, err)
+			continue
+		}
+		if snapshot == nil {
+			continue
+		}
+		if err := s.checkDrawdown(ctx, &users[i]); err != nil {
+			log.Printf("Failed to check drawdown of user %d: %v", users[i].ID, err)
+		}
+	}
+}
+
+// Snapshot records the equity of a user summed over the exchanges of their active credentials that
+// have a registered broker. Users without such credentials are skipped. The snapshot is not recorded
+// unless every exchange answers, since a partial sum would look like a drawdown.
+func (s *EquityService) Snapshot(ctx context.Context, user *models.User) (*models.EquitySnapshot, error) {
+	credentials, err := s.userService.GetAllUserCredentials(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user credentials: %w", err)
+	}
+	// Account information is only available from registered brokers
+	exchanges := 0
+	for _, credential := range credentials {
+		if _, registered := broker.Registry[credential.Exchange]; credential.IsActive && registered {
+			exchanges++
+		}
+	}
+	if exchanges == 0 {
+		return nil, nil
+	}
+
+	accounts, err := s.source.GetAccountInfo(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(accounts) < exchanges {
+		return nil, fmt.Errorf("account information of %d of %d exchanges is unavailable", exchanges-len(accounts), exchanges)
+	}
+
+	var equity, walletBalance, unrealizedPnL float64
+	for exchange, account := range accounts {
+		value, err := strconv.ParseFloat(account.TotalMarginBalance, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid total margin balance %q on %s", account.TotalMarginBalance, exchange)
+		}
+		equity += value
+		wallet, _ := strconv.ParseFloat(account.TotalWalletBalance, 64)
+		walletBalance += wallet
+		pnl, _ := strconv.ParseFloat(account.TotalUnrealizedPnL, 64)
+		unrealizedPnL += pnl
+	}
+
+	snapshot := &models.EquitySnapshot{
+		UserID:        user.ID,
+		Equity:        formatNumber(equity),
+		WalletBalance: formatNumber(walletBalance),
+		UnrealizedPnL: formatNumber(unrealizedPnL),
+		Exchanges:     len(accounts),
+		CreatedAt:     time.Now(),
+	}
+	if err := s.db.Create(snapshot).Error; err != nil {
+		return nil, fmt.Errorf("failed to save equity snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// EquityCurve returns the snapshots of a user within a period in chronological order
+func (s *EquityService) EquityCurve(userID uint, from, to time.Time) ([]models.EquitySnapshot, error) {
+	query := s.db.Where("user_id = ?", userID)
+	if !from.IsZero() {
+		query = query.Where("created_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("created_at <= ?", to)
+	}
+
+	var snapshots []models.EquitySnapshot
+	if err := query.Order("created_at").Find(&snapshots).Error; err != nil {
+		return nil, fmt.Errorf("failed to get equity snapshots: %w", err)
+	}
+	return snapshots, nil
+}
+
+// Drawdown returns how far the latest equity of a user is below the peak since a point in time,
+// nil without snapshots
+func (s *EquityService) Drawdown(userID uint, since time.Time) (*Drawdown, error) {
+	snapshots, err := s.EquityCurve(userID, since, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, nil
+	}
+
+	drawdown := &Drawdown{Since: since}
+	for _, snapshot := range snapshots {
+		equity, _ := strconv.ParseFloat(snapshot.Equity, 64)
+		if equity > drawdown.Peak {
+			drawdown.Peak = equity
+		}
+		drawdown.Equity = equity
+	}
+	if drawdown.Peak > 0 {
+		drawdown.Percent = (drawdown.Peak - drawdown.Equity) / drawdown.Peak * 100
+	}
+	return drawdown, nil
+}
+
+// Drawdowns returns the intraday and rolling drawdowns of a user as the circuit breaker measures them
+func (s *EquityService) Drawdowns(userID uint) (intraday, rolling *Drawdown, err error) {
+	approvedAt, err := s.lastApproval(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if intraday, err = s.Drawdown(userID, latest(sessionStart(now), approvedAt)); err != nil {
+		return nil, nil, err
+	}
+	if rolling, err = s.Drawdown(userID, latest(now.Add(-s.rollingWindow()), approvedAt)); err != nil {
+		return nil, nil, err
+	}
+	return intraday, rolling, nil
+}
+
+// checkDrawdown pauses a user whose intraday or rolling drawdown reaches its limit
+func (s *EquityService) checkDrawdown(ctx context.Context, user *models.User) error {
+	limits := s.config.Trading.Drawdown
+	if limits.MaxIntraday <= 0 && limits.MaxRolling <= 0 {
+		return nil
+	}
+
+	// Users that are paused already keep their switch
+	if paused, err := s.killSwitch.Check(user.ID, ""); err != nil || paused != nil {
+		return err
+	}
+
+	intraday, rolling, err := s.Drawdowns(user.ID)
+	if err != nil {
+		return err
+	}
+
+	var reason string
+	switch {
+	case limits.MaxIntraday > 0 && intraday != nil && intraday.Percent >= limits.MaxIntraday:
+		reason = fmt.Sprintf("intraday drawdown of %.2f%% reached the limit of %s%%", intraday.Percent, formatNumber(limits.MaxIntraday))
+	case limits.MaxRolling > 0 && rolling != nil && rolling.Percent >= limits.MaxRolling:
+		reason = fmt.Sprintf("rolling drawdown of %.2f%% reached the limit of %s%%", rolling.Percent, formatNumber(limits.MaxRolling))
+	default:
+		return nil
+	}
+
+	_, err = s.killSwitch.Engage(ctx, &KillSwitchRequest{
+		User:         user.APISec,
+		Pause:        models.KillSwitchModeReject,
+		CancelOrders: limits.Flatten,
+		Flatten:      limits.Flatten,
+		Reason:       reason,
+		Source:       models.KillSwitchSourceDrawdown,
+	})
+	return err
+}
+
+// resume releases the switches of the circuit breaker that were engaged before the current session
+func (s *EquityService) resume(ctx context.Context) {
+	switches, err := s.killSwitch.Active()
+	if err != nil {
+		log.Printf("Failed to load kill switches: %v", err)
+		return
+	}
+
+	session := sessionStart(time.Now())
+	for _, killSwitch := range switches {
+		if killSwitch.Source != models.KillSwitchSourceDrawdown || !killSwitch.CreatedAt.Before(session) {
+			continue
+		}
+
+		var user models.User
+		if killSwitch.UserID != 0 {
+			if err := s.db.First(&user, killSwitch.UserID).Error; err != nil {
+				log.Printf("Failed to load user %d: %v", killSwitch.UserID, err)
+				continue
+			}
+		}
+		if _, err := s.killSwitch.Release(ctx, user.APISec, killSwitch.Exchange); err != nil {
+			log.Printf("Failed to resume trading of user %d: %v", killSwitch.UserID, err)
+		}
+	}
+}
+
+// lastApproval returns when the latest pause of the circuit breaker was released for a user
+func (s *EquityService) lastApproval(userID uint) (time.Time, error) {
+	var killSwitch models.KillSwitch
+	err := s.db.Where("user_id = ? AND source = ? AND released_at IS NOT NULL", userID, models.KillSwitchSourceDrawdown).
+		Order("released_at DESC").First(&killSwitch).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get kill switch: %w", err)
+	}
+	return *killSwitch.ReleasedAt, nil
+}
+
+// snapshotInterval returns how often equity is recorded
+func (s *EquityService) snapshotInterval() time.Duration {
+	if s.config != nil && s.config.Trading.Drawdown.SnapshotInterval > 0 {
+		return s.config.Trading.Drawdown.SnapshotInterval
+	}
+	return 5 * time.Minute
+}
+
+// rollingWindow returns the period the rolling peak is taken over
+func (s *EquityService) rollingWindow() time.Duration {
+	if s.config != nil && s.config.Trading.Drawdown.RollingWindow > 0 {
+		return s.config.Trading.Drawdown.RollingWindow
+	}
+	return 7 * 24 * time.Hour
+}
+
+// sessionStart returns the start of the trading session at a point in time, midnight UTC.
+// It is returned in local time like the stored timestamps it is compared with.
+func sessionStart(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour).Local()
+}
+
+// latest returns the later of two points in time
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fakeAccountSource returns the configured total margin balance per exchange
+type fakeAccountSource struct {
+	equity map[string]string
+}
+
+func (f *fakeAccountSource) GetAccountInfo(ctx context.Context, userID uint) (map[string]*broker.AccountInfo, error) {
+	accounts := make(map[string]*broker.AccountInfo)
+	for exchange, equity := range f.equity {
+		accounts[exchange] = &broker.AccountInfo{TotalMarginBalance: equity, TotalWalletBalance: equity, TotalUnrealizedPnL: "0"}
+	}
+	return accounts, nil
+}
+
+// newTestEquityService creates an equity service pausing users with a kill switch of its own
+func newTestEquityService(t *testing.T, db *gorm.DB, source AccountSource, drawdown config.DrawdownConfig) (*EquityService, *fakeKillSwitchController) {
+	t.Helper()
+
+	userService := &UserService{db: db}
+	controller := &fakeKillSwitchController{}
+	service := &EquityService{
+		db:          db,
+		config:      &config.Config{Trading: config.TradingConfig{Drawdown: drawdown}},
+		source:      source,
+		userService: userService,
+		killSwitch:  &KillSwitchService{db: db, controller: controller, userService: userService},
+	}
+	return service, controller
+}
+
+func TestEquitySnapshots(t *testing.T) {
+	db := newTestDB(t)
+	user := &models.User{APISec: "secret", Name: "alice", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+	newTestCredential(t, db, user.ID, "secret")
+	require.NoError(t, db.Create(&models.UserCredential{UserID: user.ID, Exchange: "okx", APIKey: "key", SecretKey: "okx", IsActive: true}).Error)
+	broker.Register("okx", func() broker.Broker { return new(MockBroker) })
+	t.Cleanup(func() { delete(broker.Registry, "okx") })
+
+	// Exchanges without a registered broker have no account information and are left out
+	require.NoError(t, db.Create(&models.UserCredential{UserID: user.ID, Exchange: "bitget", APIKey: "key", SecretKey: "bitget", IsActive: true}).Error)
+
+	source := &fakeAccountSource{equity: map[string]string{"binance": "1000.5", "okx": "250"}}
+	service, _ := newTestEquityService(t, db, source, config.DrawdownConfig{})
+
+	snapshot, err := service.Snapshot(context.Background(), user)
+	require.NoError(t, err)
+	assert.Equal(t, "1250.5", snapshot.Equity)
+	assert.Equal(t, 2, snapshot.Exchanges)
+
+	// A missing exchange would look like a drawdown, so nothing is recorded
+	source.equity = map[string]string{"binance": "1000.5"}
+	_, err = service.Snapshot(context.Background(), user)
+	assert.ErrorContains(t, err, "1 of 2 exchanges")
+
+	// Users without credentials of registered brokers have no equity
+	other := &models.User{APISec: "other", Name: "bob", IsActive: true}
+	require.NoError(t, db.Create(other).Error)
+	require.NoError(t, db.Create(&models.UserCredential{UserID: other.ID, Exchange: "bitget", APIKey: "key", SecretKey: "other", IsActive: true}).Error)
+	snapshot, err = service.Snapshot(context.Background(), other)
+	require.NoError(t, err)
+	assert.Nil(t, snapshot)
+
+	curve, err := service.EquityCurve(user.ID, time.Now().Add(-time.Hour), time.Time{})
+	require.NoError(t, err)
+	require.Len(t, curve, 1)
+	assert.Equal(t, "1250.5", curve[0].Equity)
+}
+
+func TestDrawdownCircuitBreaker(t *testing.T) {
+	db := newTestDB(t)
+	user := &models.User{APISec: "secret", Name: "alice", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+	newTestCredential(t, db, user.ID, "secret")
+
+	source := &fakeAccountSource{equity: map[string]string{"binance": "1000"}}
+	service, controller := newTestEquityService(t, db, source, config.DrawdownConfig{Enabled: true, MaxIntraday: 10, Flatten: true})
+
+	// A drawdown below the limit keeps trading
+	service.RunOnce(context.Background())
+	source.equity["binance"] = "950"
+	service.RunOnce(context.Background())
+	switches, err := service.killSwitch.Active()
+	require.NoError(t, err)
+	assert.Empty(t, switches)
+
+	intraday, _, err := service.Drawdowns(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1000.0, intraday.Peak)
+	assert.InDelta(t, 5, intraday.Percent, 1e-9)
+
+	// Reaching it pauses the user and flattens their positions once
+	source.equity["binance"] = "880"
+	service.RunOnce(context.Background())
+	service.RunOnce(context.Background())
+	switches, err = service.killSwitch.Active()
+	require.NoError(t, err)
+	require.Len(t, switches, 1)
+	assert.Equal(t, user.ID, switches[0].UserID)
+	assert.Equal(t, models.KillSwitchSourceDrawdown, switches[0].Source)
+	assert.Contains(t, switches[0].Reason, "intraday drawdown of 12.00%")
+	assert.Equal(t, []string{"cancel", "flatten"}, controller.calls)
+
+	// After a manual release the drawdown is measured from the release
+	_, err = service.killSwitch.Release(context.Background(), "alice", "")
+	require.NoError(t, err)
+	service.RunOnce(context.Background())
+	switches, err = service.killSwitch.Active()
+	require.NoError(t, err)
+	assert.Empty(t, switches)
+}
+
+func TestDrawdownCircuitBreakerResumesAtNextSession(t *testing.T) {
+	db := newTestDB(t)
+	user := &models.User{APISec: "secret", Name: "alice", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+
+	service, _ := newTestEquityService(t, db, &fakeAccountSource{}, config.DrawdownConfig{Enabled: true, MaxIntraday: 10, AutoResume: true})
+	_, err := service.killSwitch.Engage(context.Background(), &KillSwitchRequest{User: "alice", Pause: models.KillSwitchModeReject})
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&models.User{APISec: "other", Name: "bob", IsActive: true}).Error)
+	_, err = service.killSwitch.Engage(context.Background(), &KillSwitchRequest{User: "bob", Pause: models.KillSwitchModeReject, Source: models.KillSwitchSourceDrawdown})
+	require.NoError(t, err)
+
+	// Pauses of the breaker from today's session stay, manual ones are never resumed
+	service.RunOnce(context.Background())
+	switches, err := service.killSwitch.Active()
+	require.NoError(t, err)
+	assert.Len(t, switches, 2)
+
+	require.NoError(t, db.Model(&models.KillSwitch{}).Where("source = ?", models.KillSwitchSourceDrawdown).
+		Update("created_at", time.Now().Add(-25*time.Hour)).Error)
+	require.NoError(t, db.Model(&models.KillSwitch{}).Where("source = ?", models.KillSwitchSourceAdmin).
+		Update("created_at", time.Now().Add(-25*time.Hour)).Error)
+	service.RunOnce(context.Background())
+	switches, err = service.killSwitch.Active()
+	require.NoError(t, err)
+	require.Len(t, switches, 1)
+	assert.Equal(t, models.KillSwitchSourceAdmin, switches[0].Source)
+}
@@ -3,20 +3,26 @@ package services
 import (
 	"fmt"
 	"log"
-	"net/http"
-	"net/url"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/database"
 	"github.com/Cyvadra/tv-forward/internal/models"
 	"github.com/go-resty/resty/v2"
+	"gorm.io/gorm"
 )
 
 // ForwardService handles forwarding alerts to downstream endpoints
 type ForwardService struct {
-	client *resty.Client
-	config *config.Config
+	client      *resty.Client
+	config      *config.Config
+	userConfig  *config.UserConfig
+	strategies  *StrategyService
+	db          *gorm.DB
+	templates   templateCache
+	router      *router
+	routerMutex sync.Mutex
 }
 
 // NewForwardService creates a new forward service
@@ -24,12 +30,33 @@ func NewForwardService() *ForwardService {
 	return &ForwardService{
 		client: resty.New().SetTimeout(10 * time.Second),
 		config: nil, // Will be set later
+		db:     database.GetDB(),
 	}
 }
 
 // SetConfig sets the configuration for the forward service
 func (s *ForwardService) SetConfig(cfg *config.Config) {
 	s.config = cfg
+	s.templates.reset()
+
+	s.routerMutex.Lock()
+	s.router = nil
+	s.routerMutex.Unlock()
+
+	// Compile the routing rules now so configuration errors are logged at startup
+	if cfg != nil {
+		s.getRouter()
+	}
+}
+
+// SetUserConfig sets the user configuration holding the users' notification channels
+func (s *ForwardService) SetUserConfig(userConfig *config.UserConfig) {
+	s.userConfig = userConfig
+}
+
+// SetStrategyService sets the service holding the strategies' notification channels
+func (s *ForwardService) SetStrategyService(strategies *StrategyService) {
+	s.strategies = strategies
 }
 
 // ForwardAlert forwards an alert to all configured downstream endpoints
@@ -39,231 +66,86 @@ func (s *ForwardService) ForwardAlert(alert *models.Alert) error {
 
 // ForwardAlertWithURL forwards an alert to all configured downstream endpoints with optional URL override
 func (s *ForwardService) ForwardAlertWithURL(alert *models.Alert, requestURL string) error {
+	return s.ForwardNotification(&Notification{Alert: alert, RequestURL: requestURL})
+}
+
+// ForwardNotification renders a notification with each routed endpoint's template and forwards it
+func (s *ForwardService) ForwardNotification(notification *Notification) error {
 	if s.config == nil {
 		return fmt.Errorf("configuration not set")
 	}
 
-	// Extract key from request URL if present
-	var wechatKey string
-	if requestURL != "" {
-		if key, err := s.extractKeyFromURL(requestURL); err == nil && key != "" {
-			wechatKey = key
-			log.Printf("Extracted WeChat key from URL: %s", wechatKey)
-		}
-	}
+	for _, name := range s.Route(notification).Endpoints {
+		endpoint := *s.findEndpoint(name)
 
-	for _, endpoint := range s.config.Endpoints {
-		if !endpoint.IsActive {
-			continue
+		// Persist the delivery so failures can be retried later
+		delivery := &models.Delivery{
+			AlertID:      notification.Alert.ID,
+			EndpointName: endpoint.Name,
+			EndpointType: endpoint.Type,
+			RequestURL:   notification.RequestURL,
+			Status:       models.DeliveryStatusPending,
+		}
+		if notification.Execution != nil {
+			delivery.SignalID = notification.Execution.ID
+		}
+		if s.db != nil {
+			if err := s.db.Create(delivery).Error; err != nil {
+				log.Printf("Failed to persist delivery to %s: %v", endpoint.Name, err)
+			}
 		}
 
-		go func(ep config.EndpointConfig) {
-			if err := s.forwardToEndpoint(alert, ep, wechatKey); err != nil {
+		go func(ep config.EndpointConfig, d *models.Delivery) {
+			if err := s.attemptDelivery(d, notification, ep); err != nil {
 				log.Printf("Failed to forward to %s (%s): %v", ep.Name, ep.Type, err)
 			}
-		}(endpoint)
+		}(endpoint, delivery)
 	}
 
 	return nil
 }
 
-// extractKeyFromURL extracts the key parameter from a request URL
-func (s *ForwardService) extractKeyFromURL(requestURL string) (string, error) {
-	parsedURL, err := url.Parse(requestURL)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse URL: %w", err)
+// NotifyExecution forwards the final state of an executed trading signal, such as an
+// order filled after submission, together with the alert it was received with
+func (s *ForwardService) NotifyExecution(signal *models.TradingSignal) error {
+	if s.db == nil {
+		return fmt.Errorf("database not initialized")
 	}
-
-	key := parsedURL.Query().Get("key")
-	return key, nil
-}
-
-// buildWeChatURL builds a WeChat webhook URL with the provided key
-func (s *ForwardService) buildWeChatURL(key string) string {
-	return fmt.Sprintf("https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=%s", key)
-}
-
-// forwardToEndpoint forwards an alert to a specific endpoint
-func (s *ForwardService) forwardToEndpoint(alert *models.Alert, endpoint config.EndpointConfig, wechatKey string) error {
-	switch endpoint.Type {
-	case "telegram":
-		return s.forwardToTelegram(alert, endpoint)
-	case "wechat":
-		return s.forwardToWeChat(alert, endpoint, wechatKey)
-	case "dingtalk":
-		return s.forwardToDingTalk(alert, endpoint)
-	case "webhook":
-		return s.forwardToWebhook(alert, endpoint)
-	default:
-		return fmt.Errorf("unsupported endpoint type: %s", endpoint.Type)
+	if signal.AlertID == 0 {
+		return fmt.Errorf("trading signal %d has no alert", signal.ID)
 	}
-}
-
-// forwardToTelegram forwards an alert to Telegram
-func (s *ForwardService) forwardToTelegram(alert *models.Alert, endpoint config.EndpointConfig) error {
-	message := s.formatRawMessage(alert)
-
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", endpoint.Token)
-	payload := map[string]interface{}{
-		"chat_id":    endpoint.ChatID,
-		"text":       message,
-		"parse_mode": "HTML",
-	}
-
-	resp, err := s.client.R().
-		SetHeader("Content-Type", "application/json").
-		SetBody(payload).
-		Post(url)
 
+	notification, err := s.alertNotification(signal.AlertID)
 	if err != nil {
-		return fmt.Errorf("telegram API request failed: %w", err)
+		return err
 	}
 
-	if resp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("telegram API returned status %d: %s", resp.StatusCode(), resp.String())
+	var execution models.TradingSignal
+	if err := s.db.Preload("User").First(&execution, signal.ID).Error; err != nil {
+		return fmt.Errorf("trading signal %d not found: %w", signal.ID, err)
 	}
+	notification.Execution = &execution
+	notification.UserName = execution.User.Name
 
-	return nil
+	return s.ForwardNotification(notification)
 }
 
-// forwardToWeChat forwards an alert to WeChat (Enterprise WeChat)
-func (s *ForwardService) forwardToWeChat(alert *models.Alert, endpoint config.EndpointConfig, wechatKey string) error {
-	message := s.formatRawMessage(alert)
-
-	log.Printf("WeChat message: %s", message)
-
-	// Use dynamic key if provided, otherwise use the configured URL
-	wechatURL := endpoint.URL
-	if wechatKey != "" {
-		// Replace the key in the URL
-		wechatURL = s.buildWeChatURL(wechatKey)
-		log.Printf("Using dynamic WeChat URL with key: %s", wechatKey)
-	}
-
-	payload := map[string]interface{}{
-		"msgtype": "text",
-		"text": map[string]string{
-			"content": message,
-		},
-	}
-
-	resp, err := s.client.R().
-		SetHeader("Content-Type", "application/json").
-		SetBody(payload).
-		Post(wechatURL)
-
-	if err != nil {
-		return fmt.Errorf("wechat API request failed: %w", err)
-	}
-
-	if resp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("wechat API returned status %d: %s", resp.StatusCode(), resp.String())
-	}
-	log.Printf("WeChat response: %s", resp.String())
-
-	return nil
-}
-
-// forwardToDingTalk forwards an alert to DingTalk
-func (s *ForwardService) forwardToDingTalk(alert *models.Alert, endpoint config.EndpointConfig) error {
-	message := s.formatRawMessage(alert)
-
-	payload := map[string]interface{}{
-		"msgtype": "text",
-		"text": map[string]string{
-			"content": message,
-		},
-	}
-
-	resp, err := s.client.R().
-		SetHeader("Content-Type", "application/json").
-		SetBody(payload).
-		Post(endpoint.URL)
-
-	if err != nil {
-		return fmt.Errorf("dingtalk API request failed: %w", err)
-	}
-
-	if resp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("dingtalk API returned status %d: %s", resp.StatusCode(), resp.String())
-	}
-
-	return nil
-}
-
-// forwardToWebhook forwards an alert to a generic webhook
-func (s *ForwardService) forwardToWebhook(alert *models.Alert, endpoint config.EndpointConfig) error {
-	resp, err := s.client.R().
-		SetHeader("Content-Type", "application/json").
-		SetBody(alert).
-		Post(endpoint.URL)
-
-	if err != nil {
-		return fmt.Errorf("webhook request failed: %w", err)
-	}
-
-	if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
-		return fmt.Errorf("webhook returned status %d: %s", resp.StatusCode(), resp.String())
-	}
-
-	return nil
+// forwardToEndpoint renders a notification and sends it with the endpoint's notifier
+func (s *ForwardService) forwardToEndpoint(notification *Notification, endpoint config.EndpointConfig) error {
+	_, err := s.sendToEndpoint(notification, endpoint)
+	return err
 }
 
-// formatTelegramMessage formats the alert message for Telegram
-func (s *ForwardService) formatTelegramMessage(alert *models.Alert) string {
-	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("🚨 <b>Trading Alert</b>\n\n"))
-	sb.WriteString(fmt.Sprintf("📊 <b>Strategy:</b> %s\n", alert.Strategy))
-	sb.WriteString(fmt.Sprintf("💱 <b>Symbol:</b> %s\n", alert.Symbol))
-	sb.WriteString(fmt.Sprintf("⚡ <b>Action:</b> %s\n", strings.ToUpper(alert.Action)))
-	sb.WriteString(fmt.Sprintf("💰 <b>Price:</b> %.8f\n", alert.Price))
-	if alert.Quantity > 0 {
-		sb.WriteString(fmt.Sprintf("📈 <b>Quantity:</b> %.8f\n", alert.Quantity))
-	}
-	if alert.Message != "" {
-		sb.WriteString(fmt.Sprintf("💬 <b>Message:</b> %s\n", alert.Message))
+// sendToEndpoint sends a notification to an endpoint and returns the downstream
+// response for notifiers that report it
+func (s *ForwardService) sendToEndpoint(notification *Notification, endpoint config.EndpointConfig) (*DeliveryResponse, error) {
+	notifier, exists := NotifierRegistry[endpoint.Type]
+	if !exists {
+		return nil, fmt.Errorf("unsupported endpoint type: %s", endpoint.Type)
 	}
-	sb.WriteString(fmt.Sprintf("⏰ <b>Time:</b> %s", alert.CreatedAt.Format("2006-01-02 15:04:05")))
-	return sb.String()
-}
-
-// formatWeChatMessage formats the alert message for WeChat
-func (s *ForwardService) formatWeChatMessage(alert *models.Alert) string {
-	var sb strings.Builder
-	sb.WriteString("🚨 Trading Alert\n\n")
-	sb.WriteString(fmt.Sprintf("📊 Strategy: %s\n", alert.Strategy))
-	sb.WriteString(fmt.Sprintf("💱 Symbol: %s\n", alert.Symbol))
-	sb.WriteString(fmt.Sprintf("⚡ Action: %s\n", strings.ToUpper(alert.Action)))
-	sb.WriteString(fmt.Sprintf("💰 Price: %.8f\n", alert.Price))
-	if alert.Quantity > 0 {
-		sb.WriteString(fmt.Sprintf("📈 Quantity: %.8f\n", alert.Quantity))
-	}
-	if alert.Message != "" {
-		sb.WriteString(fmt.Sprintf("💬 Message: %s\n", alert.Message))
-	}
-	sb.WriteString(fmt.Sprintf("⏰ Time: %s", alert.CreatedAt.Format("2006-01-02 15:04:05")))
-	return sb.String()
-}
 
-// formatDingTalkMessage formats the alert message for DingTalk
-func (s *ForwardService) formatDingTalkMessage(alert *models.Alert) string {
-	var sb strings.Builder
-	sb.WriteString("🚨 Trading Alert\n\n")
-	sb.WriteString(fmt.Sprintf("📊 Strategy: %s\n", alert.Strategy))
-	sb.WriteString(fmt.Sprintf("💱 Symbol: %s\n", alert.Symbol))
-	sb.WriteString(fmt.Sprintf("⚡ Action: %s\n", strings.ToUpper(alert.Action)))
-	sb.WriteString(fmt.Sprintf("💰 Price: %.8f\n", alert.Price))
-	if alert.Quantity > 0 {
-		sb.WriteString(fmt.Sprintf("📈 Quantity: %.8f\n", alert.Quantity))
-	}
-	if alert.Message != "" {
-		sb.WriteString(fmt.Sprintf("💬 Message: %s\n", alert.Message))
+	if responder, ok := notifier.(ResponseNotifier); ok {
+		return responder.SendWithResponse(s.client, endpoint, notification)
 	}
-	sb.WriteString(fmt.Sprintf("⏰ Time: %s", alert.CreatedAt.Format("2006-01-02 15:04:05")))
-	return sb.String()
-}
-
-// formatRawMessage formats the alert message for raw message
-func (s *ForwardService) formatRawMessage(alert *models.Alert) string {
-	return alert.Message
+	return nil, notifier.Send(s.client, endpoint, s.renderMessage(notification, endpoint), notification)
 }
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/database"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// incomeTypes are the income records pulled from the exchanges
+var incomeTypes = []broker.IncomeType{
+	broker.IncomeTypeRealizedPnL,
+	broker.IncomeTypeCommission,
+	broker.IncomeTypeFundingFee,
+	broker.IncomeTypeInsuranceClear,
+}
+
+// incomePageSize is the number of records a single income request returns at most
+const incomePageSize = 1000
+
+// IncomeService periodically pulls the income history of every active credential from brokers
+// implementing broker.IncomeReporter. Records are stored once per transaction ID and attributed to
+// the trading signal and position they belong to.
+type IncomeService struct {
+	db         *gorm.DB
+	config     *config.Config
+	brokerPool *BrokerPool
+	ledger     *LedgerService
+}
+
+// NewIncomeService creates a new income service
+func NewIncomeService(brokerPool *BrokerPool, ledger *LedgerService) *IncomeService {
+	return &IncomeService{
+		db:         database.GetDB(),
+		config:     nil, // Will be set later
+		brokerPool: brokerPool,
+		ledger:     ledger,
+	}
+}
+
+// SetConfig sets the configuration for the income service
+func (s *IncomeService) SetConfig(cfg *config.Config) {
+	s.config = cfg
+}
+
+// Start pulls the income of every credential periodically until the context is cancelled
+func (s *IncomeService) Start(ctx context.Context) {
+	if s.db == nil || !s.Scheduled() {
+		return
+	}
+
+	ticker := time.NewTicker(s.interval())
+	defer ticker.Stop()
+
+	for {
+		s.RunOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce pulls the income of every active credential
+func (s *IncomeService) RunOnce(ctx context.Context) {
+	var credentials []models.UserCredential
+	if err := s.db.Where("is_active = ?", true).Find(&credentials).Error; err != nil {
+		log.Printf("Failed to query credentials for income: %v", err)
+		return
+	}
+
+	for i := range credentials {
+		stored, err := s.SyncCredential(ctx, &credentials[i])
+		if err != nil {
+			log.Printf("Failed to pull income of user %d on %s: %v", credentials[i].UserID, credentials[i].Exchange, err)
+		}
+		if stored > 0 {
+			log.Printf("Stored %d income records of user %d on %s", stored, credentials[i].UserID, credentials[i].Exchange)
+		}
+	}
+}
+
+// Scheduled reports whether the income is pulled periodically by Start
+func (s *IncomeService) Scheduled() bool {
+	return s.config != nil && s.config.Trading.Income.Enabled
+}
+
+// SyncUser pulls the income of every active credential of a user. It keeps the funding of the
+// trades up to date on request when the periodic pull is disabled.
+func (s *IncomeService) SyncUser(ctx context.Context, userID uint) error {
+	var credentials []models.UserCredential
+	if err := s.db.Where("user_id = ? AND is_active = ?", userID, true).Find(&credentials).Error; err != nil {
+		return fmt.Errorf("failed to get user credentials: %w", err)
+	}
+
+	var errs []error
+	for i := range credentials {
+		if _, err := s.SyncCredential(ctx, &credentials[i]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", credentials[i].Exchange, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SyncCredential pulls the income records of a credential since the last stored record of each type
+// and returns how many new records were stored. Brokers without income history are skipped.
+func (s *IncomeService) SyncCredential(ctx context.Context, credential *models.UserCredential) (int, error) {
+	exchange := strings.ToLower(credential.Exchange)
+	client, release, err := s.brokerPool.Get(ctx, credential.UserID, exchange)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	reporter, ok := client.(broker.IncomeReporter)
+	if !ok {
+		return 0, nil
+	}
+
+	stored := 0
+	var fundingSince time.Time
+	var errs []error
+	for _, incomeType := range incomeTypes {
+		since, err := s.since(credential.UserID, exchange, incomeType)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for {
+			records, err := reporter.GetIncome(ctx, incomeType, since)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", incomeType, err))
+				break
+			}
+			if len(records) == 0 {
+				break
+			}
+
+			incomes := make([]models.Income, 0, len(records))
+			for _, record := range records {
+				income := models.Income{
+					UserID:   credential.UserID,
+					Exchange: exchange,
+					TranID:   record.ID,
+					Symbol:   record.Symbol,
+					Type:     string(record.Type),
+					Amount:   record.Amount,
+					Asset:    record.Asset,
+					TradeID:  record.TradeID,
+					Time:     record.Time,
+				}
+				s.attribute(&income)
+				incomes = append(incomes, income)
+			}
+
+			// Records seen before are skipped by their transaction ID
+			result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&incomes)
+			if result.Error != nil {
+				errs = append(errs, fmt.Errorf("failed to save income: %w", result.Error))
+				break
+			}
+			stored += int(result.RowsAffected)
+			if incomeType == broker.IncomeTypeFundingFee && (fundingSince.IsZero() || records[0].Time.Before(fundingSince)) {
+				fundingSince = records[0].Time
+			}
+
+			last := records[len(records)-1].Time
+			if len(records) < incomePageSize || !last.After(since) {
+				break
+			}
+			since = last
+		}
+	}
+
+	// Trades that were open while funding was charged are updated
+	if !fundingSince.IsZero() && s.ledger != nil {
+		if err := s.ledger.RefreshFunding(credential.UserID, exchange, fundingSince); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return stored, errors.Join(errs...)
+}
+
+// Incomes returns the income records of a user within a period, optionally of a single type, oldest first
+func (s *IncomeService) Incomes(userID uint, incomeType string, from, to time.Time) ([]models.Income, error) {
+	query := s.db.Where("user_id = ?", userID)
+	if incomeType != "" {
+		query = query.Where("type = ?", strings.ToUpper(incomeType))
+	}
+	if !from.IsZero() {
+		query = query.Where("time >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("time <= ?", to)
+	}
+
+	var incomes []models.Income
+	if err := query.Order("time, id").Find(&incomes).Error; err != nil {
+		return nil, fmt.Errorf("failed to get income: %w", err)
+	}
+	return incomes, nil
+}
+
+// since returns the time of the last stored record of a type, or the start of the lookback period
+// when none is stored yet
+func (s *IncomeService) since(userID uint, exchange string, incomeType broker.IncomeType) (time.Time, error) {
+	var income models.Income
+	err := s.db.Where("user_id = ? AND exchange = ? AND type = ?", userID, exchange, incomeType).
+		Order("time DESC").First(&income).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Now().Add(-s.lookback()), nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get income: %w", err)
+	}
+	return income.Time, nil
+}
+
+// attribute links a record to the latest filled trading signal of its symbol created before the
+// record and to the position of the symbol
+func (s *IncomeService) attribute(income *models.Income) {
+	if income.Symbol == "" {
+		return
+	}
+	symbol := strings.ToUpper(income.Symbol)
+
+	var signal models.TradingSignal
+	err := s.db.Where("user_id = ? AND LOWER(exchange) = ? AND UPPER(symbol) = ? AND status IN ? AND created_at <= ?",
+		income.UserID, income.Exchange, symbol, []string{"filled", "partially_filled"}, income.Time).
+		Order("created_at DESC").First(&signal).Error
+	if err == nil {
+		income.TradingSignalID = signal.ID
+	}
+
+	var position models.Position
+	err = s.db.Where("user_id = ? AND LOWER(exchange) = ? AND UPPER(symbol) = ?", income.UserID, income.Exchange, symbol).
+		Order("id DESC").First(&position).Error
+	if err == nil {
+		income.PositionID = position.ID
+	}
+}
+
+// interval returns how often income is pulled
+func (s *IncomeService) interval() time.Duration {
+	if s.config != nil && s.config.Trading.Income.Interval > 0 {
+		return s.config.Trading.Income.Interval
+	}
+	return time.Hour
+}
+
+// lookback returns how far back the first pull of a credential reaches
+func (s *IncomeService) lookback() time.Duration {
+	if s.config != nil && s.config.Trading.Income.Lookback > 0 {
+		return s.config.Trading.Income.Lookback
+	}
+	return 7 * 24 * time.Hour
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockIncomeBroker is a mock broker that also reports the income history
+type MockIncomeBroker struct {
+	MockBroker
+}
+
+func (m *MockIncomeBroker) GetIncome(ctx context.Context, incomeType broker.IncomeType, since time.Time) ([]broker.Income, error) {
+	args := m.Called(ctx, incomeType, since)
+	return args.Get(0).([]broker.Income), args.Error(1)
+}
+
+func TestIncomeSync(t *testing.T) {
+	db := newTestDB(t)
+	credential := newTestCredential(t, db, 1, "secret")
+
+	client := new(MockIncomeBroker)
+	client.On("Initialize", mock.Anything, mock.Anything).Return(nil)
+	pool, _ := newTestPool(t, db)
+	pool.create = func(exchange string) (broker.Broker, error) { return client, nil }
+
+	ledger := &LedgerService{db: db}
+	service := &IncomeService{
+		db:         db,
+		config:     &config.Config{Trading: config.TradingConfig{Income: config.IncomeConfig{Lookback: 48 * time.Hour}}},
+		brokerPool: pool,
+		ledger:     ledger,
+	}
+
+	start := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	entry := bookFill(t, db, ledger, "1", "100", "0.1", start)
+	exit := bookFill(t, db, ledger, "0", "110", "0.1", start.Add(12*time.Hour))
+	bookFill(t, db, ledger, "-1", "110", "0.1", start.Add(13*time.Hour))
+	position := &models.Position{UserID: 1, Symbol: "btcusdt", Exchange: "binance", Size: "-1"}
+	require.NoError(t, db.Create(position).Error)
+
+	// The first pull reaches back over the lookback period
+	firstPull := mock.MatchedBy(func(since time.Time) bool {
+		return since.Before(time.Now().Add(-47*time.Hour)) && since.After(time.Now().Add(-49*time.Hour))
+	})
+	funding := []broker.Income{
+		{ID: "3", Symbol: "BTCUSDT", Type: broker.IncomeTypeFundingFee, Amount: "-0.5", Asset: "USDT", Time: start.Add(8 * time.Hour)},
+		{ID: "4", Symbol: "ETHUSDT", Type: broker.IncomeTypeFundingFee, Amount: "-0.7", Asset: "USDT", Time: start.Add(8 * time.Hour)},
+		{ID: "5", Symbol: "BTCUSDT", Type: broker.IncomeTypeFundingFee, Amount: "0.2", Asset: "USDT", Time: start.Add(16 * time.Hour)},
+	}
+	client.On("GetIncome", mock.Anything, broker.IncomeTypeRealizedPnL, firstPull).Return([]broker.Income{
+		{ID: "1", Symbol: "BTCUSDT", Type: broker.IncomeTypeRealizedPnL, Amount: "10", Asset: "USDT", TradeID: "77", Time: start.Add(12 * time.Hour)},
+	}, nil).Once()
+	client.On("GetIncome", mock.Anything, broker.IncomeTypeCommission, firstPull).Return([]broker.Income{
+		{ID: "2", Symbol: "BTCUSDT", Type: broker.IncomeTypeCommission, Amount: "-0.1", Asset: "USDT", TradeID: "12", Time: start.Add(time.Second)},
+	}, nil).Once()
+	client.On("GetIncome", mock.Anything, broker.IncomeTypeFundingFee, firstPull).Return(funding, nil).Once()
+	client.On("GetIncome", mock.Anything, broker.IncomeTypeInsuranceClear, firstPull).Return([]broker.Income{}, nil).Once()
+
+	stored, err := service.SyncCredential(context.Background(), credential)
+	require.NoError(t, err)
+	assert.Equal(t, 5, stored)
+
+	// Records are attributed to the signal that filled before them and to the position of the symbol
+	incomes, err := service.Incomes(1, "", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, incomes, 5)
+	assert.Equal(t, "2", incomes[0].TranID)
+	assert.Equal(t, entry.ID, incomes[0].TradingSignalID)
+	assert.Equal(t, position.ID, incomes[0].PositionID)
+
+	pnl, err := service.Incomes(1, "realized_pnl", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, pnl, 1)
+	assert.Equal(t, exit.ID, pnl[0].TradingSignalID)
+	assert.Equal(t, "77", pnl[0].TradeID)
+
+	// Funding is charged to the trades open at the time
+	var trades []models.Trade
+	require.NoError(t, db.Order("id").Find(&trades).Error)
+	require.Len(t, trades, 2)
+	assert.Equal(t, "-0.5", trades[0].Funding)
+	assert.Equal(t, "9.3", trades[0].NetPnL)
+	assert.Equal(t, "0.2", trades[1].Funding)
+
+	// The next pull continues from the last record of each type and skips the ones already stored
+	client.On("GetIncome", mock.Anything, broker.IncomeTypeRealizedPnL, mock.MatchedBy(start.Add(12*time.Hour).Equal)).Return([]broker.Income{}, nil).Once()
+	client.On("GetIncome", mock.Anything, broker.IncomeTypeCommission, mock.MatchedBy(start.Add(time.Second).Equal)).Return([]broker.Income{}, nil).Once()
+	client.On("GetIncome", mock.Anything, broker.IncomeTypeFundingFee, mock.MatchedBy(start.Add(16*time.Hour).Equal)).Return(funding[2:], nil).Once()
+	client.On("GetIncome", mock.Anything, broker.IncomeTypeInsuranceClear, firstPull).Return([]broker.Income{}, nil).Once()
+
+	stored, err = service.SyncCredential(context.Background(), credential)
+	require.NoError(t, err)
+	assert.Zero(t, stored)
+	client.AssertExpectations(t)
+
+	require.NoError(t, db.First(&trades[1], trades[1].ID).Error)
+	assert.Equal(t, "0.2", trades[1].Funding)
+}
+
+func TestIncomeSyncSkipsBrokersWithoutIncome(t *testing.T) {
+	db := newTestDB(t)
+	credential := newTestCredential(t, db, 1, "secret")
+	pool, created := newTestPool(t, db)
+	service := &IncomeService{db: db, brokerPool: pool}
+
+	stored, err := service.SyncCredential(context.Background(), credential)
+	require.NoError(t, err)
+	assert.Zero(t, stored)
+	require.Len(t, *created, 1)
+	(*created)[0].AssertNotCalled(t, "GetIncome", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,355 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/database"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrSignalQueued is returned by the pipeline for signals held back by a kill switch in queue mode
+var ErrSignalQueued = errors.New("signal queued by kill switch")
+
+// KillSwitchController is the trading backend the kill switch cancels orders and flattens positions with
+type KillSwitchController interface {
+	CancelOpenOrders(ctx context.Context, userID uint, exchange string) map[string]error
+	ClosePositions(ctx context.Context, userID uint, exchange string) map[string]error
+}
+
+// KillSwitchRequest engages the kill switch for every user, a single user or an exchange
+type KillSwitchRequest struct {
+	User         string `json:"user"`          // Name or api_sec, empty for every user
+	Exchange     string `json:"exchange"`      // Empty for every exchange
+	Pause        string `json:"pause"`         // reject or queue new signals, empty keeps accepting them
+	CancelOrders bool   `json:"cancel_orders"` // Cancel the open orders in scope
+	Flatten      bool   `json:"flatten"`       // Close the positions in scope
+	Reason       string `json:"reason"`
+	Source       string `json:"-"` // Set by services engaging the switch, admin otherwise
+}
+
+// KillSwitchResult reports what engaging or releasing a kill switch did
+type KillSwitchResult struct {
+	Switch        *models.KillSwitch `json:"switch,omitempty"`
+	CancelErrors  map[string]string  `json:"cancel_errors,omitempty"`  // Error per user/exchange whose orders could not be cancelled
+	FlattenErrors map[string]string  `json:"flatten_errors,omitempty"` // Error per user/exchange whose positions could not be closed
+	Replayed      int                `json:"replayed,omitempty"`       // Queued signals executed after the release
+}
+
+// KillSwitchService pauses trading, cancels open orders and flattens positions globally, per user
+// or per exchange. Switches are stored in the database so they survive restarts.
+type KillSwitchService struct {
+	db             *gorm.DB
+	controller     KillSwitchController
+	userService    *UserService
+	forwardService *ForwardService
+	tradingService *TradingService
+	mutex          sync.Mutex
+}
+
+// NewKillSwitchService creates a new kill switch service
+func NewKillSwitchService(controller KillSwitchController, userService *UserService) *KillSwitchService {
+	return &KillSwitchService{
+		db:          database.GetDB(),
+		controller:  controller,
+		userService: userService,
+	}
+}
+
+// SetForwardService sets the service every toggle is notified with
+func (s *KillSwitchService) SetForwardService(forwardService *ForwardService) {
+	s.forwardService = forwardService
+}
+
+// SetTradingService sets the service queued signals are executed with once a switch is released
+func (s *KillSwitchService) SetTradingService(tradingService *TradingService) {
+	s.tradingService = tradingService
+}
+
+// Active returns the engaged kill switches
+func (s *KillSwitchService) Active() ([]models.KillSwitch, error) {
+	var switches []models.KillSwitch
+	if err := s.db.Where("active = ?", true).Order("id").Find(&switches).Error; err != nil {
+		return nil, fmt.Errorf("failed to get kill switches: %w", err)
+	}
+	return switches, nil
+}
+
+// Check returns the engaged switch covering signals of a user on an exchange, nil when trading is allowed.
+// A rejecting switch takes precedence over a queueing one.
+func (s *KillSwitchService) Check(userID uint, exchange string) (*models.KillSwitch, error) {
+	switches, err := s.Active()
+	if err != nil {
+		return nil, err
+	}
+
+	var match *models.KillSwitch
+	for i := range switches {
+		if !switches[i].Applies(userID, exchange) {
+			continue
+		}
+		if match == nil || switches[i].Mode == models.KillSwitchModeReject {
+			match = &switches[i]
+		}
+	}
+	return match, nil
+}
+
+// Engage pauses new signals in the scope of the request, then cancels its open orders and
+// flattens its positions as requested. Engaging a paused scope again updates its mode.
+func (s *KillSwitchService) Engage(ctx context.Context, req *KillSwitchRequest) (*KillSwitchResult, error) {
+	if req.Pause != "" && req.Pause != models.KillSwitchModeReject && req.Pause != models.KillSwitchModeQueue {
+		return nil, fmt.Errorf("invalid pause mode %q: must be %s or %s", req.Pause, models.KillSwitchModeReject, models.KillSwitchModeQueue)
+	}
+	if req.Pause == "" && !req.CancelOrders && !req.Flatten {
+		return nil, fmt.Errorf("nothing to do: set pause, cancel_orders or flatten")
+	}
+
+	user, err := s.resolveUser(req.User)
+	if err != nil {
+		return nil, err
+	}
+	exchange := strings.ToLower(req.Exchange)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := &KillSwitchResult{}
+	if req.Pause != "" {
+		killSwitch, err := s.find(user, exchange)
+		if err != nil {
+			return nil, err
+		}
+		if killSwitch == nil {
+			killSwitch = &models.KillSwitch{Exchange: exchange, Active: true}
+			if user != nil {
+				killSwitch.UserID = user.ID
+			}
+		}
+		killSwitch.Mode = req.Pause
+		killSwitch.Reason = req.Reason
+		killSwitch.Source = req.Source
+		if killSwitch.Source == "" {
+			killSwitch.Source = models.KillSwitchSourceAdmin
+		}
+		if err := s.db.Save(killSwitch).Error; err != nil {
+			return nil, fmt.Errorf("failed to save kill switch: %w", err)
+		}
+		result.Switch = killSwitch
+	}
+
+	// Open orders are cancelled first so they cannot reopen the positions being closed
+	if req.CancelOrders {
+		if result.CancelErrors, err = s.forEachAccount(ctx, user, exchange, s.controller.CancelOpenOrders); err != nil {
+			return result, err
+		}
+	}
+	if req.Flatten {
+		if result.FlattenErrors, err = s.forEachAccount(ctx, user, exchange, s.controller.ClosePositions); err != nil {
+			return result, err
+		}
+	}
+
+	var actions []string
+	switch req.Pause {
+	case models.KillSwitchModeReject:
+		actions = append(actions, "new signals are rejected")
+	case models.KillSwitchModeQueue:
+		actions = append(actions, "new signals are queued")
+	}
+	if req.CancelOrders {
+		actions = append(actions, "open orders cancelled"+failures(result.CancelErrors))
+	}
+	if req.Flatten {
+		actions = append(actions, "positions flattened"+failures(result.FlattenErrors))
+	}
+	message := fmt.Sprintf("Kill switch engaged %s: %s", scopeDescription(user, exchange), strings.Join(actions, ", "))
+	if req.Reason != "" {
+		message += ". Reason: " + req.Reason
+	}
+	s.notify("engage", user, message, req)
+
+	log.Print(message)
+	return result, nil
+}
+
+// Release resumes trading in a scope and executes the signals queued while it was paused.
+// Signals still covered by another switch stay queued.
+func (s *KillSwitchService) Release(ctx context.Context, userName, exchange string) (*KillSwitchResult, error) {
+	user, err := s.resolveUser(userName)
+	if err != nil {
+		return nil, err
+	}
+	exchange = strings.ToLower(exchange)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	killSwitch, err := s.find(user, exchange)
+	if err != nil {
+		return nil, err
+	}
+	if killSwitch == nil {
+		return nil, fmt.Errorf("kill switch is not engaged %s", scopeDescription(user, exchange))
+	}
+
+	now := time.Now()
+	killSwitch.Active = false
+	killSwitch.ReleasedAt = &now
+	if err := s.db.Save(killSwitch).Error; err != nil {
+		return nil, fmt.Errorf("failed to save kill switch: %w", err)
+	}
+
+	result := &KillSwitchResult{Switch: killSwitch}
+	result.Replayed = s.replayQueued(ctx)
+
+	message := fmt.Sprintf("Kill switch released %s", scopeDescription(user, exchange))
+	if result.Replayed > 0 {
+		message += fmt.Sprintf(": %d queued signals executed", result.Replayed)
+	}
+	s.notify("release", user, message, map[string]string{"user": userName, "exchange": exchange})
+
+	log.Print(message)
+	return result, nil
+}
+
+// find returns the engaged switch of exactly the given scope, nil when there is none
+func (s *KillSwitchService) find(user *models.User, exchange string) (*models.KillSwitch, error) {
+	var userID uint
+	if user != nil {
+		userID = user.ID
+	}
+
+	var killSwitch models.KillSwitch
+	err := s.db.Where("user_id = ? AND exchange = ? AND active = ?", userID, exchange, true).First(&killSwitch).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kill switch: %w", err)
+	}
+	return &killSwitch, nil
+}
+
+// resolveUser finds a user by name or api_sec, nil for the empty identifier
+func (s *KillSwitchService) resolveUser(identifier string) (*models.User, error) {
+	if identifier == "" {
+		return nil, nil
+	}
+	user, err := s.userService.FindUser(identifier)
+	if err != nil {
+		return nil, fmt.Errorf("unknown user: %s", identifier)
+	}
+	return user, nil
+}
+
+// forEachAccount runs an action for the accounts of one user, or of every user, and returns the errors by user/exchange
+func (s *KillSwitchService) forEachAccount(ctx context.Context, user *models.User, exchange string,
+	action func(ctx context.Context, userID uint, exchange string) map[string]error) (map[string]string, error) {
+	users := []models.User{}
+	if user != nil {
+		users = append(users, *user)
+	} else {
+		var err error
+		if users, err = s.userService.GetUsers(); err != nil {
+			return nil, fmt.Errorf("failed to load users: %w", err)
+		}
+	}
+
+	errs := make(map[string]string)
+	for _, u := range users {
+		for name, err := range action(ctx, u.ID, exchange) {
+			errs[u.Name+"/"+name] = err.Error()
+		}
+	}
+	return errs, nil
+}
+
+// replayQueued executes the queued alerts in the order they were received and returns how many left the queue
+func (s *KillSwitchService) replayQueued(ctx context.Context) int {
+	if s.tradingService == nil {
+		return 0
+	}
+
+	var alerts []models.Alert
+	if err := s.db.Where("status = ?", "queued").Order("id").Find(&alerts).Error; err != nil {
+		log.Printf("Failed to load queued alerts: %v", err)
+		return 0
+	}
+
+	replayed := 0
+	for i := range alerts {
+		body := alerts[i].RawPayload
+		if alerts[i].SignalPayload != "" {
+			body = alerts[i].SignalPayload
+		}
+		execution := &Execution{
+			Body:       []byte(body),
+			ReceivedAt: time.Now(),
+			Alert:      &alerts[i],
+		}
+		if err := s.tradingService.Execute(ctx, execution); err != nil {
+			log.Printf("Failed to execute queued alert %d: %v", alerts[i].ID, err)
+		}
+		if execution.Alert.Status != "queued" {
+			replayed++
+		}
+	}
+	return replayed
+}
+
+// notify stores a toggle as an alert and forwards it to the routed endpoints
+func (s *KillSwitchService) notify(action string, user *models.User, message string, payload interface{}) {
+	if s.forwardService == nil || s.db == nil {
+		return
+	}
+
+	rawPayload, _ := json.Marshal(payload)
+	alert := &models.Alert{
+		Strategy:   "kill_switch",
+		Action:     action,
+		Message:    message,
+		RawPayload: string(rawPayload),
+		Status:     "processed",
+		CreatedAt:  time.Now(),
+	}
+	if err := s.db.Create(alert).Error; err != nil {
+		log.Printf("Failed to save kill switch alert: %v", err)
+		return
+	}
+
+	notification := &Notification{Alert: alert}
+	if user != nil {
+		notification.UserName = user.Name
+	}
+	if err := s.forwardService.ForwardNotification(notification); err != nil {
+		log.Printf("Failed to notify kill switch toggle: %v", err)
+	}
+}
+
+// scopeDescription describes the users and exchanges a switch applies to
+func scopeDescription(user *models.User, exchange string) string {
+	scope := "for all users"
+	if user != nil {
+		scope = "for " + user.Name
+	}
+	if exchange != "" {
+		scope += " on " + exchange
+	}
+	return scope
+}
+
+// failures lists the accounts an action failed on
+func failures(errs map[string]string) string {
+	if len(errs) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (failed on %s)", strings.Join(sortedKeys(errs), ", "))
+}
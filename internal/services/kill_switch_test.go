@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKillSwitchController records the accounts orders are cancelled and positions closed on
+type fakeKillSwitchController struct {
+	calls []string
+	errs  map[uint]error
+}
+
+func (f *fakeKillSwitchController) CancelOpenOrders(ctx context.Context, userID uint, exchange string) map[string]error {
+	f.calls = append(f.calls, "cancel")
+	return nil
+}
+
+func (f *fakeKillSwitchController) ClosePositions(ctx context.Context, userID uint, exchange string) map[string]error {
+	f.calls = append(f.calls, "flatten")
+	if err := f.errs[userID]; err != nil {
+		return map[string]error{exchange: err}
+	}
+	return nil
+}
+
+func TestKillSwitchRejectsAndQueuesSignals(t *testing.T) {
+	db := newTestDB(t)
+	pool, created := newTestPool(t, db)
+	require.NoError(t, db.Create(&models.User{APISec: "secret", Name: "alice", IsActive: true}).Error)
+	newTestCredential(t, db, 1, "secret")
+	service := newTestTradingService(t, db, pool)
+	killSwitch := &KillSwitchService{db: db, controller: &fakeKillSwitchController{}, userService: service.userService, tradingService: service}
+	service.SetKillSwitch(killSwitch)
+
+	body := []byte(`{"api_sec":"secret","symbol":"BTCUSDT","exchange":"binance","action":"buy","prev_market_position_size":"0","market_position_size":"0.01"}`)
+
+	// Rejected signals are recorded as failed with the kill switch as the rule that fired
+	_, err := killSwitch.Engage(context.Background(), &KillSwitchRequest{User: "alice", Pause: models.KillSwitchModeReject, Reason: "maintenance"})
+	require.NoError(t, err)
+	execution := &Execution{Body: body}
+	require.NoError(t, service.Execute(context.Background(), execution))
+	assert.Equal(t, "failed", execution.Record.Status)
+	assert.Equal(t, RiskRuleKillSwitch, execution.Record.RiskRule)
+	assert.Contains(t, execution.Record.ErrorMessage, "maintenance")
+	_, err = killSwitch.Release(context.Background(), "alice", "")
+	require.NoError(t, err)
+
+	// Engaging a paused scope again updates its mode
+	_, err = killSwitch.Engage(context.Background(), &KillSwitchRequest{Exchange: "Binance", Pause: models.KillSwitchModeReject})
+	require.NoError(t, err)
+	_, err = killSwitch.Engage(context.Background(), &KillSwitchRequest{Exchange: "binance", Pause: models.KillSwitchModeQueue})
+	require.NoError(t, err)
+	switches, err := killSwitch.Active()
+	require.NoError(t, err)
+	require.Len(t, switches, 1)
+	assert.Equal(t, models.KillSwitchModeQueue, switches[0].Mode)
+
+	// Queued signals are stored but not traded
+	execution = &Execution{Body: body}
+	require.NoError(t, service.Execute(context.Background(), execution))
+	assert.Equal(t, "queued", execution.Alert.Status)
+	assert.Empty(t, *created)
+	var count int64
+	db.Model(&models.TradingSignal{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// Releasing the switch executes them with the alert they were received with
+	_, release, err := pool.Get(context.Background(), 1, "binance")
+	require.NoError(t, err)
+	release()
+	(*created)[0].On("PlaceOrder", mock.Anything, mock.Anything).Return(&broker.Order{
+		ID: "42", Symbol: "BTCUSDT", ExecutedQuantity: "0.01", Status: broker.OrderStatusFilled,
+	}, nil).Once()
+
+	result, err := killSwitch.Release(context.Background(), "", "binance")
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Replayed)
+	(*created)[0].AssertExpectations(t)
+
+	var alert models.Alert
+	require.NoError(t, db.First(&alert, execution.Alert.ID).Error)
+	assert.Equal(t, "processed", alert.Status)
+	var signal models.TradingSignal
+	require.NoError(t, db.Where("alert_id = ?", alert.ID).First(&signal).Error)
+	assert.Equal(t, "42", signal.OrderID)
+
+	_, err = killSwitch.Release(context.Background(), "", "binance")
+	assert.ErrorContains(t, err, "not engaged")
+}
+
+func TestKillSwitchReplaysParsedSignals(t *testing.T) {
+	db := newTestDB(t)
+	pool, created := newTestPool(t, db)
+	require.NoError(t, db.Create(&models.User{APISec: "secret", Name: "alice", IsActive: true}).Error)
+	newTestCredential(t, db, 1, "secret")
+	service := newTestTradingService(t, db, pool)
+	killSwitch := &KillSwitchService{db: db, controller: &fakeKillSwitchController{}, userService: service.userService, tradingService: service}
+	service.SetKillSwitch(killSwitch)
+
+	_, err := killSwitch.Engage(context.Background(), &KillSwitchRequest{Exchange: "binance", Pause: models.KillSwitchModeQueue})
+	require.NoError(t, err)
+
+	// The queued alert keeps the original text next to the signal it was parsed into
+	body := "order buy @ 0.01 filled on BINANCE:BTCUSDT.P"
+	execution := &Execution{Body: []byte(body), RequestURL: "/api/v1/webhook/tradingview_text?api_sec=secret&exchange=binance", Parser: "tradingview_text"}
+	require.NoError(t, service.Execute(context.Background(), execution))
+	assert.Equal(t, "queued", execution.Alert.Status)
+	assert.Equal(t, body, execution.Alert.RawPayload)
+	assert.Contains(t, execution.Alert.SignalPayload, `"api_sec":"secret"`)
+
+	// Releasing the switch trades the canonical signal
+	_, release, err := pool.Get(context.Background(), 1, "binance")
+	require.NoError(t, err)
+	release()
+	(*created)[0].On("PlaceOrder", mock.Anything, mock.Anything).Return(&broker.Order{
+		ID: "42", Symbol: "BTCUSDT", ExecutedQuantity: "0.01", Status: broker.OrderStatusFilled,
+	}, nil).Once()
+	result, err := killSwitch.Release(context.Background(), "", "binance")
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Replayed)
+	(*created)[0].AssertExpectations(t)
+
+	var alert models.Alert
+	require.NoError(t, db.First(&alert, execution.Alert.ID).Error)
+	assert.Equal(t, "processed", alert.Status)
+	assert.Equal(t, body, alert.RawPayload)
+	assert.Equal(t, execution.Alert.SignalPayload, alert.SignalPayload)
+}
+
+func TestKillSwitchCancelsOrdersAndFlattens(t *testing.T) {
+	db := newTestDB(t)
+	require.NoError(t, db.Create(&models.User{APISec: "a", Name: "alice", IsActive: true}).Error)
+	require.NoError(t, db.Create(&models.User{APISec: "b", Name: "bob", IsActive: true}).Error)
+	controller := &fakeKillSwitchController{errs: map[uint]error{2: errors.New("position mode mismatch")}}
+	killSwitch := &KillSwitchService{db: db, controller: controller, userService: &UserService{db: db}}
+
+	_, err := killSwitch.Engage(context.Background(), &KillSwitchRequest{Pause: "halt"})
+	assert.ErrorContains(t, err, "invalid pause mode")
+	_, err = killSwitch.Engage(context.Background(), &KillSwitchRequest{})
+	assert.ErrorContains(t, err, "nothing to do")
+	_, err = killSwitch.Engage(context.Background(), &KillSwitchRequest{User: "carol", Flatten: true})
+	assert.ErrorContains(t, err, "unknown user")
+
+	// Orders of every user are cancelled before their positions are closed
+	result, err := killSwitch.Engage(context.Background(), &KillSwitchRequest{Exchange: "binance", CancelOrders: true, Flatten: true})
+	require.NoError(t, err)
+	assert.Nil(t, result.Switch)
+	assert.Equal(t, []string{"cancel", "cancel", "flatten", "flatten"}, controller.calls)
+	assert.Empty(t, result.CancelErrors)
+	assert.Equal(t, map[string]string{"bob/binance": "position mode mismatch"}, result.FlattenErrors)
+
+	// Without a pause nothing is stored
+	switches, err := killSwitch.Active()
+	require.NoError(t, err)
+	assert.Empty(t, switches)
+}
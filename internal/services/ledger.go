@@ -0,0 +1,239 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/database"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"gorm.io/gorm"
+)
+
+// positionEpsilon is the size below which a position counts as closed
+const positionEpsilon = 1e-9
+
+// LedgerService keeps the trade ledger: it pairs the fills of every user into round-trip trades per
+// exchange and symbol and computes their realized PnL. Commissions are taken from the order fills,
+// funding fees from the income records stored by the IncomeService.
+type LedgerService struct {
+	db    *gorm.DB
+	mutex sync.Mutex
+}
+
+// NewLedgerService creates a new ledger service
+func NewLedgerService() *LedgerService {
+	return &LedgerService{
+		db: database.GetDB(),
+	}
+}
+
+// Record books a filled trading signal: the part of the order that reduces the open position closes
+// it, the rest opens or increases a position. Signals of legacy alerts and unfilled signals are ignored.
+func (s *LedgerService) Record(signal *models.TradingSignal) error {
+	if signal.UserID == 0 || signal.Status != "filled" {
+		return nil
+	}
+
+	target, err := strconv.ParseFloat(signal.MarketPositionSize, 64)
+	if err != nil {
+		return fmt.Errorf("invalid market_position_size: %w", err)
+	}
+	price := parseAmount(signal.AvgPrice)
+	if price <= 0 {
+		price = parseAmount(signal.Price)
+	}
+	if price <= 0 {
+		return fmt.Errorf("trading signal %d has no fill price", signal.ID)
+	}
+	executedAt := time.Now()
+	if signal.ExecutedAt != nil {
+		executedAt = *signal.ExecutedAt
+	}
+	exchange := strings.ToLower(signal.Exchange)
+	symbol := broker.FormatSymbol(signal.Symbol, exchange)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	trade, err := s.openTrade(signal.UserID, exchange, symbol)
+	if err != nil {
+		return err
+	}
+
+	position := 0.0
+	if trade != nil {
+		position = parseAmount(trade.Size)
+		if trade.Side == "short" {
+			position = -position
+		}
+	}
+	delta := target - position
+	if abs(delta) < positionEpsilon {
+		return nil
+	}
+	fee := parseAmount(signal.Fee)
+
+	closing := 0.0
+	if position*delta < 0 {
+		closing = min(abs(delta), abs(position))
+	}
+	opening := abs(delta) - closing
+
+	if closing > 0 {
+		size := parseAmount(trade.Size)
+		entryPrice := parseAmount(trade.EntryPrice)
+		exited := parseAmount(trade.Quantity) - size
+
+		pnl := (price - entryPrice) * closing
+		if trade.Side == "short" {
+			pnl = -pnl
+		}
+		// The exchange reports the PnL of the fills; the opening part of a reversal realizes nothing
+		if reported, err := strconv.ParseFloat(signal.RealizedPnL, 64); err == nil {
+			pnl = reported
+		}
+
+		size -= closing
+		trade.Size = formatNumber(size)
+		trade.ExitPrice = formatNumber((parseAmount(trade.ExitPrice)*exited + price*closing) / (exited + closing))
+		trade.RealizedPnL = formatNumber(parseAmount(trade.RealizedPnL) + pnl)
+		trade.Fees = formatNumber(parseAmount(trade.Fees) + fee*closing/abs(delta))
+		if size < positionEpsilon {
+			trade.Size = "0"
+			trade.Status = models.TradeStatusClosed
+			trade.ClosedAt = &executedAt
+			trade.ExitSignalID = signal.ID
+		}
+		if err := s.save(trade); err != nil {
+			return err
+		}
+	}
+
+	if opening > 0 {
+		if trade == nil || trade.Status == models.TradeStatusClosed {
+			trade = &models.Trade{
+				UserID:        signal.UserID,
+				Exchange:      exchange,
+				Symbol:        symbol,
+				StrategyID:    signal.StrategyID,
+				Strategy:      s.signalStrategy(signal),
+				Side:          "long",
+				EntrySignalID: signal.ID,
+				Status:        models.TradeStatusOpen,
+				OpenedAt:      executedAt,
+			}
+			if delta < 0 {
+				trade.Side = "short"
+			}
+		}
+
+		size := parseAmount(trade.Size)
+		trade.EntryPrice = formatNumber((parseAmount(trade.EntryPrice)*size + price*opening) / (size + opening))
+		trade.Size = formatNumber(size + opening)
+		trade.Quantity = formatNumber(parseAmount(trade.Quantity) + opening)
+		trade.Fees = formatNumber(parseAmount(trade.Fees) + fee*opening/abs(delta))
+		if err := s.save(trade); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RefreshFunding recalculates the funding of the trades that were open at or after a point in time
+func (s *LedgerService) RefreshFunding(userID uint, exchange string, since time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var trades []models.Trade
+	err := s.db.Where("user_id = ? AND exchange = ? AND (closed_at IS NULL OR closed_at >= ?)", userID, exchange, since).
+		Find(&trades).Error
+	if err != nil {
+		return fmt.Errorf("failed to get trades: %w", err)
+	}
+	for i := range trades {
+		if err := s.save(&trades[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Trades returns the trades of a user that were open within a period, oldest first
+func (s *LedgerService) Trades(userID uint, from, to time.Time) ([]models.Trade, error) {
+	query := s.db.Where("user_id = ?", userID)
+	if !from.IsZero() {
+		query = query.Where("closed_at IS NULL OR closed_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("opened_at <= ?", to)
+	}
+
+	var trades []models.Trade
+	if err := query.Order("opened_at, id").Find(&trades).Error; err != nil {
+		return nil, fmt.Errorf("failed to get trades: %w", err)
+	}
+	return trades, nil
+}
+
+// openTrade returns the open trade of a user on a symbol, nil when the position is flat
+func (s *LedgerService) openTrade(userID uint, exchange, symbol string) (*models.Trade, error) {
+	var trade models.Trade
+	err := s.db.Where("user_id = ? AND exchange = ? AND symbol = ? AND status = ?", userID, exchange, symbol, models.TradeStatusOpen).
+		Order("id DESC").First(&trade).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open trade: %w", err)
+	}
+	return &trade, nil
+}
+
+// save stores a trade with the funding charged while it was open and its net PnL
+func (s *LedgerService) save(trade *models.Trade) error {
+	query := s.db.Model(&models.Income{}).
+		Where("user_id = ? AND exchange = ? AND symbol = ? AND type = ? AND time >= ?",
+			trade.UserID, trade.Exchange, trade.Symbol, broker.IncomeTypeFundingFee, trade.OpenedAt)
+	if trade.ClosedAt != nil {
+		query = query.Where("time <= ?", *trade.ClosedAt)
+	}
+	var amounts []string
+	if err := query.Pluck("amount", &amounts).Error; err != nil {
+		return fmt.Errorf("failed to sum funding: %w", err)
+	}
+
+	funding := 0.0
+	for _, amount := range amounts {
+		funding += parseAmount(amount)
+	}
+	trade.Funding = formatNumber(funding)
+	trade.NetPnL = formatNumber(parseAmount(trade.RealizedPnL) - parseAmount(trade.Fees) + funding)
+
+	if err := s.db.Save(trade).Error; err != nil {
+		return fmt.Errorf("failed to save trade: %w", err)
+	}
+	return nil
+}
+
+// signalStrategy returns the strategy key of the alert a signal was received with
+func (s *LedgerService) signalStrategy(signal *models.TradingSignal) string {
+	if signal.Alert.ID != 0 {
+		return signal.Alert.Strategy
+	}
+	var alert models.Alert
+	if signal.AlertID == 0 || s.db.First(&alert, signal.AlertID).Error != nil {
+		return ""
+	}
+	return alert.Strategy
+}
+
+// parseAmount parses a decimal string, treating empty and invalid values as zero
+func parseAmount(value string) float64 {
+	amount, _ := strconv.ParseFloat(value, 64)
+	return amount
+}
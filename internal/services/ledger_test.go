@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// bookFill stores a filled signal moving the position of user 1 on BTCUSDT to a target and books it
+func bookFill(t *testing.T, db *gorm.DB, ledger *LedgerService, target, price, fee string, at time.Time) *models.TradingSignal {
+	t.Helper()
+
+	signal := &models.TradingSignal{
+		UserID:             1,
+		Symbol:             "btcusdt",
+		Exchange:           "Binance",
+		MarketPositionSize: target,
+		AvgPrice:           price,
+		Fee:                fee,
+		Status:             "filled",
+		ExecutedAt:         &at,
+		CreatedAt:          at,
+	}
+	require.NoError(t, db.Create(signal).Error)
+	require.NoError(t, ledger.Record(signal))
+	return signal
+}
+
+func TestLedgerPairsEntriesAndExits(t *testing.T) {
+	db := newTestDB(t)
+	ledger := &LedgerService{db: db}
+	start := time.Now().Add(-time.Hour)
+
+	// Entries average the price; partial exits realize PnL against it
+	entry := bookFill(t, db, ledger, "1", "100", "0.1", start)
+	bookFill(t, db, ledger, "2", "110", "0.1", start.Add(time.Minute))
+	bookFill(t, db, ledger, "0.5", "120", "0.15", start.Add(2*time.Minute))
+
+	var trades []models.Trade
+	require.NoError(t, db.Find(&trades).Error)
+	require.Len(t, trades, 1)
+	assert.Equal(t, models.TradeStatusOpen, trades[0].Status)
+	assert.Equal(t, "BTCUSDT", trades[0].Symbol)
+	assert.Equal(t, "binance", trades[0].Exchange)
+	assert.Equal(t, "long", trades[0].Side)
+	assert.Equal(t, "105", trades[0].EntryPrice)
+	assert.Equal(t, "0.5", trades[0].Size)
+	assert.Equal(t, "22.5", trades[0].RealizedPnL)
+	assert.Equal(t, entry.ID, trades[0].EntrySignalID)
+
+	// A reversal closes the long and opens a short with the rest of the order
+	reversal := bookFill(t, db, ledger, "-1", "100", "0.3", start.Add(3*time.Minute))
+	exit := bookFill(t, db, ledger, "0", "90", "0.1", start.Add(4*time.Minute))
+
+	trades = nil
+	require.NoError(t, db.Order("id").Find(&trades).Error)
+	require.Len(t, trades, 2)
+
+	long := trades[0]
+	assert.Equal(t, models.TradeStatusClosed, long.Status)
+	assert.Equal(t, "2", long.Quantity)
+	assert.Equal(t, "115", long.ExitPrice)
+	assert.Equal(t, "20", long.RealizedPnL)
+	assert.Equal(t, "0.45", long.Fees)
+	assert.Equal(t, "19.55", long.NetPnL)
+	assert.Equal(t, reversal.ID, long.ExitSignalID)
+	require.NotNil(t, long.ClosedAt)
+
+	short := trades[1]
+	assert.Equal(t, models.TradeStatusClosed, short.Status)
+	assert.Equal(t, "short", short.Side)
+	assert.Equal(t, "100", short.EntryPrice)
+	assert.Equal(t, "10", short.RealizedPnL)
+	assert.Equal(t, "0.3", short.Fees)
+	assert.Equal(t, reversal.ID, short.EntrySignalID)
+	assert.Equal(t, exit.ID, short.ExitSignalID)
+
+	// The PnL reported by the exchange takes precedence over the PnL calculated from the prices
+	bookFill(t, db, ledger, "1", "100", "", start.Add(5*time.Minute))
+	closedAt := start.Add(6 * time.Minute)
+	reported := &models.TradingSignal{UserID: 1, Symbol: "BTCUSDT", Exchange: "binance", MarketPositionSize: "0",
+		AvgPrice: "101", RealizedPnL: "-1.25", Status: "filled", ExecutedAt: &closedAt}
+	require.NoError(t, db.Create(reported).Error)
+	require.NoError(t, ledger.Record(reported))
+
+	var last models.Trade
+	require.NoError(t, db.Order("id DESC").First(&last).Error)
+	assert.Equal(t, "-1.25", last.RealizedPnL)
+
+	// Signals of legacy alerts and unfilled signals are not booked
+	require.NoError(t, ledger.Record(&models.TradingSignal{Symbol: "BTCUSDT", MarketPositionSize: "1", Status: "filled"}))
+	require.NoError(t, ledger.Record(&models.TradingSignal{UserID: 1, Symbol: "BTCUSDT", MarketPositionSize: "1", Status: "pending"}))
+	var count int64
+	db.Model(&models.Trade{}).Count(&count)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestLedgerSyncsFunding(t *testing.T) {
+	db := newTestDB(t)
+	newTestCredential(t, db, 1, "secret")
+
+	client := new(MockIncomeBroker)
+	client.On("Initialize", mock.Anything, mock.Anything).Return(nil)
+	pool, _ := newTestPool(t, db)
+	pool.create = func(exchange string) (broker.Broker, error) { return client, nil }
+
+	// Without a config the periodic pull is disabled and the income is synchronized on request
+	ledger := &LedgerService{db: db}
+	service := &IncomeService{db: db, brokerPool: pool, ledger: ledger}
+	assert.False(t, service.Scheduled())
+
+	start := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	bookFill(t, db, ledger, "1", "100", "0.1", start)
+	bookFill(t, db, ledger, "0", "110", "0.1", start.Add(12*time.Hour))
+	bookFill(t, db, ledger, "-1", "110", "0.1", start.Add(13*time.Hour))
+
+	incomes := []broker.Income{
+		{ID: "1", Symbol: "BTCUSDT", Type: broker.IncomeTypeFundingFee, Amount: "-0.5", Asset: "USDT", Time: start.Add(8 * time.Hour)},
+		{ID: "2", Symbol: "ETHUSDT", Type: broker.IncomeTypeFundingFee, Amount: "-0.7", Asset: "USDT", Time: start.Add(8 * time.Hour)},
+		{ID: "3", Symbol: "BTCUSDT", Type: broker.IncomeTypeFundingFee, Amount: "0.2", Asset: "USDT", Time: start.Add(16 * time.Hour)},
+	}
+	client.On("GetIncome", mock.Anything, broker.IncomeTypeFundingFee, mock.MatchedBy(start.Add(16*time.Hour).After)).Return(incomes, nil).Once()
+	otherTypes := mock.MatchedBy(func(incomeType broker.IncomeType) bool { return incomeType != broker.IncomeTypeFundingFee })
+	client.On("GetIncome", mock.Anything, otherTypes, mock.Anything).Return([]broker.Income{}, nil)
+	require.NoError(t, service.SyncUser(context.Background(), 1))
+
+	// Funding is charged to the trades open at the time
+	var trades []models.Trade
+	require.NoError(t, db.Order("id").Find(&trades).Error)
+	require.Len(t, trades, 2)
+	assert.Equal(t, "-0.5", trades[0].Funding)
+	assert.Equal(t, "9.3", trades[0].NetPnL)
+	assert.Equal(t, "0.2", trades[1].Funding)
+
+	// The next sync continues from the last record and skips the ones already stored
+	client.On("GetIncome", mock.Anything, broker.IncomeTypeFundingFee, mock.MatchedBy(start.Add(16*time.Hour).Equal)).Return(incomes[2:], nil).Once()
+	require.NoError(t, service.SyncUser(context.Background(), 1))
+	client.AssertExpectations(t)
+
+	var count int64
+	db.Model(&models.Income{}).Count(&count)
+	assert.Equal(t, int64(3), count)
+	require.NoError(t, db.First(&trades[1], trades[1].ID).Error)
+	assert.Equal(t, "0.2", trades[1].Funding)
+}
+
+func TestPerformanceStats(t *testing.T) {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(4 * 24 * time.Hour)
+	trade := func(strategy, pnl string, opened, held time.Duration) models.Trade {
+		closedAt := from.Add(opened + held)
+		return models.Trade{Strategy: strategy, NetPnL: pnl, Fees: "1", OpenedAt: from.Add(opened), ClosedAt: &closedAt, Status: models.TradeStatusClosed}
+	}
+
+	trades := []models.Trade{
+		trade("grid", "30", 0, 12*time.Hour),
+		trade("grid", "-10", 6*time.Hour, 12*time.Hour), // Overlaps the first trade
+		trade("trend", "-20", 24*time.Hour, 24*time.Hour),
+		trade("trend", "40", 72*time.Hour, 12*time.Hour),
+		// Open trades only add to the exposure
+		{Strategy: "trend", NetPnL: "0", OpenedAt: from.Add(90 * time.Hour), Status: models.TradeStatusOpen},
+	}
+	report := newPerformanceReport(trades, from, to)
+
+	total := report.Total
+	assert.Equal(t, 4, total.Trades)
+	assert.Equal(t, 2, total.Wins)
+	assert.Equal(t, 2, total.Losses)
+	assert.Equal(t, 50.0, total.WinRate)
+	assert.Equal(t, 70.0, total.GrossProfit)
+	assert.Equal(t, 30.0, total.GrossLoss)
+	require.NotNil(t, total.ProfitFactor)
+	assert.InDelta(t, 2.333, *total.ProfitFactor, 0.001)
+	assert.Equal(t, 40.0, total.NetPnL)
+	assert.Equal(t, 4.0, total.Fees)
+	assert.Equal(t, 30.0, total.MaxDrawdown)
+	assert.Equal(t, 15.0*3600, total.AvgHoldingSeconds)
+	// 18h + 24h + 12h + 6h open out of 96h
+	assert.InDelta(t, 62.5, total.ExposureTime, 0.001)
+	assert.Greater(t, total.SharpeRatio, 0.0)
+
+	require.Len(t, report.ByStrategy, 2)
+	grid := report.ByStrategy["grid"]
+	assert.Equal(t, 2, grid.Trades)
+	assert.Equal(t, 20.0, grid.NetPnL)
+	assert.Equal(t, 10.0, grid.MaxDrawdown)
+	trend := report.ByStrategy["trend"]
+	assert.Equal(t, 20.0, trend.NetPnL)
+	assert.Equal(t, 20.0, trend.MaxDrawdown)
+
+	// Without losses there is no profit factor
+	winning := newPerformanceReport(trades[:1], from, to)
+	assert.Nil(t, winning.Total.ProfitFactor)
+	assert.Zero(t, winning.Total.MaxDrawdown)
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Latency stages recorded while executing trading signals
+const (
+	LatencyWebhookToOrder = "webhook_to_order" // From webhook arrival until the exchange acknowledged the order
+	LatencyBrokerConnect  = "broker_connect"   // Getting a ready broker client, including lazy initialization
+	LatencyPlaceOrder     = "place_order"      // Exchange round trip of the order request, including retries
+)
+
+// latencyWindow is the number of recent samples percentiles are computed from
+const latencyWindow = 1000
+
+// LatencyStats summarizes the latencies of a stage in milliseconds
+type LatencyStats struct {
+	Count int64   `json:"count"` // All samples since start
+	Last  float64 `json:"last_ms"`
+	Avg   float64 `json:"avg_ms"` // Average, percentiles and maximum cover the recent window
+	P50   float64 `json:"p50_ms"`
+	P95   float64 `json:"p95_ms"`
+	P99   float64 `json:"p99_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+// LatencyMetrics records latencies per stage over a window of recent samples
+type LatencyMetrics struct {
+	mu     sync.Mutex
+	stages map[string]*latencySeries
+}
+
+// latencySeries is a ring buffer of recent samples
+type latencySeries struct {
+	count   int64
+	last    time.Duration
+	samples []time.Duration
+	next    int
+}
+
+// NewLatencyMetrics creates empty latency metrics
+func NewLatencyMetrics() *LatencyMetrics {
+	return &LatencyMetrics{stages: make(map[string]*latencySeries)}
+}
+
+// Observe records a latency sample of a stage
+func (m *LatencyMetrics) Observe(stage string, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, exists := m.stages[stage]
+	if !exists {
+		series = &latencySeries{}
+		m.stages[stage] = series
+	}
+
+	series.count++
+	series.last = latency
+	if len(series.samples) < latencyWindow {
+		series.samples = append(series.samples, latency)
+		return
+	}
+	series.samples[series.next] = latency
+	series.next = (series.next + 1) % latencyWindow
+}
+
+// Snapshot returns the statistics of every recorded stage
+func (m *LatencyMetrics) Snapshot() map[string]LatencyStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make(map[string]LatencyStats, len(m.stages))
+	for stage, series := range m.stages {
+		samples := append([]time.Duration(nil), series.samples...)
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+		var total time.Duration
+		for _, sample := range samples {
+			total += sample
+		}
+
+		result[stage] = LatencyStats{
+			Count: series.count,
+			Last:  milliseconds(series.last),
+			Avg:   milliseconds(total / time.Duration(len(samples))),
+			P50:   milliseconds(percentile(samples, 0.50)),
+			P95:   milliseconds(percentile(samples, 0.95)),
+			P99:   milliseconds(percentile(samples, 0.99)),
+			Max:   milliseconds(samples[len(samples)-1]),
+		}
+	}
+	return result
+}
+
+// percentile returns the nearest-rank percentile of sorted samples
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(float64(len(sorted))*p)) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// milliseconds converts a duration to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,442 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/models"
+)
+
+// Notification carries everything a downstream message can be rendered from
+type Notification struct {
+	Alert      *models.Alert
+	Signal     *models.TradingViewSignal // Nil for legacy and plain-text alerts
+	Execution  *models.TradingSignal     // Nil when no trade was executed
+	UserName   string
+	RequestURL string
+}
+
+// IsPlainText reports whether the alert was received as a plain-text message
+func (n *Notification) IsPlainText() bool {
+	return n.Signal == nil && n.Alert != nil && n.Alert.Strategy == "alert"
+}
+
+// Strategy returns the strategy key of a signal or the strategy name of a legacy alert
+func (n *Notification) Strategy() string {
+	if n.Signal != nil {
+		return n.Signal.StrategyKey()
+	}
+	if n.Alert == nil {
+		return ""
+	}
+	return n.Alert.Strategy
+}
+
+// Symbol returns the traded symbol
+func (n *Notification) Symbol() string {
+	if n.Signal != nil {
+		return n.Signal.Symbol
+	}
+	if n.Alert != nil {
+		return n.Alert.Symbol
+	}
+	return ""
+}
+
+// Action returns the signal action (buy, sell, close)
+func (n *Notification) Action() string {
+	if n.Signal != nil {
+		return n.Signal.Action
+	}
+	if n.Alert != nil {
+		return n.Alert.Action
+	}
+	return ""
+}
+
+// Exchange returns the exchange the signal targets
+func (n *Notification) Exchange() string {
+	if n.Signal != nil {
+		return n.Signal.ExchangeName
+	}
+	return ""
+}
+
+// Price returns the signal price
+func (n *Notification) Price() string {
+	if n.Signal != nil {
+		return n.Signal.Price
+	}
+	if n.Alert != nil && n.Alert.Price > 0 {
+		return formatNumber(n.Alert.Price)
+	}
+	return ""
+}
+
+// Quantity returns the order quantity
+func (n *Notification) Quantity() string {
+	if n.Signal != nil {
+		return n.Signal.PositionSize
+	}
+	if n.Alert != nil && n.Alert.Quantity > 0 {
+		return formatNumber(n.Alert.Quantity)
+	}
+	return ""
+}
+
+// Message returns the alert message
+func (n *Notification) Message() string {
+	if n.Alert == nil {
+		return ""
+	}
+	return n.Alert.Message
+}
+
+// Time returns the time the alert was received
+func (n *Notification) Time() string {
+	if n.Alert == nil || n.Alert.CreatedAt.IsZero() {
+		return ""
+	}
+	return n.Alert.CreatedAt.Format("2006-01-02 15:04:05")
+}
+
+// telegramTemplate is the built-in template for channels using HTML formatting
+const telegramTemplate = `{{if .IsPlainText}}{{esc .Message}}{{else -}}
+🚨 <b>Trading Alert</b>
+{{with .Strategy}}
+📊 <b>Strategy:</b> {{esc .}}{{end}}
+💱 <b>Symbol:</b> {{esc .Symbol}}
+⚡ <b>Action:</b> {{esc (upper .Action)}}
+{{- with .Exchange}}
+🏦 <b>Exchange:</b> {{esc .}}{{end}}
+{{- with .Price}}
+💰 <b>Price:</b> {{esc .}}{{end}}
+{{- with .Quantity}}
+📈 <b>Quantity:</b> {{esc .}}{{end}}
+{{- with .Signal}}
+📍 <b>Position:</b> {{esc .PrevMarketPosition}} {{esc .PrevMarketPositionSize}} → {{esc .MarketPosition}} {{esc .MarketPositionSize}}{{end}}
+{{- with .UserName}}
+👤 <b>User:</b> {{esc .}}{{end}}
+{{- with .Execution}}
+🧾 <b>Status:</b> {{esc .Status}}{{with .OrderID}} (order {{esc .}}){{end}}
+{{- with .FilledQuantity}}
+✅ <b>Filled:</b> {{esc .}}{{with $.Execution.AvgPrice}} @ {{esc .}}{{end}}{{end}}
+{{- with .Fee}}
+💸 <b>Fee:</b> {{esc .}} {{esc $.Execution.FeeAsset}}{{end}}
+{{- with .RealizedPnL}}
+💵 <b>Realized PnL:</b> {{esc .}}{{end}}
+{{- with .ErrorMessage}}
+❗ <b>Error:</b> {{with $.Execution.ErrorCode}}[{{esc .}}] {{end}}{{esc .}}{{end}}{{end}}
+{{- if not .Signal}}{{with .Message}}
+💬 <b>Message:</b> {{esc .}}{{end}}{{end}}
+{{- with .Time}}
+⏰ <b>Time:</b> {{esc .}}{{end}}{{end}}`
+
+// markdownTemplate is the built-in template for channels using markdown formatting
+const markdownTemplate = `{{if .IsPlainText}}{{esc .Message}}{{else -}}
+### 🚨 Trading Alert
+{{with .Strategy}}
+**Strategy:** {{esc .}}
+{{end}}
+**Symbol:** {{esc .Symbol}}
+
+**Action:** {{esc (upper .Action)}}
+{{- with .Exchange}}
+
+**Exchange:** {{esc .}}{{end}}
+{{- with .Price}}
+
+**Price:** {{esc .}}{{end}}
+{{- with .Quantity}}
+
+**Quantity:** {{esc .}}{{end}}
+{{- with .Signal}}
+
+**Position:** {{esc .PrevMarketPosition}} {{esc .PrevMarketPositionSize}} → {{esc .MarketPosition}} {{esc .MarketPositionSize}}{{end}}
+{{- with .UserName}}
+
+**User:** {{esc .}}{{end}}
+{{- with .Execution}}
+
+**Status:** {{esc .Status}}{{with .OrderID}} (order {{esc .}}){{end}}
+{{- with .FilledQuantity}}
+
+**Filled:** {{esc .}}{{with $.Execution.AvgPrice}} @ {{esc .}}{{end}}{{end}}
+{{- with .Fee}}
+
+**Fee:** {{esc .}} {{esc $.Execution.FeeAsset}}{{end}}
+{{- with .RealizedPnL}}
+
+**Realized PnL:** {{esc .}}{{end}}
+{{- with .ErrorMessage}}
+
+**Error:** {{with $.Execution.ErrorCode}}\[{{esc .}}\] {{end}}{{esc .}}{{end}}{{end}}
+{{- if not .Signal}}{{with .Message}}
+
+**Message:** {{esc .}}{{end}}{{end}}
+{{- with .Time}}
+
+**Time:** {{esc .}}{{end}}{{end}}`
+
+// plainTemplate is the built-in template for plain-text channels
+const plainTemplate = `{{if .IsPlainText}}{{.Message}}{{else -}}
+🚨 Trading Alert
+{{with .Strategy}}
+📊 Strategy: {{.}}{{end}}
+💱 Symbol: {{.Symbol}}
+⚡ Action: {{upper .Action}}
+{{- with .Exchange}}
+🏦 Exchange: {{.}}{{end}}
+{{- with .Price}}
+💰 Price: {{.}}{{end}}
+{{- with .Quantity}}
+📈 Quantity: {{.}}{{end}}
+{{- with .Signal}}
+📍 Position: {{.PrevMarketPosition}} {{.PrevMarketPositionSize}} → {{.MarketPosition}} {{.MarketPositionSize}}{{end}}
+{{- with .UserName}}
+👤 User: {{.}}{{end}}
+{{- with .Execution}}
+🧾 Status: {{.Status}}{{with .OrderID}} (order {{.}}){{end}}
+{{- with .FilledQuantity}}
+✅ Filled: {{.}}{{with $.Execution.AvgPrice}} @ {{.}}{{end}}{{end}}
+{{- with .Fee}}
+💸 Fee: {{.}} {{$.Execution.FeeAsset}}{{end}}
+{{- with .RealizedPnL}}
+💵 Realized PnL: {{.}}{{end}}
+{{- with .ErrorMessage}}
+❗ Error: {{with $.Execution.ErrorCode}}[{{.}}] {{end}}{{.}}{{end}}{{end}}
+{{- if not .Signal}}{{with .Message}}
+💬 Message: {{.}}{{end}}{{end}}
+{{- with .Time}}
+⏰ Time: {{.}}{{end}}{{end}}`
+
+// slackTemplate is the built-in template for Slack mrkdwn formatting
+const slackTemplate = `{{if .IsPlainText}}{{esc .Message}}{{else -}}
+:rotating_light: *Trading Alert*
+{{with .Strategy}}
+*Strategy:* {{esc .}}{{end}}
+*Symbol:* {{esc .Symbol}}
+*Action:* {{esc (upper .Action)}}
+{{- with .Exchange}}
+*Exchange:* {{esc .}}{{end}}
+{{- with .Price}}
+*Price:* {{esc .}}{{end}}
+{{- with .Quantity}}
+*Quantity:* {{esc .}}{{end}}
+{{- with .Signal}}
+*Position:* {{esc .PrevMarketPosition}} {{esc .PrevMarketPositionSize}} → {{esc .MarketPosition}} {{esc .MarketPositionSize}}{{end}}
+{{- with .UserName}}
+*User:* {{esc .}}{{end}}
+{{- with .Execution}}
+*Status:* {{esc .Status}}{{with .OrderID}} (order {{esc .}}){{end}}
+{{- with .FilledQuantity}}
+*Filled:* {{esc .}}{{with $.Execution.AvgPrice}} @ {{esc .}}{{end}}{{end}}
+{{- with .Fee}}
+*Fee:* {{esc .}} {{esc $.Execution.FeeAsset}}{{end}}
+{{- with .RealizedPnL}}
+*Realized PnL:* {{esc .}}{{end}}
+{{- with .ErrorMessage}}
+*Error:* {{with $.Execution.ErrorCode}}[{{esc .}}] {{end}}{{esc .}}{{end}}{{end}}
+{{- if not .Signal}}{{with .Message}}
+*Message:* {{esc .}}{{end}}{{end}}
+{{- with .Time}}
+*Time:* {{esc .}}{{end}}{{end}}`
+
+// emailTemplate is the built-in template for HTML emails
+const emailTemplate = `{{if .IsPlainText}}<pre>{{esc .Message}}</pre>{{else -}}
+<h2>🚨 Trading Alert</h2>
+<table>
+{{- with .Strategy}}
+<tr><th align="left">Strategy</th><td>{{esc .}}</td></tr>{{end}}
+<tr><th align="left">Symbol</th><td>{{esc .Symbol}}</td></tr>
+<tr><th align="left">Action</th><td>{{esc (upper .Action)}}</td></tr>
+{{- with .Exchange}}
+<tr><th align="left">Exchange</th><td>{{esc .}}</td></tr>{{end}}
+{{- with .Price}}
+<tr><th align="left">Price</th><td>{{esc .}}</td></tr>{{end}}
+{{- with .Quantity}}
+<tr><th align="left">Quantity</th><td>{{esc .}}</td></tr>{{end}}
+{{- with .Signal}}
+<tr><th align="left">Position</th><td>{{esc .PrevMarketPosition}} {{esc .PrevMarketPositionSize}} → {{esc .MarketPosition}} {{esc .MarketPositionSize}}</td></tr>{{end}}
+{{- with .UserName}}
+<tr><th align="left">User</th><td>{{esc .}}</td></tr>{{end}}
+{{- with .Execution}}
+<tr><th align="left">Status</th><td>{{esc .Status}}{{with .OrderID}} (order {{esc .}}){{end}}</td></tr>
+{{- with .FilledQuantity}}
+<tr><th align="left">Filled</th><td>{{esc .}}{{with $.Execution.AvgPrice}} @ {{esc .}}{{end}}</td></tr>{{end}}
+{{- with .Fee}}
+<tr><th align="left">Fee</th><td>{{esc .}} {{esc $.Execution.FeeAsset}}</td></tr>{{end}}
+{{- with .RealizedPnL}}
+<tr><th align="left">Realized PnL</th><td>{{esc .}}</td></tr>{{end}}
+{{- with .ErrorMessage}}
+<tr><th align="left">Error</th><td>{{with $.Execution.ErrorCode}}[{{esc .}}] {{end}}{{esc .}}</td></tr>{{end}}{{end}}
+{{- if not .Signal}}{{with .Message}}
+<tr><th align="left">Message</th><td>{{esc .}}</td></tr>{{end}}{{end}}
+{{- with .Time}}
+<tr><th align="left">Time</th><td>{{esc .}}</td></tr>{{end}}
+</table>{{end}}`
+
+// markdownEscaper escapes characters with a meaning in markdown
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`,
+	`(`, `\(`, `)`, `\)`, `#`, `\#`, `>`, `\>`, `|`, `\|`, `!`, `\!`,
+)
+
+// escapeMarkdown escapes a value for use in a markdown message
+func escapeMarkdown(value string) string {
+	return markdownEscaper.Replace(value)
+}
+
+// formatNumber formats a number without trailing zeros or floating point noise
+// such as 0.30000000000000004
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(math.Round(value*1e12)/1e12, 'f', -1, 64)
+}
+
+// multiplySize scales a size, such as by the size multiplier of a strategy or a relay. Sizes that
+// are empty or not numeric are returned unchanged.
+func multiplySize(size string, multiplier float64) string {
+	value, err := strconv.ParseFloat(size, 64)
+	if err != nil {
+		return size
+	}
+	return formatNumber(value * multiplier)
+}
+
+// escapeNone leaves values of plain-text channels untouched
+func escapeNone(value string) string {
+	return value
+}
+
+// escapeSlack escapes the control characters of Slack mrkdwn
+func escapeSlack(value string) string {
+	return slackEscaper.Replace(value)
+}
+
+// slackEscaper escapes characters Slack interprets in mrkdwn text
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// templateFuncs returns the functions available to templates using the given escaper
+func templateFuncs(escape func(string) string) template.FuncMap {
+	return template.FuncMap{
+		"esc":   escape,
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"trim":  strings.TrimSpace,
+		"default": func(fallback, value string) string {
+			if value == "" {
+				return fallback
+			}
+			return value
+		},
+	}
+}
+
+// templateCache holds compiled templates per endpoint
+type templateCache struct {
+	mutex     sync.Mutex
+	templates map[string]*template.Template
+}
+
+// reset drops all compiled templates so they are rebuilt from the current configuration
+func (c *templateCache) reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.templates = nil
+}
+
+// get returns the compiled template of an endpoint, compiling it on first use
+func (c *templateCache) get(endpoint config.EndpointConfig) (*template.Template, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if tmpl, exists := c.templates[endpoint.Name]; exists {
+		return tmpl, nil
+	}
+
+	tmpl, err := compileTemplate(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.templates == nil {
+		c.templates = make(map[string]*template.Template)
+	}
+	c.templates[endpoint.Name] = tmpl
+	return tmpl, nil
+}
+
+// compileTemplate compiles the configured template of an endpoint, or the channel default
+func compileTemplate(endpoint config.EndpointConfig) (*template.Template, error) {
+	text := endpoint.Template
+	if text == "" && endpoint.TemplateFile != "" {
+		data, err := os.ReadFile(endpoint.TemplateFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template file: %w", err)
+		}
+		text = string(data)
+	}
+	if text == "" {
+		text = defaultTemplate(endpoint)
+	}
+
+	return template.New(endpoint.Name).Funcs(templateFuncs(templateEscaper(endpoint))).Option("missingkey=zero").Parse(text)
+}
+
+// defaultTemplate returns the built-in template of an endpoint's channel
+func defaultTemplate(endpoint config.EndpointConfig) string {
+	if notifier, exists := NotifierRegistry[endpoint.Type]; exists {
+		return notifier.DefaultTemplate(endpoint)
+	}
+	return plainTemplate
+}
+
+// templateEscaper returns the escaping function of an endpoint's channel
+func templateEscaper(endpoint config.EndpointConfig) func(string) string {
+	if notifier, exists := NotifierRegistry[endpoint.Type]; exists {
+		return func(value string) string { return notifier.Escape(endpoint, value) }
+	}
+	return escapeNone
+}
+
+// renderText renders a template string that is not tied to an endpoint
+func renderText(text string, escape func(string) string, notification *Notification) (string, error) {
+	tmpl, err := template.New("text").Funcs(templateFuncs(escape)).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, notification); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// renderMessage renders the notification with the endpoint's template, falling back
+// to the channel default if the configured template fails
+func (s *ForwardService) renderMessage(notification *Notification, endpoint config.EndpointConfig) string {
+	tmpl, err := s.templates.get(endpoint)
+	if err == nil {
+		var buf bytes.Buffer
+		if err = tmpl.Execute(&buf, notification); err == nil {
+			return buf.String()
+		}
+	}
+	log.Printf("Failed to render template for %s, using default: %v", endpoint.Name, err)
+
+	message, err := renderText(defaultTemplate(endpoint), templateEscaper(endpoint), notification)
+	if err != nil {
+		log.Printf("Failed to render default template for %s: %v", endpoint.Name, err)
+		return notification.Message()
+	}
+	return message
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestNotification returns an executed trading signal notification
+func newTestNotification() *Notification {
+	return &Notification{
+		Alert: &models.Alert{
+			Strategy:  "trading_signal",
+			Symbol:    "BTCUSDT",
+			Action:    "buy",
+			CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		Signal: &models.TradingViewSignal{
+			Symbol:                 "BTCUSDT",
+			Action:                 "buy",
+			ExchangeName:           "binance",
+			Price:                  "42000.5",
+			PositionSize:           "0.01",
+			PrevMarketPosition:     "flat",
+			PrevMarketPositionSize: "0",
+			MarketPosition:         "long",
+			MarketPositionSize:     "0.01",
+			APISec:                 "secret",
+		},
+		Execution: &models.TradingSignal{Status: "failed", ErrorMessage: "margin <insufficient>"},
+		UserName:  "alice_[main]",
+	}
+}
+
+func TestRenderDefaultTemplates(t *testing.T) {
+	service := &ForwardService{}
+	notification := newTestNotification()
+
+	telegram := service.renderMessage(notification, config.EndpointConfig{Name: "tg", Type: "telegram"})
+	assert.Contains(t, telegram, "💱 <b>Symbol:</b> BTCUSDT")
+	assert.Contains(t, telegram, "⚡ <b>Action:</b> BUY")
+	assert.Contains(t, telegram, "📍 <b>Position:</b> flat 0 → long 0.01")
+	assert.Contains(t, telegram, "❗ <b>Error:</b> margin &lt;insufficient&gt;")
+	assert.Contains(t, telegram, "⏰ <b>Time:</b> 2024-01-02 03:04:05")
+	assert.NotContains(t, telegram, "trading_signal")
+
+	dingtalk := service.renderMessage(notification, config.EndpointConfig{Name: "dd", Type: "dingtalk"})
+	assert.Contains(t, dingtalk, "**User:** alice\\_\\[main\\]")
+	assert.Contains(t, dingtalk, "**Price:** 42000.5")
+
+	wechat := service.renderMessage(notification, config.EndpointConfig{Name: "wx", Type: "wechat"})
+	assert.Contains(t, wechat, "👤 User: alice_[main]")
+	assert.Contains(t, wechat, "❗ Error: margin <insufficient>")
+}
+
+func TestRenderExecutionDetails(t *testing.T) {
+	service := &ForwardService{}
+
+	// Failures carry the broker error code
+	failed := newTestNotification()
+	failed.Execution.ErrorCode = "ORDER_FAILED"
+	telegram := service.renderMessage(failed, config.EndpointConfig{Name: "tg", Type: "telegram"})
+	assert.Contains(t, telegram, "❗ <b>Error:</b> [ORDER_FAILED] margin &lt;insufficient&gt;")
+	assert.NotContains(t, telegram, "Filled")
+
+	// Closing fills report price, fees and realized PnL
+	closed := newTestNotification()
+	closed.Execution = &models.TradingSignal{
+		Status:         "filled",
+		OrderID:        "42",
+		FilledQuantity: "0.01",
+		AvgPrice:       "42050",
+		Fee:            "0.168",
+		FeeAsset:       "USDT",
+		RealizedPnL:    "12.5",
+	}
+	wechat := service.renderMessage(closed, config.EndpointConfig{Name: "wx", Type: "wechat"})
+	assert.Contains(t, wechat, "🧾 Status: filled (order 42)")
+	assert.Contains(t, wechat, "✅ Filled: 0.01 @ 42050")
+	assert.Contains(t, wechat, "💸 Fee: 0.168 USDT")
+	assert.Contains(t, wechat, "💵 Realized PnL: 12.5")
+
+	email := service.renderMessage(closed, config.EndpointConfig{Name: "mail", Type: "email"})
+	assert.Contains(t, email, `<tr><th align="left">Realized PnL</th><td>12.5</td></tr>`)
+}
+
+func TestRenderPlainTextAlert(t *testing.T) {
+	service := &ForwardService{}
+	notification := &Notification{Alert: &models.Alert{Strategy: "alert", Message: "RSI < 30"}}
+
+	assert.Equal(t, "RSI &lt; 30", service.renderMessage(notification, config.EndpointConfig{Name: "tg", Type: "telegram"}))
+	assert.Equal(t, "RSI < 30", service.renderMessage(notification, config.EndpointConfig{Name: "wx", Type: "wechat"}))
+}
+
+func TestRenderCustomTemplate(t *testing.T) {
+	service := &ForwardService{}
+	notification := newTestNotification()
+
+	endpoint := config.EndpointConfig{
+		Name:     "tg",
+		Type:     "telegram",
+		Template: `{{upper .Action}} {{.Signal.Symbol}} for {{esc .UserName}}: {{.Execution.Status}}`,
+	}
+	assert.Equal(t, "BUY BTCUSDT for alice_[main]: failed", service.renderMessage(notification, endpoint))
+
+	// Templates failing at render time fall back to the channel default
+	broken := config.EndpointConfig{Name: "broken", Type: "telegram", Template: `{{.Execution.Missing}}`}
+	assert.Contains(t, service.renderMessage(notification, broken), "<b>Trading Alert</b>")
+}
+
+func TestLoadNotificationForRetry(t *testing.T) {
+	db := newTestDB(t)
+	service := &ForwardService{db: db}
+
+	user := &models.User{APISec: "secret", Name: "alice"}
+	require.NoError(t, db.Create(user).Error)
+	execution := &models.TradingSignal{UserID: user.ID, Symbol: "BTCUSDT", Status: "filled"}
+	require.NoError(t, db.Create(execution).Error)
+	alert := &models.Alert{Strategy: "trading_signal", RawPayload: `{"symbol":"BTCUSDT","action":"buy","api_sec":"secret"}`}
+	require.NoError(t, db.Create(alert).Error)
+
+	notification, err := service.loadNotification(&models.Delivery{AlertID: alert.ID, SignalID: execution.ID})
+	require.NoError(t, err)
+	require.NotNil(t, notification.Signal)
+	assert.Equal(t, "buy", notification.Signal.Action)
+	require.NotNil(t, notification.Execution)
+	assert.Equal(t, "filled", notification.Execution.Status)
+	assert.Equal(t, "alice", notification.UserName)
+}
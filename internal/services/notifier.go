@@ -0,0 +1,159 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/go-resty/resty/v2"
+)
+
+// Notifier delivers rendered messages to one type of downstream channel
+type Notifier interface {
+	// Escape escapes a template value for the message format used by the endpoint
+	Escape(endpoint config.EndpointConfig, value string) string
+
+	// DefaultTemplate returns the built-in message template for the endpoint
+	DefaultTemplate(endpoint config.EndpointConfig) string
+
+	// Send delivers a notification, rendered as message, to the endpoint
+	Send(client *resty.Client, endpoint config.EndpointConfig, message string, notification *Notification) error
+}
+
+// maxResponseBody limits how much of a downstream response is stored on a delivery
+const maxResponseBody = 4096
+
+// DeliveryResponse is the downstream answer to a delivery attempt
+type DeliveryResponse struct {
+	StatusCode int
+	Body       string
+}
+
+// ResponseNotifier is implemented by notifiers whose downstream response is stored on the delivery
+type ResponseNotifier interface {
+	Notifier
+
+	// SendWithResponse delivers a notification and returns the downstream response, also on failure
+	SendWithResponse(client *resty.Client, endpoint config.EndpointConfig, notification *Notification) (*DeliveryResponse, error)
+}
+
+// newDeliveryResponse captures the status and truncated body of a response
+func newDeliveryResponse(resp *resty.Response) *DeliveryResponse {
+	body := resp.String()
+	if len(body) > maxResponseBody {
+		body = body[:maxResponseBody]
+	}
+	return &DeliveryResponse{StatusCode: resp.StatusCode(), Body: body}
+}
+
+// NotifierRegistry holds all registered notifiers by endpoint type
+var NotifierRegistry = make(map[string]Notifier)
+
+// RegisterNotifier registers a notifier for an endpoint type
+func RegisterNotifier(endpointType string, notifier Notifier) {
+	NotifierRegistry[endpointType] = notifier
+}
+
+// postJSON posts a JSON payload and returns an error for non-2xx responses.
+// Rate limit responses carrying a Retry-After header are reported as retryAfterError.
+func postJSON(client *resty.Client, channel, url string, payload interface{}) (*resty.Response, error) {
+	resp, err := client.R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(payload).
+		Post(url)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s request failed: %w", channel, err)
+	}
+
+	if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
+		err := fmt.Errorf("%s returned status %d: %s", channel, resp.StatusCode(), resp.String())
+		if resp.StatusCode() == http.StatusTooManyRequests {
+			delay := retryAfterHeader(resp)
+			if delay <= 0 {
+				delay = retryAfterBody(resp)
+			}
+			if delay > 0 {
+				return resp, &retryAfterError{err: err, delay: delay}
+			}
+		}
+		return resp, err
+	}
+
+	return resp, nil
+}
+
+// retryAfterHeader parses the Retry-After header of a response given in seconds
+func retryAfterHeader(resp *resty.Response) time.Duration {
+	seconds, err := strconv.ParseFloat(resp.Header().Get("Retry-After"), 64)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// retryAfterBody parses the retry delay in seconds that Telegram and Discord
+// include in the JSON body of rate limit responses
+func retryAfterBody(resp *resty.Response) time.Duration {
+	var body struct {
+		RetryAfter float64 `json:"retry_after"`
+		Parameters struct {
+			RetryAfter float64 `json:"retry_after"`
+		} `json:"parameters"`
+	}
+	if err := json.Unmarshal(resp.Body(), &body); err != nil {
+		return 0
+	}
+
+	seconds := max(body.RetryAfter, body.Parameters.RetryAfter)
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// checkErrcode reports the error DingTalk and WeChat Work return with HTTP 200 in the body
+func checkErrcode(resp *resty.Response, channel string) error {
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.Unmarshal(resp.Body(), &result); err == nil && result.ErrCode != 0 {
+		return fmt.Errorf("%s returned errcode %d: %s", channel, result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+// shouldMention reports whether a notification triggers the endpoint's mentions
+func shouldMention(mentions config.MentionConfig, notification *Notification) bool {
+	if len(mentions.Mobiles) == 0 && len(mentions.UserIDs) == 0 && !mentions.All {
+		return false
+	}
+	if notification.Execution == nil {
+		return false
+	}
+
+	statuses := mentions.Statuses
+	if len(statuses) == 0 {
+		statuses = []string{"failed"}
+	}
+	return matchesAny(statuses, notification.Execution.Status)
+}
+
+// actionURL renders the link of card messages, defaulting to the TradingView symbol page
+func actionURL(endpoint config.EndpointConfig, notification *Notification) string {
+	if endpoint.ActionURL != "" {
+		link, err := renderText(endpoint.ActionURL, url.PathEscape, notification)
+		if err == nil {
+			return link
+		}
+		log.Printf("Failed to render action URL for %s: %v", endpoint.Name, err)
+	}
+
+	if symbol := notification.Symbol(); symbol != "" {
+		return fmt.Sprintf("https://www.tradingview.com/symbols/%s/", url.PathEscape(symbol))
+	}
+	return "https://www.tradingview.com/"
+}
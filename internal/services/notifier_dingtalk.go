@@ -0,0 +1,155 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/go-resty/resty/v2"
+)
+
+// DingTalk message types
+const (
+	dingTalkText       = "text"
+	dingTalkMarkdown   = "markdown"
+	dingTalkActionCard = "actionCard"
+)
+
+// DingTalkNotifier sends text, markdown and actionCard messages to DingTalk group bots
+type DingTalkNotifier struct{}
+
+// Escape escapes a value for DingTalk markdown; text messages are left untouched
+func (n *DingTalkNotifier) Escape(endpoint config.EndpointConfig, value string) string {
+	if dingTalkMessageType(endpoint) == dingTalkText {
+		return escapeNone(value)
+	}
+	return escapeMarkdown(value)
+}
+
+// DefaultTemplate returns the built-in DingTalk template for the endpoint's message type
+func (n *DingTalkNotifier) DefaultTemplate(endpoint config.EndpointConfig) string {
+	if dingTalkMessageType(endpoint) == dingTalkText {
+		return plainTemplate
+	}
+	return markdownTemplate
+}
+
+// Send sends a message to the configured bot, signing the request when a secret is configured
+func (n *DingTalkNotifier) Send(client *resty.Client, endpoint config.EndpointConfig, message string, notification *Notification) error {
+	mention := shouldMention(endpoint.Mentions, notification)
+
+	var payload map[string]interface{}
+	switch messageType := dingTalkMessageType(endpoint); messageType {
+	case dingTalkText:
+		payload = map[string]interface{}{
+			"msgtype": "text",
+			"text":    map[string]string{"content": message},
+		}
+	case dingTalkMarkdown:
+		// Mentioned mobiles must appear in the text to be highlighted
+		if mention {
+			message = appendDingTalkMentions(message, endpoint.Mentions)
+		}
+		payload = map[string]interface{}{
+			"msgtype": "markdown",
+			"markdown": map[string]string{
+				"title": dingTalkTitle(notification),
+				"text":  message,
+			},
+		}
+	case dingTalkActionCard:
+		payload = map[string]interface{}{
+			"msgtype": "actionCard",
+			"actionCard": map[string]string{
+				"title":       dingTalkTitle(notification),
+				"text":        message,
+				"singleTitle": "View details",
+				"singleURL":   actionURL(endpoint, notification),
+			},
+		}
+	default:
+		return fmt.Errorf("unsupported dingtalk msg_type: %s", messageType)
+	}
+
+	if mention {
+		payload["at"] = map[string]interface{}{
+			"atMobiles": endpoint.Mentions.Mobiles,
+			"atUserIds": endpoint.Mentions.UserIDs,
+			"isAtAll":   endpoint.Mentions.All,
+		}
+	}
+
+	webhookURL := endpoint.URL
+	if endpoint.Secret != "" {
+		var err error
+		if webhookURL, err = signDingTalkURL(endpoint.URL, endpoint.Secret, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	resp, err := postJSON(client, "dingtalk API", webhookURL, payload)
+	if err != nil {
+		return err
+	}
+	return checkErrcode(resp, "dingtalk API")
+}
+
+// dingTalkMessageType returns the configured message type, markdown by default
+func dingTalkMessageType(endpoint config.EndpointConfig) string {
+	if endpoint.MessageType == "" {
+		return dingTalkMarkdown
+	}
+	return endpoint.MessageType
+}
+
+// dingTalkTitle returns the title shown in DingTalk's conversation list
+func dingTalkTitle(notification *Notification) string {
+	if notification.IsPlainText() || notification.Symbol() == "" {
+		return "Trading Alert"
+	}
+	return fmt.Sprintf("%s %s", strings.ToUpper(notification.Action()), notification.Symbol())
+}
+
+// appendDingTalkMentions appends the @mentions DingTalk expects in markdown text
+func appendDingTalkMentions(message string, mentions config.MentionConfig) string {
+	var at []string
+	for _, mobile := range mentions.Mobiles {
+		at = append(at, "@"+mobile)
+	}
+	for _, userID := range mentions.UserIDs {
+		at = append(at, "@"+userID)
+	}
+	if len(at) == 0 {
+		return message
+	}
+	return message + "\n\n" + strings.Join(at, " ")
+}
+
+// signDingTalkURL adds the timestamp and HMAC-SHA256 signature required by bots with signing enabled
+func signDingTalkURL(webhookURL, secret string, now time.Time) (string, error) {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid dingtalk webhook URL: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(now.UnixMilli(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+
+	query := parsed.Query()
+	query.Set("timestamp", timestamp)
+	query.Set("sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	parsed.RawQuery = query.Encode()
+
+	return parsed.String(), nil
+}
+
+func init() {
+	RegisterNotifier("dingtalk", &DingTalkNotifier{})
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/go-resty/resty/v2"
+)
+
+// Discord embed colors
+const (
+	discordColorBuy     = 0x2ECC71
+	discordColorSell    = 0xE74C3C
+	discordColorNeutral = 0x95A5A6
+)
+
+// DiscordNotifier sends embeds to Discord webhooks
+type DiscordNotifier struct{}
+
+// Escape escapes a value for Discord markdown
+func (n *DiscordNotifier) Escape(endpoint config.EndpointConfig, value string) string {
+	return escapeMarkdown(value)
+}
+
+// DefaultTemplate returns the built-in Discord template
+func (n *DiscordNotifier) DefaultTemplate(endpoint config.EndpointConfig) string {
+	return markdownTemplate
+}
+
+// Send posts the message as an embed colored by the signal direction
+func (n *DiscordNotifier) Send(client *resty.Client, endpoint config.EndpointConfig, message string, notification *Notification) error {
+	timestamp := time.Now()
+	if notification.Alert != nil && !notification.Alert.CreatedAt.IsZero() {
+		timestamp = notification.Alert.CreatedAt
+	}
+
+	payload := map[string]interface{}{
+		"embeds": []map[string]interface{}{
+			{
+				"description": message,
+				"color":       discordColor(notification),
+				"timestamp":   timestamp.UTC().Format(time.RFC3339),
+			},
+		},
+	}
+
+	// Discord reports how long to wait in the body of rate limit responses
+	_, err := postJSON(client, "discord webhook", endpoint.URL, payload)
+	return err
+}
+
+// discordColor picks the embed color for a notification
+func discordColor(notification *Notification) int {
+	if notification.Execution != nil && notification.Execution.Status == "failed" {
+		return discordColorSell
+	}
+
+	switch strings.ToLower(notification.Action()) {
+	case "buy":
+		return discordColorBuy
+	case "sell":
+		return discordColorSell
+	default:
+		return discordColorNeutral
+	}
+}
+
+func init() {
+	RegisterNotifier("discord", &DiscordNotifier{})
+}
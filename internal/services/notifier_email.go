@@ -0,0 +1,160 @@
+package services
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"html"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/go-resty/resty/v2"
+)
+
+// defaultEmailSubject is the subject template used when an endpoint configures none
+const defaultEmailSubject = `{{if .IsPlainText}}TradingView Alert{{else}}Trading Alert: {{upper .Action}} {{.Symbol}}{{with .Execution}} ({{.Status}}){{end}}{{end}}`
+
+// smtpTimeout bounds the whole SMTP conversation
+const smtpTimeout = 30 * time.Second
+
+// EmailNotifier sends HTML emails through an SMTP server
+type EmailNotifier struct{}
+
+// Escape escapes a value for the HTML body
+func (n *EmailNotifier) Escape(endpoint config.EndpointConfig, value string) string {
+	return html.EscapeString(value)
+}
+
+// DefaultTemplate returns the built-in email template
+func (n *EmailNotifier) DefaultTemplate(endpoint config.EndpointConfig) string {
+	return emailTemplate
+}
+
+// Send sends the message to all configured recipients
+func (n *EmailNotifier) Send(client *resty.Client, endpoint config.EndpointConfig, message string, notification *Notification) error {
+	if endpoint.From == "" || len(endpoint.To) == 0 {
+		return fmt.Errorf("email endpoint requires from and to addresses")
+	}
+
+	subjectTemplate := endpoint.Subject
+	if subjectTemplate == "" {
+		subjectTemplate = defaultEmailSubject
+	}
+	subject, err := renderText(subjectTemplate, escapeNone, notification)
+	if err != nil {
+		return fmt.Errorf("failed to render email subject: %w", err)
+	}
+
+	body, err := buildEmail(endpoint.From, endpoint.To, strings.TrimSpace(subject), message)
+	if err != nil {
+		return err
+	}
+
+	return sendMail(endpoint, body)
+}
+
+// buildEmail builds a MIME message with a quoted-printable HTML body
+func buildEmail(from string, to []string, subject, htmlBody string) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	writer := quotedprintable.NewWriter(&buf)
+	if _, err := writer.Write([]byte(htmlBody)); err != nil {
+		return nil, fmt.Errorf("failed to encode email body: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode email body: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// sendMail delivers a message through the endpoint's SMTP server, using implicit TLS
+// for smtps:// URLs and STARTTLS whenever the server offers it
+func sendMail(endpoint config.EndpointConfig, message []byte) error {
+	server, err := url.Parse(endpoint.URL)
+	if err != nil || server.Host == "" {
+		return fmt.Errorf("invalid SMTP server URL: %s", endpoint.URL)
+	}
+
+	host := server.Hostname()
+	address := server.Host
+	if server.Port() == "" {
+		if server.Scheme == "smtps" {
+			address = net.JoinHostPort(host, "465")
+		} else {
+			address = net.JoinHostPort(host, "587")
+		}
+	}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	if server.Scheme == "smtps" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake failed: %w", err)
+	}
+	defer client.Close()
+
+	if server.Scheme != "smtps" {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+				return fmt.Errorf("SMTP STARTTLS failed: %w", err)
+			}
+		}
+	}
+
+	if endpoint.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", endpoint.Username, endpoint.Password, host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(endpoint.From); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %w", err)
+	}
+	for _, recipient := range endpoint.To {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("SMTP RCPT TO %s failed: %w", recipient, err)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := writer.Write(message); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected email: %w", err)
+	}
+
+	return client.Quit()
+}
+
+func init() {
+	RegisterNotifier("email", &EmailNotifier{})
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/go-resty/resty/v2"
+)
+
+// FeishuNotifier sends interactive cards to Feishu/Lark custom bots
+type FeishuNotifier struct{}
+
+// Escape escapes a value for Feishu lark_md
+func (n *FeishuNotifier) Escape(endpoint config.EndpointConfig, value string) string {
+	return escapeMarkdown(value)
+}
+
+// DefaultTemplate returns the built-in Feishu template
+func (n *FeishuNotifier) DefaultTemplate(endpoint config.EndpointConfig) string {
+	return markdownTemplate
+}
+
+// Send posts the message as a card, signed when the bot has a secret configured
+func (n *FeishuNotifier) Send(client *resty.Client, endpoint config.EndpointConfig, message string, notification *Notification) error {
+	headerColor := "blue"
+	if notification.Execution != nil && notification.Execution.Status == "failed" {
+		headerColor = "red"
+	}
+
+	payload := map[string]interface{}{
+		"msg_type": "interactive",
+		"card": map[string]interface{}{
+			"header": map[string]interface{}{
+				"title":    map[string]string{"tag": "plain_text", "content": "Trading Alert"},
+				"template": headerColor,
+			},
+			"elements": []map[string]interface{}{
+				{
+					"tag":  "div",
+					"text": map[string]string{"tag": "lark_md", "content": message},
+				},
+			},
+		},
+	}
+
+	if endpoint.Secret != "" {
+		timestamp := time.Now().Unix()
+		sign, err := feishuSign(endpoint.Secret, timestamp)
+		if err != nil {
+			return err
+		}
+		payload["timestamp"] = strconv.FormatInt(timestamp, 10)
+		payload["sign"] = sign
+	}
+
+	resp, err := postJSON(client, "feishu API", endpoint.URL, payload)
+	if err != nil {
+		return err
+	}
+
+	// Feishu answers with HTTP 200 and reports failures in the body
+	var result struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.Unmarshal(resp.Body(), &result); err == nil && result.Code != 0 {
+		return fmt.Errorf("feishu API returned code %d: %s", result.Code, result.Msg)
+	}
+
+	return nil
+}
+
+// feishuSign computes the signature of a Feishu bot request: the HMAC-SHA256
+// of an empty message keyed with "timestamp\nsecret", base64 encoded
+func feishuSign(secret string, timestamp int64) (string, error) {
+	mac := hmac.New(sha256.New, []byte(fmt.Sprintf("%d\n%s", timestamp, secret)))
+	if _, err := mac.Write(nil); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func init() {
+	RegisterNotifier("feishu", &FeishuNotifier{})
+	RegisterNotifier("lark", &FeishuNotifier{})
+}
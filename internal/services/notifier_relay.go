@@ -0,0 +1,117 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/go-resty/resty/v2"
+)
+
+// relaySizeFields are the payload fields scaled by the relay size multiplier
+var relaySizeFields = []string{
+	"position_size",
+	"contracts",
+	"amount",
+	"market_position_size",
+	"prev_market_position_size",
+	"quantity",
+}
+
+// RelayNotifier replays the original webhook body to another tv-forward or bot instance
+type RelayNotifier struct{}
+
+// Escape leaves values untouched, relays do not render messages
+func (n *RelayNotifier) Escape(endpoint config.EndpointConfig, value string) string {
+	return escapeNone(value)
+}
+
+// DefaultTemplate returns the plain-text template; relays send the original body instead
+func (n *RelayNotifier) DefaultTemplate(endpoint config.EndpointConfig) string {
+	return plainTemplate
+}
+
+// Send relays the original body to the endpoint
+func (n *RelayNotifier) Send(client *resty.Client, endpoint config.EndpointConfig, message string, notification *Notification) error {
+	_, err := n.SendWithResponse(client, endpoint, notification)
+	return err
+}
+
+// SendWithResponse relays the original body, rewritten if configured, and returns the downstream response
+func (n *RelayNotifier) SendWithResponse(client *resty.Client, endpoint config.EndpointConfig, notification *Notification) (*DeliveryResponse, error) {
+	body, err := rewriteRelayPayload([]byte(notification.Alert.RawPayload), endpoint.Relay)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := "text/plain; charset=utf-8"
+	if json.Valid(body) {
+		contentType = "application/json"
+	}
+
+	resp, err := webhookRequest(client, endpoint, body, contentType).Post(endpoint.URL)
+	if err != nil {
+		return nil, fmt.Errorf("relay request failed: %w", err)
+	}
+
+	response := newDeliveryResponse(resp)
+	if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
+		return response, fmt.Errorf("relay returned status %d: %s", resp.StatusCode(), resp.String())
+	}
+
+	return response, nil
+}
+
+// rewriteRelayPayload applies the configured rewrites to a JSON payload. Payloads are
+// relayed byte for byte when no rewrite is configured or the body is not a JSON object.
+func rewriteRelayPayload(raw []byte, relay config.RelayConfig) ([]byte, error) {
+	if relay.APISec == "" && relay.Exchange == "" && relay.SizeMultiplier == 0 {
+		return raw, nil
+	}
+
+	var payload map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&payload); err != nil {
+		return raw, nil
+	}
+
+	// Only trading signals are authenticated by api_sec, legacy alerts must not become signals
+	if _, exists := payload["api_sec"]; exists && relay.APISec != "" {
+		payload["api_sec"] = relay.APISec
+	}
+	if relay.Exchange != "" {
+		payload["exchange"] = relay.Exchange
+	}
+	if relay.SizeMultiplier != 0 {
+		for _, field := range relaySizeFields {
+			if value, exists := payload[field]; exists {
+				payload[field] = scaleSize(value, relay.SizeMultiplier)
+			}
+		}
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(payload); err != nil {
+		return nil, fmt.Errorf("failed to encode relay payload: %w", err)
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
+
+// scaleSize multiplies a numeric or numeric-string size, keeping its JSON type
+func scaleSize(value interface{}, multiplier float64) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		return json.Number(multiplySize(string(v), multiplier))
+	case string:
+		return multiplySize(v, multiplier)
+	}
+	return value
+}
+
+func init() {
+	RegisterNotifier("relay", &RelayNotifier{})
+}
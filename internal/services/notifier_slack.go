@@ -0,0 +1,42 @@
+package services
+
+import (
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/go-resty/resty/v2"
+)
+
+// SlackNotifier sends mrkdwn messages to Slack incoming webhooks
+type SlackNotifier struct{}
+
+// Escape escapes a value for Slack mrkdwn
+func (n *SlackNotifier) Escape(endpoint config.EndpointConfig, value string) string {
+	return escapeSlack(value)
+}
+
+// DefaultTemplate returns the built-in Slack template
+func (n *SlackNotifier) DefaultTemplate(endpoint config.EndpointConfig) string {
+	return slackTemplate
+}
+
+// Send posts the message as a section block; the text doubles as notification fallback
+func (n *SlackNotifier) Send(client *resty.Client, endpoint config.EndpointConfig, message string, notification *Notification) error {
+	payload := map[string]interface{}{
+		"text": message,
+		"blocks": []map[string]interface{}{
+			{
+				"type": "section",
+				"text": map[string]string{
+					"type": "mrkdwn",
+					"text": message,
+				},
+			},
+		},
+	}
+
+	_, err := postJSON(client, "slack webhook", endpoint.URL, payload)
+	return err
+}
+
+func init() {
+	RegisterNotifier("slack", &SlackNotifier{})
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/go-resty/resty/v2"
+)
+
+// TelegramNotifier sends HTML messages through the Telegram Bot API
+type TelegramNotifier struct{}
+
+// Escape escapes a value for Telegram HTML
+func (n *TelegramNotifier) Escape(endpoint config.EndpointConfig, value string) string {
+	return html.EscapeString(value)
+}
+
+// DefaultTemplate returns the built-in Telegram template
+func (n *TelegramNotifier) DefaultTemplate(endpoint config.EndpointConfig) string {
+	return telegramTemplate
+}
+
+// Send sends a message to the configured chat
+func (n *TelegramNotifier) Send(client *resty.Client, endpoint config.EndpointConfig, message string, notification *Notification) error {
+	// A configured URL points to a self-hosted Bot API server
+	apiURL := "https://api.telegram.org"
+	if endpoint.URL != "" {
+		apiURL = strings.TrimRight(endpoint.URL, "/")
+	}
+	url := fmt.Sprintf("%s/bot%s/sendMessage", apiURL, endpoint.Token)
+	payload := map[string]interface{}{
+		"chat_id":    endpoint.ChatID,
+		"text":       message,
+		"parse_mode": "HTML",
+	}
+
+	// Telegram reports how long to wait in the body of rate limit responses
+	_, err := postJSON(client, "telegram API", url, payload)
+	return err
+}
+
+func init() {
+	RegisterNotifier("telegram", &TelegramNotifier{})
+}
@@ -0,0 +1,358 @@
+package services
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureServer records the JSON body of every request and answers with the given response
+func captureServer(t *testing.T, status int, header http.Header, response string) (*httptest.Server, *[]map[string]interface{}) {
+	t.Helper()
+
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		bodies = append(bodies, body)
+
+		for key, values := range header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &bodies
+}
+
+func TestSlackNotifier(t *testing.T) {
+	server, bodies := captureServer(t, http.StatusOK, nil, "ok")
+	service := &ForwardService{client: resty.New()}
+
+	endpoint := config.EndpointConfig{Name: "slack", Type: "slack", URL: server.URL}
+	require.NoError(t, service.forwardToEndpoint(newTestNotification(), endpoint))
+
+	require.Len(t, *bodies, 1)
+	text := (*bodies)[0]["text"].(string)
+	assert.Contains(t, text, "*Symbol:* BTCUSDT")
+	assert.Contains(t, text, "*Error:* margin &lt;insufficient&gt;")
+	blocks := (*bodies)[0]["blocks"].([]interface{})
+	assert.Equal(t, "mrkdwn", blocks[0].(map[string]interface{})["text"].(map[string]interface{})["type"])
+}
+
+func TestSlackNotifierRetryAfterHeader(t *testing.T) {
+	server, _ := captureServer(t, http.StatusTooManyRequests, http.Header{"Retry-After": {"30"}}, "rate_limited")
+	service := &ForwardService{client: resty.New()}
+
+	err := service.forwardToEndpoint(newTestNotification(), config.EndpointConfig{Name: "slack", Type: "slack", URL: server.URL})
+	require.Error(t, err)
+	assert.Equal(t, 30*time.Second, service.retryDelay(1, err))
+}
+
+func TestDiscordNotifier(t *testing.T) {
+	server, bodies := captureServer(t, http.StatusNoContent, nil, "")
+	service := &ForwardService{client: resty.New()}
+
+	endpoint := config.EndpointConfig{Name: "discord", Type: "discord", URL: server.URL}
+	require.NoError(t, service.forwardToEndpoint(newTestNotification(), endpoint))
+
+	embed := (*bodies)[0]["embeds"].([]interface{})[0].(map[string]interface{})
+	assert.Contains(t, embed["description"], "**User:** alice\\_\\[main\\]")
+	assert.Equal(t, float64(discordColorSell), embed["color"]) // Failed execution
+	assert.Equal(t, "2024-01-02T03:04:05Z", embed["timestamp"])
+
+	// Discord reports the retry delay in the body
+	limited, _ := captureServer(t, http.StatusTooManyRequests, nil, `{"message":"You are being rate limited.","retry_after":1.5}`)
+	err := service.forwardToEndpoint(newTestNotification(), config.EndpointConfig{Name: "discord", Type: "discord", URL: limited.URL})
+	require.Error(t, err)
+	assert.Equal(t, 1500*time.Millisecond, service.retryDelay(1, err))
+}
+
+func TestFeishuNotifier(t *testing.T) {
+	server, bodies := captureServer(t, http.StatusOK, nil, `{"code":0,"msg":"success"}`)
+	service := &ForwardService{client: resty.New()}
+
+	endpoint := config.EndpointConfig{Name: "feishu", Type: "feishu", URL: server.URL, Secret: "s3cret"}
+	require.NoError(t, service.forwardToEndpoint(newTestNotification(), endpoint))
+
+	body := (*bodies)[0]
+	assert.Equal(t, "interactive", body["msg_type"])
+
+	// The signature verifies with the bot secret
+	timestamp := body["timestamp"].(string)
+	mac := hmac.New(sha256.New, []byte(timestamp+"\ns3cret"))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(mac.Sum(nil)), body["sign"])
+
+	card := body["card"].(map[string]interface{})
+	assert.Equal(t, "red", card["header"].(map[string]interface{})["template"])
+	element := card["elements"].([]interface{})[0].(map[string]interface{})
+	assert.Contains(t, element["text"].(map[string]interface{})["content"], "**Symbol:** BTCUSDT")
+
+	// Errors are reported in the body with HTTP 200
+	rejected, _ := captureServer(t, http.StatusOK, nil, `{"code":19021,"msg":"sign match fail or timestamp is not within one hour from current time"}`)
+	err := service.forwardToEndpoint(newTestNotification(), config.EndpointConfig{Name: "lark", Type: "lark", URL: rejected.URL})
+	assert.ErrorContains(t, err, "code 19021")
+}
+
+func TestEmailNotifier(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan smtpMessage, 1)
+	go serveSMTP(listener, received)
+
+	service := &ForwardService{client: resty.New()}
+	endpoint := config.EndpointConfig{
+		Name: "mail",
+		Type: "email",
+		URL:  "smtp://" + listener.Addr().String(),
+		From: "alerts@example.com",
+		To:   []string{"ops@example.com", "desk@example.com"},
+	}
+	require.NoError(t, service.forwardToEndpoint(newTestNotification(), endpoint))
+
+	select {
+	case message := <-received:
+		assert.Equal(t, "<alerts@example.com>", message.from)
+		assert.Equal(t, []string{"<ops@example.com>", "<desk@example.com>"}, message.to)
+		assert.Contains(t, message.data, "Subject: Trading Alert: BUY BTCUSDT (failed)")
+		assert.Contains(t, message.data, "Content-Type: text/html; charset=UTF-8")
+
+		body, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(message.data[strings.Index(message.data, "\r\n\r\n")+4:])))
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "<tr><th align=\"left\">Error</th><td>margin &lt;insufficient&gt;</td></tr>")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email received")
+	}
+}
+
+// smtpMessage is an email accepted by the SMTP stand-in
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// serveSMTP accepts a single SMTP session and reports the received message
+func serveSMTP(listener net.Listener, received chan<- smtpMessage) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	var message smtpMessage
+	reply("220 localhost ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250-localhost")
+			reply("250 8BITMIME")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			message.from = strings.Fields(strings.TrimPrefix(command, "MAIL FROM:"))[0]
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			message.to = append(message.to, strings.TrimPrefix(command, "RCPT TO:"))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			message.data = data.String()
+			reply("250 OK")
+			received <- message
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func TestDingTalkNotifierSigningAndMentions(t *testing.T) {
+	var query url.Values
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		body = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer server.Close()
+
+	service := &ForwardService{client: resty.New()}
+	endpoint := config.EndpointConfig{
+		Name:     "dd",
+		Type:     "dingtalk",
+		URL:      server.URL + "/robot/send?access_token=abc",
+		Secret:   "SEC123",
+		Mentions: config.MentionConfig{Mobiles: []string{"13800000000"}},
+	}
+	require.NoError(t, service.forwardToEndpoint(newTestNotification(), endpoint))
+
+	// The signature is the HMAC of "timestamp\nsecret" keyed with the secret
+	assert.Equal(t, "abc", query.Get("access_token"))
+	mac := hmac.New(sha256.New, []byte("SEC123"))
+	mac.Write([]byte(query.Get("timestamp") + "\nSEC123"))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(mac.Sum(nil)), query.Get("sign"))
+
+	// Failed executions mention the configured mobiles
+	assert.Equal(t, "markdown", body["msgtype"])
+	markdown := body["markdown"].(map[string]interface{})
+	assert.Equal(t, "BUY BTCUSDT", markdown["title"])
+	assert.True(t, strings.HasSuffix(markdown["text"].(string), "@13800000000"))
+	assert.Equal(t, []interface{}{"13800000000"}, body["at"].(map[string]interface{})["atMobiles"])
+
+	// Filled executions do not mention anyone
+	filled := newTestNotification()
+	filled.Execution.Status = "filled"
+	require.NoError(t, service.forwardToEndpoint(filled, endpoint))
+	assert.NotContains(t, body, "at")
+}
+
+func TestDingTalkNotifierActionCardAndErrors(t *testing.T) {
+	server, bodies := captureServer(t, http.StatusOK, nil, `{"errcode":310000,"errmsg":"sign not match"}`)
+	service := &ForwardService{client: resty.New()}
+
+	endpoint := config.EndpointConfig{
+		Name:        "dd",
+		Type:        "dingtalk",
+		URL:         server.URL,
+		MessageType: "actionCard",
+		ActionURL:   "https://example.com/chart/{{.Symbol}}",
+	}
+	err := service.forwardToEndpoint(newTestNotification(), endpoint)
+	assert.ErrorContains(t, err, "errcode 310000")
+
+	card := (*bodies)[0]["actionCard"].(map[string]interface{})
+	assert.Equal(t, "https://example.com/chart/BTCUSDT", card["singleURL"])
+	assert.Contains(t, card["text"], "**Symbol:** BTCUSDT")
+}
+
+func TestWeChatNotifierMessageTypes(t *testing.T) {
+	server, bodies := captureServer(t, http.StatusOK, nil, `{"errcode":0,"errmsg":"ok"}`)
+	service := &ForwardService{client: resty.New()}
+
+	mentions := config.MentionConfig{UserIDs: []string{"zhangsan"}, Mobiles: []string{"13800000000"}, All: true}
+
+	// Text messages carry the mention lists
+	text := config.EndpointConfig{Name: "wx", Type: "wechat", URL: server.URL, Mentions: mentions}
+	require.NoError(t, service.forwardToEndpoint(newTestNotification(), text))
+	content := (*bodies)[0]["text"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"zhangsan", "@all"}, content["mentioned_list"])
+	assert.Equal(t, []interface{}{"13800000000"}, content["mentioned_mobile_list"])
+
+	// Markdown messages mention users inline
+	markdown := config.EndpointConfig{Name: "wx-md", Type: "wechat", URL: server.URL, MessageType: "markdown", Mentions: mentions}
+	require.NoError(t, service.forwardToEndpoint(newTestNotification(), markdown))
+	assert.True(t, strings.HasSuffix((*bodies)[1]["markdown"].(map[string]interface{})["content"].(string), "<@zhangsan>"))
+
+	// Template cards link to the symbol
+	card := config.EndpointConfig{Name: "wx-card", Type: "wechat", URL: server.URL, MessageType: "template_card"}
+	require.NoError(t, service.forwardToEndpoint(newTestNotification(), card))
+	templateCard := (*bodies)[2]["template_card"].(map[string]interface{})
+	assert.Equal(t, "text_notice", templateCard["card_type"])
+	assert.Equal(t, "BUY BTCUSDT - failed", templateCard["main_title"].(map[string]interface{})["title"])
+	assert.Equal(t, "https://www.tradingview.com/symbols/BTCUSDT/", templateCard["card_action"].(map[string]interface{})["url"])
+}
+
+func TestWebhookNotifierSigningAndHeaders(t *testing.T) {
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	service := &ForwardService{client: resty.New()}
+	endpoint := config.EndpointConfig{
+		Name:          "hook",
+		Type:          "webhook",
+		URL:           server.URL,
+		Secret:        "s3cret",
+		BearerToken:   "token",
+		Headers:       map[string]string{"X-Team": "quant"},
+		PayloadFormat: "raw",
+	}
+	notification := newTestNotification()
+	notification.Alert.RawPayload = `{"api_sec":"secret", "symbol":"BTCUSDT"}`
+	require.NoError(t, service.forwardToEndpoint(notification, endpoint))
+
+	// The raw payload is forwarded byte for byte
+	assert.Equal(t, notification.Alert.RawPayload, string(body))
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", header.Get("Authorization"))
+	assert.Equal(t, "quant", header.Get("X-Team"))
+
+	// Receivers recompute the HMAC of "timestamp.body"
+	timestamp := header.Get(WebhookTimestampHeader)
+	require.NotEmpty(t, timestamp)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(timestamp + "." + string(body)))
+	assert.Equal(t, "sha256="+fmt.Sprintf("%x", mac.Sum(nil)), header.Get(WebhookSignatureHeader))
+}
+
+func TestWebhookNotifierPayloadFormats(t *testing.T) {
+	server, bodies := captureServer(t, http.StatusOK, nil, "")
+	service := &ForwardService{client: resty.New()}
+	notification := newTestNotification()
+
+	for _, format := range []string{"", "signal", "execution"} {
+		endpoint := config.EndpointConfig{Name: "hook", Type: "webhook", URL: server.URL, PayloadFormat: format}
+		require.NoError(t, service.forwardToEndpoint(notification, endpoint))
+	}
+	require.Len(t, *bodies, 3)
+	assert.Equal(t, "trading_signal", (*bodies)[0]["strategy"])
+	assert.Equal(t, "secret", (*bodies)[1]["api_sec"])
+	assert.Equal(t, "alice_[main]", (*bodies)[2]["user"])
+	assert.Equal(t, "failed", (*bodies)[2]["execution"].(map[string]interface{})["status"])
+	assert.Equal(t, "long", (*bodies)[2]["signal"].(map[string]interface{})["market_position"])
+
+	// Plain alerts have no signal to send, and unknown formats are rejected
+	plain := &Notification{Alert: notification.Alert}
+	signal := config.EndpointConfig{Name: "hook", Type: "webhook", URL: server.URL, PayloadFormat: "signal"}
+	assert.ErrorContains(t, service.forwardToEndpoint(plain, signal), "no TradingView signal")
+	unknown := config.EndpointConfig{Name: "hook", Type: "webhook", URL: server.URL, PayloadFormat: "xml"}
+	assert.ErrorContains(t, service.forwardToEndpoint(plain, unknown), "unsupported webhook payload_format")
+	assert.Len(t, *bodies, 3)
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/go-resty/resty/v2"
+)
+
+// Headers of signed webhook requests
+const (
+	WebhookTimestampHeader = "X-TV-Forward-Timestamp"
+	WebhookSignatureHeader = "X-TV-Forward-Signature"
+)
+
+// Webhook payload formats
+const (
+	webhookPayloadAlert     = "alert"
+	webhookPayloadRaw       = "raw"
+	webhookPayloadSignal    = "signal"
+	webhookPayloadExecution = "execution"
+)
+
+// webhookExecution is the payload of the execution format
+type webhookExecution struct {
+	AlertID   uint        `json:"alert_id"`
+	User      string      `json:"user,omitempty"`
+	Signal    interface{} `json:"signal"`
+	Execution interface{} `json:"execution"`
+}
+
+// WebhookNotifier posts alerts to a generic webhook, optionally signed
+type WebhookNotifier struct{}
+
+// Escape leaves values untouched, the webhook receives structured data
+func (n *WebhookNotifier) Escape(endpoint config.EndpointConfig, value string) string {
+	return escapeNone(value)
+}
+
+// DefaultTemplate returns the plain-text template; webhooks receive structured payloads
+func (n *WebhookNotifier) DefaultTemplate(endpoint config.EndpointConfig) string {
+	return plainTemplate
+}
+
+// Send posts the payload in the configured format with the configured headers
+func (n *WebhookNotifier) Send(client *resty.Client, endpoint config.EndpointConfig, message string, notification *Notification) error {
+	body, contentType, err := webhookPayload(endpoint.PayloadFormat, notification)
+	if err != nil {
+		return err
+	}
+
+	resp, err := webhookRequest(client, endpoint, body, contentType).Post(endpoint.URL)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+
+	if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
+		return fmt.Errorf("webhook returned status %d: %s", resp.StatusCode(), resp.String())
+	}
+
+	return nil
+}
+
+// webhookRequest prepares a request with the endpoint's headers, bearer token and signature
+func webhookRequest(client *resty.Client, endpoint config.EndpointConfig, body []byte, contentType string) *resty.Request {
+	request := client.R().
+		SetHeader("Content-Type", contentType).
+		SetHeaders(endpoint.Headers).
+		SetBody(body)
+	if endpoint.BearerToken != "" {
+		request.SetAuthToken(endpoint.BearerToken)
+	}
+	if endpoint.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		request.SetHeader(WebhookTimestampHeader, timestamp)
+		request.SetHeader(WebhookSignatureHeader, SignWebhook(endpoint.Secret, timestamp, body))
+	}
+	return request
+}
+
+// webhookPayload builds the request body and content type for a payload format
+func webhookPayload(format string, notification *Notification) ([]byte, string, error) {
+	var payload interface{}
+	switch format {
+	case "", webhookPayloadAlert:
+		payload = notification.Alert
+	case webhookPayloadRaw:
+		// The original request body, byte for byte
+		raw := []byte(notification.Alert.RawPayload)
+		if json.Valid(raw) {
+			return raw, "application/json", nil
+		}
+		return raw, "text/plain; charset=utf-8", nil
+	case webhookPayloadSignal:
+		if notification.Signal == nil {
+			return nil, "", fmt.Errorf("alert %d has no TradingView signal", notification.Alert.ID)
+		}
+		payload = notification.Signal
+	case webhookPayloadExecution:
+		execution := webhookExecution{AlertID: notification.Alert.ID, User: notification.UserName}
+		if notification.Signal != nil {
+			execution.Signal = notification.Signal
+		}
+		if notification.Execution != nil {
+			execution.Execution = notification.Execution
+		}
+		payload = execution
+	default:
+		return nil, "", fmt.Errorf("unsupported webhook payload_format: %s", format)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+	return body, "application/json", nil
+}
+
+// SignWebhook returns the signature of a webhook request: the hex-encoded
+// HMAC-SHA256 of "timestamp.body" keyed with the endpoint secret
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func init() {
+	RegisterNotifier("webhook", &WebhookNotifier{})
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/go-resty/resty/v2"
+)
+
+// WeChat Work message types
+const (
+	weChatText         = "text"
+	weChatMarkdown     = "markdown"
+	weChatTemplateCard = "template_card"
+)
+
+// WeChatNotifier sends text, markdown and template card messages to Enterprise WeChat group bots
+type WeChatNotifier struct{}
+
+// Escape escapes a value for WeChat markdown; text and card messages are left untouched
+func (n *WeChatNotifier) Escape(endpoint config.EndpointConfig, value string) string {
+	if weChatMessageType(endpoint) == weChatMarkdown {
+		return escapeMarkdown(value)
+	}
+	return escapeNone(value)
+}
+
+// DefaultTemplate returns the built-in WeChat template for the endpoint's message type
+func (n *WeChatNotifier) DefaultTemplate(endpoint config.EndpointConfig) string {
+	if weChatMessageType(endpoint) == weChatMarkdown {
+		return markdownTemplate
+	}
+	return plainTemplate
+}
+
+// Send sends a message to the configured bot, or to the bot whose key was passed
+// in the webhook request URL
+func (n *WeChatNotifier) Send(client *resty.Client, endpoint config.EndpointConfig, message string, notification *Notification) error {
+	log.Printf("WeChat message: %s", message)
+
+	// Use dynamic key if provided, otherwise use the configured URL
+	wechatURL := endpoint.URL
+	if key := extractKeyFromURL(notification.RequestURL); key != "" {
+		wechatURL = buildWeChatURL(key)
+		log.Printf("Using dynamic WeChat URL with key: %s", key)
+	}
+
+	mention := shouldMention(endpoint.Mentions, notification)
+
+	var payload map[string]interface{}
+	switch messageType := weChatMessageType(endpoint); messageType {
+	case weChatText:
+		text := map[string]interface{}{"content": message}
+		if mention {
+			mentioned := endpoint.Mentions.UserIDs
+			if endpoint.Mentions.All {
+				mentioned = append(append([]string{}, mentioned...), "@all")
+			}
+			text["mentioned_list"] = mentioned
+			text["mentioned_mobile_list"] = endpoint.Mentions.Mobiles
+		}
+		payload = map[string]interface{}{"msgtype": "text", "text": text}
+	case weChatMarkdown:
+		// Markdown messages mention users inline; mobiles are not supported
+		if mention {
+			for _, userID := range endpoint.Mentions.UserIDs {
+				message += fmt.Sprintf(" <@%s>", userID)
+			}
+		}
+		payload = map[string]interface{}{
+			"msgtype":  "markdown",
+			"markdown": map[string]string{"content": message},
+		}
+	case weChatTemplateCard:
+		payload = map[string]interface{}{
+			"msgtype": "template_card",
+			"template_card": map[string]interface{}{
+				"card_type": "text_notice",
+				"main_title": map[string]string{
+					"title": weChatCardTitle(notification),
+					"desc":  notification.Time(),
+				},
+				"sub_title_text": message,
+				"card_action": map[string]interface{}{
+					"type": 1,
+					"url":  actionURL(endpoint, notification),
+				},
+			},
+		}
+	default:
+		return fmt.Errorf("unsupported wechat msg_type: %s", messageType)
+	}
+
+	resp, err := postJSON(client, "wechat API", wechatURL, payload)
+	if err != nil {
+		return err
+	}
+	log.Printf("WeChat response: %s", resp.String())
+
+	return checkErrcode(resp, "wechat API")
+}
+
+// weChatMessageType returns the configured message type, text by default
+func weChatMessageType(endpoint config.EndpointConfig) string {
+	if endpoint.MessageType == "" {
+		return weChatText
+	}
+	return endpoint.MessageType
+}
+
+// weChatCardTitle returns the main title of a template card
+func weChatCardTitle(notification *Notification) string {
+	if notification.IsPlainText() || notification.Symbol() == "" {
+		return "Trading Alert"
+	}
+
+	title := fmt.Sprintf("%s %s", strings.ToUpper(notification.Action()), notification.Symbol())
+	if notification.Execution != nil && notification.Execution.Status != "" {
+		title += " - " + notification.Execution.Status
+	}
+	return title
+}
+
+// extractKeyFromURL extracts the key parameter from a request URL
+func extractKeyFromURL(requestURL string) string {
+	if requestURL == "" {
+		return ""
+	}
+
+	parsedURL, err := url.Parse(requestURL)
+	if err != nil {
+		return ""
+	}
+	return parsedURL.Query().Get("key")
+}
+
+// buildWeChatURL builds a WeChat webhook URL with the provided key
+func buildWeChatURL(key string) string {
+	return fmt.Sprintf("https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=%s", url.QueryEscape(key))
+}
+
+func init() {
+	RegisterNotifier("wechat", &WeChatNotifier{})
+}
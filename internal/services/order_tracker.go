@@ -0,0 +1,365 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/database"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"gorm.io/gorm"
+)
+
+// BrokerConnector returns a connected broker for a user's credentials on an exchange and the
+// function to call when done with it, like BrokerPool.Get
+type BrokerConnector func(ctx context.Context, userID uint, exchange string) (client broker.Broker, release func(), err error)
+
+// OrderTracker follows submitted orders until they are filled, cancelled or rejected
+// and keeps the trading signals they belong to up to date
+type OrderTracker struct {
+	db          *gorm.DB
+	config      *config.Config
+	userService *UserService
+	connect     BrokerConnector
+	onFinal     func(signal *models.TradingSignal)
+
+	// Serializes updates from polling and user data streams so an order is completed once
+	mu sync.Mutex
+}
+
+// NewOrderTracker creates a new order tracker that polls orders with the clients of a shared pool
+func NewOrderTracker(userService *UserService, brokerPool *BrokerPool) *OrderTracker {
+	return &OrderTracker{
+		db:          database.GetDB(),
+		config:      nil, // Will be set later
+		userService: userService,
+		connect:     brokerPool.Get,
+	}
+}
+
+// SetConfig sets the configuration for the order tracker
+func (t *OrderTracker) SetConfig(cfg *config.Config) {
+	t.config = cfg
+}
+
+// SetConnector replaces how brokers are connected for polling
+func (t *OrderTracker) SetConnector(connect BrokerConnector) {
+	t.connect = connect
+}
+
+// OnFinal registers a callback invoked when the order of a trading signal reaches a final state
+func (t *OrderTracker) OnFinal(callback func(signal *models.TradingSignal)) {
+	t.onFinal = callback
+}
+
+// Track stores an open order of a trading signal so it is followed until it is final
+func (t *OrderTracker) Track(signal *models.TradingSignal, order *broker.Order) (*models.Order, error) {
+	if t.db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	record := &models.Order{
+		TradingSignalID:  signal.ID,
+		UserID:           signal.UserID,
+		StrategyID:       signal.StrategyID,
+		Exchange:         signal.Exchange,
+		Symbol:           order.Symbol,
+		ExchangeOrderID:  order.ID,
+		ClientOrderID:    order.ClientOrderID,
+		Side:             string(order.Side),
+		Type:             string(order.Type),
+		PositionSide:     string(order.PositionSide),
+		Quantity:         order.Quantity,
+		Price:            order.Price,
+		ExecutedQuantity: order.ExecutedQuantity,
+		AvgPrice:         order.AvgPrice,
+		Status:           string(order.Status),
+	}
+
+	if order.Type == broker.OrderTypeLimit && t.config != nil && t.config.Trading.OrderTracking.LimitTimeout > 0 {
+		expiresAt := time.Now().Add(t.config.Trading.OrderTracking.LimitTimeout)
+		record.ExpiresAt = &expiresAt
+	}
+
+	if err := t.db.Create(record).Error; err != nil {
+		return nil, fmt.Errorf("failed to save order: %w", err)
+	}
+	return record, nil
+}
+
+// Start polls open orders until the context is cancelled
+func (t *OrderTracker) Start(ctx context.Context) {
+	if t.db == nil {
+		return
+	}
+
+	ticker := time.NewTicker(t.pollInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.PollOnce(ctx)
+		}
+	}
+}
+
+// PollOnce checks every open order with its exchange once
+func (t *OrderTracker) PollOnce(ctx context.Context) {
+	var orders []models.Order
+	if err := t.db.Where("status IN ?", []string{models.OrderStatusNew, models.OrderStatusPartiallyFilled}).
+		Order("id").
+		Find(&orders).Error; err != nil {
+		log.Printf("Failed to query open orders: %v", err)
+		return
+	}
+
+	// One connection per user and exchange for the whole round
+	type account struct {
+		userID   uint
+		exchange string
+	}
+	clients := make(map[account]broker.Broker)
+	var releases []func()
+	defer func() {
+		for _, release := range releases {
+			release()
+		}
+	}()
+
+	for i := range orders {
+		if ctx.Err() != nil {
+			return
+		}
+
+		order := &orders[i]
+		key := account{order.UserID, order.Exchange}
+		client, exists := clients[key]
+		if !exists {
+			var (
+				release func()
+				err     error
+			)
+			client, release, err = t.connect(ctx, order.UserID, order.Exchange)
+			if err != nil {
+				log.Printf("Failed to connect to %s for user %d: %v", order.Exchange, order.UserID, err)
+				continue
+			}
+			clients[key] = client
+			releases = append(releases, release)
+		}
+
+		if err := t.refresh(ctx, client, order); err != nil {
+			log.Printf("Failed to refresh order %s on %s: %v", order.ExchangeOrderID, order.Exchange, err)
+		}
+	}
+}
+
+// ApplyUpdate applies an order update pushed by the exchange to the tracked order it belongs to.
+// Orders that are not tracked or already final are ignored.
+func (t *OrderTracker) ApplyUpdate(ctx context.Context, client broker.Broker, userID uint, exchange string, latest *broker.Order) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var order models.Order
+	err := t.db.Where("user_id = ? AND exchange = ? AND exchange_order_id = ?", userID, exchange, latest.ID).
+		First(&order).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to query order %s: %w", latest.ID, err)
+	}
+
+	if order.IsFinal() {
+		return nil
+	}
+	return t.Apply(ctx, client, &order, latest)
+}
+
+// refresh queries an order, cancels it once its time-in-force has expired, and applies the result
+func (t *OrderTracker) refresh(ctx context.Context, client broker.Broker, order *models.Order) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// A user data stream may have completed the order since it was queried
+	if err := t.db.First(order, order.ID).Error; err != nil {
+		return fmt.Errorf("failed to reload order: %w", err)
+	}
+	if order.IsFinal() {
+		return nil
+	}
+
+	now := time.Now()
+	order.LastCheckedAt = &now
+
+	latest, err := client.GetOrder(ctx, order.Symbol, order.ExchangeOrderID)
+	if err != nil {
+		order.LastError = err.Error()
+		t.saveOrder(order)
+		return err
+	}
+
+	open := latest.Status == broker.OrderStatusNew || latest.Status == broker.OrderStatusPartiallyFilled
+	if open && order.ExpiresAt != nil && now.After(*order.ExpiresAt) {
+		if err := client.CancelOrder(ctx, order.Symbol, order.ExchangeOrderID); err != nil {
+			order.LastError = fmt.Sprintf("failed to cancel expired order: %v", err)
+			t.saveOrder(order)
+			return err
+		}
+		log.Printf("Cancelled order %s on %s after its time-in-force expired", order.ExchangeOrderID, order.Exchange)
+
+		if cancelled, err := client.GetOrder(ctx, order.Symbol, order.ExchangeOrderID); err == nil {
+			latest = cancelled
+		} else {
+			latest.Status = broker.OrderStatusCanceled
+		}
+	}
+
+	return t.Apply(ctx, client, order, latest)
+}
+
+// Apply records the latest state of an order and updates its trading signal.
+// Fees and realized PnL are collected from the fills once the order is final.
+func (t *OrderTracker) Apply(ctx context.Context, client broker.Broker, order *models.Order, latest *broker.Order) error {
+	order.Status = string(latest.Status)
+	order.ExecutedQuantity = latest.ExecutedQuantity
+	order.LastError = ""
+	if latest.AvgPrice != "" {
+		order.AvgPrice = latest.AvgPrice
+	}
+
+	if order.IsFinal() {
+		now := time.Now()
+		order.CompletedAt = &now
+
+		if reporter, ok := client.(broker.FillReporter); ok {
+			if fills, err := reporter.GetOrderFills(ctx, order.Symbol, order.ExchangeOrderID); err != nil {
+				log.Printf("Failed to get fills of order %s: %v", order.ExchangeOrderID, err)
+			} else if len(fills) > 0 {
+				order.Fee, order.FeeAsset, order.RealizedPnL = summarizeFills(fills)
+			}
+		}
+	}
+
+	if err := t.db.Save(order).Error; err != nil {
+		return fmt.Errorf("failed to update order: %w", err)
+	}
+	return t.updateSignal(order)
+}
+
+// updateSignal copies the state of an order to its trading signal
+func (t *OrderTracker) updateSignal(order *models.Order) error {
+	var signal models.TradingSignal
+	if err := t.db.First(&signal, order.TradingSignalID).Error; err != nil {
+		return fmt.Errorf("trading signal %d not found: %w", order.TradingSignalID, err)
+	}
+
+	previous := signal.Status
+	signal.Status = orderSignalStatus(order.Status, order.ExecutedQuantity)
+	signal.FilledQuantity = order.ExecutedQuantity
+	signal.AvgPrice = order.AvgPrice
+	signal.Fee = order.Fee
+	signal.FeeAsset = order.FeeAsset
+	signal.RealizedPnL = order.RealizedPnL
+	if order.Status == models.OrderStatusRejected {
+		signal.ErrorMessage = fmt.Sprintf("order %s was rejected by %s", order.ExchangeOrderID, order.Exchange)
+	}
+	if signal.Status == "filled" && signal.ExecutedAt == nil {
+		signal.ExecutedAt = order.CompletedAt
+	}
+
+	if err := t.db.Save(&signal).Error; err != nil {
+		return fmt.Errorf("failed to update trading signal: %w", err)
+	}
+
+	if previous != signal.Status {
+		log.Printf("Trading signal %d changed from %s to %s (order %s)",
+			signal.ID, previous, signal.Status, order.ExchangeOrderID)
+	}
+
+	if !order.IsFinal() {
+		return nil
+	}
+
+	// The position moves by what the order filled once it is final
+	if t.userService != nil {
+		var err error
+		switch signal.Status {
+		case "filled":
+			err = updateSignalPosition(t.userService, &signal)
+		case "partially_filled":
+			err = updatePartialPosition(t.userService, &signal, broker.OrderSide(order.Side))
+		}
+		if err != nil {
+			log.Printf("Failed to update position for trading signal %d: %v", signal.ID, err)
+		}
+	}
+	if t.onFinal != nil {
+		t.onFinal(&signal)
+	}
+	return nil
+}
+
+// saveOrder persists an order, logging failures
+func (t *OrderTracker) saveOrder(order *models.Order) {
+	if err := t.db.Save(order).Error; err != nil {
+		log.Printf("Failed to update order %d: %v", order.ID, err)
+	}
+}
+
+// pollInterval returns how often open orders are checked
+func (t *OrderTracker) pollInterval() time.Duration {
+	if t.config != nil && t.config.Trading.OrderTracking.PollInterval > 0 {
+		return t.config.Trading.OrderTracking.PollInterval
+	}
+	return 5 * time.Second
+}
+
+// orderSignalStatus maps an order status to the status of its trading signal
+func orderSignalStatus(status string, executedQuantity string) string {
+	executed, _ := strconv.ParseFloat(executedQuantity, 64)
+
+	switch status {
+	case models.OrderStatusFilled:
+		return "filled"
+	case models.OrderStatusPartiallyFilled:
+		return "partially_filled"
+	case models.OrderStatusCanceled, models.OrderStatusExpired:
+		if executed > 0 {
+			return "partially_filled"
+		}
+		return "cancelled"
+	case models.OrderStatusRejected:
+		return "failed"
+	default:
+		return "pending"
+	}
+}
+
+// summarizeFills returns the total fee, its asset and the realized PnL of a set of fills.
+// The realized PnL is empty when the fills did not reduce a position.
+func summarizeFills(fills []broker.Fill) (fee, feeAsset, realizedPnL string) {
+	var totalFee, totalPnL float64
+	for _, fill := range fills {
+		commission, _ := strconv.ParseFloat(fill.Commission, 64)
+		pnl, _ := strconv.ParseFloat(fill.RealizedPnL, 64)
+		totalFee += commission
+		totalPnL += pnl
+		if feeAsset == "" {
+			feeAsset = fill.CommissionAsset
+		}
+	}
+
+	fee = formatNumber(totalFee)
+	if totalPnL != 0 {
+		realizedPnL = formatNumber(totalPnL)
+	}
+	return fee, feeAsset, realizedPnL
+}
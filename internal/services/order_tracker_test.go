@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newTestTracker creates an order tracker whose broker connections return the given mock
+func newTestTracker(t *testing.T, db *gorm.DB, client broker.Broker, limitTimeout time.Duration) (*OrderTracker, *[]uint) {
+	t.Helper()
+
+	tracker := &OrderTracker{
+		db:          db,
+		userService: &UserService{db: db},
+		config: &config.Config{
+			Trading: config.TradingConfig{
+				OrderTracking: config.OrderTrackingConfig{LimitTimeout: limitTimeout},
+			},
+		},
+	}
+	tracker.SetConnector(func(ctx context.Context, userID uint, exchange string) (broker.Broker, func(), error) {
+		return client, func() { client.Close() }, nil
+	})
+
+	var final []uint
+	tracker.OnFinal(func(signal *models.TradingSignal) {
+		final = append(final, signal.ID)
+	})
+	return tracker, &final
+}
+
+// newPendingSignal stores a trading signal whose order has not been filled yet
+func newPendingSignal(t *testing.T, db *gorm.DB) *models.TradingSignal {
+	t.Helper()
+
+	user := &models.User{APISec: "secret", Name: "alice"}
+	require.NoError(t, db.Create(user).Error)
+	signal := &models.TradingSignal{
+		UserID:             user.ID,
+		Symbol:             "BTCUSDT",
+		Exchange:           "binance",
+		Price:              "42000",
+		MarketPosition:     "long",
+		MarketPositionSize: "0.02",
+		Status:             "pending",
+	}
+	require.NoError(t, db.Create(signal).Error)
+	return signal
+}
+
+func TestOrderTrackerFollowsOrderUntilFilled(t *testing.T) {
+	db := newTestDB(t)
+	mockBroker := new(MockFillBroker)
+	tracker, final := newTestTracker(t, db, mockBroker, 0)
+	signal := newPendingSignal(t, db)
+
+	order, err := tracker.Track(signal, &broker.Order{
+		ID: "42", Symbol: "BTCUSDT", Side: broker.OrderSideBuy, Type: broker.OrderTypeLimit,
+		Quantity: "0.02", Price: "42000", ExecutedQuantity: "0", Status: broker.OrderStatusNew,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, order.ExpiresAt)
+
+	// A partial fill is recorded on the order and the signal
+	mockBroker.On("GetOrder", mock.Anything, "BTCUSDT", "42").Return(&broker.Order{
+		ID: "42", Symbol: "BTCUSDT", ExecutedQuantity: "0.01", AvgPrice: "42000", Status: broker.OrderStatusPartiallyFilled,
+	}, nil).Once()
+	mockBroker.On("Close").Return(nil)
+	tracker.PollOnce(context.Background())
+
+	var stored models.TradingSignal
+	require.NoError(t, db.First(&stored, signal.ID).Error)
+	assert.Equal(t, "partially_filled", stored.Status)
+	assert.Equal(t, "0.01", stored.FilledQuantity)
+	assert.Nil(t, stored.ExecutedAt)
+	assert.Empty(t, *final)
+
+	// The final fill collects fees, updates the position and notifies once
+	mockBroker.On("GetOrder", mock.Anything, "BTCUSDT", "42").Return(&broker.Order{
+		ID: "42", Symbol: "BTCUSDT", ExecutedQuantity: "0.02", AvgPrice: "41990", Status: broker.OrderStatusFilled,
+	}, nil).Once()
+	mockBroker.On("GetOrderFills", mock.Anything, "BTCUSDT", "42").Return([]broker.Fill{
+		{Commission: "0.1", CommissionAsset: "USDT"},
+		{Commission: "0.2", CommissionAsset: "USDT"},
+	}, nil).Once()
+	tracker.PollOnce(context.Background())
+
+	require.NoError(t, db.First(&stored, signal.ID).Error)
+	assert.Equal(t, "filled", stored.Status)
+	assert.Equal(t, "41990", stored.AvgPrice)
+	assert.Equal(t, "0.3", stored.Fee)
+	assert.NotNil(t, stored.ExecutedAt)
+	assert.Equal(t, []uint{signal.ID}, *final)
+
+	var position models.Position
+	require.NoError(t, db.Where("user_id = ? AND symbol = ?", signal.UserID, "BTCUSDT").First(&position).Error)
+	assert.Equal(t, "0.02", position.Size)
+	assert.Equal(t, "41990", position.EntryPrice)
+
+	// Final orders are no longer polled
+	tracker.PollOnce(context.Background())
+	mockBroker.AssertExpectations(t)
+}
+
+func TestOrderTrackerCancelsExpiredLimitOrders(t *testing.T) {
+	db := newTestDB(t)
+	mockBroker := new(MockFillBroker)
+	tracker, final := newTestTracker(t, db, mockBroker, time.Minute)
+	signal := newPendingSignal(t, db)
+
+	order, err := tracker.Track(signal, &broker.Order{
+		ID: "7", Symbol: "BTCUSDT", Type: broker.OrderTypeLimit, ExecutedQuantity: "0", Status: broker.OrderStatusNew,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, order.ExpiresAt)
+
+	// Let the time-in-force run out
+	expired := time.Now().Add(-time.Second)
+	require.NoError(t, db.Model(order).Update("expires_at", expired).Error)
+
+	mockBroker.On("GetOrder", mock.Anything, "BTCUSDT", "7").Return(&broker.Order{
+		ID: "7", Symbol: "BTCUSDT", ExecutedQuantity: "0", Status: broker.OrderStatusNew,
+	}, nil).Once()
+	mockBroker.On("CancelOrder", mock.Anything, "BTCUSDT", "7").Return(nil).Once()
+	mockBroker.On("GetOrder", mock.Anything, "BTCUSDT", "7").Return(&broker.Order{
+		ID: "7", Symbol: "BTCUSDT", ExecutedQuantity: "0", Status: broker.OrderStatusCanceled,
+	}, nil).Once()
+	mockBroker.On("GetOrderFills", mock.Anything, "BTCUSDT", "7").Return([]broker.Fill{}, nil).Once()
+	mockBroker.On("Close").Return(nil)
+	tracker.PollOnce(context.Background())
+
+	var stored models.TradingSignal
+	require.NoError(t, db.First(&stored, signal.ID).Error)
+	assert.Equal(t, "cancelled", stored.Status)
+	assert.Equal(t, []uint{signal.ID}, *final)
+
+	var storedOrder models.Order
+	require.NoError(t, db.First(&storedOrder, order.ID).Error)
+	assert.Equal(t, models.OrderStatusCanceled, storedOrder.Status)
+	assert.NotNil(t, storedOrder.CompletedAt)
+	mockBroker.AssertExpectations(t)
+}
+
+func TestOrderTrackerBooksPartialFillsOfFinalOrders(t *testing.T) {
+	db := newTestDB(t)
+	mockBroker := new(MockFillBroker)
+	tracker, final := newTestTracker(t, db, mockBroker, 0)
+	signal := newPendingSignal(t, db)
+
+	_, err := tracker.Track(signal, &broker.Order{
+		ID: "9", Symbol: "BTCUSDT", Side: broker.OrderSideBuy, Type: broker.OrderTypeLimit,
+		Quantity: "0.02", Price: "42000", ExecutedQuantity: "0", Status: broker.OrderStatusNew,
+	})
+	require.NoError(t, err)
+
+	// The order is cancelled after filling half of it
+	mockBroker.On("GetOrder", mock.Anything, "BTCUSDT", "9").Return(&broker.Order{
+		ID: "9", Symbol: "BTCUSDT", ExecutedQuantity: "0.01", AvgPrice: "42000", Status: broker.OrderStatusCanceled,
+	}, nil).Once()
+	mockBroker.On("GetOrderFills", mock.Anything, "BTCUSDT", "9").Return([]broker.Fill{}, nil).Once()
+	mockBroker.On("Close").Return(nil)
+	tracker.PollOnce(context.Background())
+
+	var stored models.TradingSignal
+	require.NoError(t, db.First(&stored, signal.ID).Error)
+	assert.Equal(t, "partially_filled", stored.Status)
+	assert.Equal(t, "0.02", stored.MarketPositionSize)
+	assert.Equal(t, []uint{signal.ID}, *final)
+
+	// The position moves by the filled part only
+	var position models.Position
+	require.NoError(t, db.Where("user_id = ? AND symbol = ?", signal.UserID, "BTCUSDT").First(&position).Error)
+	assert.Equal(t, "0.01", position.Size)
+	assert.Equal(t, "long", position.Side)
+	mockBroker.AssertExpectations(t)
+}
+
+func TestOrderSignalStatus(t *testing.T) {
+	assert.Equal(t, "pending", orderSignalStatus(models.OrderStatusNew, "0"))
+	assert.Equal(t, "partially_filled", orderSignalStatus(models.OrderStatusPartiallyFilled, "0.5"))
+	assert.Equal(t, "filled", orderSignalStatus(models.OrderStatusFilled, "1"))
+	assert.Equal(t, "partially_filled", orderSignalStatus(models.OrderStatusCanceled, "0.5"))
+	assert.Equal(t, "cancelled", orderSignalStatus(models.OrderStatusExpired, "0"))
+	assert.Equal(t, "failed", orderSignalStatus(models.OrderStatusRejected, "0"))
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Cyvadra/tv-forward/internal/models"
+)
+
+// SignalParser decodes webhook bodies of a third-party format into the canonical TradingView signal
+type SignalParser interface {
+	// Detect reports whether a body is in the parser's format. It is used to pick a parser when the
+	// webhook path names none.
+	Detect(body []byte) bool
+
+	// Parse decodes a body into a signal. Formats that only carry an order leave the position sizes
+	// empty; they are completed from the known position. Fields a format cannot carry, such as the
+	// api_sec, are taken from the query parameters of the webhook URL.
+	Parse(body []byte) (*models.TradingViewSignal, error)
+}
+
+// ParserRegistry holds all registered signal parsers by name
+var ParserRegistry = make(map[string]SignalParser)
+
+// RegisterParser registers a signal parser under the name used in the webhook path
+func RegisterParser(name string, parser SignalParser) {
+	ParserRegistry[name] = parser
+}
+
+// parseSignal decodes a webhook that is not a TradingView JSON signal with the parser named by the
+// execution, or with the first parser detecting the body. A named parser that fails rejects the
+// webhook; a detected one falls back to the legacy and plain-text handling.
+func (s *TradingService) parseSignal(exec *Execution) (*models.TradingViewSignal, error) {
+	parsers := s.parsers()
+	name := exec.Parser
+	if name == "" {
+		for _, candidate := range sortedParserNames(parsers) {
+			if parsers[candidate].Detect(exec.Body) {
+				name = candidate
+				break
+			}
+		}
+		if name == "" {
+			return nil, nil
+		}
+	}
+
+	parser, ok := parsers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown signal parser: %s", name)
+	}
+	signal, err := parser.Parse(exec.Body)
+	if err == nil {
+		applySignalQuery(signal, exec.RequestURL)
+		if signal.APISec == "" {
+			err = fmt.Errorf("no api_sec in the payload or the webhook URL")
+		}
+	}
+	if err != nil {
+		if exec.Parser == "" {
+			log.Printf("Body detected as %s could not be parsed: %v", name, err)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse %s signal: %w", name, err)
+	}
+
+	log.Printf("Parsed %s webhook for %s", name, signal.Symbol)
+	return signal, nil
+}
+
+// parsers returns the registered parsers together with the JSON mappings of the configuration,
+// which take precedence over registered parsers of the same name
+func (s *TradingService) parsers() map[string]SignalParser {
+	if s.config == nil || len(s.config.Parsers) == 0 {
+		return ParserRegistry
+	}
+
+	parsers := make(map[string]SignalParser, len(ParserRegistry)+len(s.config.Parsers))
+	for name, parser := range ParserRegistry {
+		parsers[name] = parser
+	}
+	for _, mapping := range s.config.Parsers {
+		parsers[mapping.Name] = &MappingParser{Match: mapping.Match, Fields: mapping.Fields}
+	}
+	return parsers
+}
+
+// sortedParserNames returns the parser names in the order they detect bodies
+func sortedParserNames(parsers map[string]SignalParser) []string {
+	names := make([]string, 0, len(parsers))
+	for name := range parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applySignalQuery fills the api_sec, exchange and strategy of a parsed signal from the query
+// parameters of the webhook URL when the payload has none. Without an exchange, the exchange of
+// the TradingView ticker is traded.
+func applySignalQuery(signal *models.TradingViewSignal, requestURL string) {
+	query := url.Values{}
+	if parsed, err := url.Parse(requestURL); err == nil {
+		query = parsed.Query()
+	}
+
+	if signal.APISec == "" {
+		signal.APISec = query.Get("api_sec")
+	}
+	if signal.ExchangeName == "" {
+		signal.ExchangeName = query.Get("exchange")
+	}
+	if signal.Strategy == "" {
+		signal.Strategy = query.Get("strategy")
+	}
+	if signal.ExchangeName == "" {
+		signal.ExchangeName = strings.ToLower(signal.Exchange)
+	}
+}
+
+// marketPosition returns the TradingView market position of a signed position size
+func marketPosition(size float64) string {
+	switch {
+	case size > positionEpsilon:
+		return "long"
+	case size < -positionEpsilon:
+		return "short"
+	}
+	return "flat"
+}
+
+// tickerPattern splits TradingView tickers such as BINANCE:BTCUSDT.P into exchange and symbol
+var tickerPattern = regexp.MustCompile(`^(?:([A-Za-z0-9_]+):)?([A-Za-z0-9_/-]+?)(?:\.P|\.PERP)?$`)
+
+// splitTicker returns the symbol and the lowercase exchange of a TradingView ticker
+func splitTicker(ticker string) (symbol, exchange string) {
+	ticker = strings.TrimSpace(ticker)
+	match := tickerPattern.FindStringSubmatch(ticker)
+	if match == nil {
+		return strings.ToUpper(ticker), ""
+	}
+	return strings.ToUpper(strings.ReplaceAll(match[2], "/", "")), strings.ToLower(match[1])
+}
+
+// flexString decodes JSON strings and numbers alike, as third-party formats send amounts as either
+type flexString string
+
+// UnmarshalJSON accepts a string, a number or null
+func (f *flexString) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*f = flexString(strings.TrimSpace(text))
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("expected a string or a number: %s", string(data))
+	}
+	*f = flexString(number.String())
+	return nil
+}
+
+// orderAmount parses a positive order amount
+func orderAmount(value string) (float64, error) {
+	amount, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || amount <= 0 {
+		return 0, fmt.Errorf("invalid amount: %q", value)
+	}
+	return amount, nil
+}
+
+// signedAmount parses a position size, negative for short positions
+func signedAmount(value string) (float64, error) {
+	amount, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid position size: %q", value)
+	}
+	return amount, nil
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Cyvadra/tv-forward/internal/models"
+)
+
+// threeCommasSignal is the custom signal payload of 3Commas signal bots
+type threeCommasSignal struct {
+	Secret       string     `json:"secret"`
+	MaxLag       flexString `json:"max_lag"`
+	Timestamp    string     `json:"timestamp"`
+	TriggerPrice flexString `json:"trigger_price"`
+	TVExchange   string     `json:"tv_exchange"`
+	TVInstrument string     `json:"tv_instrument"`
+	Action       string     `json:"action"`
+	BotUUID      string     `json:"bot_uuid"`
+	Order        *struct {
+		Amount       flexString `json:"amount"`
+		CurrencyType string     `json:"currency_type"`
+	} `json:"order"`
+}
+
+// ThreeCommasParser decodes 3Commas signal bot payloads. The secret is the api_sec and the bot is the
+// strategy. Entries are sized in the base currency, or in the quote currency at the trigger price;
+// exits close the position of their side.
+type ThreeCommasParser struct{}
+
+// Detect reports whether the body is a 3Commas signal
+func (p *ThreeCommasParser) Detect(body []byte) bool {
+	var payload threeCommasSignal
+	return json.Unmarshal(body, &payload) == nil && payload.BotUUID != "" && payload.Action != ""
+}
+
+// Parse decodes a 3Commas signal
+func (p *ThreeCommasParser) Parse(body []byte) (*models.TradingViewSignal, error) {
+	var payload threeCommasSignal
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid 3Commas payload: %w", err)
+	}
+
+	symbol, exchange := splitTicker(payload.TVInstrument)
+	if exchange == "" {
+		exchange = strings.ToLower(payload.TVExchange)
+	}
+	if symbol == "" {
+		return nil, fmt.Errorf("no tv_instrument")
+	}
+	signal := &models.TradingViewSignal{
+		Ticker:   payload.TVInstrument,
+		Exchange: exchange,
+		Symbol:   symbol,
+		Price:    string(payload.TriggerPrice),
+		TimeNow:  payload.Timestamp,
+		APISec:   payload.Secret,
+		Strategy: payload.BotUUID,
+	}
+
+	switch strings.ToLower(payload.Action) {
+	case "enter_long":
+		signal.Action = "buy"
+	case "enter_short":
+		signal.Action = "sell"
+	case "exit_long":
+		signal.MarketPosition = "flat"
+		signal.PrevMarketPosition = "long"
+		return signal, nil
+	case "exit_short":
+		signal.MarketPosition = "flat"
+		signal.PrevMarketPosition = "short"
+		return signal, nil
+	default:
+		return nil, fmt.Errorf("unsupported action: %s", payload.Action)
+	}
+
+	if payload.Order == nil {
+		return nil, fmt.Errorf("no order for %s", payload.Action)
+	}
+	amount, err := orderAmount(string(payload.Order.Amount))
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(payload.Order.CurrencyType) {
+	case "", "base":
+	case "quote":
+		price, err := orderAmount(signal.Price)
+		if err != nil {
+			return nil, fmt.Errorf("quote amounts need a trigger_price: %w", err)
+		}
+		amount /= price
+	default:
+		return nil, fmt.Errorf("unsupported currency_type: %s", payload.Order.CurrencyType)
+	}
+	signal.Contracts = formatNumber(amount)
+	return signal, nil
+}
+
+func init() {
+	RegisterParser("3commas", &ThreeCommasParser{})
+}
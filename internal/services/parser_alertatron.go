@@ -0,0 +1,115 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Cyvadra/tv-forward/internal/models"
+)
+
+var (
+	// alertatronPattern matches Alertatron alert messages: keys(SYMBOL) { command(arg=value, ...); ... } #bot
+	alertatronPattern = regexp.MustCompile(`(?s)^\s*([A-Za-z0-9_-]+)\s*\(\s*([^)\s]+)\s*\)\s*\{(.*)\}\s*(?:#\S+\s*)?$`)
+
+	// alertatronCommandPattern matches a single command of an Alertatron message
+	alertatronCommandPattern = regexp.MustCompile(`(?s)^\s*([A-Za-z]+)\s*\((.*)\)\s*$`)
+)
+
+// AlertatronParser decodes Alertatron alert messages. The name of the API keys is the api_sec. A
+// message carries exactly one trade: a market order with a side and an amount, a market order to a
+// target position, or exitPosition. Cancels and waits are ignored.
+type AlertatronParser struct{}
+
+// Detect reports whether the body is an Alertatron message
+func (p *AlertatronParser) Detect(body []byte) bool {
+	return alertatronPattern.Match(body)
+}
+
+// Parse decodes an Alertatron message
+func (p *AlertatronParser) Parse(body []byte) (*models.TradingViewSignal, error) {
+	match := alertatronPattern.FindStringSubmatch(string(body))
+	if match == nil {
+		return nil, fmt.Errorf("not an Alertatron message")
+	}
+
+	symbol, exchange := splitTicker(match[2])
+	signal := &models.TradingViewSignal{
+		Ticker:   match[2],
+		Exchange: exchange,
+		Symbol:   symbol,
+		APISec:   match[1],
+	}
+
+	trades := 0
+	for _, statement := range strings.Split(match[3], ";") {
+		if strings.TrimSpace(statement) == "" {
+			continue
+		}
+		command := alertatronCommandPattern.FindStringSubmatch(statement)
+		if command == nil {
+			return nil, fmt.Errorf("invalid command: %s", strings.TrimSpace(statement))
+		}
+		args := alertatronArgs(command[2])
+
+		switch command[1] {
+		case "cancel", "wait":
+			continue
+		case "market":
+			if err := alertatronMarket(signal, args); err != nil {
+				return nil, err
+			}
+		case "exitPosition":
+			signal.MarketPosition = "flat"
+		default:
+			return nil, fmt.Errorf("unsupported command: %s", command[1])
+		}
+		trades++
+	}
+	if trades != 1 {
+		return nil, fmt.Errorf("expected one trade command, got %d", trades)
+	}
+	return signal, nil
+}
+
+// alertatronMarket sets the order of a market command, given by a side and an amount or by a target
+// position
+func alertatronMarket(signal *models.TradingViewSignal, args map[string]string) error {
+	if position, ok := args["position"]; ok {
+		target, err := signedAmount(position)
+		if err != nil {
+			return err
+		}
+		signal.MarketPosition = marketPosition(target)
+		signal.MarketPositionSize = formatNumber(target)
+		return nil
+	}
+
+	side := strings.ToLower(args["side"])
+	if side != "buy" && side != "sell" {
+		return fmt.Errorf("invalid market side: %q", args["side"])
+	}
+	amount, err := orderAmount(args["amount"])
+	if err != nil {
+		return err
+	}
+	signal.Action = side
+	signal.Contracts = formatNumber(amount)
+	return nil
+}
+
+// alertatronArgs splits the arguments of a command into their names and values
+func alertatronArgs(text string) map[string]string {
+	args := make(map[string]string)
+	for _, arg := range strings.Split(text, ",") {
+		name, value, ok := strings.Cut(arg, "=")
+		if ok {
+			args[strings.TrimSpace(name)] = strings.Trim(strings.TrimSpace(value), `"'`)
+		}
+	}
+	return args
+}
+
+func init() {
+	RegisterParser("alertatron", &AlertatronParser{})
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Cyvadra/tv-forward/internal/models"
+)
+
+// jsonPathStep matches one step of the JSONPath subset mappings use: .key, ['key'], ["key"] or [n]
+var jsonPathStep = regexp.MustCompile(`^(?:\.([^.\[]+)|\[\s*'([^']*)'\s*\]|\[\s*"([^"]*)"\s*\]|\[\s*([0-9]+)\s*\])`)
+
+// MappingParser decodes JSON payloads of any format with a user-defined mapping. Fields maps the JSON
+// names of the canonical signal, such as "symbol" or "market_position_size", to a JSONPath into the
+// payload, like $.order.side; values not starting with $ are taken literally. A mapping detects the
+// payloads whose values at the paths of Match equal the given values, and none when Match is empty.
+type MappingParser struct {
+	Match  map[string]string
+	Fields map[string]string
+}
+
+// Detect reports whether the body matches all values of the mapping
+func (p *MappingParser) Detect(body []byte) bool {
+	if len(p.Match) == 0 {
+		return false
+	}
+	document, err := decodeJSON(body)
+	if err != nil {
+		return false
+	}
+	for path, expected := range p.Match {
+		value, err := jsonPath(document, path)
+		if err != nil || jsonText(value) != expected {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse maps a JSON body to a signal
+func (p *MappingParser) Parse(body []byte) (*models.TradingViewSignal, error) {
+	document, err := decodeJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON payload: %w", err)
+	}
+
+	names := make([]string, 0, len(p.Fields))
+	for name := range p.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	signal := &models.TradingViewSignal{}
+	for _, name := range names {
+		value := p.Fields[name]
+		if strings.HasPrefix(value, "$") {
+			found, err := jsonPath(document, value)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", name, err)
+			}
+			value = jsonText(found)
+		}
+		if err := setSignalField(signal, name, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if signal.Symbol == "" && signal.Ticker != "" {
+		signal.Symbol, signal.Exchange = splitTicker(signal.Ticker)
+	}
+	return signal, nil
+}
+
+// decodeJSON decodes a JSON document keeping numbers as written
+func decodeJSON(body []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// jsonPath returns the value at a path of the JSONPath subset $, .key, ['key'] and [n]
+func jsonPath(document interface{}, path string) (interface{}, error) {
+	rest := strings.TrimSpace(path)
+	if !strings.HasPrefix(rest, "$") {
+		return nil, fmt.Errorf("path must start with $: %s", path)
+	}
+	rest = rest[1:]
+
+	value := document
+	for rest != "" {
+		step := jsonPathStep.FindStringSubmatch(rest)
+		if step == nil {
+			return nil, fmt.Errorf("invalid path: %s", path)
+		}
+		rest = rest[len(step[0]):]
+
+		if step[4] != "" {
+			index, _ := strconv.Atoi(step[4])
+			list, ok := value.([]interface{})
+			if !ok || index >= len(list) {
+				return nil, fmt.Errorf("no value at %s", path)
+			}
+			value = list[index]
+			continue
+		}
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("no value at %s", path)
+		}
+		if value, ok = object[step[1]+step[2]+step[3]]; !ok {
+			return nil, fmt.Errorf("no value at %s", path)
+		}
+	}
+	return value, nil
+}
+
+// jsonText returns a JSON value as the text signals carry it: strings and numbers as written,
+// other values as JSON
+func jsonText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	text, _ := json.Marshal(value)
+	return string(text)
+}
+
+// setSignalField sets the field of a signal with the given JSON name
+func setSignalField(signal *models.TradingViewSignal, name, value string) error {
+	fields := reflect.ValueOf(signal).Elem()
+	for i := 0; i < fields.NumField(); i++ {
+		tag := strings.Split(fields.Type().Field(i).Tag.Get("json"), ",")[0]
+		if tag != name || tag == "-" {
+			continue
+		}
+
+		field := fields.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Int:
+			if value == "" {
+				return nil
+			}
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("field %s: invalid number: %q", name, value)
+			}
+			field.SetInt(int64(number))
+		default:
+			return fmt.Errorf("field %s cannot be mapped", name)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown signal field: %s", name)
+}
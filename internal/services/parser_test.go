@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of the parser tests")
+
+// testMappingParser is the configured mapping the golden files of testdata/parsers/mapping use
+var testMappingParser = &MappingParser{
+	Match: map[string]string{"$.source": "screener"},
+	Fields: map[string]string{
+		"api_sec":              "$.auth['key']",
+		"ticker":               "$.instrument.ticker",
+		"action":               "$.orders[0].side",
+		"contracts":            "$.orders[0].qty",
+		"price":                "$.orders[0].price",
+		"ord_type":             "limit",
+		"lever":                "$.leverage",
+		"market_position_size": "$.target",
+	},
+}
+
+// TestParsersGolden decodes every testdata/parsers/<parser>/<case>.input with its parser and compares
+// whether it was detected and the signal or error with <case>.golden. Run with -update to rewrite
+// the golden files.
+func TestParsersGolden(t *testing.T) {
+	parsers := map[string]SignalParser{"mapping": testMappingParser}
+	for name, parser := range ParserRegistry {
+		parsers[name] = parser
+	}
+
+	inputs, err := filepath.Glob(filepath.Join("testdata", "parsers", "*", "*.input"))
+	require.NoError(t, err)
+	require.NotEmpty(t, inputs)
+
+	tested := make(map[string]bool)
+	for _, input := range inputs {
+		name := filepath.Base(filepath.Dir(input))
+		tested[name] = true
+		t.Run(name+"/"+strings.TrimSuffix(filepath.Base(input), ".input"), func(t *testing.T) {
+			parser, ok := parsers[name]
+			require.True(t, ok, "no parser %s", name)
+			body, err := os.ReadFile(input)
+			require.NoError(t, err)
+
+			result := map[string]interface{}{"detected": parser.Detect(body)}
+			if signal, err := parser.Parse(body); err != nil {
+				result["error"] = err.Error()
+			} else {
+				result["signal"] = signalFields(t, signal)
+			}
+			actual, err := json.MarshalIndent(result, "", "  ")
+			require.NoError(t, err)
+			actual = append(actual, '\n')
+
+			golden := strings.TrimSuffix(input, ".input") + ".golden"
+			if *updateGolden {
+				require.NoError(t, os.WriteFile(golden, actual, 0o644))
+			}
+			expected, err := os.ReadFile(golden)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), string(actual))
+		})
+	}
+
+	for name := range parsers {
+		assert.True(t, tested[name], "no golden files for parser %s", name)
+	}
+}
+
+// signalFields returns the fields of a signal that are set, by their JSON names
+func signalFields(t *testing.T, signal *models.TradingViewSignal) map[string]interface{} {
+	data, err := json.Marshal(signal)
+	require.NoError(t, err)
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &fields))
+	for name, value := range fields {
+		if value == "" || value == float64(0) {
+			delete(fields, name)
+		}
+	}
+	return fields
+}
+
+func TestParserDetection(t *testing.T) {
+	service := &TradingService{config: &config.Config{Parsers: []config.ParserConfig{{
+		Name:   "screener",
+		Match:  testMappingParser.Match,
+		Fields: testMappingParser.Fields,
+	}}}}
+
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{`order buy @ 1 filled on BTCUSDT`, "tradingview_text"},
+		{`keys(BTCUSDT) { market(side=buy, amount=1); }`, "alertatron"},
+		{`{"secret":"s","bot_uuid":"b","action":"exit_long","tv_instrument":"BTCUSDT"}`, "3commas"},
+		{`{"code":"EXIT-ALL_BINANCE_BTCUSDT_BOT"}`, "wundertrading"},
+		{`{"source":"screener"}`, "screener"},
+		{`{"strategy":"legacy","action":"buy","symbol":"BTCUSDT"}`, ""},
+		{`plain text alert`, ""},
+	}
+	for _, tt := range tests {
+		detected := ""
+		parsers := service.parsers()
+		for _, name := range sortedParserNames(parsers) {
+			if parsers[name].Detect([]byte(tt.body)) {
+				detected = name
+				break
+			}
+		}
+		assert.Equal(t, tt.expected, detected, tt.body)
+	}
+}
+
+func TestPipelineParsedSignals(t *testing.T) {
+	db := newTestDB(t)
+	pool, _ := newTestPool(t, db)
+	service := newTestTradingService(t, db, pool)
+	execute := func(body, parser string) *Execution {
+		t.Helper()
+		// Bitget has no registered broker, so the completed signals are recorded without trading
+		execution := &Execution{Body: []byte(body), RequestURL: "/api/v1/webhook/" + parser + "?api_sec=user_1&exchange=bitget", Parser: parser}
+		require.NoError(t, service.Execute(context.Background(), execution))
+		require.NotNil(t, execution.Signal)
+		return execution
+	}
+
+	// A text message without the strategy position opens a position from the flat one
+	execution := execute("order buy @ 0.5 filled on BINANCE:BTCUSDT.P", "tradingview_text")
+	assert.Equal(t, "bitget", execution.Record.Exchange)
+	assert.Equal(t, "BTCUSDT", execution.Record.Symbol)
+	assert.Equal(t, "0", execution.Record.PrevMarketPositionSize)
+	assert.Equal(t, "0.5", execution.Record.MarketPositionSize)
+	assert.Equal(t, "long", execution.Record.MarketPosition)
+
+	// The stored alert keeps the original body and carries the canonical signal alongside
+	assert.Equal(t, "order buy @ 0.5 filled on BINANCE:BTCUSDT.P", execution.Alert.RawPayload)
+	var stored models.TradingViewSignal
+	require.NoError(t, json.Unmarshal([]byte(execution.Alert.SignalPayload), &stored))
+	assert.Equal(t, "user_1", stored.APISec)
+	assert.Equal(t, "BTCUSDT", stored.Symbol)
+
+	// A detected sell is added to the known position
+	require.NoError(t, db.Create(&models.Position{UserID: execution.User.ID, Symbol: "BTCUSDT", Exchange: "bitget", Side: "long", Size: "0.5", IsActive: true}).Error)
+	execution = execute("user_1(BINANCE:BTCUSDT) { cancel(which=all); market(side=sell, amount=2); }", "")
+	assert.Equal(t, "0.5", execution.Record.PrevMarketPositionSize)
+	assert.Equal(t, "-1.5", execution.Record.MarketPositionSize)
+	assert.Equal(t, "short", execution.Record.MarketPosition)
+
+	// Exits of the other side leave the position alone
+	exitLong := `{"secret":"user_1","bot_uuid":"bot","action":"exit_long","tv_exchange":"BINANCE","tv_instrument":"BTCUSDT"}`
+	execution = execute(exitLong, "3commas")
+	assert.Equal(t, "0.5", execution.Record.PrevMarketPositionSize)
+	assert.Equal(t, "0", execution.Record.MarketPositionSize)
+	assert.Equal(t, "sell", execution.Record.Action)
+
+	// A stored short starts from the negative size
+	require.NoError(t, db.Model(&models.Position{}).Where("user_id = ?", execution.User.ID).Updates(map[string]interface{}{"side": "short", "size": "2"}).Error)
+	execution = execute(exitLong, "3commas")
+	assert.Equal(t, "-2", execution.Record.PrevMarketPositionSize)
+	assert.Equal(t, "-2", execution.Record.MarketPositionSize)
+
+	execution = execute("user_1(BINANCE:BTCUSDT) { market(side=sell, amount=1); }", "")
+	assert.Equal(t, "-2", execution.Record.PrevMarketPositionSize)
+	assert.Equal(t, "-3", execution.Record.MarketPositionSize)
+	assert.Equal(t, "short", execution.Record.PrevMarketPosition)
+
+	exitShort := `{"secret":"user_1","bot_uuid":"bot","action":"exit_short","tv_exchange":"BINANCE","tv_instrument":"BTCUSDT"}`
+	execution = execute(exitShort, "3commas")
+	assert.Equal(t, "-2", execution.Record.PrevMarketPositionSize)
+	assert.Equal(t, "0", execution.Record.MarketPositionSize)
+	assert.Equal(t, "buy", execution.Record.Action)
+
+	// A named parser that cannot decode the body rejects the webhook
+	execution = &Execution{Body: []byte(`{"code":"HOLD"}`), Parser: "wundertrading"}
+	assert.ErrorContains(t, service.Execute(context.Background(), execution), "failed to parse wundertrading signal")
+	execution = &Execution{Body: []byte(`order buy @ 1 filled on BTCUSDT`), Parser: "unknown"}
+	assert.ErrorContains(t, service.Execute(context.Background(), execution), "unknown signal parser")
+}
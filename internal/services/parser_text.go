@@ -0,0 +1,65 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Cyvadra/tv-forward/internal/models"
+)
+
+// strategyMessagePattern matches the default order fill message of TradingView strategies:
+// "order {{strategy.order.action}} @ {{strategy.order.contracts}} filled on {{ticker}}. New strategy position is {{strategy.position_size}}"
+var strategyMessagePattern = regexp.MustCompile(`(?is)^\s*order\s+(buy|sell)\s+@\s+([0-9]*\.?[0-9]+)\s+filled\s+on\s+(\S+?)\.?(?:\s+new\s+strategy\s+position\s+is\s+(-?[0-9]*\.?[0-9]+))?\s*\.?\s*$`)
+
+// StrategyMessageParser decodes the plain-text order fill messages of TradingView strategies. With
+// the new strategy position the signal moves the position to it, otherwise the order is added to
+// the known position.
+type StrategyMessageParser struct{}
+
+// Detect reports whether the body is a strategy order fill message
+func (p *StrategyMessageParser) Detect(body []byte) bool {
+	return strategyMessagePattern.Match(body)
+}
+
+// Parse decodes a strategy order fill message
+func (p *StrategyMessageParser) Parse(body []byte) (*models.TradingViewSignal, error) {
+	match := strategyMessagePattern.FindStringSubmatch(string(body))
+	if match == nil {
+		return nil, fmt.Errorf("not a strategy order message")
+	}
+
+	contracts, err := orderAmount(match[2])
+	if err != nil {
+		return nil, err
+	}
+	symbol, exchange := splitTicker(match[3])
+	signal := &models.TradingViewSignal{
+		Ticker:    match[3],
+		Exchange:  exchange,
+		Symbol:    symbol,
+		Action:    strings.ToLower(match[1]),
+		Contracts: formatNumber(contracts),
+	}
+
+	if match[4] != "" {
+		position, err := signedAmount(match[4])
+		if err != nil {
+			return nil, err
+		}
+		previous := position - contracts
+		if signal.Action == "sell" {
+			previous = position + contracts
+		}
+		signal.PositionSize = formatNumber(position)
+		signal.MarketPosition = marketPosition(position)
+		signal.MarketPositionSize = formatNumber(position)
+		signal.PrevMarketPosition = marketPosition(previous)
+		signal.PrevMarketPositionSize = formatNumber(previous)
+	}
+	return signal, nil
+}
+
+func init() {
+	RegisterParser("tradingview_text", &StrategyMessageParser{})
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Cyvadra/tv-forward/internal/models"
+)
+
+// wunderTradingCodePattern matches the signal codes of WunderTrading bots:
+// ENTER-LONG_BINANCE-FUTURES_BTCUSDT_MY-BOT_1H_1a2b3c
+var wunderTradingCodePattern = regexp.MustCompile(`^(ENTER|EXIT)-(LONG|SHORT|ALL)_([A-Za-z0-9]+)(?:-[A-Za-z0-9]+)?_([A-Za-z0-9/-]+)_([^_]+)(?:_.*)?$`)
+
+// wunderTradingSignal is the JSON payload of WunderTrading signal bots
+type wunderTradingSignal struct {
+	Code               string     `json:"code"`
+	OrderType          string     `json:"orderType"`
+	LimitPrice         flexString `json:"limitPrice"`
+	AmountPerTradeType string     `json:"amountPerTradeType"`
+	AmountPerTrade     flexString `json:"amountPerTrade"`
+	Leverage           int        `json:"leverage"`
+}
+
+// WunderTradingParser decodes WunderTrading signal bot payloads. The bot named in the code is the
+// strategy; the api_sec comes from the webhook URL. Entries are sized in contracts, exits close the
+// position of their side or, for EXIT-ALL, any position.
+type WunderTradingParser struct{}
+
+// Detect reports whether the body is a WunderTrading signal
+func (p *WunderTradingParser) Detect(body []byte) bool {
+	var payload wunderTradingSignal
+	return json.Unmarshal(body, &payload) == nil && wunderTradingCodePattern.MatchString(payload.Code)
+}
+
+// Parse decodes a WunderTrading signal
+func (p *WunderTradingParser) Parse(body []byte) (*models.TradingViewSignal, error) {
+	var payload wunderTradingSignal
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid WunderTrading payload: %w", err)
+	}
+	code := wunderTradingCodePattern.FindStringSubmatch(payload.Code)
+	if code == nil {
+		return nil, fmt.Errorf("invalid signal code: %q", payload.Code)
+	}
+
+	symbol, _ := splitTicker(code[4])
+	signal := &models.TradingViewSignal{
+		Ticker:   code[4],
+		Exchange: strings.ToLower(code[3]),
+		Symbol:   symbol,
+		Leverage: payload.Leverage,
+		Strategy: code[5],
+	}
+
+	if code[1] == "EXIT" {
+		signal.MarketPosition = "flat"
+		if code[2] != "ALL" {
+			signal.PrevMarketPosition = strings.ToLower(code[2])
+		}
+		return signal, nil
+	}
+	switch code[2] {
+	case "LONG":
+		signal.Action = "buy"
+	case "SHORT":
+		signal.Action = "sell"
+	default:
+		return nil, fmt.Errorf("invalid signal code: %q", payload.Code)
+	}
+
+	if payload.AmountPerTradeType != "" && !strings.EqualFold(payload.AmountPerTradeType, "contracts") {
+		return nil, fmt.Errorf("unsupported amountPerTradeType: %s", payload.AmountPerTradeType)
+	}
+	amount, err := orderAmount(string(payload.AmountPerTrade))
+	if err != nil {
+		return nil, err
+	}
+	signal.Contracts = formatNumber(amount)
+
+	switch strings.ToLower(payload.OrderType) {
+	case "", "market":
+	case "limit":
+		if _, err := orderAmount(string(payload.LimitPrice)); err != nil {
+			return nil, fmt.Errorf("limit orders need a limitPrice: %w", err)
+		}
+		signal.OrderType = "limit"
+		signal.Price = string(payload.LimitPrice)
+	default:
+		return nil, fmt.Errorf("unsupported orderType: %s", payload.OrderType)
+	}
+	return signal, nil
+}
+
+func init() {
+	RegisterParser("wundertrading", &WunderTradingParser{})
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/models"
+)
+
+// Stages of the execution pipeline, in the order they run
+const (
+	StageParse    = "parse"    // Decodes the webhook body and stores the alert
+	StageValidate = "validate" // Resolves the strategy and the user and checks the signal against the known position
+	StageRisk     = "risk"     // Rejects signals of paused users, disabled strategies and signals exceeding the risk limits
+	StageSize     = "size"     // Calculates the order that moves the position to its target
+	StageRoute    = "route"    // Takes ready clients of the registered brokers, or none for accounts in shadow mode
+	StageExecute  = "execute"  // Places the order, or only prepares it in shadow mode
+	StageTrack    = "track"    // Stores the execution, updates the position and follows open orders
+	StageNotify   = "notify"   // Updates the alert and forwards it downstream
+)
+
+// Modes of batch webhooks
+const (
+	BatchModeBestEffort   = "best_effort"    // Every order is placed; failed orders do not affect the others
+	BatchModeAllOrNothing = "all_or_nothing" // No order is placed unless all pass, and the batch stops at the first failed placement
+)
+
+// TradingViewAlert represents the structure of a legacy TradingView webhook alert
+type TradingViewAlert struct {
+	Strategy string  `json:"strategy"`
+	Symbol   string  `json:"symbol"`
+	Action   string  `json:"action"`
+	Price    float64 `json:"price"`
+	Quantity float64 `json:"quantity"`
+	Message  string  `json:"message"`
+	// Additional fields that might be present
+	Exchange string `json:"exchange,omitempty"`
+	Time     string `json:"time,omitempty"`
+}
+
+// Execution carries one webhook through the execution pipeline
+type Execution struct {
+	Body       []byte
+	RequestURL string
+	ReceivedAt time.Time
+	Parser     string // Signal parser named by the webhook path, detected from the body when empty
+
+	Alert    *models.Alert             // Stored record of the webhook
+	Signal   *models.TradingViewSignal // Set for signals in the TradingView strategy format; may be given instead of a body
+	Legacy   *TradingViewAlert         // Set for legacy alerts, traded with the credentials of the configuration
+	User     *models.User              // Owner of a TradingView signal
+	Strategy *models.Strategy          // Strategy that sent the trade, nil when it names none
+	Record   *models.TradingSignal     // Execution record, nil when the webhook does not trade
+	Order    *broker.OrderRequest      // Order to place, nil when the position does not change
+	Routes   []*Route                  // Brokers the order is offered to in turn until one accepts it
+	Result   *broker.Order             // Latest state of the placed order
+
+	Shadow      bool                // The account is in shadow mode: the order is stored instead of placed
+	ShadowOrder *models.ShadowOrder // Order prepared for the exchange in shadow mode
+
+	Batch *Batch // Set on a webhook carrying several orders and on each of its orders
+}
+
+// Batch holds the orders of a webhook carrying several signals. They share the alert of the webhook
+// and run through the pipeline one stage at a time, in the order they are listed.
+type Batch struct {
+	Mode  string       // BatchModeBestEffort or BatchModeAllOrNothing
+	Items []*Execution // One execution per order
+}
+
+// Route is a ready broker client an order can be placed on
+type Route struct {
+	Exchange string
+	Client   broker.Broker
+	Release  func() // Hands the client back once the execution is done
+}
+
+// Trades reports whether the webhook carries a trade
+func (e *Execution) Trades() bool {
+	return e.Record != nil
+}
+
+// Failed reports whether the trade failed
+func (e *Execution) Failed() bool {
+	return e.Record != nil && e.Record.Status == "failed"
+}
+
+// Executions returns the executions of the orders of a batch, or the execution itself
+func (e *Execution) Executions() []*Execution {
+	if e.Batch != nil {
+		return e.Batch.Items
+	}
+	return []*Execution{e}
+}
+
+// Fail records why the trade could not be executed. The signal is still stored and notified,
+// but the remaining trading stages are skipped.
+func (e *Execution) Fail(err error) {
+	e.Record.Status = "failed"
+	e.Record.ErrorCode = brokerErrorCode(err)
+	e.Record.ErrorMessage = err.Error()
+
+	var violation *RiskViolation
+	if errors.As(err, &violation) {
+		e.Record.ErrorCode = "RISK_REJECTED"
+		e.Record.RiskRule = violation.Rule
+	}
+}
+
+// PipelineStage is a named step of the execution pipeline
+type PipelineStage struct {
+	Name string
+	Run  func(ctx context.Context, exec *Execution) error
+
+	// RunBatch runs the stage for all orders of a batch at once. Without it, Run runs for each
+	// order in turn.
+	RunBatch func(ctx context.Context, batch *Batch) error
+}
+
+// Pipeline runs webhooks through a sequence of stages. A stage returning an error rejects the
+// webhook and skips the remaining stages; failures to trade are recorded with Execution.Fail instead.
+type Pipeline struct {
+	mu     sync.RWMutex
+	stages []PipelineStage
+}
+
+// NewPipeline creates a pipeline running the given stages in order
+func NewPipeline(stages ...PipelineStage) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+// Stages returns the names of the stages in the order they run
+func (p *Pipeline) Stages() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	names := make([]string, len(p.stages))
+	for i, stage := range p.stages {
+		names[i] = stage.Name
+	}
+	return names
+}
+
+// SetStage replaces the stage with the same name
+func (p *Pipeline) SetStage(stage PipelineStage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	index := p.indexOf(stage.Name)
+	if index < 0 {
+		return fmt.Errorf("unknown pipeline stage: %s", stage.Name)
+	}
+	p.stages[index] = stage
+	return nil
+}
+
+// InsertBefore adds a stage that runs right before the named stage
+func (p *Pipeline) InsertBefore(name string, stage PipelineStage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.indexOf(stage.Name) >= 0 {
+		return fmt.Errorf("pipeline stage %s already exists", stage.Name)
+	}
+	index := p.indexOf(name)
+	if index < 0 {
+		return fmt.Errorf("unknown pipeline stage: %s", name)
+	}
+
+	stages := make([]PipelineStage, 0, len(p.stages)+1)
+	stages = append(stages, p.stages[:index]...)
+	stages = append(stages, stage)
+	p.stages = append(stages, p.stages[index:]...)
+	return nil
+}
+
+// Run passes a webhook through every stage and releases the routed brokers when done. Once a stage
+// turns the webhook into a batch, the remaining stages run for all of its orders before the next
+// stage starts.
+func (p *Pipeline) Run(ctx context.Context, exec *Execution) error {
+	p.mu.RLock()
+	stages := append([]PipelineStage(nil), p.stages...)
+	p.mu.RUnlock()
+
+	return p.runStages(ctx, stages, exec)
+}
+
+// RunThrough passes a webhook through the stages up to and including the named one and returns a
+// function running the remaining stages, such as in the background once the webhook is stored.
+func (p *Pipeline) RunThrough(ctx context.Context, exec *Execution, name string) (func(ctx context.Context) error, error) {
+	p.mu.RLock()
+	index := p.indexOf(name)
+	stages := append([]PipelineStage(nil), p.stages...)
+	p.mu.RUnlock()
+
+	if index < 0 {
+		return nil, fmt.Errorf("unknown pipeline stage: %s", name)
+	}
+	if err := p.runStages(ctx, stages[:index+1], exec); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		return p.runStages(ctx, stages[index+1:], exec)
+	}, nil
+}
+
+// runStages passes a webhook through the given stages and releases the routed brokers when done
+func (p *Pipeline) runStages(ctx context.Context, stages []PipelineStage, exec *Execution) error {
+	defer func() {
+		executions := []*Execution{exec}
+		if exec.Batch != nil {
+			executions = append(executions, exec.Batch.Items...)
+		}
+		for _, execution := range executions {
+			for _, route := range execution.Routes {
+				if route.Release != nil {
+					route.Release()
+				}
+			}
+		}
+	}()
+
+	for _, stage := range stages {
+		if err := p.runStage(ctx, stage, exec); err != nil {
+			return fmt.Errorf("%s: %w", stage.Name, err)
+		}
+	}
+	return nil
+}
+
+// runStage runs a stage for a webhook, or for every order once it is a batch
+func (p *Pipeline) runStage(ctx context.Context, stage PipelineStage, exec *Execution) error {
+	if exec.Batch == nil {
+		return stage.Run(ctx, exec)
+	}
+	if stage.RunBatch != nil {
+		return stage.RunBatch(ctx, exec.Batch)
+	}
+	for i, item := range exec.Batch.Items {
+		if err := stage.Run(ctx, item); err != nil {
+			return fmt.Errorf("order %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// indexOf returns the position of a stage, -1 when it does not exist
+func (p *Pipeline) indexOf(name string) int {
+	for i, stage := range p.stages {
+		if stage.Name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	_ "github.com/Cyvadra/tv-forward/broker/binance"
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newTestTradingService creates a trading service with the default pipeline, taking brokers from the pool
+func newTestTradingService(t *testing.T, db *gorm.DB, pool *BrokerPool) *TradingService {
+	t.Helper()
+
+	cfg := &config.Config{}
+	userService := &UserService{db: db}
+	service := &TradingService{
+		db:          db,
+		config:      cfg,
+		userService: userService,
+		riskEngine:  &RiskEngine{db: db, config: cfg, userService: userService},
+		brokerPool:  pool,
+		metrics:     NewLatencyMetrics(),
+	}
+	service.pipeline = service.newPipeline()
+	return service
+}
+
+func TestPipelineTracksOpenOrders(t *testing.T) {
+	db := newTestDB(t)
+	pool, created := newTestPool(t, db)
+	newTestCredential(t, db, 1, "secret")
+	service := newTestTradingService(t, db, pool)
+
+	// Warm the pool so the mock can expect the order
+	_, release, err := pool.Get(context.Background(), 1, "binance")
+	require.NoError(t, err)
+	release()
+	client := (*created)[0]
+	tracker, _ := newTestTracker(t, db, client, 0)
+	service.SetOrderTracker(tracker)
+
+	placed := &broker.Order{ID: "7", Symbol: "ETHUSDT", Type: broker.OrderTypeLimit, Status: broker.OrderStatusNew, ExecutedQuantity: "0"}
+	client.On("PlaceOrder", mock.Anything, mock.MatchedBy(func(req *broker.OrderRequest) bool {
+		return req.Symbol == "ETHUSDT" && req.Type == broker.OrderTypeLimit && req.Quantity == "0.50000000"
+	})).Return(placed, nil).Once()
+	client.On("GetOrder", mock.Anything, "ETHUSDT", "7").Return(placed, nil).Once()
+
+	execution := &Execution{Body: []byte(`{"api_sec":"secret","id":"s1","symbol":"ethusdt","exchange":"Binance","action":"buy","price":"3000","ord_type":"limit","prev_market_position_size":"0","market_position_size":"0.5"}`)}
+	require.NoError(t, service.Execute(context.Background(), execution))
+	client.AssertExpectations(t)
+
+	// The signal is stored with its alert and waits for the order to fill
+	assert.Equal(t, "pending", execution.Record.Status)
+	assert.Equal(t, "binance", execution.Record.Exchange)
+	assert.Equal(t, execution.Alert.ID, execution.Record.AlertID)
+
+	var alert models.Alert
+	require.NoError(t, db.First(&alert, execution.Alert.ID).Error)
+	assert.Equal(t, "processed", alert.Status)
+	assert.Equal(t, "trading_signal", alert.Strategy)
+
+	var order models.Order
+	require.NoError(t, db.First(&order).Error)
+	assert.Equal(t, execution.Record.ID, order.TradingSignalID)
+	assert.Equal(t, "7", order.ExchangeOrderID)
+}
+
+func TestPipelineRecordsFailedTrades(t *testing.T) {
+	db := newTestDB(t)
+	pool, _ := newTestPool(t, db)
+	service := newTestTradingService(t, db, pool)
+
+	// Exchanges without a registered broker cannot be traded
+	execution := &Execution{Body: []byte(`{"api_sec":"secret","symbol":"BTCUSDT","exchange":"bitget","action":"buy","prev_market_position_size":"0","market_position_size":"1"}`)}
+	require.NoError(t, service.Execute(context.Background(), execution))
+	assert.Equal(t, "failed", execution.Record.Status)
+	assert.Contains(t, execution.Record.ErrorMessage, "unsupported exchange: bitget")
+	assert.Equal(t, "processed", execution.Alert.Status)
+
+	// Legacy alerts are traded on the configured exchanges only
+	legacy := &Execution{Body: []byte(`{"strategy":"grid","symbol":"BTCUSDT","action":"buy","quantity":0.1}`)}
+	require.NoError(t, service.Execute(context.Background(), legacy))
+	require.NotNil(t, legacy.Legacy)
+	assert.Equal(t, "failed", legacy.Record.Status)
+	assert.Contains(t, legacy.Record.ErrorMessage, "no active trading platform")
+	assert.Equal(t, "failed", legacy.Alert.Status)
+
+	// Plain-text messages do not trade
+	text := &Execution{Body: []byte("BTC crossed 100k")}
+	require.NoError(t, service.Execute(context.Background(), text))
+	assert.Nil(t, text.Record)
+	assert.Equal(t, "alert", text.Alert.Strategy)
+	assert.Equal(t, "processed", text.Alert.Status)
+
+	var count int64
+	db.Model(&models.TradingSignal{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestTradingServiceAcceptsLegacyAlertsInBackground(t *testing.T) {
+	db := newTestDB(t)
+	pool, _ := newTestPool(t, db)
+	service := newTestTradingService(t, db, pool)
+
+	// Legacy alerts are stored first and traded once resumed
+	legacy := &Execution{Body: []byte(`{"strategy":"grid","symbol":"BTCUSDT","action":"buy","quantity":0.1}`)}
+	resume, err := service.Accept(context.Background(), legacy)
+	require.NoError(t, err)
+	require.NotNil(t, resume)
+	assert.NotZero(t, legacy.Alert.ID)
+	assert.Equal(t, "received", legacy.Alert.Status)
+	assert.Equal(t, "pending", legacy.Record.Status)
+
+	resume()
+	assert.Equal(t, "failed", legacy.Record.Status)
+	var alert models.Alert
+	require.NoError(t, db.First(&alert, legacy.Alert.ID).Error)
+	assert.Equal(t, "failed", alert.Status)
+
+	// Plain-text messages are forwarded in the background as well
+	text := &Execution{Body: []byte("BTC crossed 100k")}
+	resume, err = service.Accept(context.Background(), text)
+	require.NoError(t, err)
+	require.NotNil(t, resume)
+	resume()
+	assert.Equal(t, "processed", text.Alert.Status)
+
+	// Signals are executed before their sender is answered
+	signal := &Execution{Body: []byte(`{"api_sec":"secret","symbol":"BTCUSDT","exchange":"bitget","action":"buy","prev_market_position_size":"0","market_position_size":"1"}`)}
+	resume, err = service.Accept(context.Background(), signal)
+	require.NoError(t, err)
+	assert.Nil(t, resume)
+	assert.Equal(t, "failed", signal.Record.Status)
+	assert.Equal(t, "processed", signal.Alert.Status)
+}
+
+func TestPipelineRoundsOrdersToFilters(t *testing.T) {
+	db := newTestDB(t)
+	pool, created := newTestPool(t, db)
+	market := new(MockBroker)
+	market.On("GetSymbolInfo", mock.Anything, "BTCUSDT").Return(&broker.SymbolInfo{Symbol: "BTCUSDT", StepSize: "0.00100000", TickSize: "0.10"}, nil).Once()
+	pool.market = func(exchange string) (broker.Broker, error) { return market, nil }
+	newTestCredential(t, db, 1, "secret")
+	service := newTestTradingService(t, db, pool)
+	service.userService.SetUserConfig(&config.UserConfig{Users: []config.UserConfigEntry{{
+		APISec:      "follower",
+		Name:        "Follower",
+		IsActive:    true,
+		Credentials: []config.UserCredentialConfig{{Exchange: "binance", IsActive: true, Shadow: true}},
+	}}})
+
+	_, release, err := pool.Get(context.Background(), 1, "binance")
+	require.NoError(t, err)
+	release()
+	client := (*created)[0]
+
+	// The quantity is rounded down to the step size and the price to the nearest tick
+	client.On("PlaceOrder", mock.Anything, mock.MatchedBy(func(req *broker.OrderRequest) bool {
+		return req.Quantity == "0.123" && req.Price == "50000.1"
+	})).Return(&broker.Order{ID: "1", Symbol: "BTCUSDT", Status: broker.OrderStatusFilled, ExecutedQuantity: "0.123", AvgPrice: "50000.1"}, nil).Once()
+	body := `{"api_sec":"%s","symbol":"BTCUSDT","exchange":"binance","action":"buy","ord_type":"limit","price":"50000.06","prev_market_position_size":"0","market_position_size":"%s"}`
+	live := &Execution{Body: []byte(fmt.Sprintf(body, "secret", "0.12345"))}
+	require.NoError(t, service.Execute(context.Background(), live))
+	assert.Equal(t, "filled", live.Record.Status)
+
+	// The target and the booked position are the ones the rounded order reaches
+	assert.Equal(t, "0.123", live.Record.MarketPositionSize)
+	assert.Equal(t, "long", live.Record.MarketPosition)
+	positions, err := service.userService.GetUserPositions(live.User.ID)
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	assert.Equal(t, "0.123", positions[0].Size)
+
+	// Shadow orders are stored as they would have been sent
+	shadow := &Execution{Body: []byte(fmt.Sprintf(body, "follower", "0.12345"))}
+	require.NoError(t, service.Execute(context.Background(), shadow))
+	require.NotNil(t, shadow.ShadowOrder)
+	assert.Equal(t, "0.123", shadow.ShadowOrder.Quantity)
+	assert.Equal(t, "50000.1", shadow.ShadowOrder.Price)
+	assert.Equal(t, "0.123", shadow.Record.MarketPositionSize)
+
+	// Orders below the step size are not placed
+	execution := &Execution{Body: []byte(fmt.Sprintf(body, "secret", "0.0004"))}
+	require.NoError(t, service.Execute(context.Background(), execution))
+	assert.Equal(t, "failed", execution.Record.Status)
+	assert.Contains(t, execution.Record.ErrorMessage, "below the step size")
+	client.AssertExpectations(t)
+
+	// Live orders are compared as they were placed; the filters are requested once
+	orders, err := (&ShadowService{db: db, brokerPool: pool}).LiveOrders(context.Background(), live.User.ID, "", live.Record.CreatedAt.Add(-time.Minute), time.Time{})
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+	assert.Equal(t, "0.123", orders[0].Quantity)
+	assert.Equal(t, "50000.1", orders[0].Price)
+	assert.Equal(t, "0.00040000", orders[1].Quantity)
+	market.AssertExpectations(t)
+}
+
+func TestPipelineStagesArePluggable(t *testing.T) {
+	db := newTestDB(t)
+	pool, _ := newTestPool(t, db)
+	service := newTestTradingService(t, db, pool)
+
+	assert.Equal(t, []string{StageParse, StageValidate, StageRisk, StageSize, StageRoute, StageExecute, StageTrack, StageNotify},
+		service.Pipeline().Stages())
+	assert.Error(t, service.Pipeline().SetStage(PipelineStage{Name: "unknown"}))
+	assert.Error(t, service.Pipeline().InsertBefore(StageRisk, PipelineStage{Name: StageSize}))
+
+	// A stage returning an error rejects the webhook before anything is traded
+	require.NoError(t, service.Pipeline().InsertBefore(StageSize, PipelineStage{
+		Name: "symbols",
+		Run: func(ctx context.Context, exec *Execution) error {
+			if exec.Signal != nil && exec.Signal.Symbol != "BTCUSDT" {
+				return errors.New("symbol not allowed")
+			}
+			return nil
+		},
+	}))
+
+	execution := &Execution{Body: []byte(`{"api_sec":"secret","symbol":"DOGEUSDT","exchange":"binance","action":"buy","prev_market_position_size":"0","market_position_size":"1"}`)}
+	err := service.Execute(context.Background(), execution)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "symbols: symbol not allowed")
+
+	var alert models.Alert
+	require.NoError(t, db.First(&alert, execution.Alert.ID).Error)
+	assert.Equal(t, "failed", alert.Status)
+
+	// Paused users are rejected by the risk stage
+	require.NoError(t, db.Model(execution.User).Update("is_active", false).Error)
+	execution = &Execution{Signal: &models.TradingViewSignal{APISec: "secret", Symbol: "BTCUSDT", ExchangeName: "binance", PrevMarketPositionSize: "0", MarketPositionSize: "1"}}
+	err = service.Execute(context.Background(), execution)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "risk: trading is paused")
+
+	var count int64
+	db.Model(&models.TradingSignal{}).Count(&count)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,385 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/broker/paper"
+	"github.com/Cyvadra/tv-forward/internal/config"
+)
+
+// maxReplayLine is the longest line of a replay file
+const maxReplayLine = 1 << 20
+
+// ReplayEntry is a recorded webhook
+type ReplayEntry struct {
+	Line       int
+	ReceivedAt time.Time
+	Body       []byte
+}
+
+// ReplayOptions configures a replay
+type ReplayOptions struct {
+	Speed   float64 // Factor the gaps between webhooks are shortened by; 0 replays without waiting
+	Balance float64 // Starting balance of every paper account, paper.DefaultBalance when 0
+	FeeRate float64 // Commission rate of every paper account, paper.DefaultFeeRate when 0
+}
+
+// ReplayReport summarizes a replay
+type ReplayReport struct {
+	From           time.Time       `json:"from"`
+	To             time.Time       `json:"to"`
+	Webhooks       int             `json:"webhooks"`
+	Rejected       int             `json:"rejected"`        // Webhooks the pipeline rejected
+	Signals        map[string]int  `json:"signals"`         // Trades by status
+	RiskRejections map[string]int  `json:"risk_rejections"` // Failed trades by the risk rule that fired
+	Failures       []ReplayFailure `json:"failures"`
+	Accounts       []ReplayAccount `json:"accounts"`
+}
+
+// ReplayFailure is a rejected webhook or a failed trade
+type ReplayFailure struct {
+	Line  int       `json:"line"`
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+// ReplayAccount is the paper account of a user on an exchange after a replay. Legacy alerts are
+// traded on the account of user 0.
+type ReplayAccount struct {
+	UserID        uint               `json:"user_id"`
+	User          string             `json:"user"`
+	Exchange      string             `json:"exchange"`
+	WalletBalance string             `json:"wallet_balance"`
+	UnrealizedPnL string             `json:"unrealized_pnl"`
+	Orders        []broker.Order     `json:"orders"`
+	Positions     []broker.Position  `json:"positions"`
+	Performance   *PerformanceReport `json:"performance,omitempty"` // Ledger performance of the user
+}
+
+// replayAccountKey identifies a paper account
+type replayAccountKey struct {
+	userID   uint
+	exchange string
+}
+
+// replayAccount is a paper account opened during a replay
+type replayAccount struct {
+	user   string
+	client *paper.Client
+}
+
+// ReplayService feeds recorded webhooks through the execution pipeline with their original
+// timestamps. Orders are placed on paper accounts instead of the exchanges, so strategy and risk
+// configurations can be tested before they go live. It must run on its own database.
+type ReplayService struct {
+	trading    *TradingService
+	strategies *StrategyService
+	ledger     *LedgerService
+	options    ReplayOptions
+
+	mutex    sync.Mutex
+	current  time.Time
+	accounts map[replayAccountKey]*replayAccount
+}
+
+// NewReplayService creates a new replay service
+func NewReplayService(options ReplayOptions) *ReplayService {
+	userService := NewUserService()
+	trading := NewTradingService()
+	trading.SetUserService(userService)
+	trading.SetRiskEngine(NewRiskEngine(userService))
+	return newReplayService(trading, NewStrategyService(), NewLedgerService(), options)
+}
+
+// newReplayService sets up a trading service to replay webhooks on paper accounts
+func newReplayService(trading *TradingService, strategies *StrategyService, ledger *LedgerService, options ReplayOptions) *ReplayService {
+	if options.Balance <= 0 {
+		options.Balance = paper.DefaultBalance
+	}
+	if options.FeeRate <= 0 {
+		options.FeeRate = paper.DefaultFeeRate
+	}
+
+	s := &ReplayService{
+		trading:    trading,
+		strategies: strategies,
+		ledger:     ledger,
+		options:    options,
+		accounts:   make(map[replayAccountKey]*replayAccount),
+	}
+	trading.SetStrategyService(strategies)
+	trading.SetLedger(ledger)
+	trading.SetClock(s.clock)
+	// Replays run offline, so orders are not rounded to the filters requested from the exchanges
+	trading.SetBrokerPool(nil)
+	if trading.riskEngine != nil {
+		trading.riskEngine.SetClock(s.clock)
+	}
+	trading.Pipeline().SetStage(PipelineStage{Name: StageRoute, Run: s.routeStage})
+	return s
+}
+
+// SetConfig sets the configuration the replayed webhooks are checked with
+func (s *ReplayService) SetConfig(cfg *config.Config) {
+	s.trading.SetConfig(cfg)
+	if s.trading.riskEngine != nil {
+		s.trading.riskEngine.SetConfig(cfg)
+	}
+}
+
+// SetUserConfig sets the user configuration the replayed webhooks are checked with
+func (s *ReplayService) SetUserConfig(cfg *config.UserConfig) {
+	s.trading.userService.SetUserConfig(cfg)
+}
+
+// Strategies returns the strategy service, to configure strategies before the replay
+func (s *ReplayService) Strategies() *StrategyService {
+	return s.strategies
+}
+
+// Run replays the entries in order, waiting the gaps between them shortened by the speed factor
+func (s *ReplayService) Run(ctx context.Context, entries []ReplayEntry) (*ReplayReport, error) {
+	report := &ReplayReport{
+		Signals:        make(map[string]int),
+		RiskRejections: make(map[string]int),
+		Failures:       []ReplayFailure{},
+	}
+	if len(entries) > 0 {
+		report.From = entries[0].ReceivedAt
+		report.To = entries[len(entries)-1].ReceivedAt
+	}
+
+	for i, entry := range entries {
+		if i > 0 && s.options.Speed > 0 {
+			gap := time.Duration(float64(entry.ReceivedAt.Sub(entries[i-1].ReceivedAt)) / s.options.Speed)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(gap):
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		s.mutex.Lock()
+		s.current = entry.ReceivedAt
+		s.mutex.Unlock()
+
+		report.Webhooks++
+		exec := &Execution{Body: entry.Body}
+		if err := s.trading.Execute(ctx, exec); err != nil {
+			report.Rejected++
+			report.Failures = append(report.Failures, ReplayFailure{Line: entry.Line, Time: entry.ReceivedAt, Error: err.Error()})
+			continue
+		}
+		for _, exec := range exec.Executions() {
+			if !exec.Trades() {
+				continue
+			}
+
+			report.Signals[exec.Record.Status]++
+			if exec.Failed() {
+				if exec.Record.RiskRule != "" {
+					report.RiskRejections[exec.Record.RiskRule]++
+				}
+				report.Failures = append(report.Failures, ReplayFailure{Line: entry.Line, Time: entry.ReceivedAt, Error: exec.Record.ErrorMessage})
+			}
+		}
+	}
+
+	accounts, err := s.report(ctx, report.From, report.To)
+	if err != nil {
+		return nil, err
+	}
+	report.Accounts = accounts
+	return report, nil
+}
+
+// routeStage places every trade on the paper account of its user and exchange, priced at the
+// signal's price
+func (s *ReplayService) routeStage(ctx context.Context, exec *Execution) error {
+	if !exec.Trades() || exec.Failed() || exec.Order == nil {
+		return nil
+	}
+
+	key := replayAccountKey{exchange: strings.ToLower(exec.Record.Exchange)}
+	user := ""
+	if exec.User != nil {
+		key.userID = exec.User.ID
+		user = exec.User.Name
+	} else if exec.Legacy != nil {
+		key.exchange = strings.ToLower(exec.Legacy.Exchange)
+	}
+	if key.exchange == "" {
+		key.exchange = "binance"
+	}
+
+	client := s.account(key, user)
+	price := parseAmount(exec.Record.Price)
+	if price <= 0 && exec.Signal != nil {
+		price = parseAmount(exec.Signal.Close)
+	}
+	if price <= 0 && exec.Legacy != nil {
+		price = exec.Legacy.Price
+	}
+	if price > 0 {
+		client.SetPrice(broker.FormatSymbol(exec.Order.Symbol, key.exchange), price)
+	}
+
+	exec.Record.Exchange = key.exchange
+	exec.Routes = append(exec.Routes, &Route{Exchange: key.exchange, Client: client, Release: func() {}})
+	return nil
+}
+
+// account returns the paper account of a user on an exchange, opening it on first use
+func (s *ReplayService) account(key replayAccountKey, user string) *paper.Client {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if account, ok := s.accounts[key]; ok {
+		return account.client
+	}
+	client := paper.New(s.options.Balance, s.options.FeeRate)
+	client.SetClock(s.clock)
+	client.Initialize(context.Background(), nil)
+	s.accounts[key] = &replayAccount{user: user, client: client}
+	return client
+}
+
+// report collects the orders, positions and performance over the replayed period of every paper
+// account
+func (s *ReplayService) report(ctx context.Context, from, to time.Time) ([]ReplayAccount, error) {
+	s.mutex.Lock()
+	opened := maps.Clone(s.accounts)
+	s.mutex.Unlock()
+
+	keys := slices.Collect(maps.Keys(opened))
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].userID != keys[j].userID {
+			return keys[i].userID < keys[j].userID
+		}
+		return keys[i].exchange < keys[j].exchange
+	})
+
+	accounts := make([]ReplayAccount, 0, len(keys))
+	for _, key := range keys {
+		account := opened[key]
+		info, err := account.client.GetAccountInfo(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get paper account: %w", err)
+		}
+
+		result := ReplayAccount{
+			UserID:        key.userID,
+			User:          account.user,
+			Exchange:      key.exchange,
+			WalletBalance: info.TotalWalletBalance,
+			UnrealizedPnL: info.TotalUnrealizedPnL,
+			Orders:        account.client.Orders(),
+			Positions:     info.Positions,
+		}
+		if key.userID != 0 && s.ledger != nil {
+			result.Performance, err = s.ledger.UserPerformance(key.userID, from, to)
+			if err != nil {
+				return nil, err
+			}
+		}
+		accounts = append(accounts, result)
+	}
+	return accounts, nil
+}
+
+// clock returns the original time of the webhook being replayed
+func (s *ReplayService) clock() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.current
+}
+
+// ReadReplayEntries reads recorded webhooks, one JSON object per line. A line is either the webhook
+// body itself, timestamped by its timenow or time field, or an envelope with the body and its
+// received_at or time. Entries without a timestamp take the one of the previous entry. The entries
+// are returned in the order of their timestamps.
+func ReadReplayEntries(r io.Reader) ([]ReplayEntry, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxReplayLine)
+
+	var entries []ReplayEntry
+	var last time.Time
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		entry, err := parseReplayEntry([]byte(text))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if entry.ReceivedAt.IsZero() {
+			if last.IsZero() {
+				return nil, fmt.Errorf("line %d: no timestamp", line)
+			}
+			entry.ReceivedAt = last
+		}
+		entry.Line = line
+		last = entry.ReceivedAt
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read replay file: %w", err)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].ReceivedAt.Before(entries[j].ReceivedAt)
+	})
+	return entries, nil
+}
+
+// parseReplayEntry decodes a line of a replay file
+func parseReplayEntry(line []byte) (ReplayEntry, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return ReplayEntry{}, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	entry := ReplayEntry{Body: line}
+	timestampFields := []string{"timenow", "time"}
+	if body, ok := fields["body"]; ok {
+		// A body recorded as a string is the raw webhook body
+		var raw string
+		if err := json.Unmarshal(body, &raw); err == nil {
+			body = json.RawMessage(raw)
+		}
+		entry.Body = body
+		timestampFields = []string{"received_at", "time"}
+	}
+
+	for _, name := range timestampFields {
+		var value string
+		if err := json.Unmarshal(fields[name], &value); err != nil || value == "" {
+			continue
+		}
+		timestamp, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return ReplayEntry{}, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		entry.ReceivedAt = timestamp
+		break
+	}
+	return entry, nil
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadReplayEntries(t *testing.T) {
+	entries, err := ReadReplayEntries(strings.NewReader(`
+{"received_at":"2025-09-07T10:00:00Z","body":"{\"symbol\":\"ETHUSDT\"}"}
+{"timenow":"2025-09-07T09:00:00Z","symbol":"BTCUSDT"}
+{"body":{"symbol":"SOLUSDT"}}
+`))
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	// Entries are ordered by their timestamps; those without one take the previous timestamp
+	assert.Equal(t, 3, entries[0].Line)
+	assert.Equal(t, time.Date(2025, 9, 7, 9, 0, 0, 0, time.UTC), entries[0].ReceivedAt)
+	assert.Equal(t, `{"symbol":"SOLUSDT"}`, string(entries[1].Body))
+	assert.Equal(t, entries[0].ReceivedAt, entries[1].ReceivedAt)
+	assert.Equal(t, `{"symbol":"ETHUSDT"}`, string(entries[2].Body))
+
+	_, err = ReadReplayEntries(strings.NewReader(`{"symbol":"BTCUSDT"}`))
+	assert.ErrorContains(t, err, "line 1: no timestamp")
+	_, err = ReadReplayEntries(strings.NewReader(`{"time":"yesterday"}`))
+	assert.ErrorContains(t, err, "invalid time")
+}
+
+func TestReplay(t *testing.T) {
+	db := newTestDB(t)
+	pool, created := newTestPool(t, db)
+	pool.market = func(exchange string) (broker.Broker, error) {
+		t.Errorf("replay requested the %s filters", exchange)
+		return nil, broker.ErrNotConnected
+	}
+	trading := newTestTradingService(t, db, pool)
+	replay := newReplayService(trading, &StrategyService{db: db}, &LedgerService{db: db}, ReplayOptions{Balance: 1000, FeeRate: 0.001})
+	replay.SetConfig(&config.Config{})
+
+	_, err := replay.Strategies().Create(&StrategyRequest{Key: "grid", Risk: &config.RiskConfig{MaxLeverage: 5}})
+	require.NoError(t, err)
+
+	entries, err := ReadReplayEntries(strings.NewReader(`
+{"timenow":"2025-09-07T09:00:00Z","api_sec":"secret","strategy":"grid","symbol":"BTCUSDT","exchange":"binance","action":"buy","price":"100","lever":2,"prev_market_position_size":"0","market_position_size":"1"}
+{"received_at":"2025-09-07T10:00:00Z","body":{"api_sec":"secret","strategy":"grid","symbol":"BTCUSDT","exchange":"binance","action":"sell","price":"110","prev_market_position_size":"1","market_position_size":"0"}}
+{"timenow":"2025-09-07T11:00:00Z","api_sec":"secret","strategy":"grid","symbol":"BTCUSDT","exchange":"binance","action":"buy","price":"120","lever":10,"prev_market_position_size":"0","market_position_size":"1"}
+`))
+	require.NoError(t, err)
+
+	report, err := replay.Run(context.Background(), entries)
+	require.NoError(t, err)
+
+	// Orders are placed on paper accounts, never through the broker pool
+	assert.Empty(t, *created)
+	assert.Equal(t, 3, report.Webhooks)
+	assert.Equal(t, map[string]int{"filled": 2, "failed": 1}, report.Signals)
+	assert.Equal(t, map[string]int{RiskRuleMaxLeverage: 1}, report.RiskRejections)
+	require.Len(t, report.Failures, 1)
+	assert.Equal(t, 4, report.Failures[0].Line)
+
+	require.Len(t, report.Accounts, 1)
+	account := report.Accounts[0]
+	assert.Equal(t, "binance", account.Exchange)
+	assert.Len(t, account.Orders, 2)
+	assert.Empty(t, account.Positions)
+	assert.Equal(t, "1009.79", account.WalletBalance)
+	require.NotNil(t, account.Performance)
+	assert.Equal(t, 1, account.Performance.Total.Trades)
+	assert.InDelta(t, 9.79, account.Performance.Total.NetPnL, 1e-9)
+
+	// The trade is timestamped with the original times of the webhooks
+	var trade models.Trade
+	require.NoError(t, db.First(&trade).Error)
+	assert.Equal(t, time.Date(2025, 9, 7, 9, 0, 0, 0, time.UTC), trade.OpenedAt.UTC())
+	require.NotNil(t, trade.ClosedAt)
+	assert.Equal(t, time.Date(2025, 9, 7, 10, 0, 0, 0, time.UTC), trade.ClosedAt.UTC())
+}
@@ -0,0 +1,298 @@
+package services
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/database"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"gorm.io/gorm"
+)
+
+// retentionTarget describes which rows of a table a retention policy applies to
+type retentionTarget struct {
+	table string
+	scope func(db *gorm.DB) *gorm.DB
+}
+
+// retentionTargets lists the tables that can be archived by a retention policy
+var retentionTargets = map[string]retentionTarget{
+	// Alerts that are not referenced by any trading signal or delivery
+	"alerts": {
+		table: "alerts",
+		scope: func(db *gorm.DB) *gorm.DB {
+			return notReferenced(db, "trading_signals.alert_id", "deliveries.alert_id")
+		},
+	},
+	// Plain-text alerts that never resulted in a trade and are no longer referenced by a delivery
+	"non_trading_alerts": {
+		table: "alerts",
+		scope: func(db *gorm.DB) *gorm.DB {
+			return notReferenced(db.Where("strategy = ?", "alert"), "deliveries.alert_id")
+		},
+	},
+	// Trading signals that no order, trade, income or delivery refers to anymore
+	"trading_signals": {
+		table: "trading_signals",
+		scope: func(db *gorm.DB) *gorm.DB {
+			return notReferenced(db, "orders.trading_signal_id", "shadow_orders.trading_signal_id",
+				"trades.entry_signal_id", "trades.exit_signal_id", "incomes.trading_signal_id", "deliveries.signal_id")
+		},
+	},
+	// Successfully delivered forwards; failed ones are kept for replay
+	"deliveries": {
+		table: "deliveries",
+		scope: func(db *gorm.DB) *gorm.DB {
+			return db.Where("status = ?", models.DeliveryStatusDelivered)
+		},
+	},
+}
+
+// notReferenced excludes the rows whose ID is stored in any of the given table columns,
+// so that purging them leaves no dangling references behind
+func notReferenced(db *gorm.DB, references ...string) *gorm.DB {
+	for _, reference := range references {
+		table, column, _ := strings.Cut(reference, ".")
+		db = db.Where("id NOT IN (?)",
+			db.Session(&gorm.Session{NewDB: true}).Table(table).
+				Select(column).Where(column+" IS NOT NULL"))
+	}
+	return db
+}
+
+// ArchiveResult describes the outcome of archiving a single retention policy
+type ArchiveResult struct {
+	Table  string    `json:"table"`
+	Cutoff time.Time `json:"cutoff"`
+	Rows   int64     `json:"rows"`
+	File   string    `json:"file,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// RetentionService archives and purges rows that exceed their retention period
+type RetentionService struct {
+	db     *gorm.DB
+	config *config.Config
+	mutex  sync.Mutex
+}
+
+// NewRetentionService creates a new retention service
+func NewRetentionService() *RetentionService {
+	return &RetentionService{
+		db:     database.GetDB(),
+		config: nil, // Will be set later
+	}
+}
+
+// SetConfig sets the configuration for the retention service
+func (s *RetentionService) SetConfig(cfg *config.Config) {
+	s.config = cfg
+}
+
+// Start runs the archival job periodically until the context is cancelled
+func (s *RetentionService) Start(ctx context.Context) {
+	if s.config == nil || !s.config.Retention.Enabled {
+		return
+	}
+
+	interval := s.config.Retention.Interval
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.RunOnce(ctx); err != nil {
+			log.Printf("Retention job failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce archives and hard-deletes all rows that are past their retention period
+func (s *RetentionService) RunOnce(ctx context.Context) ([]ArchiveResult, error) {
+	if s.config == nil {
+		return nil, fmt.Errorf("configuration not set")
+	}
+	if s.db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	// Only one archival run at a time
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var results []ArchiveResult
+	var deleted int64
+	for _, policy := range s.config.Retention.Policies {
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+
+		result, err := s.archivePolicy(ctx, policy)
+		if err != nil {
+			log.Printf("Failed to archive %s: %v", policy.Table, err)
+			result.Error = err.Error()
+		} else if result.Rows > 0 {
+			log.Printf("Archived %d rows from %s to %s", result.Rows, policy.Table, result.File)
+		}
+		deleted += result.Rows
+		results = append(results, result)
+	}
+
+	// Reclaim disk space freed by the hard deletes
+	if deleted > 0 && s.config.Retention.Vacuum && s.db.Dialector.Name() == "sqlite" {
+		if err := s.db.WithContext(ctx).Exec("VACUUM").Error; err != nil {
+			log.Printf("Failed to vacuum database: %v", err)
+		}
+	}
+
+	return results, nil
+}
+
+// archivePolicy exports expired rows of a single policy to a gzip-compressed JSONL file
+// and hard-deletes them once the archive has been written
+func (s *RetentionService) archivePolicy(ctx context.Context, policy config.RetentionPolicy) (ArchiveResult, error) {
+	result := ArchiveResult{Table: policy.Table}
+
+	target, exists := retentionTargets[policy.Table]
+	if !exists {
+		return result, fmt.Errorf("unsupported retention table: %s", policy.Table)
+	}
+	if policy.Days <= 0 {
+		return result, fmt.Errorf("retention days must be positive")
+	}
+
+	result.Cutoff = time.Now().AddDate(0, 0, -policy.Days)
+	expired := func() *gorm.DB {
+		query := s.db.WithContext(ctx).Table(target.table).Where("created_at < ?", result.Cutoff)
+		return target.scope(query)
+	}
+
+	var count int64
+	if err := expired().Count(&count).Error; err != nil {
+		return result, fmt.Errorf("failed to count expired rows: %w", err)
+	}
+	if count == 0 {
+		return result, nil
+	}
+
+	archiveDir := s.config.Retention.ArchiveDir
+	if archiveDir == "" {
+		archiveDir = "archive"
+	}
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		return result, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	fileName := fmt.Sprintf("%s_%s.jsonl.gz", policy.Table, time.Now().UTC().Format("20060102T150405Z"))
+	result.File = filepath.Join(archiveDir, fileName)
+
+	ids, err := s.exportRows(expired, result.File)
+	if err != nil {
+		os.Remove(result.File)
+		result.File = ""
+		return result, err
+	}
+
+	// Hard-delete archived rows, including soft-deleted ones
+	batchSize := s.batchSize()
+	for start := 0; start < len(ids); start += batchSize {
+		end := min(start+batchSize, len(ids))
+		res := s.db.WithContext(ctx).Exec(fmt.Sprintf("DELETE FROM %s WHERE id IN ?", target.table), ids[start:end])
+		if res.Error != nil {
+			return result, fmt.Errorf("failed to delete archived rows: %w", res.Error)
+		}
+		result.Rows += res.RowsAffected
+	}
+
+	return result, nil
+}
+
+// exportRows writes every row matched by the query to a gzip-compressed JSONL file
+// and returns the IDs of the exported rows
+func (s *RetentionService) exportRows(query func() *gorm.DB, fileName string) ([]uint64, error) {
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive file: %w", err)
+	}
+	defer file.Close()
+
+	writer := gzip.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+
+	var ids []uint64
+	var lastID uint64
+	batchSize := s.batchSize()
+	for {
+		var rows []map[string]interface{}
+		if err := query().Where("id > ?", lastID).Order("id").Limit(batchSize).Find(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to read expired rows: %w", err)
+		}
+
+		for _, row := range rows {
+			if err := encoder.Encode(row); err != nil {
+				return nil, fmt.Errorf("failed to write archive: %w", err)
+			}
+			id, err := rowID(row)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+			lastID = id
+		}
+
+		if len(rows) < batchSize {
+			break
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync archive: %w", err)
+	}
+
+	return ids, nil
+}
+
+// batchSize returns the configured archival batch size
+func (s *RetentionService) batchSize() int {
+	if s.config.Retention.BatchSize > 0 {
+		return s.config.Retention.BatchSize
+	}
+	return 500
+}
+
+// rowID extracts the primary key from a row read into a map
+func rowID(row map[string]interface{}) (uint64, error) {
+	switch id := row["id"].(type) {
+	case int64:
+		return uint64(id), nil
+	case uint64:
+		return id, nil
+	case int:
+		return uint64(id), nil
+	case uint:
+		return uint64(id), nil
+	default:
+		return 0, fmt.Errorf("unexpected id type %T", row["id"])
+	}
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/database"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB creates an isolated in-memory database with the application schema
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+
+	// A single connection keeps the in-memory database alive for the whole test
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	require.NoError(t, database.Migrate(db))
+	return db
+}
+
+func TestRetentionRunOnce(t *testing.T) {
+	db := newTestDB(t)
+	archiveDir := t.TempDir()
+
+	old := time.Now().AddDate(0, 0, -40)
+	recent := time.Now().AddDate(0, 0, -5)
+
+	alerts := []models.Alert{
+		{Strategy: "alert", Message: "old plain alert", CreatedAt: old},
+		{Strategy: "alert", Message: "recent plain alert", CreatedAt: recent},
+		{Strategy: "RSI", Symbol: "BTCUSDT", Message: "old strategy alert", CreatedAt: old},
+	}
+	require.NoError(t, db.Create(&alerts).Error)
+
+	// Soft-deleted rows must be archived and purged as well
+	softDeleted := models.Alert{Strategy: "alert", Message: "soft deleted", CreatedAt: old}
+	require.NoError(t, db.Create(&softDeleted).Error)
+	require.NoError(t, db.Delete(&softDeleted).Error)
+
+	service := &RetentionService{
+		db: db,
+		config: &config.Config{
+			Retention: config.RetentionConfig{
+				ArchiveDir: archiveDir,
+				BatchSize:  1,
+				Vacuum:     true,
+				Policies: []config.RetentionPolicy{
+					{Table: "non_trading_alerts", Days: 30},
+				},
+			},
+		},
+	}
+
+	results, err := service.RunOnce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, int64(2), results[0].Rows)
+	assert.Empty(t, results[0].Error)
+
+	// Only the recent plain alert and the strategy alert remain
+	var remaining []models.Alert
+	require.NoError(t, db.Unscoped().Order("id").Find(&remaining).Error)
+	require.Len(t, remaining, 2)
+	assert.Equal(t, "recent plain alert", remaining[0].Message)
+	assert.Equal(t, "old strategy alert", remaining[1].Message)
+
+	// The archive contains the purged rows as JSON lines
+	file, err := os.Open(results[0].File)
+	require.NoError(t, err)
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	require.NoError(t, err)
+
+	var messages []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		var row map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &row))
+		messages = append(messages, row["message"].(string))
+	}
+	assert.ElementsMatch(t, []string{"old plain alert", "soft deleted"}, messages)
+}
+
+func TestRetentionUnknownTable(t *testing.T) {
+	service := &RetentionService{
+		db: newTestDB(t),
+		config: &config.Config{
+			Retention: config.RetentionConfig{
+				ArchiveDir: t.TempDir(),
+				Policies:   []config.RetentionPolicy{{Table: "unknown", Days: 1}},
+			},
+		},
+	}
+
+	results, err := service.RunOnce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Contains(t, results[0].Error, "unsupported retention table")
+}
+
+func TestRetentionKeepsReferencedRows(t *testing.T) {
+	db := newTestDB(t)
+	old := time.Now().AddDate(0, 0, -40)
+
+	alerts := []models.Alert{
+		{Strategy: "alert", Message: "delivered plain alert", CreatedAt: old},
+		{Strategy: "RSI", Message: "traded alert", CreatedAt: old},
+		{Strategy: "RSI", Message: "unreferenced alert", CreatedAt: old},
+	}
+	require.NoError(t, db.Create(&alerts).Error)
+	signals := []models.TradingSignal{
+		{AlertID: alerts[1].ID, SignalID: "ordered", CreatedAt: old},
+		{SignalID: "shadowed", CreatedAt: old},
+		{SignalID: "entered", CreatedAt: old},
+		{SignalID: "exited", CreatedAt: old},
+		{SignalID: "charged", CreatedAt: old},
+		{SignalID: "delivered", CreatedAt: old},
+		{SignalID: "unreferenced", CreatedAt: old},
+	}
+	require.NoError(t, db.Create(&signals).Error)
+	require.NoError(t, db.Create(&models.Order{TradingSignalID: signals[0].ID}).Error)
+	require.NoError(t, db.Create(&models.ShadowOrder{TradingSignalID: signals[1].ID}).Error)
+	require.NoError(t, db.Create(&models.Trade{EntrySignalID: signals[2].ID, ExitSignalID: signals[3].ID}).Error)
+	require.NoError(t, db.Create(&models.Income{TranID: "1", TradingSignalID: signals[4].ID}).Error)
+	require.NoError(t, db.Create(&models.Delivery{AlertID: alerts[0].ID, SignalID: signals[5].ID}).Error)
+
+	service := &RetentionService{
+		db: db,
+		config: &config.Config{
+			Retention: config.RetentionConfig{
+				ArchiveDir: t.TempDir(),
+				Policies: []config.RetentionPolicy{
+					{Table: "non_trading_alerts", Days: 30},
+					{Table: "trading_signals", Days: 30},
+					{Table: "alerts", Days: 30},
+				},
+			},
+		},
+	}
+
+	results, err := service.RunOnce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Equal(t, int64(0), results[0].Rows)
+	assert.Equal(t, int64(1), results[1].Rows)
+	assert.Equal(t, int64(1), results[2].Rows)
+
+	// Only the rows nothing refers to are purged
+	var remainingSignals []models.TradingSignal
+	require.NoError(t, db.Unscoped().Order("id").Find(&remainingSignals).Error)
+	require.Len(t, remainingSignals, 6)
+	for _, signal := range remainingSignals {
+		assert.NotEqual(t, "unreferenced", signal.SignalID)
+	}
+	var remainingAlerts []models.Alert
+	require.NoError(t, db.Unscoped().Order("id").Find(&remainingAlerts).Error)
+	require.Len(t, remainingAlerts, 2)
+	assert.Equal(t, "delivered plain alert", remainingAlerts[0].Message)
+	assert.Equal(t, "traded alert", remainingAlerts[1].Message)
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/database"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"gorm.io/gorm"
+)
+
+// Risk rules, recorded on the trading signals they reject
+const (
+	RiskRuleAllowedExchanges    = "allowed_exchanges"
+	RiskRuleAllowedSymbols      = "allowed_symbols"
+	RiskRuleMaxLeverage         = "max_leverage"
+	RiskRuleMaxOrdersPerMinute  = "max_orders_per_minute"
+	RiskRuleMaxDailyLoss        = "max_daily_loss"
+	RiskRuleMaxPositionNotional = "max_position_notional"
+	RiskRuleMaxAccountNotional  = "max_account_notional"
+	RiskRuleKillSwitch          = "kill_switch"
+	RiskRuleStrategyDisabled    = "strategy_disabled"
+)
+
+// RiskViolation is the rejection of a signal by a risk rule
+type RiskViolation struct {
+	Rule    string
+	Message string
+}
+
+func (v *RiskViolation) Error() string {
+	return fmt.Sprintf("risk rule %s: %s", v.Rule, v.Message)
+}
+
+// riskRequest is what the risk rules know about a trade
+type riskRequest struct {
+	userID     uint
+	exchange   string
+	symbol     string
+	leverage   int
+	prevSize   float64
+	targetSize float64
+	price      float64
+}
+
+// reduces reports whether the trade only reduces or closes the current position
+func (r *riskRequest) reduces() bool {
+	if r.targetSize == 0 {
+		return true
+	}
+	return r.prevSize*r.targetSize > 0 && abs(r.targetSize) <= abs(r.prevSize)
+}
+
+// RiskEngine checks trades against the global, per-user and per-strategy risk limits before any order is placed
+type RiskEngine struct {
+	db          *gorm.DB
+	config      *config.Config
+	userService *UserService
+	clock       func() time.Time
+}
+
+// NewRiskEngine creates a new risk engine
+func NewRiskEngine(userService *UserService) *RiskEngine {
+	return &RiskEngine{
+		db:          database.GetDB(),
+		config:      nil, // Will be set later
+		userService: userService,
+	}
+}
+
+// SetConfig sets the configuration holding the global risk limits
+func (e *RiskEngine) SetConfig(cfg *config.Config) {
+	e.config = cfg
+}
+
+// SetClock sets the clock the order rate and the daily loss are measured with instead of the system time
+func (e *RiskEngine) SetClock(clock func() time.Time) {
+	e.clock = clock
+}
+
+// Limits returns the risk limits of a user, or the global limits for apiSec "". The limits of a
+// strategy replace them with Merge.
+func (e *RiskEngine) Limits(apiSec string) config.RiskConfig {
+	var limits config.RiskConfig
+	if e.config != nil {
+		limits = e.config.Trading.Risk
+	}
+	if apiSec != "" && e.userService != nil {
+		if entry := e.userService.GetUserConfig(apiSec); entry != nil {
+			limits = limits.Merge(entry.Risk)
+		}
+	}
+	return limits
+}
+
+// Check evaluates the risk rules for a trade and returns the violation of the first rule that fires.
+// Trades that only reduce a position are subject to the allow lists and the order rate only.
+// Legacy alerts are checked with CheckRoute on each exchange they are routed to instead.
+func (e *RiskEngine) Check(exec *Execution) error {
+	if !exec.Trades() || exec.Legacy != nil {
+		return nil
+	}
+	return e.check(e.executionLimits(exec), newRiskRequest(exec))
+}
+
+// CheckRoute evaluates the risk rules for a legacy alert on an exchange it is routed to. Legacy
+// alerts only carry an order, so when a limit depends on the position, the position held on the
+// exchange is fetched from the client and the order is added to it.
+func (e *RiskEngine) CheckRoute(ctx context.Context, exec *Execution, exchange string, client broker.Broker) error {
+	limits := e.executionLimits(exec)
+	req := newRiskRequest(exec)
+	req.exchange = strings.ToLower(exchange)
+
+	if limits.MaxLeverage > 0 || limits.MaxDailyLoss > 0 || limits.MaxPositionNotional > 0 || limits.MaxAccountNotional > 0 {
+		position, err := client.GetPosition(ctx, broker.FormatSymbol(req.symbol, req.exchange))
+		if err != nil && !errors.Is(err, broker.ErrPositionNotFound) {
+			return fmt.Errorf("failed to get %s position: %w", req.symbol, err)
+		}
+		if position != nil {
+			size, _ := strconv.ParseFloat(position.Size, 64)
+			if size > 0 && position.PositionSide == broker.PositionSideShort {
+				size = -size
+			}
+			req.prevSize = size
+			req.targetSize += size
+			if req.price <= 0 {
+				req.price, _ = strconv.ParseFloat(position.MarkPrice, 64)
+			}
+		}
+	}
+	return e.check(limits, req)
+}
+
+// executionLimits returns the risk limits of the user and strategy of an execution
+func (e *RiskEngine) executionLimits(exec *Execution) config.RiskConfig {
+	apiSec := ""
+	if exec.User != nil {
+		apiSec = exec.User.APISec
+	}
+	limits := e.Limits(apiSec)
+	if exec.Strategy != nil {
+		limits = limits.Merge(exec.Strategy.Risk)
+	}
+	return limits
+}
+
+// check evaluates the risk rules for a trade
+func (e *RiskEngine) check(limits config.RiskConfig, req *riskRequest) error {
+	if req.exchange != "" && !matchesAny(limits.AllowedExchanges, req.exchange) {
+		return &RiskViolation{RiskRuleAllowedExchanges, fmt.Sprintf("%s is not an allowed exchange", req.exchange)}
+	}
+	if !matchesAny(limits.AllowedSymbols, req.symbol) {
+		return &RiskViolation{RiskRuleAllowedSymbols, fmt.Sprintf("%s is not an allowed symbol", req.symbol)}
+	}
+
+	if limits.MaxOrdersPerMinute > 0 {
+		orders, err := e.recentOrders(req.userID, time.Minute)
+		if err != nil {
+			return err
+		}
+		if orders >= int64(limits.MaxOrdersPerMinute) {
+			return &RiskViolation{RiskRuleMaxOrdersPerMinute, fmt.Sprintf("%d orders in the last minute, limit is %d", orders, limits.MaxOrdersPerMinute)}
+		}
+	}
+
+	if req.reduces() {
+		return nil
+	}
+
+	if limits.MaxLeverage > 0 && req.leverage > limits.MaxLeverage {
+		return &RiskViolation{RiskRuleMaxLeverage, fmt.Sprintf("leverage %dx exceeds %dx", req.leverage, limits.MaxLeverage)}
+	}
+
+	if limits.MaxDailyLoss > 0 {
+		pnl, err := e.dailyRealizedPnL(req.userID)
+		if err != nil {
+			return err
+		}
+		if -pnl >= limits.MaxDailyLoss {
+			return &RiskViolation{RiskRuleMaxDailyLoss, fmt.Sprintf("realized loss today is %s, limit is %s", formatNumber(-pnl), formatNumber(limits.MaxDailyLoss))}
+		}
+	}
+
+	if limits.MaxPositionNotional > 0 || limits.MaxAccountNotional > 0 {
+		return e.checkNotional(limits, req)
+	}
+	return nil
+}
+
+// checkNotional checks the value of the target position and of the whole account
+func (e *RiskEngine) checkNotional(limits config.RiskConfig, req *riskRequest) error {
+	positions, err := e.openPositions(req.userID)
+	if err != nil {
+		return err
+	}
+
+	price := req.price
+	accountNotional := 0.0
+	for _, position := range positions {
+		value := positionPrice(&position)
+		if strings.EqualFold(position.Symbol, req.symbol) && strings.EqualFold(position.Exchange, req.exchange) {
+			// Market signals often carry no price; value them at the price of the current position
+			if price <= 0 {
+				price = value
+			}
+			continue
+		}
+		size, _ := strconv.ParseFloat(position.Size, 64)
+		accountNotional += abs(size) * value
+	}
+
+	if price <= 0 {
+		log.Printf("No price to value %s for user %d, skipping notional limits", req.symbol, req.userID)
+		return nil
+	}
+
+	notional := abs(req.targetSize) * price
+	if limits.MaxPositionNotional > 0 && notional > limits.MaxPositionNotional {
+		return &RiskViolation{RiskRuleMaxPositionNotional, fmt.Sprintf("%s position of %s exceeds %s", req.symbol, formatNumber(notional), formatNumber(limits.MaxPositionNotional))}
+	}
+	if limits.MaxAccountNotional > 0 && accountNotional+notional > limits.MaxAccountNotional {
+		return &RiskViolation{RiskRuleMaxAccountNotional, fmt.Sprintf("open positions of %s exceed %s", formatNumber(accountNotional+notional), formatNumber(limits.MaxAccountNotional))}
+	}
+	return nil
+}
+
+// recentOrders counts the trading signals of a user that were not rejected or failed within a period
+func (e *RiskEngine) recentOrders(userID uint, period time.Duration) (int64, error) {
+	var count int64
+	err := e.db.Model(&models.TradingSignal{}).
+		Where("user_id = ? AND created_at >= ? AND status <> ?", userID, e.now().Add(-period), "failed").
+		Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recent orders: %w", err)
+	}
+	return count, nil
+}
+
+// dailyRealizedPnL sums the realized PnL of a user's executions since midnight UTC
+func (e *RiskEngine) dailyRealizedPnL(userID uint) (float64, error) {
+	var signals []models.TradingSignal
+	err := e.db.Where("user_id = ? AND executed_at >= ?", userID, e.now().UTC().Truncate(24*time.Hour)).
+		Find(&signals).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum realized PnL: %w", err)
+	}
+
+	total := 0.0
+	for _, signal := range signals {
+		if pnl, err := strconv.ParseFloat(signal.RealizedPnL, 64); err == nil {
+			total += pnl
+		}
+	}
+	return total, nil
+}
+
+// openPositions returns the open positions of a user
+func (e *RiskEngine) openPositions(userID uint) ([]models.Position, error) {
+	var positions []models.Position
+	if err := e.db.Where("user_id = ? AND is_active = ?", userID, true).Find(&positions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get positions: %w", err)
+	}
+	return positions, nil
+}
+
+// newRiskRequest describes the trade of an execution. Legacy alerts move a flat position by their
+// quantity, down for sells.
+func newRiskRequest(exec *Execution) *riskRequest {
+	req := &riskRequest{
+		exchange: strings.ToLower(exec.Record.Exchange),
+		symbol:   strings.ToUpper(exec.Record.Symbol),
+		leverage: exec.Record.Leverage,
+	}
+	if exec.User != nil {
+		req.userID = exec.User.ID
+	}
+
+	if exec.Legacy != nil {
+		req.targetSize = exec.Legacy.Quantity
+		if strings.EqualFold(exec.Legacy.Action, "sell") {
+			req.targetSize = -req.targetSize
+		}
+		req.price = exec.Legacy.Price
+		return req
+	}
+
+	req.prevSize, _ = strconv.ParseFloat(exec.Record.PrevMarketPositionSize, 64)
+	req.targetSize, _ = strconv.ParseFloat(exec.Record.MarketPositionSize, 64)
+	req.price, _ = strconv.ParseFloat(exec.Record.Price, 64)
+	return req
+}
+
+// now returns the time of the clock, the system time by default
+func (e *RiskEngine) now() time.Time {
+	if e.clock != nil {
+		return e.clock()
+	}
+	return time.Now()
+}
+
+// positionPrice returns the price a position is valued at
+func positionPrice(position *models.Position) float64 {
+	if price, err := strconv.ParseFloat(position.MarkPrice, 64); err == nil && price > 0 {
+		return price
+	}
+	price, _ := strconv.ParseFloat(position.EntryPrice, 64)
+	return price
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRiskEngineLimits(t *testing.T) {
+	userService := &UserService{}
+	userService.SetUserConfig(&config.UserConfig{Users: []config.UserConfigEntry{
+		{APISec: "capped", Risk: &config.RiskConfig{MaxLeverage: 3, AllowedSymbols: []string{"BTCUSDT"}}},
+		{APISec: "default"},
+	}})
+	engine := &RiskEngine{userService: userService}
+	engine.SetConfig(&config.Config{Trading: config.TradingConfig{Risk: config.RiskConfig{MaxLeverage: 10, MaxDailyLoss: 500}}})
+
+	// Limits of a user replace the global ones they set and keep the others
+	assert.Equal(t, config.RiskConfig{MaxLeverage: 3, MaxDailyLoss: 500, AllowedSymbols: []string{"BTCUSDT"}}, engine.Limits("capped"))
+	assert.Equal(t, config.RiskConfig{MaxLeverage: 10, MaxDailyLoss: 500}, engine.Limits("default"))
+	assert.Equal(t, config.RiskConfig{MaxLeverage: 10, MaxDailyLoss: 500}, engine.Limits("unknown"))
+}
+
+func TestRiskEngineRules(t *testing.T) {
+	db := newTestDB(t)
+	user := &models.User{APISec: "secret", Name: "trader", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+
+	now := time.Now()
+	require.NoError(t, db.Create(&models.Position{UserID: user.ID, Exchange: "binance", Symbol: "BTCUSDT", Side: "long", Size: "0.1", MarkPrice: "60000", IsActive: true}).Error)
+	require.NoError(t, db.Create(&models.Position{UserID: user.ID, Exchange: "binance", Symbol: "ETHUSDT", Side: "long", Size: "2", EntryPrice: "3000", IsActive: true}).Error)
+	require.NoError(t, db.Create(&models.TradingSignal{UserID: user.ID, Symbol: "ETHUSDT", Status: "filled", RealizedPnL: "-150", ExecutedAt: &now}).Error)
+
+	newExecution := func(exchange, symbol string, leverage int, price, prevSize, size string) *Execution {
+		return &Execution{User: user, Record: &models.TradingSignal{
+			UserID: user.ID, Exchange: exchange, Symbol: symbol, Leverage: leverage, Price: price,
+			PrevMarketPositionSize: prevSize, MarketPositionSize: size,
+		}}
+	}
+
+	tests := []struct {
+		name   string
+		limits config.RiskConfig
+		exec   *Execution
+		rule   string
+	}{
+		{"allowed", config.RiskConfig{MaxLeverage: 10, MaxPositionNotional: 10000}, newExecution("binance", "BTCUSDT", 5, "", "0.1", "0.15"), ""},
+		{"exchange not allowed", config.RiskConfig{AllowedExchanges: []string{"Binance"}}, newExecution("okx", "BTCUSDT", 1, "", "0", "1"), RiskRuleAllowedExchanges},
+		{"symbol not allowed", config.RiskConfig{AllowedSymbols: []string{"btcusdt"}}, newExecution("binance", "DOGEUSDT", 1, "", "0", "1"), RiskRuleAllowedSymbols},
+		{"symbol not allowed on close", config.RiskConfig{AllowedSymbols: []string{"BTCUSDT"}}, newExecution("binance", "ETHUSDT", 1, "", "2", "0"), RiskRuleAllowedSymbols},
+		{"leverage", config.RiskConfig{MaxLeverage: 5}, newExecution("binance", "BTCUSDT", 20, "", "0.1", "0.2"), RiskRuleMaxLeverage},
+		{"leverage on reduce", config.RiskConfig{MaxLeverage: 5}, newExecution("binance", "BTCUSDT", 20, "", "0.1", "0.05"), ""},
+		{"orders per minute", config.RiskConfig{MaxOrdersPerMinute: 1}, newExecution("binance", "BTCUSDT", 1, "", "0.1", "0"), RiskRuleMaxOrdersPerMinute},
+		{"daily loss", config.RiskConfig{MaxDailyLoss: 100}, newExecution("binance", "BTCUSDT", 1, "", "0.1", "0.2"), RiskRuleMaxDailyLoss},
+		{"daily loss on close", config.RiskConfig{MaxDailyLoss: 100}, newExecution("binance", "BTCUSDT", 1, "", "0.1", "0"), ""},
+		{"position notional at signal price", config.RiskConfig{MaxPositionNotional: 10000}, newExecution("binance", "SOLUSDT", 1, "200", "0", "60"), RiskRuleMaxPositionNotional},
+		{"position notional at mark price", config.RiskConfig{MaxPositionNotional: 10000}, newExecution("binance", "BTCUSDT", 1, "", "0.1", "-0.2"), RiskRuleMaxPositionNotional},
+		{"account notional", config.RiskConfig{MaxAccountNotional: 15000}, newExecution("binance", "BTCUSDT", 1, "", "0.1", "0.2"), RiskRuleMaxAccountNotional},
+		{"no price to value", config.RiskConfig{MaxPositionNotional: 1}, newExecution("binance", "SOLUSDT", 1, "", "0", "60"), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := &RiskEngine{db: db, config: &config.Config{Trading: config.TradingConfig{Risk: tt.limits}}}
+			err := engine.Check(tt.exec)
+			if tt.rule == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var violation *RiskViolation
+			require.ErrorAs(t, err, &violation)
+			assert.Equal(t, tt.rule, violation.Rule)
+		})
+	}
+}
+
+func TestPipelineRecordsRiskRejections(t *testing.T) {
+	db := newTestDB(t)
+	pool, created := newTestPool(t, db)
+	newTestCredential(t, db, 1, "secret")
+	service := newTestTradingService(t, db, pool)
+	service.config.Trading.Risk = config.RiskConfig{MaxPositionNotional: 1000}
+
+	// The signal is stored as failed with the rule that fired and no order reaches the broker
+	execution := &Execution{Body: []byte(`{"api_sec":"secret","symbol":"BTCUSDT","exchange":"binance","action":"buy","price":"60000","prev_market_position_size":"0","market_position_size":"1"}`)}
+	require.NoError(t, service.Execute(context.Background(), execution))
+	assert.Empty(t, *created)
+
+	var signal models.TradingSignal
+	require.NoError(t, db.First(&signal, execution.Record.ID).Error)
+	assert.Equal(t, "failed", signal.Status)
+	assert.Equal(t, "RISK_REJECTED", signal.ErrorCode)
+	assert.Equal(t, RiskRuleMaxPositionNotional, signal.RiskRule)
+	assert.Contains(t, signal.ErrorMessage, "exceeds 1000")
+	assert.Equal(t, "processed", execution.Alert.Status)
+}
+
+func TestPipelineChecksLegacyRoutes(t *testing.T) {
+	db := newTestDB(t)
+	pool, created := newTestPool(t, db)
+	service := newTestTradingService(t, db, pool)
+	service.config.Trading.Binance = config.BinanceConfig{APIKey: "key", SecretKey: "secret", IsActive: true}
+	service.config.Trading.Risk = config.RiskConfig{AllowedExchanges: []string{"okx"}}
+
+	// Configured exchanges that the limits do not allow are not traded
+	execution := &Execution{Body: []byte(`{"strategy":"grid","symbol":"BTCUSDT","action":"buy","quantity":0.1}`)}
+	require.NoError(t, service.Execute(context.Background(), execution))
+	require.NotNil(t, execution.Legacy)
+	assert.Equal(t, "failed", execution.Record.Status)
+	assert.Equal(t, "RISK_REJECTED", execution.Record.ErrorCode)
+	assert.Equal(t, RiskRuleAllowedExchanges, execution.Record.RiskRule)
+	assert.Contains(t, execution.Record.ErrorMessage, "binance is not an allowed exchange")
+	require.Len(t, *created, 1)
+	client := (*created)[0]
+	client.AssertNotCalled(t, "PlaceOrder", mock.Anything, mock.Anything)
+
+	// Sells are valued against the position held on the exchange: closing it passes the
+	// notional limit, adding to the short side does not
+	service.config.Trading.Risk = config.RiskConfig{MaxPositionNotional: 10000}
+	client.On("GetPosition", mock.Anything, "BTCUSDT").
+		Return(&broker.Position{Symbol: "BTCUSDT", Size: "0.5", MarkPrice: "60000"}, nil).Twice()
+	client.On("PlaceOrder", mock.Anything, mock.MatchedBy(func(req *broker.OrderRequest) bool {
+		return req.Side == broker.OrderSideSell && req.Quantity == "0.50000000"
+	})).Return(&broker.Order{ID: "1", Symbol: "BTCUSDT", Status: broker.OrderStatusFilled, ExecutedQuantity: "0.5"}, nil).Once()
+
+	execution = &Execution{Body: []byte(`{"strategy":"grid","symbol":"BTCUSDT","action":"sell","quantity":0.5}`)}
+	require.NoError(t, service.Execute(context.Background(), execution))
+	assert.Equal(t, "filled", execution.Record.Status)
+
+	execution = &Execution{Body: []byte(`{"strategy":"grid","symbol":"BTCUSDT","action":"sell","quantity":1}`)}
+	require.NoError(t, service.Execute(context.Background(), execution))
+	assert.Equal(t, "failed", execution.Record.Status)
+	assert.Equal(t, RiskRuleMaxPositionNotional, execution.Record.RiskRule)
+	client.AssertExpectations(t)
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+)
+
+// RouteResult describes which endpoints a notification is routed to and why
+type RouteResult struct {
+	Endpoints    []string `json:"endpoints"`
+	MatchedRules []string `json:"matched_rules"`
+	Default      bool     `json:"default"` // No rule matched, the default endpoints were used
+	// Notification channels of the signal's user from users.yaml, also included in Endpoints
+	UserEndpoints []string `json:"user_endpoints,omitempty"`
+	// Notification channels of the signal's strategy, also included in Endpoints
+	StrategyEndpoints []string `json:"strategy_endpoints,omitempty"`
+}
+
+// routeRule is a routing rule with its message pattern compiled
+type routeRule struct {
+	config.RoutingRule
+	message *regexp.Regexp
+}
+
+// router evaluates routing rules against notifications
+type router struct {
+	rules            []routeRule
+	defaultEndpoints []string
+}
+
+// newRouter compiles the routing rules of a configuration
+func newRouter(cfg config.RoutingConfig) (*router, error) {
+	r := &router{defaultEndpoints: cfg.DefaultEndpoints}
+
+	for i, rule := range cfg.Rules {
+		compiled := routeRule{RoutingRule: rule}
+		if rule.MessageRegex != "" {
+			pattern, err := regexp.Compile(rule.MessageRegex)
+			if err != nil {
+				return nil, fmt.Errorf("routing rule %d (%s): invalid message_regex: %w", i, rule.Name, err)
+			}
+			compiled.message = pattern
+		}
+		r.rules = append(r.rules, compiled)
+	}
+
+	return r, nil
+}
+
+// matches reports whether a notification satisfies every condition of the rule
+func (r *routeRule) matches(notification *Notification) bool {
+	var apiSec, status string
+	if notification.Signal != nil {
+		apiSec = notification.Signal.APISec
+	}
+	if notification.Execution != nil {
+		status = notification.Execution.Status
+	}
+
+	if !matchesAny(r.Strategies, notification.Strategy()) ||
+		!matchesAny(r.Symbols, notification.Symbol()) ||
+		!matchesAny(r.Actions, notification.Action()) ||
+		!matchesAny(r.Exchanges, notification.Exchange()) ||
+		!matchesAny(r.Users, notification.UserName) ||
+		!matchesAny(r.APISecs, apiSec) ||
+		!matchesAny(r.Statuses, status) {
+		return false
+	}
+
+	if r.message != nil {
+		if notification.Alert == nil {
+			return false
+		}
+		return r.message.MatchString(notification.Alert.Message) || r.message.MatchString(notification.Alert.RawPayload)
+	}
+
+	return true
+}
+
+// matchesAny reports whether the value is in the list; an empty list matches everything
+func matchesAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// route returns the endpoint names a notification is routed to
+func (r *router) route(notification *Notification) RouteResult {
+	result := RouteResult{Endpoints: []string{}, MatchedRules: []string{}}
+	seen := make(map[string]bool)
+
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if !rule.matches(notification) {
+			continue
+		}
+
+		result.MatchedRules = append(result.MatchedRules, rule.Name)
+		for _, endpoint := range rule.Endpoints {
+			if !seen[endpoint] {
+				seen[endpoint] = true
+				result.Endpoints = append(result.Endpoints, endpoint)
+			}
+		}
+		if rule.Stop {
+			break
+		}
+	}
+
+	if len(result.MatchedRules) == 0 {
+		result.Default = true
+		result.Endpoints = append(result.Endpoints, r.defaultEndpoints...)
+	}
+
+	return result
+}
+
+// Route returns the active endpoints a notification would be forwarded to.
+// Without routing rules every active endpoint that is not exclusive receives every notification.
+func (s *ForwardService) Route(notification *Notification) RouteResult {
+	if s.config == nil {
+		return RouteResult{Endpoints: []string{}, MatchedRules: []string{}}
+	}
+
+	var result RouteResult
+	if len(s.config.Routing.Rules) == 0 {
+		result = RouteResult{Endpoints: []string{}, MatchedRules: []string{}, Default: true}
+		for _, endpoint := range s.config.Endpoints {
+			if endpoint.IsActive && !endpoint.Exclusive {
+				result.Endpoints = append(result.Endpoints, endpoint.Name)
+			}
+		}
+	} else {
+		result = s.getRouter().route(notification)
+
+		// Only keep endpoints that exist and are active
+		active := result.Endpoints[:0]
+		for _, name := range result.Endpoints {
+			if s.findEndpoint(name) != nil {
+				active = append(active, name)
+			} else {
+				log.Printf("Routing target %s is not a configured active endpoint", name)
+			}
+		}
+		result.Endpoints = active
+	}
+
+	// Executions also go to the notification channels of their user
+	for _, name := range s.userEndpoints(notification) {
+		result.UserEndpoints = append(result.UserEndpoints, name)
+		if !slices.Contains(result.Endpoints, name) {
+			result.Endpoints = append(result.Endpoints, name)
+		}
+	}
+
+	// Signals also go to the notification channels of their strategy
+	for _, name := range s.strategyEndpoints(notification) {
+		result.StrategyEndpoints = append(result.StrategyEndpoints, name)
+		if !slices.Contains(result.Endpoints, name) {
+			result.Endpoints = append(result.Endpoints, name)
+		}
+	}
+
+	return result
+}
+
+// strategyEndpoints returns the active notification channels of the strategy a notification belongs to
+func (s *ForwardService) strategyEndpoints(notification *Notification) []string {
+	key := notification.Strategy()
+	if s.strategies == nil || key == "" || notification.IsPlainText() {
+		return nil
+	}
+
+	strategy, err := s.strategies.Get(key)
+	if err != nil {
+		return nil
+	}
+
+	var endpoints []string
+	for _, name := range strategy.Notify {
+		if s.findEndpoint(name) != nil {
+			endpoints = append(endpoints, name)
+		} else {
+			log.Printf("Notification channel %s of strategy %s is not a configured active endpoint", name, strategy.Key)
+		}
+	}
+	return endpoints
+}
+
+// userEndpoints returns the active notification channels of the user an execution belongs to
+func (s *ForwardService) userEndpoints(notification *Notification) []string {
+	if s.userConfig == nil || notification.Signal == nil || notification.Execution == nil {
+		return nil
+	}
+
+	user := s.userConfig.GetUserByAPISec(notification.Signal.APISec)
+	if user == nil {
+		return nil
+	}
+
+	var endpoints []string
+	for _, name := range user.Notify {
+		if s.findEndpoint(name) != nil {
+			endpoints = append(endpoints, name)
+		} else {
+			log.Printf("Notification channel %s of user %s is not a configured active endpoint", name, user.Name)
+		}
+	}
+	return endpoints
+}
+
+// getRouter returns the compiled router of the current configuration
+func (s *ForwardService) getRouter() *router {
+	s.routerMutex.Lock()
+	defer s.routerMutex.Unlock()
+
+	if s.router == nil {
+		r, err := newRouter(s.config.Routing)
+		if err != nil {
+			// A broken rule set falls back to the default endpoints
+			log.Printf("Failed to compile routing rules: %v", err)
+			r = &router{defaultEndpoints: s.config.Routing.DefaultEndpoints}
+		}
+		s.router = r
+	}
+	return s.router
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteNotifications(t *testing.T) {
+	service := &ForwardService{
+		config: &config.Config{
+			Endpoints: []config.EndpointConfig{
+				{Name: "ops", Type: "telegram", IsActive: true},
+				{Name: "btc", Type: "wechat", IsActive: true},
+				{Name: "news", Type: "dingtalk", IsActive: true},
+				{Name: "archive", Type: "webhook", IsActive: false},
+			},
+			Routing: config.RoutingConfig{
+				DefaultEndpoints: []string{"news"},
+				Rules: []config.RoutingRule{
+					{Name: "failures", Statuses: []string{"failed"}, Endpoints: []string{"ops", "archive"}, Stop: true},
+					{Name: "btc", Symbols: []string{"btcusdt"}, Exchanges: []string{"binance"}, Endpoints: []string{"btc"}},
+					{Name: "alice", Users: []string{"alice"}, Endpoints: []string{"ops", "btc"}},
+					{Name: "breakouts", MessageRegex: `(?i)breakout`, Endpoints: []string{"news"}},
+				},
+			},
+		},
+	}
+
+	signal := &models.TradingViewSignal{Symbol: "BTCUSDT", ExchangeName: "binance", APISec: "secret"}
+
+	tests := []struct {
+		name         string
+		notification *Notification
+		endpoints    []string
+		rules        []string
+		isDefault    bool
+	}{
+		{
+			name: "failed execution stops at the first rule and skips inactive endpoints",
+			notification: &Notification{
+				Alert:     &models.Alert{},
+				Signal:    signal,
+				Execution: &models.TradingSignal{Status: "failed"},
+				UserName:  "alice",
+			},
+			endpoints: []string{"ops"},
+			rules:     []string{"failures"},
+		},
+		{
+			name: "matching rules are combined without duplicates",
+			notification: &Notification{
+				Alert:     &models.Alert{},
+				Signal:    signal,
+				Execution: &models.TradingSignal{Status: "filled"},
+				UserName:  "alice",
+			},
+			endpoints: []string{"btc", "ops"},
+			rules:     []string{"btc", "alice"},
+		},
+		{
+			name:         "message regex",
+			notification: &Notification{Alert: &models.Alert{Strategy: "alert", Message: "ETH Breakout above 4k"}},
+			endpoints:    []string{"news"},
+			rules:        []string{"breakouts"},
+		},
+		{
+			name:         "unmatched alerts go to the default endpoints",
+			notification: &Notification{Alert: &models.Alert{Strategy: "alert", Message: "hello"}},
+			endpoints:    []string{"news"},
+			rules:        []string{},
+			isDefault:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := service.Route(tt.notification)
+			assert.Equal(t, tt.endpoints, result.Endpoints)
+			assert.Equal(t, tt.rules, result.MatchedRules)
+			assert.Equal(t, tt.isDefault, result.Default)
+		})
+	}
+}
+
+func TestRouteWithoutRulesReachesAllActiveEndpoints(t *testing.T) {
+	service := &ForwardService{
+		config: &config.Config{
+			Endpoints: []config.EndpointConfig{
+				{Name: "a", IsActive: true},
+				{Name: "b", IsActive: false},
+				{Name: "c", IsActive: true},
+			},
+		},
+	}
+
+	result := service.Route(&Notification{Alert: &models.Alert{}})
+	assert.Equal(t, []string{"a", "c"}, result.Endpoints)
+	assert.True(t, result.Default)
+}
+
+func TestInvalidRoutingRule(t *testing.T) {
+	_, err := newRouter(config.RoutingConfig{Rules: []config.RoutingRule{{Name: "bad", MessageRegex: "("}}})
+	assert.ErrorContains(t, err, "invalid message_regex")
+}
+
+func TestRouteUserNotificationChannels(t *testing.T) {
+	service := &ForwardService{
+		config: &config.Config{
+			Endpoints: []config.EndpointConfig{
+				{Name: "ops", Type: "telegram", IsActive: true},
+				{Name: "alice-dm", Type: "telegram", IsActive: true, Exclusive: true},
+				{Name: "bob-mail", Type: "email", IsActive: false},
+				{Name: "desk", Type: "slack", IsActive: true},
+			},
+		},
+		userConfig: &config.UserConfig{
+			Users: []config.UserConfigEntry{
+				{APISec: "alice-secret", Name: "alice", Notify: []string{"alice-dm"}},
+				{APISec: "bob-secret", Name: "bob", Notify: []string{"bob-mail"}},
+				{APISec: "carol-secret", Name: "carol", Notify: []string{"desk"}},
+			},
+		},
+	}
+
+	// Executions reach the user's own channel in addition to the routed endpoints
+	alice := &Notification{
+		Alert:     &models.Alert{},
+		Signal:    &models.TradingViewSignal{APISec: "alice-secret"},
+		Execution: &models.TradingSignal{Status: "filled"},
+	}
+	result := service.Route(alice)
+	assert.Equal(t, []string{"ops", "desk", "alice-dm"}, result.Endpoints)
+	assert.Equal(t, []string{"alice-dm"}, result.UserEndpoints)
+
+	// Exclusive channels of other users stay private, inactive channels are skipped
+	bob := &Notification{
+		Alert:     &models.Alert{},
+		Signal:    &models.TradingViewSignal{APISec: "bob-secret"},
+		Execution: &models.TradingSignal{Status: "failed"},
+	}
+	result = service.Route(bob)
+	assert.Equal(t, []string{"ops", "desk"}, result.Endpoints)
+	assert.Empty(t, result.UserEndpoints)
+
+	// Alerts without an execution are not sent to exclusive user channels; the channels of
+	// users that are not exclusive keep receiving the default broadcast
+	result = service.Route(&Notification{Alert: &models.Alert{Strategy: "alert"}})
+	assert.Equal(t, []string{"ops", "desk"}, result.Endpoints)
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/database"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"gorm.io/gorm"
+)
+
+// DefaultShadowWindow is how far apart a shadow order and a live order of the same signal may be
+const DefaultShadowWindow = time.Minute
+
+// Divergences between a shadow order and the live order of the same signal
+const (
+	DivergenceMissingLive   = "missing_live"   // The live account placed no order for the shadow order
+	DivergenceMissingShadow = "missing_shadow" // The shadow account prepared no order for the live order
+	DivergenceLiveFailed    = "live_failed"    // The live order could not be placed
+	DivergenceSide          = "side"
+	DivergenceType          = "type"
+	DivergenceQuantity      = "quantity"
+	DivergencePrice         = "price"
+	DivergenceReduceOnly    = "reduce_only"
+)
+
+// LiveOrder is the order a live trading signal placed, with the request it was built from and its fill
+type LiveOrder struct {
+	TradingSignalID uint      `json:"trading_signal_id"`
+	StrategyID      uint      `json:"strategy_id,omitempty"`
+	Exchange        string    `json:"exchange"`
+	Symbol          string    `json:"symbol"`
+	Side            string    `json:"side"`
+	Type            string    `json:"type"`
+	Quantity        string    `json:"quantity"`
+	Price           string    `json:"price,omitempty"`
+	ReduceOnly      bool      `json:"reduce_only"`
+	OrderID         string    `json:"order_id,omitempty"`
+	FilledQuantity  string    `json:"filled_quantity,omitempty"`
+	AvgPrice        string    `json:"avg_price,omitempty"`
+	Status          string    `json:"status"`
+	ErrorMessage    string    `json:"error_message,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// ShadowPair is a shadow order next to the live order of the same signal. One side is nil when the
+// other account has no matching order.
+type ShadowPair struct {
+	Shadow      *models.ShadowOrder `json:"shadow"`
+	Live        *LiveOrder          `json:"live"`
+	Divergences []string            `json:"divergences"`
+}
+
+// ShadowComparison lines up the orders of an account in shadow mode with those of a live account
+type ShadowComparison struct {
+	From     time.Time    `json:"from"`
+	To       time.Time    `json:"to"`
+	Window   string       `json:"window"`
+	Matched  int          `json:"matched"`  // Pairs without divergences
+	Diverged int          `json:"diverged"` // Pairs with at least one divergence
+	Pairs    []ShadowPair `json:"pairs"`
+}
+
+// ShadowCompareRequest selects the orders to compare
+type ShadowCompareRequest struct {
+	ShadowUserID   uint
+	ShadowExchange string // All exchanges when empty
+	LiveUserID     uint
+	LiveExchange   string // All exchanges when empty
+	From           time.Time
+	To             time.Time     // Open-ended when zero
+	Window         time.Duration // DefaultShadowWindow when zero
+}
+
+// ShadowService serves the orders stored for accounts in shadow mode
+type ShadowService struct {
+	db         *gorm.DB
+	brokerPool *BrokerPool
+}
+
+// NewShadowService creates a new shadow service
+func NewShadowService() *ShadowService {
+	return &ShadowService{
+		db: database.GetDB(),
+	}
+}
+
+// SetBrokerPool sets the pool the filters of live orders are requested from
+func (s *ShadowService) SetBrokerPool(pool *BrokerPool) {
+	s.brokerPool = pool
+}
+
+// Orders returns the shadow orders of a user in a period, oldest first
+func (s *ShadowService) Orders(userID uint, exchange string, from, to time.Time) ([]models.ShadowOrder, error) {
+	query := s.db.Where("user_id = ? AND created_at >= ?", userID, from)
+	if !to.IsZero() {
+		query = query.Where("created_at <= ?", to)
+	}
+	if exchange != "" {
+		query = query.Where("LOWER(exchange) = ?", strings.ToLower(exchange))
+	}
+
+	var orders []models.ShadowOrder
+	if err := query.Order("created_at, id").Find(&orders).Error; err != nil {
+		return nil, fmt.Errorf("failed to get shadow orders: %w", err)
+	}
+	return orders, nil
+}
+
+// LiveOrders returns the orders live trading signals of a user placed or failed to place in a
+// period, oldest first
+func (s *ShadowService) LiveOrders(ctx context.Context, userID uint, exchange string, from, to time.Time) ([]LiveOrder, error) {
+	query := s.db.Where("user_id = ? AND created_at >= ? AND status <> ?", userID, from, "shadow")
+	if !to.IsZero() {
+		query = query.Where("created_at <= ?", to)
+	}
+	if exchange != "" {
+		query = query.Where("LOWER(exchange) = ?", strings.ToLower(exchange))
+	}
+
+	var signals []models.TradingSignal
+	if err := query.Order("created_at, id").Find(&signals).Error; err != nil {
+		return nil, fmt.Errorf("failed to get trading signals: %w", err)
+	}
+
+	var orders []LiveOrder
+	for _, signal := range signals {
+		// The request is built again from the stored signal the same way it was when it was placed
+		req, err := signalOrderRequest(&signal)
+		if err != nil || req == nil {
+			continue
+		}
+		exchange := strings.ToLower(signal.Exchange)
+		// Orders below the step size failed before they were placed and are listed as built
+		if rounded := *req; roundOrder(ctx, s.brokerPool, exchange, &rounded) == nil {
+			req = &rounded
+		}
+		orders = append(orders, LiveOrder{
+			TradingSignalID: signal.ID,
+			StrategyID:      signal.StrategyID,
+			Exchange:        exchange,
+			Symbol:          broker.FormatSymbol(req.Symbol, exchange),
+			Side:            string(req.Side),
+			Type:            string(req.Type),
+			Quantity:        req.Quantity,
+			Price:           req.Price,
+			ReduceOnly:      req.ReduceOnly,
+			OrderID:         signal.OrderID,
+			FilledQuantity:  signal.FilledQuantity,
+			AvgPrice:        signal.AvgPrice,
+			Status:          signal.Status,
+			ErrorMessage:    signal.ErrorMessage,
+			CreatedAt:       signal.CreatedAt,
+		})
+	}
+	return orders, nil
+}
+
+// Compare pairs every shadow order with the live order of the same strategy and symbol closest in
+// time within the window, and lists how they diverge. Orders without a partner are paired with nil.
+func (s *ShadowService) Compare(ctx context.Context, req *ShadowCompareRequest) (*ShadowComparison, error) {
+	window := req.Window
+	if window <= 0 {
+		window = DefaultShadowWindow
+	}
+
+	shadowOrders, err := s.Orders(req.ShadowUserID, req.ShadowExchange, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+	liveOrders, err := s.LiveOrders(ctx, req.LiveUserID, req.LiveExchange, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &ShadowComparison{From: req.From, To: req.To, Window: window.String(), Pairs: []ShadowPair{}}
+	paired := make([]bool, len(liveOrders))
+	for i := range shadowOrders {
+		shadow := &shadowOrders[i]
+		match := -1
+		for j := range liveOrders {
+			live := &liveOrders[j]
+			if paired[j] || live.StrategyID != shadow.StrategyID || baseSymbol(live.Symbol) != baseSymbol(shadow.Symbol) {
+				continue
+			}
+			gap := abs(float64(live.CreatedAt.Sub(shadow.CreatedAt)))
+			if gap > float64(window) {
+				continue
+			}
+			if match < 0 || gap < abs(float64(liveOrders[match].CreatedAt.Sub(shadow.CreatedAt))) {
+				match = j
+			}
+		}
+
+		pair := ShadowPair{Shadow: shadow, Divergences: []string{DivergenceMissingLive}}
+		if match >= 0 {
+			paired[match] = true
+			pair.Live = &liveOrders[match]
+			pair.Divergences = orderDivergences(shadow, pair.Live)
+		}
+		comparison.Pairs = append(comparison.Pairs, pair)
+	}
+	for j := range liveOrders {
+		if !paired[j] {
+			comparison.Pairs = append(comparison.Pairs, ShadowPair{Live: &liveOrders[j], Divergences: []string{DivergenceMissingShadow}})
+		}
+	}
+
+	sort.SliceStable(comparison.Pairs, func(i, j int) bool {
+		return comparison.Pairs[i].time().Before(comparison.Pairs[j].time())
+	})
+	for _, pair := range comparison.Pairs {
+		if len(pair.Divergences) == 0 {
+			comparison.Matched++
+		} else {
+			comparison.Diverged++
+		}
+	}
+	return comparison, nil
+}
+
+// time returns when the signal of a pair was received
+func (p *ShadowPair) time() time.Time {
+	if p.Shadow != nil {
+		return p.Shadow.CreatedAt
+	}
+	return p.Live.CreatedAt
+}
+
+// orderDivergences lists the fields a shadow order and a live order differ in
+func orderDivergences(shadow *models.ShadowOrder, live *LiveOrder) []string {
+	divergences := []string{}
+	if live.Status == "failed" {
+		divergences = append(divergences, DivergenceLiveFailed)
+	}
+	if shadow.Side != live.Side {
+		divergences = append(divergences, DivergenceSide)
+	}
+	if shadow.Type != live.Type {
+		divergences = append(divergences, DivergenceType)
+	}
+	if abs(parseAmount(shadow.Quantity)-parseAmount(live.Quantity)) > positionEpsilon {
+		divergences = append(divergences, DivergenceQuantity)
+	}
+	if abs(parseAmount(shadow.Price)-parseAmount(live.Price)) > positionEpsilon {
+		divergences = append(divergences, DivergencePrice)
+	}
+	if shadow.ReduceOnly != live.ReduceOnly {
+		divergences = append(divergences, DivergenceReduceOnly)
+	}
+	return divergences
+}
+
+// baseSymbol strips the separators exchanges write symbols with, so BTC-USDT matches BTCUSDT
+func baseSymbol(symbol string) string {
+	return strings.NewReplacer("-", "", "_", "", "/", "").Replace(strings.ToUpper(symbol))
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipelineShadowMode(t *testing.T) {
+	db := newTestDB(t)
+	pool, created := newTestPool(t, db)
+	service := newTestTradingService(t, db, pool)
+	service.SetLedger(&LedgerService{db: db})
+	service.userService.SetUserConfig(&config.UserConfig{Users: []config.UserConfigEntry{{
+		APISec:      "follower",
+		Name:        "Follower",
+		IsActive:    true,
+		Credentials: []config.UserCredentialConfig{{Exchange: "binance", IsActive: true, Shadow: true}},
+	}}})
+
+	// The order is prepared and stored, but no client is taken and nothing is placed
+	execution := &Execution{Body: []byte(`{"api_sec":"follower","symbol":"btcusdt","exchange":"Binance","action":"buy","price":"100","prev_market_position_size":"0","market_position_size":"1"}`)}
+	require.NoError(t, service.Execute(context.Background(), execution))
+	assert.Empty(t, *created)
+	assert.Equal(t, "shadow", execution.Record.Status)
+
+	var orders []models.ShadowOrder
+	require.NoError(t, db.Find(&orders).Error)
+	require.Len(t, orders, 1)
+	assert.Equal(t, execution.Record.ID, orders[0].TradingSignalID)
+	assert.Equal(t, execution.User.ID, orders[0].UserID)
+	assert.Equal(t, "binance", orders[0].Exchange)
+	assert.Equal(t, "BTCUSDT", orders[0].Symbol)
+	assert.Equal(t, "BUY", orders[0].Side)
+	assert.Equal(t, "MARKET", orders[0].Type)
+	assert.Equal(t, "1.00000000", orders[0].Quantity)
+	assert.False(t, orders[0].ReduceOnly)
+
+	// The position and the ledger stay untouched
+	positions, err := service.userService.GetUserPositions(execution.User.ID)
+	require.NoError(t, err)
+	assert.Empty(t, positions)
+	var trades int64
+	require.NoError(t, db.Model(&models.Trade{}).Count(&trades).Error)
+	assert.Zero(t, trades)
+
+	// Other exchanges of the user trade live
+	execution = &Execution{Body: []byte(`{"api_sec":"follower","symbol":"BTCUSDT","exchange":"okx","action":"buy","price":"100","prev_market_position_size":"0","market_position_size":"1"}`)}
+	require.NoError(t, service.Execute(context.Background(), execution))
+	assert.Equal(t, "failed", execution.Record.Status)
+	assert.Contains(t, execution.Record.ErrorMessage, "unsupported exchange")
+	assert.Nil(t, execution.ShadowOrder)
+}
+
+func TestCompareShadowOrders(t *testing.T) {
+	db := newTestDB(t)
+	service := &ShadowService{db: db}
+	start := time.Date(2025, 9, 7, 9, 0, 0, 0, time.UTC)
+
+	shadowOrders := []models.ShadowOrder{
+		{UserID: 1, StrategyID: 7, Exchange: "okx", Symbol: "BTC-USDT", Side: "BUY", Type: "MARKET", Quantity: "1.00000000", CreatedAt: start},
+		{UserID: 1, StrategyID: 7, Exchange: "okx", Symbol: "BTC-USDT", Side: "SELL", Type: "MARKET", Quantity: "1.00000000", ReduceOnly: true, CreatedAt: start.Add(time.Hour)},
+		{UserID: 1, StrategyID: 7, Exchange: "okx", Symbol: "ETH-USDT", Side: "BUY", Type: "MARKET", Quantity: "2.00000000", CreatedAt: start.Add(3 * time.Hour)},
+	}
+	require.NoError(t, db.Create(&shadowOrders).Error)
+	signals := []models.TradingSignal{
+		{UserID: 2, StrategyID: 7, Symbol: "BTCUSDT", Exchange: "binance", Action: "buy", PrevMarketPositionSize: "0", MarketPositionSize: "1", Status: "filled", CreatedAt: start.Add(2 * time.Second)},
+		{UserID: 2, StrategyID: 7, Symbol: "BTCUSDT", Exchange: "binance", Action: "sell", PrevMarketPositionSize: "1", MarketPositionSize: "0.5", Status: "filled", CreatedAt: start.Add(time.Hour + time.Second)},
+		{UserID: 2, StrategyID: 7, Symbol: "BTCUSDT", Exchange: "binance", Action: "sell", PrevMarketPositionSize: "0.5", MarketPositionSize: "0", Status: "failed", CreatedAt: start.Add(2 * time.Hour)},
+		{UserID: 1, StrategyID: 7, Symbol: "BTCUSDT", Exchange: "okx", Action: "buy", PrevMarketPositionSize: "0", MarketPositionSize: "1", Status: "shadow", CreatedAt: start},
+	}
+	require.NoError(t, db.Create(&signals).Error)
+
+	comparison, err := service.Compare(context.Background(), &ShadowCompareRequest{ShadowUserID: 1, LiveUserID: 2, From: start.Add(-time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, comparison.Pairs, 4)
+	assert.Equal(t, 1, comparison.Matched)
+	assert.Equal(t, 3, comparison.Diverged)
+
+	// Orders are paired across exchanges by strategy, symbol and time
+	assert.Empty(t, comparison.Pairs[0].Divergences)
+	assert.Equal(t, signals[0].ID, comparison.Pairs[0].Live.TradingSignalID)
+	assert.Equal(t, []string{DivergenceQuantity}, comparison.Pairs[1].Divergences)
+	assert.Equal(t, "0.50000000", comparison.Pairs[1].Live.Quantity)
+
+	assert.Nil(t, comparison.Pairs[2].Shadow)
+	assert.Equal(t, []string{DivergenceMissingShadow}, comparison.Pairs[2].Divergences)
+	assert.Equal(t, "failed", comparison.Pairs[2].Live.Status)
+	assert.Nil(t, comparison.Pairs[3].Live)
+	assert.Equal(t, []string{DivergenceMissingLive}, comparison.Pairs[3].Divergences)
+
+	// Orders further apart than the window are not paired
+	comparison, err = service.Compare(context.Background(), &ShadowCompareRequest{ShadowUserID: 1, LiveUserID: 2, From: start.Add(-time.Hour), Window: 500 * time.Millisecond})
+	require.NoError(t, err)
+	assert.Zero(t, comparison.Matched)
+	assert.Len(t, comparison.Pairs, 6)
+}
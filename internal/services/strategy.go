@@ -0,0 +1,178 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/database"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrStrategyNotFound is returned for strategy keys that are not stored
+var ErrStrategyNotFound = errors.New("strategy not found")
+
+// StrategyRequest creates a strategy or updates the fields that are set
+type StrategyRequest struct {
+	Key            string             `json:"key"` // Ignored on updates
+	Name           string             `json:"name"`
+	Description    string             `json:"description"`
+	Enabled        *bool              `json:"enabled"`         // New strategies are enabled when unset
+	SizeMultiplier *float64           `json:"size_multiplier"` // New strategies use 1 when unset
+	Risk           *config.RiskConfig `json:"risk"`
+	Notify         []string           `json:"notify"` // An empty list removes the channels, null keeps them
+}
+
+// StrategyService manages the strategies signals are grouped by. Strategies are created with their
+// defaults on the first signal naming them and can be configured through the API afterwards.
+type StrategyService struct {
+	db    *gorm.DB
+	mutex sync.Mutex
+}
+
+// NewStrategyService creates a new strategy service
+func NewStrategyService() *StrategyService {
+	return &StrategyService{
+		db: database.GetDB(),
+	}
+}
+
+// Resolve returns the strategy of a key, creating it enabled and unscaled when it is not stored yet.
+// An empty key resolves to nil.
+func (s *StrategyService) Resolve(key string) (*models.Strategy, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return nil, nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	strategy, err := s.Get(key)
+	if !errors.Is(err, ErrStrategyNotFound) {
+		return strategy, err
+	}
+
+	strategy = &models.Strategy{
+		Key:            key,
+		Name:           key,
+		Enabled:        true,
+		SizeMultiplier: 1,
+	}
+	if err := s.db.Create(strategy).Error; err != nil {
+		return nil, fmt.Errorf("failed to create strategy: %w", err)
+	}
+	return strategy, nil
+}
+
+// Get returns the strategy of a key
+func (s *StrategyService) Get(key string) (*models.Strategy, error) {
+	var strategy models.Strategy
+	err := s.db.Where(&models.Strategy{Key: key}).First(&strategy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrStrategyNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get strategy: %w", err)
+	}
+	return &strategy, nil
+}
+
+// List returns every strategy in the order they were created
+func (s *StrategyService) List() ([]models.Strategy, error) {
+	var strategies []models.Strategy
+	if err := s.db.Order("id").Find(&strategies).Error; err != nil {
+		return nil, fmt.Errorf("failed to get strategies: %w", err)
+	}
+	return strategies, nil
+}
+
+// Create stores a new strategy
+func (s *StrategyService) Create(req *StrategyRequest) (*models.Strategy, error) {
+	key := strings.TrimSpace(req.Key)
+	if key == "" {
+		return nil, fmt.Errorf("key is required")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.Get(key); err == nil {
+		return nil, fmt.Errorf("strategy %s already exists", key)
+	} else if !errors.Is(err, ErrStrategyNotFound) {
+		return nil, err
+	}
+
+	strategy := &models.Strategy{Key: key, Name: key, Enabled: true, SizeMultiplier: 1}
+	if err := applyStrategyRequest(strategy, req); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(strategy).Error; err != nil {
+		return nil, fmt.Errorf("failed to create strategy: %w", err)
+	}
+	return strategy, nil
+}
+
+// Update changes the fields of a strategy that are set in the request
+func (s *StrategyService) Update(key string, req *StrategyRequest) (*models.Strategy, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	strategy, err := s.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyStrategyRequest(strategy, req); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(strategy).Error; err != nil {
+		return nil, fmt.Errorf("failed to save strategy: %w", err)
+	}
+	return strategy, nil
+}
+
+// Delete removes a strategy. Signals, orders and trades keep their strategy ID, and the strategy is
+// created again with its defaults on its next signal.
+func (s *StrategyService) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	strategy, err := s.Get(key)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Delete(strategy).Error; err != nil {
+		return fmt.Errorf("failed to delete strategy: %w", err)
+	}
+	return nil
+}
+
+// applyStrategyRequest copies the fields set in a request onto a strategy
+func applyStrategyRequest(strategy *models.Strategy, req *StrategyRequest) error {
+	if req.SizeMultiplier != nil && *req.SizeMultiplier <= 0 {
+		return fmt.Errorf("size_multiplier must be positive")
+	}
+
+	if req.Name != "" {
+		strategy.Name = req.Name
+	}
+	if req.Description != "" {
+		strategy.Description = req.Description
+	}
+	if req.Enabled != nil {
+		strategy.Enabled = *req.Enabled
+	}
+	if req.SizeMultiplier != nil {
+		strategy.SizeMultiplier = *req.SizeMultiplier
+	}
+	if req.Risk != nil {
+		strategy.Risk = req.Risk
+	}
+	if req.Notify != nil {
+		strategy.Notify = req.Notify
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrategyService(t *testing.T) {
+	db := newTestDB(t)
+	service := &StrategyService{db: db}
+
+	// Strategies are created enabled and unscaled on their first signal
+	strategy, err := service.Resolve("grid")
+	require.NoError(t, err)
+	assert.Equal(t, "grid", strategy.Name)
+	assert.True(t, strategy.Enabled)
+	assert.Equal(t, 1.0, strategy.SizeMultiplier)
+
+	again, err := service.Resolve("grid")
+	require.NoError(t, err)
+	assert.Equal(t, strategy.ID, again.ID)
+
+	none, err := service.Resolve(" ")
+	require.NoError(t, err)
+	assert.Nil(t, none)
+
+	// Updates only change the fields that are set
+	disabled := false
+	multiplier := 0.5
+	updated, err := service.Update("grid", &StrategyRequest{Enabled: &disabled, SizeMultiplier: &multiplier,
+		Risk: &config.RiskConfig{MaxLeverage: 3}, Notify: []string{"grid-channel"}})
+	require.NoError(t, err)
+	assert.False(t, updated.Enabled)
+	assert.Equal(t, "grid", updated.Name)
+
+	stored, err := service.Get("grid")
+	require.NoError(t, err)
+	assert.False(t, stored.Enabled)
+	assert.Equal(t, 0.5, stored.SizeMultiplier)
+	require.NotNil(t, stored.Risk)
+	assert.Equal(t, 3, stored.Risk.MaxLeverage)
+	assert.Equal(t, []string{"grid-channel"}, stored.Notify)
+
+	invalid := -1.0
+	_, err = service.Update("grid", &StrategyRequest{SizeMultiplier: &invalid})
+	assert.ErrorContains(t, err, "size_multiplier must be positive")
+	_, err = service.Create(&StrategyRequest{Key: "grid"})
+	assert.ErrorContains(t, err, "already exists")
+
+	// Deleted strategies are created again with their defaults
+	require.NoError(t, service.Delete("grid"))
+	_, err = service.Get("grid")
+	assert.ErrorIs(t, err, ErrStrategyNotFound)
+	assert.ErrorIs(t, service.Delete("grid"), ErrStrategyNotFound)
+
+	recreated, err := service.Resolve("grid")
+	require.NoError(t, err)
+	assert.True(t, recreated.Enabled)
+}
+
+func TestPipelineAppliesStrategies(t *testing.T) {
+	db := newTestDB(t)
+	pool, created := newTestPool(t, db)
+	newTestCredential(t, db, 1, "secret")
+	service := newTestTradingService(t, db, pool)
+	strategies := &StrategyService{db: db}
+	service.SetStrategyService(strategies)
+	service.SetLedger(&LedgerService{db: db})
+
+	multiplier := 2.0
+	_, err := strategies.Create(&StrategyRequest{Key: "grid", SizeMultiplier: &multiplier, Risk: &config.RiskConfig{MaxLeverage: 5}})
+	require.NoError(t, err)
+
+	_, release, err := pool.Get(context.Background(), 1, "binance")
+	require.NoError(t, err)
+	release()
+	client := (*created)[0]
+
+	// The sizes are scaled by the multiplier before they are checked and ordered
+	filled := &broker.Order{ID: "1", Symbol: "BTCUSDT", Status: broker.OrderStatusFilled, ExecutedQuantity: "1", AvgPrice: "100"}
+	client.On("PlaceOrder", mock.Anything, mock.MatchedBy(func(req *broker.OrderRequest) bool {
+		return req.Symbol == "BTCUSDT" && req.Quantity == "1.00000000"
+	})).Return(filled, nil).Once()
+
+	execution := &Execution{Body: []byte(`{"api_sec":"secret","strategy":"grid","symbol":"BTCUSDT","exchange":"binance","action":"buy","price":"100","lever":2,"prev_market_position_size":"0","market_position_size":"0.5"}`)}
+	require.NoError(t, service.Execute(context.Background(), execution))
+	client.AssertExpectations(t)
+	require.NotNil(t, execution.Strategy)
+	assert.Equal(t, "filled", execution.Record.Status)
+	assert.Equal(t, "1", execution.Record.MarketPositionSize)
+	assert.Equal(t, execution.Strategy.ID, execution.Record.StrategyID)
+	assert.Equal(t, "grid", execution.Alert.Strategy)
+
+	var trade models.Trade
+	require.NoError(t, db.First(&trade).Error)
+	assert.Equal(t, execution.Strategy.ID, trade.StrategyID)
+	assert.Equal(t, "grid", trade.Strategy)
+
+	// The strategy's limits replace the global ones
+	execution = &Execution{Body: []byte(`{"api_sec":"secret","strategy":"grid","symbol":"BTCUSDT","exchange":"binance","action":"buy","price":"100","lever":10,"prev_market_position_size":"0.5","market_position_size":"1"}`)}
+	require.NoError(t, service.Execute(context.Background(), execution))
+	assert.Equal(t, "failed", execution.Record.Status)
+	assert.Equal(t, RiskRuleMaxLeverage, execution.Record.RiskRule)
+
+	// Signals of a disabled strategy are recorded as failed
+	disabled := false
+	_, err = strategies.Update("grid", &StrategyRequest{Enabled: &disabled})
+	require.NoError(t, err)
+	execution = &Execution{Body: []byte(`{"api_sec":"secret","strategy":"grid","symbol":"BTCUSDT","exchange":"binance","action":"sell","price":"100","prev_market_position_size":"0.5","market_position_size":"0"}`)}
+	require.NoError(t, service.Execute(context.Background(), execution))
+	assert.Equal(t, "failed", execution.Record.Status)
+	assert.Equal(t, "RISK_REJECTED", execution.Record.ErrorCode)
+	assert.Equal(t, RiskRuleStrategyDisabled, execution.Record.RiskRule)
+
+	// Without a strategy key the aid identifies the strategy
+	execution = &Execution{Body: []byte(`{"api_sec":"secret","aid":"12345","symbol":"BTCUSDT","exchange":"bitget","action":"buy","prev_market_position_size":"0","market_position_size":"1"}`)}
+	require.NoError(t, service.Execute(context.Background(), execution))
+	require.NotNil(t, execution.Strategy)
+	assert.Equal(t, "12345", execution.Strategy.Key)
+	assert.Equal(t, "12345", execution.Alert.Strategy)
+}
+
+func TestRouteStrategyNotificationChannels(t *testing.T) {
+	db := newTestDB(t)
+	strategies := &StrategyService{db: db}
+	_, err := strategies.Create(&StrategyRequest{Key: "grid", Notify: []string{"grid-room", "missing"}})
+	require.NoError(t, err)
+
+	service := &ForwardService{
+		config: &config.Config{
+			Endpoints: []config.EndpointConfig{
+				{Name: "ops", Type: "telegram", IsActive: true},
+				{Name: "grid-room", Type: "slack", IsActive: true, Exclusive: true},
+			},
+		},
+		strategies: strategies,
+	}
+
+	// Signals of the strategy reach its channels in addition to the routed endpoints
+	result := service.Route(&Notification{Alert: &models.Alert{}, Signal: &models.TradingViewSignal{Strategy: "grid"}})
+	assert.Equal(t, []string{"ops", "grid-room"}, result.Endpoints)
+	assert.Equal(t, []string{"grid-room"}, result.StrategyEndpoints)
+
+	// Legacy alerts are matched by their strategy name; exclusive channels of other strategies stay private
+	result = service.Route(&Notification{Alert: &models.Alert{Strategy: "grid"}})
+	assert.Equal(t, []string{"ops", "grid-room"}, result.Endpoints)
+	result = service.Route(&Notification{Alert: &models.Alert{}, Signal: &models.TradingViewSignal{AID: "trend"}})
+	assert.Equal(t, []string{"ops"}, result.Endpoints)
+	assert.Empty(t, result.StrategyEndpoints)
+}
+
+func TestStrategyDashboard(t *testing.T) {
+	db := newTestDB(t)
+	ledger := &LedgerService{db: db}
+	strategy := &models.Strategy{Key: "grid", Enabled: true, SizeMultiplier: 1}
+	require.NoError(t, db.Create(strategy).Error)
+
+	from := time.Now().Add(-24 * time.Hour)
+	closedAt := from.Add(2 * time.Hour)
+	trades := []models.Trade{
+		{UserID: 1, Symbol: "BTCUSDT", Strategy: "grid", NetPnL: "10", OpenedAt: from.Add(time.Hour), ClosedAt: &closedAt, Status: models.TradeStatusClosed},
+		{UserID: 2, Symbol: "ETHUSDT", Strategy: "grid", NetPnL: "-4", OpenedAt: from.Add(time.Hour), ClosedAt: &closedAt, Status: models.TradeStatusClosed},
+		{UserID: 1, Symbol: "ETHUSDT", Strategy: "grid", NetPnL: "0", OpenedAt: from.Add(3 * time.Hour), Status: models.TradeStatusOpen},
+		{UserID: 1, Symbol: "BTCUSDT", Strategy: "trend", NetPnL: "50", OpenedAt: from.Add(time.Hour), ClosedAt: &closedAt, Status: models.TradeStatusClosed},
+	}
+	require.NoError(t, db.Create(&trades).Error)
+
+	report, err := ledger.StrategyDashboard(strategy, from, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Total.Trades)
+	assert.Equal(t, 6.0, report.Total.NetPnL)
+	assert.Equal(t, 10.0, report.BySymbol["BTCUSDT"].NetPnL)
+	assert.Equal(t, -4.0, report.BySymbol["ETHUSDT"].NetPnL)
+	assert.Equal(t, 1, report.ByUser[1].Trades)
+	assert.Equal(t, -4.0, report.ByUser[2].NetPnL)
+	require.Len(t, report.OpenTrades, 1)
+	assert.Equal(t, "ETHUSDT", report.OpenTrades[0].Symbol)
+}
@@ -0,0 +1,558 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/database"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/go-resty/resty/v2"
+	"gorm.io/gorm"
+)
+
+// confirmationTimeout is how long a dangerous command waits for confirmation
+const confirmationTimeout = 2 * time.Minute
+
+// BotController is the trading backend the Telegram bot queries and controls
+type BotController interface {
+	GetAllPositions(ctx context.Context, userID uint) (map[string][]broker.Position, error)
+	GetAccountInfo(ctx context.Context, userID uint) (map[string]*broker.AccountInfo, error)
+	CloseAllPositions(ctx context.Context, userID uint) map[string]error
+}
+
+// telegramUpdate is an incoming update from the Bot API
+type telegramUpdate struct {
+	UpdateID      int64                  `json:"update_id"`
+	Message       *telegramMessage       `json:"message"`
+	CallbackQuery *telegramCallbackQuery `json:"callback_query"`
+}
+
+// telegramMessage is a chat message
+type telegramMessage struct {
+	MessageID int64 `json:"message_id"`
+	Chat      struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	Text string `json:"text"`
+}
+
+// telegramCallbackQuery is a press on an inline keyboard button
+type telegramCallbackQuery struct {
+	ID      string           `json:"id"`
+	Message *telegramMessage `json:"message"`
+	Data    string           `json:"data"`
+}
+
+// pendingAction is a dangerous command waiting for confirmation
+type pendingAction struct {
+	chatID    int64
+	run       func(ctx context.Context) string
+	expiresAt time.Time
+}
+
+// TelegramBotService answers monitoring and control commands sent to the Telegram bot
+type TelegramBotService struct {
+	client      *resty.Client
+	config      *config.Config
+	db          *gorm.DB
+	controller  BotController
+	userService *UserService
+	startedAt   time.Time
+	offset      int64
+	pending     map[string]*pendingAction
+	mutex       sync.Mutex
+}
+
+// NewTelegramBotService creates a new Telegram bot service
+func NewTelegramBotService(controller BotController, userService *UserService) *TelegramBotService {
+	return &TelegramBotService{
+		client:      resty.New(),
+		config:      nil, // Will be set later
+		db:          database.GetDB(),
+		controller:  controller,
+		userService: userService,
+		startedAt:   time.Now(),
+		pending:     make(map[string]*pendingAction),
+	}
+}
+
+// SetConfig sets the configuration for the Telegram bot service
+func (s *TelegramBotService) SetConfig(cfg *config.Config) {
+	s.config = cfg
+}
+
+// Start long-polls the Bot API for commands until the context is cancelled
+func (s *TelegramBotService) Start(ctx context.Context) {
+	if s.config == nil || !s.config.TelegramBot.Enabled {
+		return
+	}
+	if _, token := s.botAPI(); token == "" {
+		log.Printf("Telegram bot enabled but no bot token configured")
+		return
+	}
+
+	// Long polling requests stay open for the poll timeout
+	s.client.SetTimeout(s.pollTimeout() + 10*time.Second)
+	log.Printf("Telegram bot started, authorized chats: %v", s.config.TelegramBot.AuthorizedChatIDs)
+
+	for ctx.Err() == nil {
+		if err := s.PollOnce(ctx); err != nil {
+			log.Printf("Telegram bot polling failed: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}
+}
+
+// PollOnce fetches pending updates once and handles them
+func (s *TelegramBotService) PollOnce(ctx context.Context) error {
+	var response struct {
+		OK          bool             `json:"ok"`
+		Description string           `json:"description"`
+		Result      []telegramUpdate `json:"result"`
+	}
+
+	err := s.call(ctx, "getUpdates", map[string]interface{}{
+		"offset":          s.offset,
+		"timeout":         int(s.pollTimeout().Seconds()),
+		"allowed_updates": []string{"message", "callback_query"},
+	}, &response)
+	if err != nil {
+		return err
+	}
+	if !response.OK {
+		return fmt.Errorf("getUpdates failed: %s", response.Description)
+	}
+
+	for _, update := range response.Result {
+		s.offset = update.UpdateID + 1
+		s.handleUpdate(ctx, update)
+	}
+
+	return nil
+}
+
+// handleUpdate dispatches an update from an authorized chat
+func (s *TelegramBotService) handleUpdate(ctx context.Context, update telegramUpdate) {
+	switch {
+	case update.Message != nil:
+		if !s.isAuthorized(update.Message.Chat.ID) {
+			log.Printf("Ignoring Telegram command from unauthorized chat %d", update.Message.Chat.ID)
+			return
+		}
+		s.handleCommand(ctx, update.Message.Chat.ID, update.Message.Text)
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		if !s.isAuthorized(update.CallbackQuery.Message.Chat.ID) {
+			log.Printf("Ignoring Telegram callback from unauthorized chat %d", update.CallbackQuery.Message.Chat.ID)
+			return
+		}
+		s.handleCallback(ctx, update.CallbackQuery)
+	}
+}
+
+// handleCommand executes a bot command and replies with its result
+func (s *TelegramBotService) handleCommand(ctx context.Context, chatID int64, text string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return
+	}
+
+	// Commands may be addressed to the bot as /command@botname
+	command := strings.ToLower(strings.SplitN(fields[0], "@", 2)[0])
+	args := fields[1:]
+
+	var reply string
+	switch command {
+	case "/start", "/help":
+		reply = botHelp
+	case "/status":
+		reply = s.statusCommand()
+	case "/positions":
+		reply = s.forEachUser(args, func(user *models.User) string { return s.positionsCommand(ctx, user) })
+	case "/balance":
+		reply = s.forEachUser(args, func(user *models.User) string { return s.balanceCommand(ctx, user) })
+	case "/signals":
+		reply = s.signalsCommand(args)
+	case "/pause":
+		reply = s.withUser(args, func(user *models.User) string {
+			s.confirm(ctx, chatID, fmt.Sprintf("Pause trading for <b>%s</b>?", html.EscapeString(user.Name)), func(ctx context.Context) string {
+				return s.setUserActive(user, false)
+			})
+			return ""
+		})
+	case "/resume":
+		reply = s.withUser(args, func(user *models.User) string { return s.setUserActive(user, true) })
+	case "/closeall":
+		reply = s.withUser(args, func(user *models.User) string {
+			s.confirm(ctx, chatID, fmt.Sprintf("Close <b>all</b> positions of <b>%s</b>?", html.EscapeString(user.Name)), func(ctx context.Context) string {
+				return s.closeAllCommand(ctx, user)
+			})
+			return ""
+		})
+	default:
+		reply = "Unknown command. Send /help for the list of commands."
+	}
+
+	if reply != "" {
+		s.sendMessage(ctx, chatID, reply, nil)
+	}
+}
+
+// botHelp lists the available commands
+const botHelp = `<b>Available commands</b>
+/status - service status
+/positions [user] - open positions
+/balance [user] - account balances
+/signals [user] [count] - recent trading signals
+/pause &lt;user&gt; - pause trading for a user
+/resume &lt;user&gt; - resume trading for a user
+/closeall &lt;user&gt; - close all positions of a user`
+
+// statusCommand summarizes the state of the service
+func (s *TelegramBotService) statusCommand() string {
+	var sb strings.Builder
+	sb.WriteString("<b>Status</b>\n")
+	sb.WriteString(fmt.Sprintf("Uptime: %s\n", time.Since(s.startedAt).Round(time.Second)))
+
+	if s.db == nil {
+		return sb.String()
+	}
+
+	var activeUsers, pausedUsers, filled, failed, dead int64
+	since := time.Now().Add(-24 * time.Hour)
+	s.db.Model(&models.User{}).Where("is_active = ?", true).Count(&activeUsers)
+	s.db.Model(&models.User{}).Where("is_active = ?", false).Count(&pausedUsers)
+	s.db.Model(&models.TradingSignal{}).Where("status = ? AND created_at >= ?", "filled", since).Count(&filled)
+	s.db.Model(&models.TradingSignal{}).Where("status = ? AND created_at >= ?", "failed", since).Count(&failed)
+	s.db.Model(&models.Delivery{}).Where("status = ?", models.DeliveryStatusDead).Count(&dead)
+
+	sb.WriteString(fmt.Sprintf("Users: %d active, %d paused\n", activeUsers, pausedUsers))
+	sb.WriteString(fmt.Sprintf("Signals (24h): %d filled, %d failed\n", filled, failed))
+	sb.WriteString(fmt.Sprintf("Dead deliveries: %d", dead))
+	return sb.String()
+}
+
+// positionsCommand lists the open positions of a user on all exchanges
+func (s *TelegramBotService) positionsCommand(ctx context.Context, user *models.User) string {
+	positions, err := s.controller.GetAllPositions(ctx, user.ID)
+	if err != nil {
+		return fmt.Sprintf("<b>%s</b>: %s", html.EscapeString(user.Name), html.EscapeString(err.Error()))
+	}
+
+	var lines []string
+	for _, exchange := range sortedKeys(positions) {
+		for _, position := range positions[exchange] {
+			if size, err := strconv.ParseFloat(position.Size, 64); err == nil && size == 0 {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%s %s %s %s @ %s (PnL %s)",
+				html.EscapeString(exchange), html.EscapeString(position.Symbol), html.EscapeString(string(position.PositionSide)),
+				html.EscapeString(position.Size), html.EscapeString(position.EntryPrice), html.EscapeString(position.UnrealizedPnL)))
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No open positions")
+	}
+
+	return fmt.Sprintf("<b>%s</b>\n%s", html.EscapeString(user.Name), strings.Join(lines, "\n"))
+}
+
+// balanceCommand shows the account balances of a user on all exchanges
+func (s *TelegramBotService) balanceCommand(ctx context.Context, user *models.User) string {
+	accounts, err := s.controller.GetAccountInfo(ctx, user.ID)
+	if err != nil {
+		return fmt.Sprintf("<b>%s</b>: %s", html.EscapeString(user.Name), html.EscapeString(err.Error()))
+	}
+
+	var lines []string
+	for _, exchange := range sortedKeys(accounts) {
+		account := accounts[exchange]
+		if account == nil {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: wallet %s, available %s, uPnL %s",
+			html.EscapeString(exchange), html.EscapeString(account.TotalWalletBalance),
+			html.EscapeString(account.AvailableBalance), html.EscapeString(account.TotalUnrealizedPnL)))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No connected exchanges")
+	}
+
+	return fmt.Sprintf("<b>%s</b>\n%s", html.EscapeString(user.Name), strings.Join(lines, "\n"))
+}
+
+// signalsCommand lists the most recent trading signals, optionally of a single user
+func (s *TelegramBotService) signalsCommand(args []string) string {
+	if s.db == nil {
+		return "Database not initialized"
+	}
+
+	limit := 5
+	query := s.db.Preload("User").Order("created_at DESC")
+	for _, arg := range args {
+		if n, err := strconv.Atoi(arg); err == nil && n > 0 {
+			limit = min(n, 50)
+			continue
+		}
+		user, err := s.userService.FindUser(arg)
+		if err != nil {
+			return fmt.Sprintf("Unknown user: %s", html.EscapeString(arg))
+		}
+		query = query.Where("user_id = ?", user.ID)
+	}
+
+	var signals []models.TradingSignal
+	if err := query.Limit(limit).Find(&signals).Error; err != nil {
+		return fmt.Sprintf("Failed to load signals: %s", html.EscapeString(err.Error()))
+	}
+	if len(signals) == 0 {
+		return "No trading signals"
+	}
+
+	lines := []string{"<b>Recent signals</b>"}
+	for _, signal := range signals {
+		line := fmt.Sprintf("#%d %s %s %s %s %s - %s", signal.ID, signal.CreatedAt.Format("01-02 15:04"),
+			html.EscapeString(signal.User.Name), html.EscapeString(signal.Exchange), html.EscapeString(signal.Symbol),
+			html.EscapeString(strings.ToUpper(signal.Action)), html.EscapeString(signal.Status))
+		if signal.ErrorMessage != "" {
+			line += fmt.Sprintf(" (%s)", html.EscapeString(signal.ErrorMessage))
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// setUserActive pauses or resumes trading for a user
+func (s *TelegramBotService) setUserActive(user *models.User, active bool) string {
+	if err := s.userService.SetUserActive(user.ID, active); err != nil {
+		return fmt.Sprintf("Failed to update %s: %s", html.EscapeString(user.Name), html.EscapeString(err.Error()))
+	}
+
+	if active {
+		return fmt.Sprintf("▶️ Trading resumed for <b>%s</b>", html.EscapeString(user.Name))
+	}
+	return fmt.Sprintf("⏸ Trading paused for <b>%s</b>", html.EscapeString(user.Name))
+}
+
+// closeAllCommand closes all positions of a user and reports the result per exchange
+func (s *TelegramBotService) closeAllCommand(ctx context.Context, user *models.User) string {
+	results := s.controller.CloseAllPositions(ctx, user.ID)
+
+	lines := []string{fmt.Sprintf("<b>Close all positions of %s</b>", html.EscapeString(user.Name))}
+	for _, exchange := range sortedKeys(results) {
+		if err := results[exchange]; err != nil {
+			lines = append(lines, fmt.Sprintf("❌ %s: %s", html.EscapeString(exchange), html.EscapeString(err.Error())))
+		} else {
+			lines = append(lines, fmt.Sprintf("✅ %s: closed", html.EscapeString(exchange)))
+		}
+	}
+	if len(results) == 0 {
+		lines = append(lines, "No connected exchanges")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// forEachUser runs a command for the user named in args, or for every active user
+func (s *TelegramBotService) forEachUser(args []string, command func(user *models.User) string) string {
+	if len(args) > 0 {
+		return s.withUser(args, command)
+	}
+
+	users, err := s.userService.GetUsers()
+	if err != nil {
+		return fmt.Sprintf("Failed to load users: %s", html.EscapeString(err.Error()))
+	}
+
+	var replies []string
+	for i := range users {
+		if users[i].IsActive {
+			replies = append(replies, command(&users[i]))
+		}
+	}
+	if len(replies) == 0 {
+		return "No active users"
+	}
+	return strings.Join(replies, "\n\n")
+}
+
+// withUser runs a command for the user named by the first argument
+func (s *TelegramBotService) withUser(args []string, command func(user *models.User) string) string {
+	if len(args) == 0 {
+		return "Please specify a user name or api_sec"
+	}
+
+	user, err := s.userService.FindUser(args[0])
+	if err != nil {
+		return fmt.Sprintf("Unknown user: %s", html.EscapeString(args[0]))
+	}
+	return command(user)
+}
+
+// confirm asks for confirmation of a dangerous command with an inline keyboard
+func (s *TelegramBotService) confirm(ctx context.Context, chatID int64, question string, run func(ctx context.Context) string) {
+	token := newConfirmationToken()
+
+	s.mutex.Lock()
+	now := time.Now()
+	for key, action := range s.pending {
+		if now.After(action.expiresAt) {
+			delete(s.pending, key)
+		}
+	}
+	s.pending[token] = &pendingAction{chatID: chatID, run: run, expiresAt: now.Add(confirmationTimeout)}
+	s.mutex.Unlock()
+
+	keyboard := map[string]interface{}{
+		"inline_keyboard": [][]map[string]string{{
+			{"text": "✅ Confirm", "callback_data": "confirm:" + token},
+			{"text": "✖️ Cancel", "callback_data": "cancel:" + token},
+		}},
+	}
+	s.sendMessage(ctx, chatID, question, keyboard)
+}
+
+// handleCallback runs or cancels a confirmed command
+func (s *TelegramBotService) handleCallback(ctx context.Context, query *telegramCallbackQuery) {
+	decision, token, _ := strings.Cut(query.Data, ":")
+
+	s.mutex.Lock()
+	action, exists := s.pending[token]
+	if exists {
+		delete(s.pending, token)
+	}
+	s.mutex.Unlock()
+
+	s.call(ctx, "answerCallbackQuery", map[string]interface{}{"callback_query_id": query.ID}, nil)
+
+	var result string
+	switch {
+	case !exists || action.chatID != query.Message.Chat.ID || time.Now().After(action.expiresAt):
+		result = "This confirmation has expired."
+	case decision == "confirm":
+		result = action.run(ctx)
+	default:
+		result = "Cancelled."
+	}
+
+	// Replace the question so the buttons cannot be pressed again
+	s.call(ctx, "editMessageText", map[string]interface{}{
+		"chat_id":    query.Message.Chat.ID,
+		"message_id": query.Message.MessageID,
+		"text":       result,
+		"parse_mode": "HTML",
+	}, nil)
+}
+
+// sendMessage sends an HTML message, optionally with a reply markup
+func (s *TelegramBotService) sendMessage(ctx context.Context, chatID int64, text string, replyMarkup interface{}) {
+	payload := map[string]interface{}{
+		"chat_id":    chatID,
+		"text":       text,
+		"parse_mode": "HTML",
+	}
+	if replyMarkup != nil {
+		payload["reply_markup"] = replyMarkup
+	}
+
+	if err := s.call(ctx, "sendMessage", payload, nil); err != nil {
+		log.Printf("Failed to send Telegram bot reply: %v", err)
+	}
+}
+
+// call invokes a Bot API method and decodes its response into result if given
+func (s *TelegramBotService) call(ctx context.Context, method string, payload interface{}, result interface{}) error {
+	apiURL, token := s.botAPI()
+
+	resp, err := s.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(payload).
+		Post(fmt.Sprintf("%s/bot%s/%s", apiURL, token, method))
+	if err != nil {
+		return fmt.Errorf("telegram %s request failed: %w", method, err)
+	}
+	if resp.IsError() {
+		return fmt.Errorf("telegram %s returned status %d: %s", method, resp.StatusCode(), resp.String())
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(resp.Body(), result); err != nil {
+			return fmt.Errorf("failed to decode telegram %s response: %w", method, err)
+		}
+	}
+	return nil
+}
+
+// botAPI returns the Bot API base URL and token, taken from the bot configuration
+// or from the configured Telegram endpoint
+func (s *TelegramBotService) botAPI() (string, string) {
+	botConfig := s.config.TelegramBot
+	apiURL, token := botConfig.APIURL, botConfig.Token
+
+	for _, endpoint := range s.config.Endpoints {
+		if endpoint.Type != "telegram" || (botConfig.Endpoint != "" && endpoint.Name != botConfig.Endpoint) {
+			continue
+		}
+		if token == "" {
+			token = endpoint.Token
+		}
+		if apiURL == "" {
+			apiURL = endpoint.URL
+		}
+		break
+	}
+
+	if apiURL == "" {
+		apiURL = "https://api.telegram.org"
+	}
+	return strings.TrimRight(apiURL, "/"), token
+}
+
+// isAuthorized reports whether a chat may control the bot
+func (s *TelegramBotService) isAuthorized(chatID int64) bool {
+	for _, authorized := range s.config.TelegramBot.AuthorizedChatIDs {
+		if authorized == chatID {
+			return true
+		}
+	}
+	return false
+}
+
+// pollTimeout returns the long polling timeout
+func (s *TelegramBotService) pollTimeout() time.Duration {
+	if s.config.TelegramBot.PollTimeout > 0 {
+		return s.config.TelegramBot.PollTimeout
+	}
+	return 30 * time.Second
+}
+
+// newConfirmationToken returns a random token identifying a pending confirmation
+func newConfirmationToken() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBotAPI is a stand-in for the Telegram Bot API
+type fakeBotAPI struct {
+	mutex   sync.Mutex
+	updates []map[string]interface{}
+	calls   []fakeBotCall
+}
+
+// fakeBotCall is a recorded Bot API call
+type fakeBotCall struct {
+	method  string
+	payload map[string]interface{}
+}
+
+func (f *fakeBotAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !strings.HasPrefix(r.URL.Path, "/botTOKEN/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	method := strings.TrimPrefix(r.URL.Path, "/botTOKEN/")
+
+	var payload map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&payload)
+	f.calls = append(f.calls, fakeBotCall{method: method, payload: payload})
+
+	result := interface{}(true)
+	if method == "getUpdates" {
+		result = f.updates
+		f.updates = nil
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+}
+
+// push queues an update for the next getUpdates call
+func (f *fakeBotAPI) push(update map[string]interface{}) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	update["update_id"] = len(f.calls) + len(f.updates) + 1
+	f.updates = append(f.updates, update)
+}
+
+// sent returns and clears the recorded calls of a method
+func (f *fakeBotAPI) sent(method string) []map[string]interface{} {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var payloads []map[string]interface{}
+	remaining := f.calls[:0]
+	for _, call := range f.calls {
+		if call.method == method {
+			payloads = append(payloads, call.payload)
+		} else {
+			remaining = append(remaining, call)
+		}
+	}
+	f.calls = remaining
+	return payloads
+}
+
+// fakeController is a BotController returning canned data
+type fakeController struct {
+	closed []uint
+}
+
+func (c *fakeController) GetAllPositions(ctx context.Context, userID uint) (map[string][]broker.Position, error) {
+	return map[string][]broker.Position{
+		"binance": {
+			{Symbol: "BTCUSDT", PositionSide: broker.PositionSideLong, Size: "0.5", EntryPrice: "42000", UnrealizedPnL: "120.5"},
+			{Symbol: "ETHUSDT", PositionSide: broker.PositionSideBoth, Size: "0", EntryPrice: "0", UnrealizedPnL: "0"},
+		},
+	}, nil
+}
+
+func (c *fakeController) GetAccountInfo(ctx context.Context, userID uint) (map[string]*broker.AccountInfo, error) {
+	return map[string]*broker.AccountInfo{
+		"binance": {TotalWalletBalance: "1000", AvailableBalance: "800", TotalUnrealizedPnL: "120.5"},
+	}, nil
+}
+
+func (c *fakeController) CloseAllPositions(ctx context.Context, userID uint) map[string]error {
+	c.closed = append(c.closed, userID)
+	return map[string]error{"binance": nil, "okx": errors.New("not connected")}
+}
+
+// message builds a text message update
+func message(chatID int64, text string) map[string]interface{} {
+	return map[string]interface{}{
+		"message": map[string]interface{}{"message_id": 1, "chat": map[string]interface{}{"id": chatID}, "text": text},
+	}
+}
+
+// callback builds an inline keyboard button press update
+func callback(chatID int64, data string) map[string]interface{} {
+	return map[string]interface{}{
+		"callback_query": map[string]interface{}{
+			"id":      "cb",
+			"data":    data,
+			"message": map[string]interface{}{"message_id": 7, "chat": map[string]interface{}{"id": chatID}},
+		},
+	}
+}
+
+func newTestBot(t *testing.T) (*TelegramBotService, *fakeBotAPI, *fakeController, *models.User) {
+	t.Helper()
+
+	api := &fakeBotAPI{}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	db := newTestDB(t)
+	user := &models.User{APISec: "secret", Name: "alice", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+
+	controller := &fakeController{}
+	bot := &TelegramBotService{
+		client:      resty.New(),
+		db:          db,
+		controller:  controller,
+		userService: &UserService{db: db},
+		pending:     make(map[string]*pendingAction),
+		config: &config.Config{
+			Endpoints: []config.EndpointConfig{{Name: "tg", Type: "telegram", URL: server.URL, Token: "TOKEN"}},
+			TelegramBot: config.TelegramBotConfig{
+				Enabled:           true,
+				AuthorizedChatIDs: []int64{42},
+			},
+		},
+	}
+	return bot, api, controller, user
+}
+
+func TestTelegramBotIgnoresUnauthorizedChats(t *testing.T) {
+	bot, api, _, _ := newTestBot(t)
+
+	api.push(message(13, "/status"))
+	require.NoError(t, bot.PollOnce(context.Background()))
+	assert.Empty(t, api.sent("sendMessage"))
+
+	// The offset acknowledges handled updates
+	api.sent("getUpdates")
+	require.NoError(t, bot.PollOnce(context.Background()))
+	assert.Equal(t, float64(bot.offset), api.sent("getUpdates")[0]["offset"])
+}
+
+func TestTelegramBotQueries(t *testing.T) {
+	bot, api, _, _ := newTestBot(t)
+
+	api.push(message(42, "/positions alice"))
+	api.push(message(42, "/balance@tvforward_bot"))
+	api.push(message(42, "/status"))
+	api.push(message(42, "/positions bob"))
+	require.NoError(t, bot.PollOnce(context.Background()))
+
+	replies := api.sent("sendMessage")
+	require.Len(t, replies, 4)
+	assert.Equal(t, "<b>alice</b>\nbinance BTCUSDT LONG 0.5 @ 42000 (PnL 120.5)", replies[0]["text"])
+	assert.Contains(t, replies[1]["text"], "binance: wallet 1000, available 800, uPnL 120.5")
+	assert.Contains(t, replies[2]["text"], "Users: 1 active, 0 paused")
+	assert.Equal(t, "Unknown user: bob", replies[3]["text"])
+	assert.Equal(t, float64(42), replies[0]["chat_id"])
+	assert.Equal(t, "HTML", replies[0]["parse_mode"])
+}
+
+func TestTelegramBotConfirmsDangerousCommands(t *testing.T) {
+	bot, api, controller, user := newTestBot(t)
+	ctx := context.Background()
+
+	// /closeall asks for confirmation before doing anything
+	api.push(message(42, "/closeall alice"))
+	require.NoError(t, bot.PollOnce(ctx))
+	question := api.sent("sendMessage")
+	require.Len(t, question, 1)
+	assert.Empty(t, controller.closed)
+
+	buttons := question[0]["reply_markup"].(map[string]interface{})["inline_keyboard"].([]interface{})[0].([]interface{})
+	confirm := buttons[0].(map[string]interface{})["callback_data"].(string)
+
+	// Buttons pressed in another chat are ignored
+	api.push(callback(13, confirm))
+	require.NoError(t, bot.PollOnce(ctx))
+	assert.Empty(t, controller.closed)
+
+	api.push(callback(42, confirm))
+	require.NoError(t, bot.PollOnce(ctx))
+	assert.Equal(t, []uint{user.ID}, controller.closed)
+	assert.Len(t, api.sent("answerCallbackQuery"), 1)
+	edited := api.sent("editMessageText")
+	require.Len(t, edited, 1)
+	assert.Contains(t, edited[0]["text"], "✅ binance: closed")
+	assert.Contains(t, edited[0]["text"], "❌ okx: not connected")
+
+	// Confirmations cannot be replayed
+	api.push(callback(42, confirm))
+	require.NoError(t, bot.PollOnce(ctx))
+	assert.Len(t, controller.closed, 1)
+	assert.Equal(t, "This confirmation has expired.", api.sent("editMessageText")[0]["text"])
+
+	// /pause can be cancelled, /resume needs no confirmation
+	api.push(message(42, "/pause alice"))
+	require.NoError(t, bot.PollOnce(ctx))
+	buttons = api.sent("sendMessage")[0]["reply_markup"].(map[string]interface{})["inline_keyboard"].([]interface{})[0].([]interface{})
+	api.push(callback(42, buttons[1].(map[string]interface{})["callback_data"].(string)))
+	require.NoError(t, bot.PollOnce(ctx))
+	assert.Equal(t, "Cancelled.", api.sent("editMessageText")[0]["text"])
+
+	api.push(message(42, "/pause alice"))
+	require.NoError(t, bot.PollOnce(ctx))
+	buttons = api.sent("sendMessage")[0]["reply_markup"].(map[string]interface{})["inline_keyboard"].([]interface{})[0].([]interface{})
+	api.push(callback(42, buttons[0].(map[string]interface{})["callback_data"].(string)))
+	require.NoError(t, bot.PollOnce(ctx))
+
+	var stored models.User
+	require.NoError(t, bot.db.First(&stored, user.ID).Error)
+	assert.False(t, stored.IsActive)
+
+	api.push(message(42, "/resume alice"))
+	require.NoError(t, bot.PollOnce(ctx))
+	require.NoError(t, bot.db.First(&stored, user.ID).Error)
+	assert.True(t, stored.IsActive)
+}
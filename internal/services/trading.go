@@ -3,13 +3,14 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Cyvadra/tv-forward/broker"
-	"github.com/Cyvadra/tv-forward/broker/binance"
 	"github.com/Cyvadra/tv-forward/internal/config"
 	"github.com/Cyvadra/tv-forward/internal/database"
 	"github.com/Cyvadra/tv-forward/internal/models"
@@ -18,18 +19,32 @@ import (
 
 // TradingService handles trading operations
 type TradingService struct {
-	db          *gorm.DB
-	config      *config.Config
-	userService *UserService
+	db             *gorm.DB
+	config         *config.Config
+	userService    *UserService
+	orderTracker   *OrderTracker
+	brokerPool     *BrokerPool
+	metrics        *LatencyMetrics
+	forwardService *ForwardService
+	riskEngine     *RiskEngine
+	killSwitch     *KillSwitchService
+	ledger         *LedgerService
+	strategies     *StrategyService
+	pipeline       *Pipeline
+	clock          func() time.Time
 }
 
 // NewTradingService creates a new trading service
 func NewTradingService() *TradingService {
-	return &TradingService{
+	s := &TradingService{
 		db:          database.GetDB(),
 		config:      nil, // Will be set later
 		userService: NewUserService(),
+		brokerPool:  NewBrokerPool(),
+		metrics:     NewLatencyMetrics(),
 	}
+	s.pipeline = s.newPipeline()
+	return s
 }
 
 // SetConfig sets the configuration for the trading service
@@ -42,485 +57,927 @@ func (s *TradingService) SetUserService(userService *UserService) {
 	s.userService = userService
 }
 
-// ProcessTradingViewSignal processes a TradingView signal and executes orders
-func (s *TradingService) ProcessTradingViewSignal(signalData *models.TradingViewSignal) error {
-	if s.config == nil || s.userService == nil {
-		return fmt.Errorf("configuration or user service not set")
-	}
+// SetOrderTracker sets the tracker that follows orders which are not filled on submission
+func (s *TradingService) SetOrderTracker(orderTracker *OrderTracker) {
+	s.orderTracker = orderTracker
+}
 
-	// Get or create user by api_sec
-	user, err := s.userService.GetOrCreateUserByAPISec(signalData.APISec)
-	if err != nil {
-		return fmt.Errorf("failed to get user: %w", err)
-	}
+// SetBrokerPool sets the pool broker clients are taken from
+func (s *TradingService) SetBrokerPool(pool *BrokerPool) {
+	s.brokerPool = pool
+}
 
-	// Validate position change
-	if err := s.validatePositionChange(user.ID, signalData); err != nil {
-		return fmt.Errorf("position validation failed: %w", err)
-	}
+// SetForwardService sets the service executed signals are forwarded with
+func (s *TradingService) SetForwardService(forwardService *ForwardService) {
+	s.forwardService = forwardService
+}
 
-	// Create trading signal record
-	rawPayload, _ := json.Marshal(signalData)
-	tradingSignal := &models.TradingSignal{
-		UserID:                 user.ID,
-		SignalID:               signalData.ID,
-		Symbol:                 signalData.Symbol,
-		Exchange:               signalData.ExchangeName,
-		Action:                 signalData.Action,
-		PositionSize:           signalData.PositionSize,
-		Price:                  signalData.Price,
-		MarketPosition:         signalData.MarketPosition,
-		MarketPositionSize:     signalData.MarketPositionSize,
-		PrevMarketPosition:     signalData.PrevMarketPosition,
-		PrevMarketPositionSize: signalData.PrevMarketPositionSize,
-		Leverage:               signalData.Leverage,
-		TradingMode:            signalData.TradingMode,
-		OrderType:              signalData.OrderType,
-		Status:                 "pending",
-		RawPayload:             string(rawPayload),
-		CreatedAt:              time.Now(),
-	}
+// SetRiskEngine sets the risk engine trades are checked with before any order is placed
+func (s *TradingService) SetRiskEngine(riskEngine *RiskEngine) {
+	s.riskEngine = riskEngine
+}
 
-	// Try to execute on the specified exchange
-	var executionError error
-	switch signalData.ExchangeName {
-	case "bitget":
-		executionError = s.executeOnBitget(user.ID, tradingSignal)
-	case "binance":
-		executionError = s.executeOnBinance(user.ID, tradingSignal)
-	case "okx":
-		executionError = s.executeOnOKX(user.ID, tradingSignal)
-	default:
-		executionError = fmt.Errorf("unsupported exchange: %s", signalData.ExchangeName)
-	}
+// SetKillSwitch sets the kill switch that pauses new signals
+func (s *TradingService) SetKillSwitch(killSwitch *KillSwitchService) {
+	s.killSwitch = killSwitch
+}
 
-	if executionError != nil {
-		tradingSignal.Status = "failed"
-		tradingSignal.ErrorMessage = executionError.Error()
-		log.Printf("Trading execution failed for user %s, signal %s: %v",
-			signalData.APISec, signalData.ID, executionError)
-	} else {
-		tradingSignal.Status = "filled"
-		now := time.Now()
-		tradingSignal.ExecutedAt = &now
+// SetLedger sets the trade ledger filled signals are booked in
+func (s *TradingService) SetLedger(ledger *LedgerService) {
+	s.ledger = ledger
+}
+
+// SetStrategyService sets the service signals are linked to their strategy with
+func (s *TradingService) SetStrategyService(strategies *StrategyService) {
+	s.strategies = strategies
+}
+
+// SetClock sets the clock signals are timestamped with instead of the system time, such as the
+// original time of replayed webhooks
+func (s *TradingService) SetClock(clock func() time.Time) {
+	s.clock = clock
+}
+
+// Metrics returns the latency metrics of signal execution
+func (s *TradingService) Metrics() *LatencyMetrics {
+	return s.metrics
+}
+
+// Pipeline returns the execution pipeline signals are processed with
+func (s *TradingService) Pipeline() *Pipeline {
+	return s.pipeline
+}
 
-		// Update position
-		if err := s.updateUserPosition(user.ID, signalData); err != nil {
-			log.Printf("Failed to update position for user %s: %v", signalData.APISec, err)
+// Execute runs a webhook through the execution pipeline. The alert of a rejected webhook is marked
+// failed; the alert of a signal held back by the kill switch is marked queued.
+func (s *TradingService) Execute(ctx context.Context, exec *Execution) error {
+	return s.settle(exec, s.pipeline.Run(ctx, exec))
+}
+
+// Accept stores a webhook and executes it like Execute. Legacy alerts and plain-text messages are
+// only stored: the returned function runs their remaining stages, so that their sender can be
+// answered before they are traded or forwarded. It is nil once the webhook has been executed.
+func (s *TradingService) Accept(ctx context.Context, exec *Execution) (func(), error) {
+	resume, err := s.pipeline.RunThrough(ctx, exec, StageParse)
+	if err != nil {
+		return nil, s.settle(exec, err)
+	}
+	if exec.Signal != nil || exec.Batch != nil {
+		return nil, s.settle(exec, resume(ctx))
+	}
+	return func() {
+		if err := s.settle(exec, resume(ctx)); err != nil {
+			log.Printf("Failed to process alert %d: %v", exec.Alert.ID, err)
 		}
+	}, nil
+}
+
+// settle marks the alert of a webhook the pipeline rejected as failed, or as queued when the
+// kill switch held it back
+func (s *TradingService) settle(exec *Execution, err error) error {
+	if err == nil || exec.Alert == nil || exec.Alert.ID == 0 {
+		return err
 	}
 
-	// Save trading signal
-	if err := s.db.Create(tradingSignal).Error; err != nil {
-		return fmt.Errorf("failed to save trading signal: %w", err)
+	status := "failed"
+	if errors.Is(err, ErrSignalQueued) {
+		status = "queued"
 	}
+	exec.Alert.Status = status
+	if updateErr := s.db.Model(exec.Alert).Update("status", status).Error; updateErr != nil {
+		log.Printf("Failed to update alert status: %v", updateErr)
+	}
+	if status == "queued" {
+		return nil
+	}
+	return err
+}
 
-	return nil
+// newPipeline creates the default execution pipeline
+func (s *TradingService) newPipeline() *Pipeline {
+	return NewPipeline(
+		PipelineStage{Name: StageParse, Run: s.parseStage},
+		PipelineStage{Name: StageValidate, Run: s.validateStage},
+		PipelineStage{Name: StageRisk, Run: s.riskStage},
+		PipelineStage{Name: StageSize, Run: s.sizeStage},
+		PipelineStage{Name: StageRoute, Run: s.routeStage},
+		PipelineStage{Name: StageExecute, Run: s.executeStage, RunBatch: s.executeBatchStage},
+		PipelineStage{Name: StageTrack, Run: s.trackStage},
+		PipelineStage{Name: StageNotify, Run: s.notifyStage},
+	)
 }
 
-// ProcessTradingSignal processes a trading signal and executes orders (legacy method)
-func (s *TradingService) ProcessTradingSignal(alert *models.Alert) error {
-	if s.config == nil {
-		return fmt.Errorf("configuration not set")
+// parseStage decodes the webhook, stores it as an alert and creates the execution record of trades.
+// Bodies carrying an api_sec are TradingView signals, other JSON bodies are legacy alerts and
+// anything else is a plain-text message that is only forwarded. Arrays of signals and "orders"
+// lists turn the webhook into a batch. An alert that is already stored, such as a queued one, is
+// updated instead.
+func (s *TradingService) parseStage(ctx context.Context, exec *Execution) error {
+	if s.db == nil {
+		return fmt.Errorf("database not initialized")
 	}
-
-	// Create trading signal record
-	signal := &models.TradingSignal{
-		AlertID:   alert.ID,
-		Status:    "pending",
-		CreatedAt: time.Now(),
+	if exec.Signal == nil && exec.Parser == "" && isBatchBody(exec.Body) {
+		return s.parseBatch(exec)
 	}
+	stored := exec.Alert
 
-	// Try to execute on different platforms
-	var executionErrors []string
-
-	// Try Bitget
-	if s.config.Trading.Bitget.IsActive {
-		if err := s.executeOnBitgetLegacy(alert, signal); err != nil {
-			executionErrors = append(executionErrors, fmt.Sprintf("Bitget: %v", err))
+	var signalPayload []byte
+	if exec.Signal == nil {
+		var signal models.TradingViewSignal
+		if err := json.Unmarshal(exec.Body, &signal); exec.Parser == "" && err == nil && signal.APISec != "" {
+			exec.Signal = &signal
 		} else {
-			signal.Exchange = "bitget"
-			signal.Status = "filled"
-			now := time.Now()
-			signal.ExecutedAt = &now
+			parsed, err := s.parseSignal(exec)
+			if err != nil {
+				return err
+			}
+			if parsed != nil {
+				// The original body is kept for relays; queued webhooks are replayed from the canonical signal
+				exec.Signal = parsed
+				signalPayload, _ = json.Marshal(parsed)
+			}
 		}
 	}
 
-	// Try Binance
-	if signal.Status == "pending" && s.config.Trading.Binance.IsActive {
-		if err := s.executeOnBinanceLegacy(alert, signal); err != nil {
-			executionErrors = append(executionErrors, fmt.Sprintf("Binance: %v", err))
+	if exec.Signal != nil {
+		if exec.Body == nil {
+			exec.Body, _ = json.Marshal(exec.Signal)
+		}
+		exec.Signal.ReceivedAt = exec.ReceivedAt
+		strategy := exec.Signal.StrategyKey()
+		if strategy == "" {
+			strategy = "trading_signal"
+		}
+		exec.Alert = &models.Alert{
+			Strategy:      strategy,
+			Symbol:        exec.Signal.Symbol,
+			Action:        exec.Signal.Action,
+			Message:       fmt.Sprintf("Trading signal: %s %s %s", exec.Signal.Action, exec.Signal.Symbol, exec.Signal.PositionSize),
+			RawPayload:    string(exec.Body),
+			SignalPayload: string(signalPayload),
+			Status:        "received",
+			CreatedAt:     s.now(),
+		}
+	} else {
+		var alert TradingViewAlert
+		if err := json.Unmarshal(exec.Body, &alert); err == nil {
+			exec.Legacy = &alert
 		} else {
-			signal.Exchange = "binance"
-			signal.Status = "filled"
-			now := time.Now()
-			signal.ExecutedAt = &now
+			// Only the length is logged, as the body may carry credentials
+			log.Printf("Received a %d byte webhook that is not JSON", len(exec.Body))
+			alert = TradingViewAlert{
+				Strategy: "alert",
+				Message:  string(exec.Body),
+				Time:     time.Now().Format(time.RFC3339),
+			}
+		}
+
+		// Keep the original body so it can be forwarded verbatim
+		exec.Alert = &models.Alert{
+			Strategy:   alert.Strategy,
+			Symbol:     alert.Symbol,
+			Action:     alert.Action,
+			Price:      alert.Price,
+			Quantity:   alert.Quantity,
+			Message:    alert.Message,
+			RawPayload: string(exec.Body),
+			Status:     "received",
+			CreatedAt:  s.now(),
 		}
 	}
 
-	// Try OKX
-	if signal.Status == "pending" && s.config.Trading.OKX.IsActive {
-		if err := s.executeOnOKXLegacy(alert, signal); err != nil {
-			executionErrors = append(executionErrors, fmt.Sprintf("OKX: %v", err))
-		} else {
-			signal.Exchange = "okx"
-			signal.Status = "filled"
-			now := time.Now()
-			signal.ExecutedAt = &now
+	if stored != nil && stored.ID != 0 {
+		exec.Alert.ID = stored.ID
+		exec.Alert.CreatedAt = stored.CreatedAt
+		// Replayed alerts run their canonical signal but keep the body they were received with
+		if stored.SignalPayload != "" {
+			exec.Alert.RawPayload = stored.RawPayload
+			exec.Alert.SignalPayload = stored.SignalPayload
 		}
 	}
+	if err := s.db.Save(exec.Alert).Error; err != nil {
+		return fmt.Errorf("failed to save alert: %w", err)
+	}
 
-	// If all platforms failed, mark as failed
-	if signal.Status == "pending" {
-		signal.Status = "failed"
-		log.Printf("All trading platforms failed for alert %d: %v", alert.ID, executionErrors)
+	switch {
+	case exec.Signal != nil:
+		exec.Record = s.newSignalRecord(exec.Alert, exec.Signal)
+	case exec.Legacy != nil:
+		exec.Record = &models.TradingSignal{
+			AlertID:   exec.Alert.ID,
+			Symbol:    exec.Legacy.Symbol,
+			Action:    exec.Legacy.Action,
+			Status:    "pending",
+			CreatedAt: s.now(),
+		}
+	}
+	return nil
+}
+
+// newSignalRecord creates the pending execution record of a TradingView signal
+func (s *TradingService) newSignalRecord(alert *models.Alert, signal *models.TradingViewSignal) *models.TradingSignal {
+	rawPayload, _ := json.Marshal(signal)
+	return &models.TradingSignal{
+		AlertID:                alert.ID,
+		SignalID:               signal.ID,
+		Symbol:                 signal.Symbol,
+		Exchange:               signal.ExchangeName,
+		Action:                 signal.Action,
+		PositionSize:           signal.PositionSize,
+		Price:                  signal.Price,
+		MarketPosition:         signal.MarketPosition,
+		MarketPositionSize:     signal.MarketPositionSize,
+		PrevMarketPosition:     signal.PrevMarketPosition,
+		PrevMarketPositionSize: signal.PrevMarketPositionSize,
+		Leverage:               signal.Leverage,
+		TradingMode:            signal.TradingMode,
+		OrderType:              signal.OrderType,
+		Status:                 "pending",
+		RawPayload:             string(rawPayload),
+		CreatedAt:              s.now(),
 	}
+}
 
-	// Save trading signal
-	if err := s.db.Create(signal).Error; err != nil {
-		return fmt.Errorf("failed to save trading signal: %w", err)
+// validateStage links a trade to its strategy, resolves the user of a TradingView signal and checks
+// the previous position it reports
+func (s *TradingService) validateStage(ctx context.Context, exec *Execution) error {
+	if err := s.resolveStrategy(exec); err != nil {
+		return err
+	}
+	if exec.Signal == nil {
+		return nil
+	}
+	if s.config == nil || s.userService == nil {
+		return fmt.Errorf("configuration or user service not set")
 	}
 
-	// Update alert status
-	alertStatus := "processed"
-	if signal.Status == "failed" {
-		alertStatus = "failed"
+	// Get or create user by api_sec
+	user, err := s.userService.GetOrCreateUserByAPISec(exec.Signal.APISec)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
 	}
+	exec.User = user
+	exec.Record.UserID = user.ID
 
-	if err := s.db.Model(alert).Update("status", alertStatus).Error; err != nil {
-		log.Printf("Failed to update alert status: %v", err)
+	if err := s.completePositionSizes(exec); err != nil {
+		return err
 	}
 
+	// Validate position change
+	if err := s.validatePositionChange(user.ID, exec.Record); err != nil {
+		return fmt.Errorf("position validation failed: %w", err)
+	}
 	return nil
 }
 
-// validatePositionChange validates the position change based on prev_market_position_size
-func (s *TradingService) validatePositionChange(userID uint, signal *models.TradingViewSignal) error {
-	// Get current position
-	positions, err := s.userService.GetUserPositions(userID)
-	if err != nil {
-		return fmt.Errorf("failed to get user positions: %w", err)
+// resolveStrategy links a trade to the strategy named by its signal, or by the strategy field of a
+// legacy alert, and scales its sizes with the strategy's size multiplier
+func (s *TradingService) resolveStrategy(exec *Execution) error {
+	if s.strategies == nil || !exec.Trades() {
+		return nil
 	}
 
-	// Find position for this symbol and exchange
-	var currentPosition *models.Position
-	for i := range positions {
-		if positions[i].Symbol == signal.Symbol && positions[i].Exchange == signal.ExchangeName {
-			currentPosition = &positions[i]
-			break
-		}
+	key := ""
+	if exec.Signal != nil {
+		key = exec.Signal.StrategyKey()
+	} else if exec.Legacy != nil {
+		key = exec.Legacy.Strategy
+	}
+	strategy, err := s.strategies.Resolve(key)
+	if err != nil || strategy == nil {
+		return err
 	}
+	exec.Strategy = strategy
+	exec.Record.StrategyID = strategy.ID
 
-	// Parse previous position size from signal
-	prevSize, err := strconv.ParseFloat(signal.PrevMarketPositionSize, 64)
-	if err != nil {
-		return fmt.Errorf("invalid prev_market_position_size: %w", err)
+	multiplier := strategy.SizeMultiplier
+	if multiplier <= 0 || multiplier == 1 {
+		return nil
+	}
+	if exec.Legacy != nil {
+		exec.Legacy.Quantity *= multiplier
+		exec.Alert.Quantity = exec.Legacy.Quantity
+		return nil
 	}
+	exec.Record.PositionSize = multiplySize(exec.Record.PositionSize, multiplier)
+	exec.Record.MarketPositionSize = multiplySize(exec.Record.MarketPositionSize, multiplier)
+	exec.Record.PrevMarketPositionSize = multiplySize(exec.Record.PrevMarketPositionSize, multiplier)
+	return nil
+}
 
-	// Check if previous position size matches current position
-	if currentPosition != nil {
-		currentSize, err := strconv.ParseFloat(currentPosition.Size, 64)
+// riskStage rejects signals of users whose trading is paused and records signals of disabled
+// strategies and signals exceeding the risk limits as failed with the rule that fired
+func (s *TradingService) riskStage(ctx context.Context, exec *Execution) error {
+	if exec.User != nil && !exec.User.IsActive {
+		return fmt.Errorf("trading is paused for user %s", exec.User.Name)
+	}
+	if !exec.Trades() || exec.Failed() {
+		return nil
+	}
+
+	// Legacy alerts are covered by global switches here and by exchange switches when routed
+	if s.killSwitch != nil {
+		var userID uint
+		exchange := ""
+		if exec.User != nil {
+			userID = exec.User.ID
+			exchange = strings.ToLower(exec.Record.Exchange)
+		}
+		killSwitch, err := s.killSwitch.Check(userID, exchange)
 		if err != nil {
-			return fmt.Errorf("invalid current position size: %w", err)
+			return err
 		}
-
-		// Allow small floating point differences
-		if abs(currentSize-prevSize) > 0.0001 {
-			log.Printf("Position size mismatch for user %d, symbol %s: expected %.8f, got %.8f",
-				userID, signal.Symbol, prevSize, currentSize)
-			// Don't fail the trade, just log the warning
+		if killSwitch != nil && killSwitch.Mode == models.KillSwitchModeQueue {
+			return ErrSignalQueued
 		}
-	} else if prevSize != 0 {
-		log.Printf("No current position found for user %d, symbol %s, but prev_size is %.8f",
-			userID, signal.Symbol, prevSize)
+		if killSwitch != nil {
+			message := "trading is halted by the kill switch"
+			if killSwitch.Reason != "" {
+				message += ": " + killSwitch.Reason
+			}
+			exec.Fail(&RiskViolation{RiskRuleKillSwitch, message})
+			return nil
+		}
+	}
+
+	if exec.Strategy != nil && !exec.Strategy.Enabled {
+		exec.Fail(&RiskViolation{RiskRuleStrategyDisabled, fmt.Sprintf("strategy %s is disabled", exec.Strategy.Key)})
+		return nil
+	}
+
+	if s.riskEngine == nil {
+		return nil
 	}
 
+	if err := s.riskEngine.Check(exec); err != nil {
+		var violation *RiskViolation
+		if !errors.As(err, &violation) {
+			return err
+		}
+		log.Printf("Signal of alert %d rejected: %v", exec.Alert.ID, violation)
+		exec.Fail(violation)
+	}
 	return nil
 }
 
-// updateUserPosition updates the user's position after a successful trade
-func (s *TradingService) updateUserPosition(userID uint, signal *models.TradingViewSignal) error {
-	// Parse position size
-	positionSize, err := strconv.ParseFloat(signal.MarketPositionSize, 64)
-	if err != nil {
-		return fmt.Errorf("invalid market_position_size: %w", err)
+// sizeStage calculates the order of a trade and rounds the orders of signals to the exchange filters
+func (s *TradingService) sizeStage(ctx context.Context, exec *Execution) error {
+	if !exec.Trades() || exec.Failed() {
+		return nil
 	}
 
-	// If position size is 0, close the position
-	if positionSize == 0 {
-		return s.userService.ClosePosition(userID, signal.Symbol, signal.ExchangeName)
+	var err error
+	if exec.Signal != nil {
+		exec.Order, err = s.convertSignalToOrderRequest(exec.Record)
+	} else {
+		exec.Order, err = s.convertAlertToOrderRequest(exec.Alert)
+	}
+	if err != nil {
+		exec.Fail(fmt.Errorf("failed to convert signal to order request: %w", err))
+		return nil
+	}
+	if exec.Order == nil {
+		log.Printf("No order needed for signal: %s", exec.Record.Symbol)
+		return nil
 	}
 
-	// Update or create position
-	return s.userService.UpdatePosition(
-		userID,
-		signal.Symbol,
-		signal.ExchangeName,
-		signal.MarketPosition,
-		signal.MarketPositionSize,
-		signal.Price,
-		signal.Price, // Use price as mark price for now
-		"0",          // Unrealized PnL not available in signal
-		signal.Leverage,
-		signal.TradingMode,
-	)
+	// Signals trade on a single exchange, so their order is rounded to its filters before it is
+	// placed or stored as a shadow order
+	if exec.Signal != nil {
+		exchange := strings.ToLower(exec.Record.Exchange)
+		if _, registered := broker.Registry[exchange]; registered {
+			if err := roundOrder(ctx, s.brokerPool, exchange, exec.Order); err != nil {
+				exec.Fail(fmt.Errorf("failed to round order to the %s filters: %w", exchange, err))
+				return nil
+			}
+			applyOrderQuantity(exec.Record, exec.Order.Side, exec.Order.Quantity)
+		}
+	}
+	return nil
 }
 
-// abs returns the absolute value of a float64
-func abs(x float64) float64 {
-	if x < 0 {
-		return -x
+// roundOrder rounds the quantity and price of an order to the filters of its symbol on an exchange.
+// Orders stay unrounded when the filters cannot be requested; the exchange validates them itself.
+func roundOrder(ctx context.Context, pool *BrokerPool, exchange string, req *broker.OrderRequest) error {
+	if pool == nil {
+		return nil
 	}
-	return x
-}
 
-// executeOnBitget executes a trade on Bitget
-func (s *TradingService) executeOnBitget(userID uint, signal *models.TradingSignal) error {
-	// Get user credentials
-	credential, err := s.userService.GetUserCredentials(userID, "bitget")
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	symbol := broker.FormatSymbol(req.Symbol, exchange)
+	info, err := pool.SymbolInfo(ctx, exchange, symbol)
 	if err != nil {
-		return fmt.Errorf("failed to get bitget credentials: %w", err)
+		log.Printf("Failed to get the %s filters of %s, keeping the order unrounded: %v", exchange, symbol, err)
+		return nil
 	}
+	return broker.RoundToFilters(req, info)
+}
 
-	// This is a placeholder implementation
-	// In a real implementation, you would integrate with Bitget's API
-	log.Printf("Executing %s order for %s on Bitget at price %s for user %d",
-		signal.Action, signal.Symbol, signal.Price, userID)
+// applyOrderQuantity moves the target position of a signal to the position an order of a side and
+// quantity reaches from the previous one, so the booked position matches the exchange
+func applyOrderQuantity(signal *models.TradingSignal, side broker.OrderSide, quantity string) {
+	target := parseAmount(signal.PrevMarketPositionSize)
+	if side == broker.OrderSideSell {
+		target -= parseAmount(quantity)
+	} else {
+		target += parseAmount(quantity)
+	}
+	if abs(target-parseAmount(signal.MarketPositionSize)) <= positionEpsilon {
+		return
+	}
 
-	// Simulate order execution
-	signal.OrderID = fmt.Sprintf("bitget_%d_%d", signal.ID, time.Now().Unix())
+	signal.MarketPositionSize = formatNumber(target)
+	signal.MarketPosition = marketPosition(target)
+}
 
-	// TODO: Implement actual Bitget API integration using credential
-	_ = credential
+// routeStage takes ready clients of the registered brokers an order can be placed on. Signals are
+// placed on the user's credential of their exchange; legacy alerts on the active exchanges of the
+// configuration in turn that their risk limits allow.
+func (s *TradingService) routeStage(ctx context.Context, exec *Execution) error {
+	if !exec.Trades() || exec.Failed() || exec.Order == nil {
+		return nil
+	}
 
-	return nil
-}
+	if exec.User != nil {
+		exchange := strings.ToLower(exec.Record.Exchange)
 
-// executeOnBitgetLegacy executes a trade on Bitget (legacy method for alerts)
-func (s *TradingService) executeOnBitgetLegacy(alert *models.Alert, signal *models.TradingSignal) error {
-	// This is a placeholder implementation
-	// In a real implementation, you would integrate with Bitget's API
-	log.Printf("Executing %s order for %s on Bitget at price %.8f",
-		alert.Action, alert.Symbol, alert.Price)
+		// Accounts in shadow mode never reach the exchange, so they need no client
+		if s.userService != nil && s.userService.ShadowMode(exec.User.APISec, exchange) {
+			exec.Record.Exchange = exchange
+			exec.Shadow = true
+			return nil
+		}
 
-	// Simulate order execution
-	signal.OrderID = fmt.Sprintf("bitget_%d_%d", alert.ID, time.Now().Unix())
+		if _, registered := broker.Registry[exchange]; !registered {
+			exec.Fail(fmt.Errorf("unsupported exchange: %s", exec.Record.Exchange))
+			return nil
+		}
 
-	return nil
-}
+		// Take a ready client from the pool
+		connectStart := time.Now()
+		connectCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		client, release, err := s.brokerPool.Get(connectCtx, exec.User.ID, exchange)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to get %s client for user %d: %v", exchange, exec.User.ID, err)
+			exec.Fail(fmt.Errorf("failed to get %s client: %w", exchange, err))
+			return nil
+		}
+		s.metrics.Observe(LatencyBrokerConnect, time.Since(connectStart))
 
-// executeOnBinanceLegacy executes a trade on Binance (legacy method for alerts)
-func (s *TradingService) executeOnBinanceLegacy(alert *models.Alert, signal *models.TradingSignal) error {
-	log.Printf("Starting Binance legacy execution for alert %d", alert.ID)
+		exec.Record.Exchange = exchange
+		exec.Routes = append(exec.Routes, &Route{Exchange: exchange, Client: client, Release: release})
+		return nil
+	}
 
-	if s.config == nil || !s.config.Trading.Binance.IsActive {
-		log.Printf("Binance trading not configured or not active for alert %d", alert.ID)
-		return fmt.Errorf("binance trading is not configured or not active")
+	var routeErrors []error
+	for _, exchange := range []string{"bitget", "binance", "okx"} {
+		credentials := s.configuredCredentials(exchange)
+		if credentials == nil {
+			continue
+		}
+		if s.killSwitch != nil {
+			if killSwitch, err := s.killSwitch.Check(0, exchange); err != nil || killSwitch != nil {
+				routeErrors = append(routeErrors, fmt.Errorf("%s: halted by the kill switch", exchange))
+				continue
+			}
+		}
+
+		connectStart := time.Now()
+		connectCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		client, release, err := s.brokerPool.GetConfigured(connectCtx, exchange, credentials)
+		cancel()
+		if err != nil {
+			routeErrors = append(routeErrors, fmt.Errorf("%s: %w", exchange, err))
+			continue
+		}
+		s.metrics.Observe(LatencyBrokerConnect, time.Since(connectStart))
+
+		if s.riskEngine != nil {
+			if err := s.riskEngine.CheckRoute(ctx, exec, exchange, client); err != nil {
+				release()
+				log.Printf("Alert %d rejected on %s: %v", exec.Alert.ID, exchange, err)
+				routeErrors = append(routeErrors, fmt.Errorf("%s: %w", exchange, err))
+				continue
+			}
+		}
+		exec.Routes = append(exec.Routes, &Route{Exchange: exchange, Client: client, Release: release})
 	}
 
-	// Validate credentials
-	if s.config.Trading.Binance.APIKey == "" || s.config.Trading.Binance.SecretKey == "" {
-		log.Printf("Binance credentials are empty for alert %d", alert.ID)
-		return fmt.Errorf("binance credentials are not configured")
+	if len(exec.Routes) == 0 {
+		routeErrors = append(routeErrors, fmt.Errorf("no active trading platform"))
+		exec.Fail(errors.Join(routeErrors...))
 	}
+	return nil
+}
 
-	// Create Binance client using config credentials
-	client := binance.NewClient()
-	brokerCreds := &broker.Credentials{
-		APIKey:    s.config.Trading.Binance.APIKey,
-		SecretKey: s.config.Trading.Binance.SecretKey,
+// executeStage places the order on the routed brokers in turn until one accepts it. In shadow mode
+// the order is prepared for the exchange exactly as it would be placed, but only logged.
+func (s *TradingService) executeStage(ctx context.Context, exec *Execution) error {
+	if !exec.Trades() || exec.Failed() || exec.Order == nil {
+		return nil
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	if err := client.Initialize(ctx, brokerCreds); err != nil {
-		log.Printf("Failed to initialize Binance client for alert %d: %v", alert.ID, err)
-		return fmt.Errorf("failed to initialize binance client: %w", err)
+	if exec.Shadow {
+		req := *exec.Order
+		req.Symbol = broker.FormatSymbol(req.Symbol, exec.Record.Exchange)
+		log.Printf("Shadow %s order for %s on %s: side=%s, type=%s, quantity=%s, price=%s, reduce_only=%t, alert=%d",
+			exec.Record.Action, req.Symbol, exec.Record.Exchange, req.Side, req.Type, req.Quantity, req.Price, req.ReduceOnly, exec.Alert.ID)
+
+		exec.ShadowOrder = &models.ShadowOrder{
+			UserID:       exec.Record.UserID,
+			StrategyID:   exec.Record.StrategyID,
+			Exchange:     exec.Record.Exchange,
+			Symbol:       req.Symbol,
+			Side:         string(req.Side),
+			Type:         string(req.Type),
+			Quantity:     req.Quantity,
+			Price:        req.Price,
+			PositionSide: string(req.PositionSide),
+			TimeInForce:  req.TimeInForce,
+			ReduceOnly:   req.ReduceOnly,
+			CreatedAt:    exec.Record.CreatedAt,
+		}
+		return nil
 	}
-	defer func() {
-		if closeErr := client.Close(); closeErr != nil {
-			log.Printf("Warning: Failed to close Binance client: %v", closeErr)
+
+	var executionErrors []error
+	for _, route := range exec.Routes {
+		req := *exec.Order
+		req.Symbol = broker.FormatSymbol(req.Symbol, route.Exchange)
+
+		order, err := s.placeOrder(ctx, route, &req, exec)
+		if err != nil {
+			executionErrors = append(executionErrors, fmt.Errorf("%s: %w", route.Exchange, err))
+			continue
 		}
-	}()
 
-	// Convert alert to order request
-	orderReq, err := s.convertAlertToOrderRequest(alert)
-	if err != nil {
-		log.Printf("Failed to convert alert to order request for alert %d: %v", alert.ID, err)
-		return fmt.Errorf("failed to convert alert to order request: %w", err)
+		exec.Record.Exchange = route.Exchange
+		exec.Result = order
+		return nil
 	}
 
-	log.Printf("Executing %s order for %s on Binance at price %.8f (alert %d)",
-		alert.Action, alert.Symbol, alert.Price, alert.ID)
+	exec.Fail(errors.Join(executionErrors...))
+	return nil
+}
+
+// placeOrder places an order on a broker, retrying once on temporary errors, and records the
+// fill details on the execution record
+func (s *TradingService) placeOrder(ctx context.Context, route *Route, req *broker.OrderRequest, exec *Execution) (*broker.Order, error) {
+	log.Printf("Executing %s order for %s on %s: side=%s, quantity=%s, price=%s, alert=%d",
+		exec.Record.Action, req.Symbol, route.Exchange, req.Side, req.Quantity, req.Price, exec.Alert.ID)
 
-	// Place order with retry logic
-	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	// Place order with retry logic for temporary errors
+	placeCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	order, err := client.PlaceOrder(ctx, orderReq)
+	placeStart := time.Now()
+	order, err := route.Client.PlaceOrder(placeCtx, req)
 	if err != nil {
-		log.Printf("Binance legacy order failed for alert %d: %v", alert.ID, err)
+		log.Printf("%s order failed for alert %d: %v", route.Exchange, exec.Alert.ID, err)
 
-		// Check if this is a retryable error
-		if broker.IsRetryableError(err) {
-			log.Printf("Retryable error detected, attempting retry for alert %d", alert.ID)
-			// Wait a bit and retry once
-			time.Sleep(1 * time.Second)
+		if !broker.IsRetryableError(err) {
+			return nil, fmt.Errorf("failed to place %s order: %w", route.Exchange, err)
+		}
 
-			ctx2, cancel2 := context.WithTimeout(context.Background(), 30*time.Second)
-			defer cancel2()
+		// Wait a bit and retry once
+		log.Printf("Retryable error detected, attempting retry for alert %d", exec.Alert.ID)
+		time.Sleep(1 * time.Second)
 
-			order, err = client.PlaceOrder(ctx2, orderReq)
-			if err != nil {
-				log.Printf("Binance legacy order retry failed for alert %d: %v", alert.ID, err)
-				return fmt.Errorf("failed to place binance order after retry: %w", err)
-			}
-			log.Printf("Binance legacy order succeeded on retry for alert %d", alert.ID)
-		} else {
-			return fmt.Errorf("failed to place binance order: %w", err)
+		retryCtx, retryCancel := context.WithTimeout(ctx, 30*time.Second)
+		defer retryCancel()
+
+		order, err = route.Client.PlaceOrder(retryCtx, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to place %s order after retry: %w", route.Exchange, err)
 		}
+		log.Printf("%s order succeeded on retry for alert %d", route.Exchange, exec.Alert.ID)
 	}
 
 	// Validate response
 	if order == nil {
-		log.Printf("Warning: Received nil order response from Binance for alert %d", alert.ID)
-		return fmt.Errorf("received nil order response from binance")
+		return nil, fmt.Errorf("received nil order response from %s", route.Exchange)
 	}
 
-	// Store order ID
-	signal.OrderID = order.ID
-	log.Printf("Binance legacy order placed successfully for alert %d: ID=%s, Status=%s, Symbol=%s",
-		alert.ID, order.ID, order.Status, order.Symbol)
+	s.metrics.Observe(LatencyPlaceOrder, time.Since(placeStart))
+	if !exec.ReceivedAt.IsZero() {
+		s.metrics.Observe(LatencyWebhookToOrder, time.Since(exec.ReceivedAt))
+	}
+
+	exec.Record.OrderID = order.ID
+	log.Printf("%s order placed successfully for alert %d: ID=%s, Status=%s, Symbol=%s",
+		route.Exchange, exec.Alert.ID, order.ID, order.Status, order.Symbol)
+
+	// Record fill details for the execution notification
+	order = recordExecution(placeCtx, route.Client, exec.Record, order)
 
 	// Log additional order details for audit trail
-	log.Printf("Binance legacy order details - Alert: %d, OrderID: %s, Symbol: %s, Side: %s, Quantity: %s, Price: %s, Status: %s",
-		alert.ID, order.ID, order.Symbol, order.Side, order.Quantity, order.Price, order.Status)
+	log.Printf("%s order details - Alert: %d, OrderID: %s, Symbol: %s, Side: %s, Quantity: %s, Price: %s, Status: %s",
+		route.Exchange, exec.Alert.ID, order.ID, order.Symbol, order.Side, order.Quantity, order.Price, order.Status)
 
-	return nil
+	return order, nil
 }
 
-// executeOnOKXLegacy executes a trade on OKX (legacy method for alerts)
-func (s *TradingService) executeOnOKXLegacy(alert *models.Alert, signal *models.TradingSignal) error {
-	// This is a placeholder implementation
-	// In a real implementation, you would integrate with OKX's API
-	log.Printf("Executing %s order for %s on OKX at price %.8f",
-		alert.Action, alert.Symbol, alert.Price)
+// trackStage stores the execution record, updates the user's position and the trade ledger once
+// the order filled and follows orders that are still open. Signals of accounts in shadow mode are
+// stored with their shadow order and leave the position and the ledger unchanged.
+func (s *TradingService) trackStage(ctx context.Context, exec *Execution) error {
+	if !exec.Trades() {
+		return nil
+	}
+
+	if exec.Failed() {
+		log.Printf("Trading execution failed for alert %d, signal %s: %s",
+			exec.Alert.ID, exec.Record.SignalID, exec.Record.ErrorMessage)
+	} else if exec.Shadow {
+		exec.Record.Status = "shadow"
+	} else {
+		// Orders that are still open are filled later; signals without a position change at once
+		exec.Record.Status = "filled"
+		if exec.Result != nil {
+			exec.Record.Status = orderSignalStatus(string(exec.Result.Status), exec.Result.ExecutedQuantity)
+		}
+
+		if exec.Record.Status == "filled" {
+			now := s.now()
+			exec.Record.ExecutedAt = &now
+
+			// Legacy alerts do not belong to a user whose position could be updated
+			if exec.User != nil {
+				if err := updateSignalPosition(s.userService, exec.Record); err != nil {
+					log.Printf("Failed to update position for user %d: %v", exec.User.ID, err)
+				}
+			}
+		} else if exec.User != nil && exec.Record.Status == "partially_filled" &&
+			(exec.Result.Status == broker.OrderStatusCanceled || exec.Result.Status == broker.OrderStatusExpired) {
+			// Orders that ended partially filled are not tracked, so the part they filled is booked now
+			if err := updatePartialPosition(s.userService, exec.Record, exec.Result.Side); err != nil {
+				log.Printf("Failed to update position for user %d: %v", exec.User.ID, err)
+			}
+		}
+	}
 
-	// Simulate order execution
-	signal.OrderID = fmt.Sprintf("okx_%d_%d", alert.ID, time.Now().Unix())
+	// Save trading signal
+	if err := s.db.Create(exec.Record).Error; err != nil {
+		return fmt.Errorf("failed to save trading signal: %w", err)
+	}
+	if exec.ShadowOrder != nil {
+		exec.ShadowOrder.TradingSignalID = exec.Record.ID
+		if err := s.db.Create(exec.ShadowOrder).Error; err != nil {
+			return fmt.Errorf("failed to save shadow order: %w", err)
+		}
+	}
+	if exec.User != nil {
+		exec.Record.User = *exec.User
+	}
+	if s.ledger != nil && exec.User != nil && exec.Record.Status == "filled" {
+		if err := s.ledger.Record(exec.Record); err != nil {
+			log.Printf("Failed to book trading signal %d in the ledger: %v", exec.Record.ID, err)
+		}
+	}
 
+	// Follow open orders of users until they are filled, cancelled or rejected
+	order := exec.Result
+	if exec.User != nil && order != nil && s.orderTracker != nil && !exec.Failed() &&
+		(order.Status == broker.OrderStatusNew || order.Status == broker.OrderStatusPartiallyFilled) {
+		if _, err := s.orderTracker.Track(exec.Record, order); err != nil {
+			log.Printf("Failed to track order %s: %v", order.ID, err)
+		}
+	}
 	return nil
 }
 
-// executeOnBinance executes a trade on Binance using the broker system
-func (s *TradingService) executeOnBinance(userID uint, signal *models.TradingSignal) error {
-	log.Printf("Starting Binance execution for user %d, signal %s", userID, signal.SignalID)
-
-	// Get user credentials
-	credential, err := s.userService.GetUserCredentials(userID, "binance")
-	if err != nil {
-		log.Printf("Failed to get Binance credentials for user %d: %v", userID, err)
-		return fmt.Errorf("failed to get binance credentials: %w", err)
+// notifyStage records the outcome on the alert and forwards it downstream.
+// Legacy trading alerts are only executed, not forwarded.
+func (s *TradingService) notifyStage(ctx context.Context, exec *Execution) error {
+	status := "processed"
+	if exec.Legacy != nil && exec.Failed() {
+		status = "failed"
+	}
+	exec.Alert.Status = status
+	if err := s.db.Model(exec.Alert).Update("status", status).Error; err != nil {
+		log.Printf("Failed to update alert status: %v", err)
 	}
 
-	// Create Binance client
-	binanceClient, err := createBinanceClient(credential)
-	if err != nil {
-		log.Printf("Failed to create Binance client for user %d: %v", userID, err)
-		return fmt.Errorf("failed to create binance client: %w", err)
+	if exec.Legacy != nil || s.forwardService == nil {
+		return nil
 	}
-	defer func() {
-		if closeErr := binanceClient.Close(); closeErr != nil {
-			log.Printf("Warning: Failed to close Binance client: %v", closeErr)
-		}
-	}()
 
-	// Convert signal to order request
-	orderReq, err := s.convertSignalToOrderRequest(signal)
-	if err != nil {
-		log.Printf("Failed to convert signal to order request: %v", err)
-		return fmt.Errorf("failed to convert signal to order request: %w", err)
+	notification := &Notification{
+		Alert:      exec.Alert,
+		Signal:     exec.Signal,
+		Execution:  exec.Record,
+		RequestURL: exec.RequestURL,
+	}
+	if exec.User != nil {
+		notification.UserName = exec.User.Name
+	}
+	if err := s.forwardService.ForwardNotification(notification); err != nil {
+		log.Printf("Failed to forward alert %d: %v", exec.Alert.ID, err)
 	}
+	return nil
+}
 
-	if orderReq == nil {
-		log.Printf("No order needed for signal: %s", signal.Symbol)
+// configuredCredentials returns the credentials of an active exchange in the configuration, used for legacy alerts
+func (s *TradingService) configuredCredentials(exchange string) *broker.Credentials {
+	if s.config == nil {
 		return nil
 	}
 
-	log.Printf("Executing %s order for %s on Binance: side=%s, quantity=%s, price=%s, user=%d",
-		signal.Action, signal.Symbol, orderReq.Side, orderReq.Quantity, orderReq.Price, userID)
+	trading := s.config.Trading
+	switch exchange {
+	case "bitget":
+		if trading.Bitget.IsActive {
+			return &broker.Credentials{APIKey: trading.Bitget.APIKey, SecretKey: trading.Bitget.SecretKey, Passphrase: trading.Bitget.Passphrase}
+		}
+	case "binance":
+		if trading.Binance.IsActive {
+			return &broker.Credentials{APIKey: trading.Binance.APIKey, SecretKey: trading.Binance.SecretKey}
+		}
+	case "okx":
+		if trading.OKX.IsActive {
+			return &broker.Credentials{APIKey: trading.OKX.APIKey, SecretKey: trading.OKX.SecretKey, Passphrase: trading.OKX.Passphrase}
+		}
+	}
+	return nil
+}
 
-	// Place order with retry logic for temporary errors
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+// completePositionSizes fills in the position sizes of signals that only carry an order, as third-party
+// formats do, from the known position of the user. Buys and sells move the position by the contracts,
+// scaled with the size multiplier of the strategy. Exits flatten the position unless it is on the other
+// side than the one the signal exits.
+func (s *TradingService) completePositionSizes(exec *Execution) error {
+	record := exec.Record
+	if record.PrevMarketPositionSize != "" && record.MarketPositionSize != "" {
+		return nil
+	}
 
-	order, err := binanceClient.PlaceOrder(ctx, orderReq)
-	if err != nil {
-		log.Printf("Binance order failed for user %d: %v", userID, err)
+	current := parseAmount(record.PrevMarketPositionSize)
+	if previous := exec.previousBatchTarget(); record.PrevMarketPositionSize == "" && previous != "" {
+		current = parseAmount(previous)
+	} else if record.PrevMarketPositionSize == "" {
+		positions, err := s.userService.GetUserPositions(exec.User.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get user positions: %w", err)
+		}
+		for _, position := range positions {
+			if position.Symbol == record.Symbol && position.Exchange == record.Exchange {
+				// Positions are stored as an absolute size and a side
+				current = abs(parseAmount(position.Size))
+				if position.Side == "short" {
+					current = -current
+				}
+				break
+			}
+		}
+	}
 
-		// Check if this is a retryable error
-		if broker.IsRetryableError(err) {
-			log.Printf("Retryable error detected, attempting retry for user %d", userID)
-			// Wait a bit and retry once
-			time.Sleep(1 * time.Second)
+	target := current
+	switch {
+	case record.MarketPositionSize != "":
+		target = parseAmount(record.MarketPositionSize)
+	case record.MarketPosition == "flat":
+		if record.PrevMarketPosition == "" || record.PrevMarketPosition == marketPosition(current) {
+			target = 0
+		}
+	default:
+		contracts, err := orderAmount(exec.Signal.Contracts)
+		if err != nil {
+			return fmt.Errorf("signal carries neither position sizes nor contracts: %w", err)
+		}
+		if exec.Strategy != nil && exec.Strategy.SizeMultiplier > 0 {
+			contracts *= exec.Strategy.SizeMultiplier
+		}
+		switch strings.ToLower(record.Action) {
+		case "buy":
+			target = current + contracts
+		case "sell":
+			target = current - contracts
+		default:
+			return fmt.Errorf("invalid action for an order: %q", record.Action)
+		}
+	}
 
-			ctx2, cancel2 := context.WithTimeout(context.Background(), 30*time.Second)
-			defer cancel2()
+	record.PrevMarketPositionSize = formatNumber(current)
+	record.PrevMarketPosition = marketPosition(current)
+	record.MarketPositionSize = formatNumber(target)
+	record.MarketPosition = marketPosition(target)
+	if record.Action == "" {
+		record.Action = "buy"
+		if target < current {
+			record.Action = "sell"
+		}
+	}
+	return nil
+}
 
-			order, err = binanceClient.PlaceOrder(ctx2, orderReq)
-			if err != nil {
-				log.Printf("Binance order retry failed for user %d: %v", userID, err)
-				return fmt.Errorf("failed to place binance order after retry: %w", err)
-			}
-			log.Printf("Binance order succeeded on retry for user %d", userID)
-		} else {
-			return fmt.Errorf("failed to place binance order: %w", err)
+// validatePositionChange validates the position change based on prev_market_position_size
+func (s *TradingService) validatePositionChange(userID uint, signal *models.TradingSignal) error {
+	// Get current position
+	positions, err := s.userService.GetUserPositions(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user positions: %w", err)
+	}
+
+	// Find position for this symbol and exchange
+	var currentPosition *models.Position
+	for i := range positions {
+		if positions[i].Symbol == signal.Symbol && positions[i].Exchange == signal.Exchange {
+			currentPosition = &positions[i]
+			break
 		}
 	}
 
-	// Store order ID and validate response
-	if order == nil {
-		log.Printf("Warning: Received nil order response from Binance for user %d", userID)
-		return fmt.Errorf("received nil order response from binance")
+	// Parse previous position size from signal
+	prevSize, err := strconv.ParseFloat(signal.PrevMarketPositionSize, 64)
+	if err != nil {
+		return fmt.Errorf("invalid prev_market_position_size: %w", err)
 	}
 
-	signal.OrderID = order.ID
-	log.Printf("Binance order placed successfully for user %d: ID=%s, Status=%s, Symbol=%s",
-		userID, order.ID, order.Status, order.Symbol)
+	// Check if previous position size matches current position
+	if currentPosition != nil {
+		currentSize, err := strconv.ParseFloat(currentPosition.Size, 64)
+		if err != nil {
+			return fmt.Errorf("invalid current position size: %w", err)
+		}
 
-	// Log additional order details for audit trail
-	log.Printf("Binance order details - User: %d, OrderID: %s, Symbol: %s, Side: %s, Quantity: %s, Price: %s, Status: %s",
-		userID, order.ID, order.Symbol, order.Side, order.Quantity, order.Price, order.Status)
+		// Allow small floating point differences
+		if abs(currentSize-prevSize) > 0.0001 {
+			log.Printf("Position size mismatch for user %d, symbol %s: expected %.8f, got %.8f",
+				userID, signal.Symbol, prevSize, currentSize)
+			// Don't fail the trade, just log the warning
+		}
+	} else if prevSize != 0 {
+		log.Printf("No current position found for user %d, symbol %s, but prev_size is %.8f",
+			userID, signal.Symbol, prevSize)
+	}
 
 	return nil
 }
 
-// executeOnOKX executes a trade on OKX
-func (s *TradingService) executeOnOKX(userID uint, signal *models.TradingSignal) error {
-	// Get user credentials
-	credential, err := s.userService.GetUserCredentials(userID, "okx")
+// updateSignalPosition updates the user's position to the target of a filled trading signal
+func updateSignalPosition(userService *UserService, signal *models.TradingSignal) error {
+	// Parse position size
+	positionSize, err := strconv.ParseFloat(signal.MarketPositionSize, 64)
 	if err != nil {
-		return fmt.Errorf("failed to get okx credentials: %w", err)
+		return fmt.Errorf("invalid market_position_size: %w", err)
 	}
 
-	// This is a placeholder implementation
-	// In a real implementation, you would integrate with OKX's API
-	log.Printf("Executing %s order for %s on OKX at price %s for user %d",
-		signal.Action, signal.Symbol, signal.Price, userID)
+	// If position size is 0, close the position
+	if positionSize == 0 {
+		return userService.ClosePosition(signal.UserID, signal.Symbol, signal.Exchange)
+	}
 
-	// Simulate order execution
-	signal.OrderID = fmt.Sprintf("okx_%d_%d", signal.ID, time.Now().Unix())
+	// Prefer the average fill price over the signal price
+	price := signal.Price
+	if signal.AvgPrice != "" {
+		price = signal.AvgPrice
+	}
 
-	// TODO: Implement actual OKX API integration using credential
-	_ = credential
+	// Update or create position
+	return userService.UpdatePosition(
+		signal.UserID,
+		signal.Symbol,
+		signal.Exchange,
+		signal.MarketPosition,
+		signal.MarketPositionSize,
+		price,
+		price, // Use price as mark price for now
+		"0",   // Unrealized PnL not available in signal
+		signal.Leverage,
+		signal.TradingMode,
+	)
+}
 
-	return nil
+// updatePartialPosition updates the position of a signal whose order ended partially filled: the
+// previous position moves by the filled quantity instead of reaching the target
+func updatePartialPosition(userService *UserService, signal *models.TradingSignal, side broker.OrderSide) error {
+	reached := *signal
+	applyOrderQuantity(&reached, side, signal.FilledQuantity)
+	return updateSignalPosition(userService, &reached)
+}
+
+// now returns the time of the clock, the system time by default
+func (s *TradingService) now() time.Time {
+	if s.clock != nil {
+		return s.clock()
+	}
+	return time.Now()
+}
+
+// abs returns the absolute value of a float64
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
 }
 
 // GetTradingSignals retrieves trading signals for an alert
 func (s *TradingService) GetTradingSignals(alertID uint) ([]models.TradingSignal, error) {
 	var signals []models.TradingSignal
-	err := s.db.Where("alert_id = ?", alertID).Find(&signals).Error
+	err := s.db.Where("alert_id = ?", alertID).Order("id").Find(&signals).Error
 	return signals, err
 }
 
@@ -544,32 +1001,62 @@ func (s *TradingService) GetTradingSignalsByStatus(status string, limit int) ([]
 	return signals, err
 }
 
-// Helper functions for Binance integration
-
-// createBinanceClient creates a Binance client using user credentials
-func createBinanceClient(credential *models.UserCredential) (broker.Broker, error) {
-	// Create Binance client
-	client := binance.NewClient()
+// brokerErrorCode returns the code of the broker error wrapped in err, if any.
+// Requests refused for rate limiting are reported as RATE_LIMIT whatever call they failed in.
+func brokerErrorCode(err error) string {
+	if errors.Is(err, broker.ErrRateLimited) {
+		return "RATE_LIMIT"
+	}
 
-	// Initialize with credentials
-	brokerCreds := &broker.Credentials{
-		APIKey:    credential.APIKey,
-		SecretKey: credential.SecretKey,
+	var brokerErr *broker.BrokerError
+	if errors.As(err, &brokerErr) {
+		return brokerErr.Code
 	}
+	return ""
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	if err := client.Initialize(ctx, brokerCreds); err != nil {
-		return nil, fmt.Errorf("failed to initialize binance client: %w", err)
+// recordExecution stores the fill details of a placed order on the trading signal and
+// returns the latest state of the order. Market orders are usually acknowledged before
+// they fill, so the order is queried once more; fees and realized PnL come from the
+// fills if the broker reports them.
+func recordExecution(ctx context.Context, client broker.Broker, signal *models.TradingSignal, order *broker.Order) *broker.Order {
+	if order.Status != broker.OrderStatusFilled {
+		if latest, err := client.GetOrder(ctx, order.Symbol, order.ID); err != nil {
+			log.Printf("Failed to refresh order %s: %v", order.ID, err)
+		} else {
+			order = latest
+		}
 	}
 
-	return client, nil
+	signal.FilledQuantity = order.ExecutedQuantity
+	signal.AvgPrice = order.AvgPrice
+
+	reporter, ok := client.(broker.FillReporter)
+	if !ok || order.Status != broker.OrderStatusFilled {
+		return order
+	}
+	fills, err := reporter.GetOrderFills(ctx, order.Symbol, order.ID)
+	if err != nil {
+		log.Printf("Failed to get fills of order %s: %v", order.ID, err)
+		return order
+	}
+	if len(fills) > 0 {
+		signal.Fee, signal.FeeAsset, signal.RealizedPnL = summarizeFills(fills)
+	}
+	return order
 }
 
+// Helper functions for Binance integration
+
 // convertSignalToOrderRequest converts a trading signal to a broker order request
 func (s *TradingService) convertSignalToOrderRequest(signal *models.TradingSignal) (*broker.OrderRequest, error) {
-	// Parse position sizes
-	prevSize, err := strconv.ParseFloat(signal.PrevMarketPositionSize, 64)
+	return signalOrderRequest(signal)
+}
+
+// signalOrderRequest builds the order request that moves the position of a trading signal from its
+// previous to its target size. It returns nil when the position does not change.
+func signalOrderRequest(signal *models.TradingSignal) (*broker.OrderRequest, error) {
+	currentSize, err := strconv.ParseFloat(signal.PrevMarketPositionSize, 64)
 	if err != nil {
 		return nil, fmt.Errorf("invalid prev_market_position_size: %w", err)
 	}
@@ -580,10 +1067,10 @@ func (s *TradingService) convertSignalToOrderRequest(signal *models.TradingSigna
 	}
 
 	// Calculate order quantity and side
-	quantity, side, err := broker.CalculateOrderQuantity(prevSize, targetSize)
+	quantity, side, err := broker.CalculateOrderQuantity(currentSize, targetSize)
 	if err != nil {
 		if err.Error() == "no position change required" {
-			return nil, nil // No order needed
+			return nil, nil
 		}
 		return nil, err
 	}
@@ -599,21 +1086,15 @@ func (s *TradingService) convertSignalToOrderRequest(signal *models.TradingSigna
 	}
 
 	// Determine order type
-	var orderType broker.OrderType
+	orderType := broker.OrderTypeMarket
 	var price string
 	if signal.OrderType == "limit" && signal.Price != "" {
 		orderType = broker.OrderTypeLimit
 		price = signal.Price
-	} else {
-		orderType = broker.OrderTypeMarket
 	}
 
-	// Format symbol for Binance
-	symbol := broker.FormatSymbol(signal.Symbol, "binance")
-
-	// Create order request
 	orderReq := &broker.OrderRequest{
-		Symbol:       symbol,
+		Symbol:       broker.FormatSymbol(signal.Symbol, strings.ToLower(signal.Exchange)),
 		Side:         side,
 		Type:         orderType,
 		Quantity:     broker.FormatQuantity(quantity, 8),
@@ -623,7 +1104,7 @@ func (s *TradingService) convertSignalToOrderRequest(signal *models.TradingSigna
 	}
 
 	// Set reduce only for closing positions
-	if (prevSize > 0 && targetSize < prevSize) || (prevSize < 0 && targetSize > prevSize) {
+	if (currentSize > 0 && targetSize < currentSize) || (currentSize < 0 && targetSize > currentSize) {
 		orderReq.ReduceOnly = true
 	}
 
@@ -713,22 +1194,16 @@ func (s *TradingService) trackBinanceOrderStatus(ctx context.Context, client bro
 
 // getBinanceOrderStatus retrieves the current status of a Binance order
 func (s *TradingService) getBinanceOrderStatus(userID uint, symbol, orderID string) (*broker.Order, error) {
-	// Get user credentials
-	credential, err := s.userService.GetUserCredentials(userID, "binance")
-	if err != nil {
-		return nil, fmt.Errorf("failed to get binance credentials: %w", err)
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	// Create Binance client
-	client, err := createBinanceClient(credential)
+	client, release, err := s.brokerPool.Get(ctx, userID, "binance")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create binance client: %w", err)
+		return nil, fmt.Errorf("failed to get binance client: %w", err)
 	}
-	defer client.Close()
+	defer release()
 
 	// Get order status
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
 
 	order, err := client.GetOrder(ctx, symbol, orderID)
 	if err != nil {
@@ -85,6 +85,38 @@ func (s *UserService) GetOrCreateUserByAPISec(apiSec string) (*models.User, erro
 	return &user, nil
 }
 
+// GetUserName returns the name of the user with the given api_sec without creating it
+func (s *UserService) GetUserName(apiSec string) string {
+	if s.userConfig != nil {
+		if userConfig := s.userConfig.GetUserByAPISec(apiSec); userConfig != nil {
+			return userConfig.Name
+		}
+	}
+
+	if s.db != nil {
+		var user models.User
+		if err := s.db.Where("api_sec = ?", apiSec).First(&user).Error; err == nil {
+			return user.Name
+		}
+	}
+
+	return ""
+}
+
+// GetUserConfig returns the users.yaml entry of a user, nil when the user is not configured
+func (s *UserService) GetUserConfig(apiSec string) *config.UserConfigEntry {
+	if s.userConfig == nil {
+		return nil
+	}
+	return s.userConfig.GetUserByAPISec(apiSec)
+}
+
+// ShadowMode reports whether the orders of a user on an exchange are stored instead of placed
+func (s *UserService) ShadowMode(apiSec, exchange string) bool {
+	entry := s.GetUserConfig(apiSec)
+	return entry != nil && entry.ShadowMode(exchange)
+}
+
 // GetUserCredentials returns active credentials for a user and exchange
 func (s *UserService) GetUserCredentials(userID uint, exchange string) (*models.UserCredential, error) {
 	var credential models.UserCredential
@@ -169,3 +201,25 @@ func (s *UserService) GetUserTradingSignals(userID uint, limit int) ([]models.Tr
 	err := query.Find(&signals).Error
 	return signals, err
 }
+
+// FindUser finds a user by name or api_sec
+func (s *UserService) FindUser(identifier string) (*models.User, error) {
+	var user models.User
+	err := s.db.Where("name = ? OR api_sec = ?", identifier, identifier).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUsers returns all users
+func (s *UserService) GetUsers() ([]models.User, error) {
+	var users []models.User
+	err := s.db.Order("id").Find(&users).Error
+	return users, err
+}
+
+// SetUserActive pauses or resumes trading for a user
+func (s *UserService) SetUserActive(userID uint, active bool) error {
+	return s.db.Model(&models.User{}).Where("id = ?", userID).Update("is_active", active).Error
+}
@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/database"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"gorm.io/gorm"
+)
+
+// userStreamSyncInterval is how often new and removed credentials are picked up
+const userStreamSyncInterval = time.Minute
+
+// errUserStreamUnsupported is returned for brokers that cannot stream user data
+var errUserStreamUnsupported = errors.New("user data streams are not supported")
+
+// UserStreamService keeps a user data stream open for every active exchange credential
+// and applies the order, position and balance updates it pushes
+type UserStreamService struct {
+	db          *gorm.DB
+	config      *config.Config
+	userService *UserService
+	tracker     *OrderTracker
+	connect     BrokerConnector
+
+	mu      sync.Mutex
+	streams map[uint]context.CancelFunc // By credential ID
+}
+
+// NewUserStreamService creates a new user data stream service
+func NewUserStreamService(userService *UserService, tracker *OrderTracker) *UserStreamService {
+	return &UserStreamService{
+		db:          database.GetDB(),
+		config:      nil, // Will be set later
+		userService: userService,
+		tracker:     tracker,
+		connect:     tracker.connect,
+		streams:     make(map[uint]context.CancelFunc),
+	}
+}
+
+// SetConfig sets the configuration for the user data stream service
+func (s *UserStreamService) SetConfig(cfg *config.Config) {
+	s.config = cfg
+}
+
+// SetConnector replaces how brokers are connected for streaming, which defaults to the pool of the tracker
+func (s *UserStreamService) SetConnector(connect BrokerConnector) {
+	s.connect = connect
+}
+
+// Start keeps the streams of all active credentials open until the context is cancelled
+func (s *UserStreamService) Start(ctx context.Context) {
+	if s.db == nil || s.config == nil || !s.config.Trading.UserStream.Enabled {
+		return
+	}
+
+	s.Sync(ctx)
+
+	ticker := time.NewTicker(userStreamSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Sync(ctx)
+		}
+	}
+}
+
+// Sync opens streams for new credentials and stops the streams of removed ones
+func (s *UserStreamService) Sync(ctx context.Context) {
+	var credentials []models.UserCredential
+	if err := s.db.Where("is_active = ?", true).Find(&credentials).Error; err != nil {
+		log.Printf("Failed to query credentials for user data streams: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := make(map[uint]bool)
+	for _, credential := range credentials {
+		if _, registered := broker.Registry[credential.Exchange]; !registered {
+			continue
+		}
+
+		active[credential.ID] = true
+		if _, running := s.streams[credential.ID]; running {
+			continue
+		}
+
+		streamCtx, cancel := context.WithCancel(ctx)
+		s.streams[credential.ID] = cancel
+		go s.run(streamCtx, credential)
+	}
+
+	for id, cancel := range s.streams {
+		if !active[id] {
+			cancel()
+			delete(s.streams, id)
+		}
+	}
+}
+
+// run streams a credential, reconnecting with exponential backoff until the context is cancelled
+func (s *UserStreamService) run(ctx context.Context, credential models.UserCredential) {
+	delay := s.reconnectDelay()
+
+	for {
+		started := time.Now()
+		err := s.stream(ctx, credential)
+		if ctx.Err() != nil {
+			return
+		}
+		// The stream stays stopped until the credential is removed or deactivated and added again
+		if errors.Is(err, errUserStreamUnsupported) {
+			log.Printf("Not streaming user data of user %d on %s: %v", credential.UserID, credential.Exchange, err)
+			return
+		}
+
+		// A stream that stayed up for a while starts over with the shortest delay
+		if time.Since(started) > s.maxReconnectDelay() {
+			delay = s.reconnectDelay()
+		}
+		log.Printf("User data stream of user %d on %s ended: %v; reconnecting in %s",
+			credential.UserID, credential.Exchange, err, delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > s.maxReconnectDelay() {
+			delay = s.maxReconnectDelay()
+		}
+	}
+}
+
+// stream connects a credential and handles its updates until the stream ends
+func (s *UserStreamService) stream(ctx context.Context, credential models.UserCredential) error {
+	client, release, err := s.connect(ctx, credential.UserID, credential.Exchange)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	streamer, ok := client.(broker.UserDataStreamer)
+	if !ok {
+		return fmt.Errorf("%s: %w", credential.Exchange, errUserStreamUnsupported)
+	}
+
+	log.Printf("Opened user data stream of user %d on %s", credential.UserID, credential.Exchange)
+	return streamer.StreamUserData(ctx, func(event broker.UserDataEvent) {
+		s.HandleEvent(ctx, client, credential.UserID, credential.Exchange, event)
+	})
+}
+
+// HandleEvent applies an update of a user data stream to the local orders, positions and balances
+func (s *UserStreamService) HandleEvent(ctx context.Context, client broker.Broker, userID uint, exchange string, event broker.UserDataEvent) {
+	switch event.Type {
+	case broker.UserDataEventOrderUpdate:
+		if event.Order == nil {
+			return
+		}
+		if err := s.tracker.ApplyUpdate(ctx, client, userID, exchange, event.Order); err != nil {
+			log.Printf("Failed to apply update of order %s on %s: %v", event.Order.ID, exchange, err)
+		}
+
+	case broker.UserDataEventAccountUpdate:
+		for _, balance := range event.Balances {
+			if err := s.updateBalance(userID, exchange, event.Reason, balance); err != nil {
+				log.Printf("Failed to update %s balance of user %d on %s: %v", balance.Asset, userID, exchange, err)
+			}
+		}
+		for _, position := range event.Positions {
+			if err := s.updatePosition(userID, exchange, position); err != nil {
+				log.Printf("Failed to update %s position of user %d on %s: %v", position.Symbol, userID, exchange, err)
+			}
+		}
+	}
+}
+
+// updateBalance stores the latest wallet balance of an asset
+func (s *UserStreamService) updateBalance(userID uint, exchange, reason string, update broker.Balance) error {
+	var balance models.Balance
+	if err := s.db.Where(models.Balance{UserID: userID, Exchange: exchange, Asset: update.Asset}).
+		FirstOrInit(&balance).Error; err != nil {
+		return err
+	}
+
+	balance.WalletBalance = update.WalletBalance
+	balance.CrossWalletBalance = update.CrossWalletBalance
+	balance.UpdateReason = reason
+	return s.db.Save(&balance).Error
+}
+
+// updatePosition stores the position reported by the exchange, keeping the leverage known locally
+func (s *UserStreamService) updatePosition(userID uint, exchange string, update broker.Position) error {
+	size, err := strconv.ParseFloat(update.Size, 64)
+	if err != nil {
+		return fmt.Errorf("invalid position size %q: %w", update.Size, err)
+	}
+
+	side := "long"
+	if size < 0 || update.PositionSide == broker.PositionSideShort {
+		side = "short"
+	}
+
+	var existing models.Position
+	err = s.db.Where("user_id = ? AND symbol = ? AND exchange = ? AND is_active = ?",
+		userID, update.Symbol, exchange, true).First(&existing).Error
+	found := err == nil
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return fmt.Errorf("failed to query position: %w", err)
+	}
+
+	if size == 0 {
+		// In hedge mode only the side that was closed is reported
+		if found && update.PositionSide != broker.PositionSideBoth && existing.Side != side {
+			return nil
+		}
+		return s.userService.ClosePosition(userID, update.Symbol, exchange)
+	}
+
+	tradingMode := "cross"
+	if update.MarginType == broker.MarginTypeIsolated {
+		tradingMode = "isolated"
+	}
+	markPrice := update.MarkPrice
+	if markPrice == "" {
+		markPrice = existing.MarkPrice
+	}
+
+	return s.userService.UpdatePosition(
+		userID,
+		update.Symbol,
+		exchange,
+		side,
+		formatNumber(abs(size)),
+		update.EntryPrice,
+		markPrice,
+		update.UnrealizedPnL,
+		existing.Leverage,
+		tradingMode,
+	)
+}
+
+// reconnectDelay returns the delay before the first reconnect attempt
+func (s *UserStreamService) reconnectDelay() time.Duration {
+	if s.config != nil && s.config.Trading.UserStream.ReconnectDelay > 0 {
+		return s.config.Trading.UserStream.ReconnectDelay
+	}
+	return time.Second
+}
+
+// maxReconnectDelay returns the longest delay between reconnect attempts
+func (s *UserStreamService) maxReconnectDelay() time.Duration {
+	if s.config != nil && s.config.Trading.UserStream.MaxReconnectDelay > 0 {
+		return s.config.Trading.UserStream.MaxReconnectDelay
+	}
+	return time.Minute
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Cyvadra/tv-forward/broker"
+	"github.com/Cyvadra/tv-forward/internal/config"
+	"github.com/Cyvadra/tv-forward/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// MockStreamBroker is a mock broker that pushes the given events on its user data stream
+type MockStreamBroker struct {
+	MockFillBroker
+	events []broker.UserDataEvent
+	err    error // Returned right away instead of streaming when set
+}
+
+func (m *MockStreamBroker) StreamUserData(ctx context.Context, handler func(event broker.UserDataEvent)) error {
+	if m.err != nil {
+		return m.err
+	}
+	for _, event := range m.events {
+		handler(event)
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// newTestUserStream creates a user data stream service on top of a test order tracker
+func newTestUserStream(t *testing.T, db *gorm.DB, client broker.Broker) (*UserStreamService, *[]uint) {
+	t.Helper()
+
+	tracker, final := newTestTracker(t, db, client, 0)
+	stream := &UserStreamService{
+		db:          db,
+		userService: tracker.userService,
+		tracker:     tracker,
+		connect:     tracker.connect,
+		streams:     make(map[uint]context.CancelFunc),
+	}
+	return stream, final
+}
+
+func TestUserStreamAppliesOrderUpdates(t *testing.T) {
+	db := newTestDB(t)
+	mockBroker := new(MockFillBroker)
+	stream, final := newTestUserStream(t, db, mockBroker)
+	signal := newPendingSignal(t, db)
+
+	_, err := stream.tracker.Track(signal, &broker.Order{
+		ID: "42", Symbol: "BTCUSDT", Type: broker.OrderTypeLimit, ExecutedQuantity: "0", Status: broker.OrderStatusNew,
+	})
+	require.NoError(t, err)
+
+	update := func(status broker.OrderStatus, executed string) broker.UserDataEvent {
+		return broker.UserDataEvent{
+			Type:  broker.UserDataEventOrderUpdate,
+			Order: &broker.Order{ID: "42", Symbol: "BTCUSDT", ExecutedQuantity: executed, AvgPrice: "42000", Status: status},
+		}
+	}
+
+	stream.HandleEvent(context.Background(), mockBroker, signal.UserID, "binance", update(broker.OrderStatusPartiallyFilled, "0.01"))
+
+	var stored models.TradingSignal
+	require.NoError(t, db.First(&stored, signal.ID).Error)
+	assert.Equal(t, "partially_filled", stored.Status)
+	assert.Empty(t, *final)
+
+	mockBroker.On("GetOrderFills", mock.Anything, "BTCUSDT", "42").Return([]broker.Fill{
+		{Commission: "0.336", CommissionAsset: "USDT"},
+	}, nil).Once()
+	stream.HandleEvent(context.Background(), mockBroker, signal.UserID, "binance", update(broker.OrderStatusFilled, "0.02"))
+
+	require.NoError(t, db.First(&stored, signal.ID).Error)
+	assert.Equal(t, "filled", stored.Status)
+	assert.Equal(t, "0.336", stored.Fee)
+	assert.Equal(t, []uint{signal.ID}, *final)
+
+	// Repeated updates of a final order and orders that are not tracked are ignored
+	stream.HandleEvent(context.Background(), mockBroker, signal.UserID, "binance", update(broker.OrderStatusFilled, "0.02"))
+	other := update(broker.OrderStatusFilled, "1")
+	other.Order.ID = "99"
+	stream.HandleEvent(context.Background(), mockBroker, signal.UserID, "binance", other)
+	assert.Equal(t, []uint{signal.ID}, *final)
+
+	// The poller no longer queries the order
+	stream.tracker.PollOnce(context.Background())
+	mockBroker.AssertExpectations(t)
+}
+
+func TestUserStreamAppliesAccountUpdates(t *testing.T) {
+	db := newTestDB(t)
+	stream, _ := newTestUserStream(t, db, new(MockFillBroker))
+	userService := stream.userService
+	require.NoError(t, userService.UpdatePosition(1, "BTCUSDT", "binance", "long", "0.02", "41000", "41000", "0", 10, "cross"))
+
+	stream.HandleEvent(context.Background(), nil, 1, "binance", broker.UserDataEvent{
+		Type:     broker.UserDataEventAccountUpdate,
+		Reason:   "ORDER",
+		Balances: []broker.Balance{{Asset: "USDT", WalletBalance: "1000.5", CrossWalletBalance: "1000.5"}},
+		Positions: []broker.Position{
+			{Symbol: "BTCUSDT", PositionSide: broker.PositionSideBoth, Size: "-0.01", EntryPrice: "42000", UnrealizedPnL: "-1.2"},
+			{Symbol: "ETHUSDT", PositionSide: broker.PositionSideBoth, Size: "0.5", EntryPrice: "2200", MarginType: broker.MarginTypeIsolated},
+		},
+	})
+
+	positions, err := userService.GetUserPositions(1)
+	require.NoError(t, err)
+	require.Len(t, positions, 2)
+	assert.Equal(t, "short", positions[0].Side)
+	assert.Equal(t, "0.01", positions[0].Size)
+	assert.Equal(t, "42000", positions[0].EntryPrice)
+	assert.Equal(t, "41000", positions[0].MarkPrice)
+	assert.Equal(t, 10, positions[0].Leverage)
+	assert.Equal(t, "isolated", positions[1].TradingMode)
+
+	// Balances are updated in place and flat positions are closed
+	stream.HandleEvent(context.Background(), nil, 1, "binance", broker.UserDataEvent{
+		Type:      broker.UserDataEventAccountUpdate,
+		Reason:    "FUNDING_FEE",
+		Balances:  []broker.Balance{{Asset: "USDT", WalletBalance: "999.9", CrossWalletBalance: "999.9"}},
+		Positions: []broker.Position{{Symbol: "BTCUSDT", PositionSide: broker.PositionSideBoth, Size: "0"}},
+	})
+
+	var balances []models.Balance
+	require.NoError(t, db.Find(&balances).Error)
+	require.Len(t, balances, 1)
+	assert.Equal(t, "999.9", balances[0].WalletBalance)
+	assert.Equal(t, "FUNDING_FEE", balances[0].UpdateReason)
+
+	positions, err = userService.GetUserPositions(1)
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	assert.Equal(t, "ETHUSDT", positions[0].Symbol)
+}
+
+func TestUserStreamReconnects(t *testing.T) {
+	db := newTestDB(t)
+	stream, _ := newTestUserStream(t, db, nil)
+	stream.config = &config.Config{
+		Trading: config.TradingConfig{
+			UserStream: config.UserStreamConfig{
+				Enabled:           true,
+				ReconnectDelay:    time.Millisecond,
+				MaxReconnectDelay: 5 * time.Millisecond,
+			},
+		},
+	}
+
+	credential := &models.UserCredential{UserID: 1, Exchange: "binance", APIKey: "key", SecretKey: "secret"}
+	require.NoError(t, db.Create(credential).Error)
+
+	// The first two connections drop, the third one stays open and pushes a balance
+	var mu sync.Mutex
+	attempts := 0
+	stream.SetConnector(func(ctx context.Context, userID uint, exchange string) (broker.Broker, func(), error) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+
+		client := &MockStreamBroker{}
+		client.On("Close").Return(nil)
+		if attempts < 3 {
+			client.err = errors.New("connection reset")
+		} else {
+			client.events = []broker.UserDataEvent{{
+				Type:     broker.UserDataEventAccountUpdate,
+				Balances: []broker.Balance{{Asset: "USDT", WalletBalance: "500"}},
+			}}
+		}
+		return client, func() { client.Close() }, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go stream.Start(ctx)
+
+	require.Eventually(t, func() bool {
+		var count int64
+		db.Model(&models.Balance{}).Where("wallet_balance = ?", "500").Count(&count)
+		return count == 1
+	}, 2*time.Second, 5*time.Millisecond)
+
+	mu.Lock()
+	assert.Equal(t, 3, attempts)
+	mu.Unlock()
+
+	// Removed credentials stop their stream
+	require.NoError(t, db.Delete(credential).Error)
+	stream.Sync(ctx)
+	stream.mu.Lock()
+	assert.Empty(t, stream.streams)
+	stream.mu.Unlock()
+}
+
+func TestUserStreamStopsForBrokersWithoutStreams(t *testing.T) {
+	db := newTestDB(t)
+	stream, _ := newTestUserStream(t, db, nil)
+	stream.config = &config.Config{Trading: config.TradingConfig{UserStream: config.UserStreamConfig{ReconnectDelay: time.Millisecond}}}
+
+	// Credentials of unregistered exchanges are skipped without connecting
+	require.NoError(t, db.Create(&models.UserCredential{UserID: 1, Exchange: "bitget", APIKey: "key", SecretKey: "secret"}).Error)
+	require.NoError(t, db.Create(&models.UserCredential{UserID: 1, Exchange: "binance", APIKey: "key", SecretKey: "secret"}).Error)
+
+	var mu sync.Mutex
+	var connected []string
+	stream.SetConnector(func(ctx context.Context, userID uint, exchange string) (broker.Broker, func(), error) {
+		mu.Lock()
+		defer mu.Unlock()
+		connected = append(connected, exchange)
+		return new(MockBroker), func() {}, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream.Sync(ctx)
+
+	// A pooled client that cannot stream stops the stream instead of reconnecting
+	time.Sleep(20 * time.Millisecond)
+	stream.Sync(ctx)
+	mu.Lock()
+	assert.Equal(t, []string{"binance"}, connected)
+	mu.Unlock()
+}